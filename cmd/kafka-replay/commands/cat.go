@@ -7,9 +7,10 @@ import (
 	"os"
 	"time"
 
+	"github.com/lolocompany/kafka-replay/v2/cmd/kafka-replay/output"
 	"github.com/lolocompany/kafka-replay/v2/cmd/kafka-replay/util"
 	"github.com/lolocompany/kafka-replay/v2/pkg"
-	"github.com/lolocompany/kafka-replay/v2/cmd/kafka-replay/output"
+	"github.com/lolocompany/kafka-replay/v2/pkg/redact"
 	"github.com/urfave/cli/v3"
 )
 
@@ -26,7 +27,7 @@ func CatCommand() *cli.Command {
 		Name:        "cat",
 		Usage:       "Display recorded messages from a message file",
 		Description: "Read and display messages from a binary message file. Uses global --format flag (json, raw).",
-		Flags: append(globalFlags,
+		Flags: append(append(append(globalFlags, util.RedactFlags()...), util.SampleFlags()...),
 			&cli.StringFlag{
 				Name:     "input",
 				Aliases:  []string{"i"},
@@ -39,21 +40,72 @@ func CatCommand() *cli.Command {
 				Usage:   "Filter messages containing the specified literal byte sequence, case-sensitive (string converted to bytes)",
 			},
 			&cli.BoolFlag{
-				Name:    "count",
-				Usage:   "Only output the count of messages to stdout, do not display them",
-				Value:   false,
+				Name:  "count",
+				Usage: "Only output the count of messages to stdout, do not display them",
+				Value: false,
+			},
+			&cli.StringFlag{
+				Name:  "skip",
+				Usage: "Skip the first N messages (after --find and sampling; e.g. 1000 or 1e6)",
+			},
+			&cli.StringFlag{
+				Name:  "limit",
+				Usage: "Output at most N messages",
+			},
+			&cli.IntFlag{
+				Name:  "tail",
+				Usage: "Output only the last N messages",
+			},
+			&cli.BoolFlag{
+				Name:  "redact-dry-run",
+				Usage: "Apply --redact-rules without printing messages and report how many fields each rule hit (table or json)",
+				Value: false,
 			},
 		),
 		Action: func(ctx context.Context, cmd *cli.Command) error {
 			input := cmd.String("input")
 			findStr := cmd.String("find")
 			countOnly := cmd.Bool("count")
+			redactDryRun := cmd.Bool("redact-dry-run")
 
 			var findBytes []byte
 			if findStr != "" {
 				findBytes = []byte(findStr)
 			}
 
+			redactor, err := util.LoadRedactor(cmd)
+			if err != nil {
+				return err
+			}
+			sampler, err := util.LoadSampler(cmd)
+			if err != nil {
+				return err
+			}
+			var skip, limit int64
+			if cmd.IsSet("skip") {
+				if skip, err = util.ParseCount(cmd.String("skip")); err != nil {
+					return fmt.Errorf("--skip: %w", err)
+				}
+			}
+			if cmd.IsSet("limit") {
+				if limit, err = util.ParseCount(cmd.String("limit")); err != nil {
+					return fmt.Errorf("--limit: %w", err)
+				}
+			}
+			tail := cmd.Int("tail")
+			if tail < 0 {
+				return fmt.Errorf("--tail must not be negative")
+			}
+			if tail > 0 && (skip > 0 || limit > 0) {
+				return fmt.Errorf("--tail cannot be used together with --skip or --limit")
+			}
+			if redactDryRun {
+				if redactor == nil {
+					return fmt.Errorf("--redact-dry-run requires --redact-rules")
+				}
+				countOnly = true
+			}
+
 			file, err := os.Open(input)
 			if err != nil {
 				return fmt.Errorf("failed to open input file: %w", err)
@@ -62,6 +114,9 @@ func CatCommand() *cli.Command {
 
 			// For cat, default to json when --format is not set
 			formatStr := util.GetFormat(cmd)
+			if redactDryRun {
+				return catRedactionReport(ctx, file, redactor, formatStr)
+			}
 			if formatStr == "" {
 				formatStr = "json"
 			}
@@ -80,6 +135,11 @@ func CatCommand() *cli.Command {
 				Output:    os.Stdout,
 				FindBytes: findBytes,
 				CountOnly: countOnly,
+				Redactor:  redactor,
+				Sampler:   sampler,
+				Skip:      skip,
+				Limit:     limit,
+				Tail:      tail,
 			})
 			if err != nil {
 				return err
@@ -94,6 +154,37 @@ func CatCommand() *cli.Command {
 	}
 }
 
+// catRedactionReport runs the redactor over every message in file and writes
+// the per-rule hit counts instead of the messages.
+func catRedactionReport(ctx context.Context, file *os.File, redactor *redact.Redactor, formatStr string) error {
+	format, err := output.ParseFormat(formatStr, output.IsTTY(os.Stdout))
+	if err != nil {
+		return err
+	}
+	if format == output.FormatRaw {
+		return fmt.Errorf("--redact-dry-run supports formats: table, json (got %q)", format)
+	}
+	count, err := pkg.Cat(ctx, pkg.CatConfig{
+		Reader:    file,
+		CountOnly: true,
+		Redactor:  redactor,
+	})
+	if err != nil {
+		return err
+	}
+	report := redactor.Report()
+	enc := output.NewEncoder(format, os.Stdout)
+	if format == output.FormatTable {
+		headers := []string{"RULE", "ACTION", "TARGET", "HITS", "MESSAGES"}
+		rows := make([][]string, 0, len(report))
+		for _, s := range report {
+			rows = append(rows, []string{s.Rule, string(s.Action), string(s.Target), fmt.Sprintf("%d", s.Hits), fmt.Sprintf("%d/%d", s.Messages, count)})
+		}
+		return enc.EncodeTable(headers, rows)
+	}
+	return output.EncodeSlice(enc, report)
+}
+
 // catFormatter returns a formatter for the given output format.
 func catFormatter(format output.Format) (func(time.Time, []byte, []byte) []byte, error) {
 	switch format {
@@ -122,4 +213,3 @@ func jsonFormatter(timestamp time.Time, key []byte, data []byte) []byte {
 	}
 	return append(b, '\n')
 }
-
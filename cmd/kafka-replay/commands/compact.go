@@ -0,0 +1,84 @@
+package commands
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"os"
+
+	"github.com/lolocompany/kafka-replay/v2/cmd/kafka-replay/util"
+	"github.com/lolocompany/kafka-replay/v2/pkg"
+	"github.com/urfave/cli/v3"
+)
+
+func CompactCommand() *cli.Command {
+	return &cli.Command{
+		Name:        "compact",
+		Usage:       "Reduce a recording to the latest value per key",
+		Description: "Write the last entry of every key in IN to OUT, like Kafka log compaction. Entries with an empty value are tombstones and delete their key. Keys are scoped to their topic, entries without a key are kept, and survivors keep their timestamps and original order.",
+		ArgsUsage:   "IN OUT",
+		Flags: append(util.GlobalFlags(),
+			&cli.StringFlag{
+				Name:  "max-memory",
+				Usage: "Memory for the key index before it is spilled to disk (e.g. 256MB, 1GB)",
+				Value: "256MB",
+			},
+			&cli.StringFlag{
+				Name:  "temp-dir",
+				Usage: "Directory for spill files (defaults to the system temp directory)",
+			},
+		),
+		Action: func(ctx context.Context, cmd *cli.Command) error {
+			args := cmd.Args().Slice()
+			if len(args) != 2 {
+				return fmt.Errorf("compact requires an input and an output file: compact IN OUT")
+			}
+			input, output := args[0], args[1]
+			maxMemory, err := util.ParseByteSize(cmd.String("max-memory"))
+			if err != nil {
+				return fmt.Errorf("--max-memory: %w", err)
+			}
+			if err := util.CheckOutputPath(output, input); err != nil {
+				return err
+			}
+
+			in, err := os.Open(input)
+			if err != nil {
+				return fmt.Errorf("failed to open input file: %w", err)
+			}
+			defer in.Close()
+			out, err := os.Create(output)
+			if err != nil {
+				return fmt.Errorf("failed to create output file: %w", err)
+			}
+			defer out.Close()
+			w := bufio.NewWriter(out)
+
+			result, err := pkg.Compact(ctx, pkg.CompactConfig{
+				Input:     in,
+				Output:    w,
+				MaxMemory: maxMemory,
+				TempDir:   cmd.String("temp-dir"),
+			})
+			if err == nil {
+				err = w.Flush()
+			}
+			if err != nil {
+				os.Remove(output)
+				return err
+			}
+			if err := out.Close(); err != nil {
+				return err
+			}
+
+			if !util.Quiet(cmd) {
+				fmt.Fprintf(os.Stderr, "Compacted %d entries to %d (%d superseded, %d tombstones, %d without key)\n",
+					result.Read, result.Written, result.Superseded, result.Tombstones, result.Keyless)
+				if result.Spills > 0 {
+					fmt.Fprintf(os.Stderr, "Spilled the key index to disk %d times\n", result.Spills)
+				}
+			}
+			return nil
+		},
+	}
+}
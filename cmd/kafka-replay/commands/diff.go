@@ -0,0 +1,110 @@
+package commands
+
+import (
+	"context"
+	"fmt"
+	"os"
+
+	"github.com/lolocompany/kafka-replay/v2/cmd/kafka-replay/output"
+	"github.com/lolocompany/kafka-replay/v2/cmd/kafka-replay/util"
+	"github.com/lolocompany/kafka-replay/v2/pkg"
+	"github.com/urfave/cli/v3"
+)
+
+func DiffCommand() *cli.Command {
+	return &cli.Command{
+		Name:        "diff",
+		Usage:       "Compare two recordings",
+		Description: "Show what changed between the recordings A and B. Entries are compared by key and value; timestamps are ignored. Changed JSON values are shown field by field. Uses global --format (table or json).",
+		ArgsUsage:   "A B",
+		Flags: append(util.GlobalFlags(),
+			&cli.StringFlag{
+				Name:  "mode",
+				Usage: "How entries are matched: positional (Nth with Nth), keyed (last value per key) or multiset (ignore order)",
+				Value: string(pkg.DiffPositional),
+			},
+			&cli.IntFlag{
+				Name:  "max-changes",
+				Usage: "Number of changes shown in detail (all are counted)",
+				Value: pkg.DefaultDiffMaxChanges,
+			},
+		),
+		Action: func(ctx context.Context, cmd *cli.Command) error {
+			args := cmd.Args().Slice()
+			if len(args) != 2 {
+				return fmt.Errorf("diff requires two input files: diff A B")
+			}
+			format, err := output.ParseFormat(util.GetFormat(cmd), output.IsTTY(os.Stdout))
+			if err != nil {
+				return err
+			}
+			if format == output.FormatRaw {
+				return fmt.Errorf("format 'raw' is only supported by the 'cat' command")
+			}
+
+			a, err := os.Open(args[0])
+			if err != nil {
+				return fmt.Errorf("failed to open input file: %w", err)
+			}
+			defer a.Close()
+			b, err := os.Open(args[1])
+			if err != nil {
+				return fmt.Errorf("failed to open input file: %w", err)
+			}
+			defer b.Close()
+
+			result, err := pkg.Diff(ctx, pkg.DiffConfig{
+				A:          a,
+				B:          b,
+				Mode:       pkg.DiffMode(cmd.String("mode")),
+				MaxChanges: cmd.Int("max-changes"),
+			})
+			if err != nil {
+				return err
+			}
+
+			enc := output.NewEncoder(format, os.Stdout)
+			if format != output.FormatTable {
+				return output.EncodeSlice(enc, []pkg.DiffResult{result})
+			}
+			if err := enc.EncodeTable(
+				[]string{"MODE", "ENTRIES A", "ENTRIES B", "EQUAL", "ADDED", "REMOVED", "CHANGED"},
+				[][]string{{string(result.Mode), fmt.Sprint(result.EntriesA), fmt.Sprint(result.EntriesB),
+					fmt.Sprint(result.Equal), fmt.Sprint(result.Added), fmt.Sprint(result.Removed), fmt.Sprint(result.Changed)}},
+			); err != nil {
+				return err
+			}
+			if len(result.Changes) == 0 {
+				return nil
+			}
+			fmt.Fprintln(os.Stdout)
+			return enc.EncodeTable([]string{"KIND", "POSITION", "KEY", "PATH", "BEFORE", "AFTER"}, diffRows(result))
+		},
+	}
+}
+
+// diffRows renders the detailed changes of a diff, one row per changed field
+func diffRows(result pkg.DiffResult) [][]string {
+	var rows [][]string
+	for _, c := range result.Changes {
+		position := ""
+		if c.Position != nil {
+			position = fmt.Sprint(*c.Position)
+		}
+		kind := c.Kind
+		if c.Count > 1 {
+			kind = fmt.Sprintf("%s x%d", c.Kind, c.Count)
+		}
+		if len(c.Fields) == 0 {
+			rows = append(rows, []string{kind, position, c.Key, "", c.Before, c.After})
+			continue
+		}
+		for _, f := range c.Fields {
+			rows = append(rows, []string{kind, position, c.Key, f.Path, string(f.Before), string(f.After)})
+		}
+	}
+	if result.Truncated {
+		rows = append(rows, []string{"...", "", "", "", "", fmt.Sprintf("(only the first %d changes are shown)", len(result.Changes))})
+	}
+	return rows
+}
@@ -0,0 +1,76 @@
+package commands
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"os"
+
+	"github.com/lolocompany/kafka-replay/v2/cmd/kafka-replay/util"
+	"github.com/lolocompany/kafka-replay/v2/pkg"
+	"github.com/urfave/cli/v3"
+)
+
+func MergeCommand() *cli.Command {
+	return &cli.Command{
+		Name:        "merge",
+		Usage:       "Interleave several recordings by timestamp",
+		Description: "Merge the recordings IN... into OUT in timestamp order. Entries with equal timestamps are written in the order of the inputs, and each entry keeps its topic, partition and offset.",
+		ArgsUsage:   "OUT IN...",
+		Flags: append(util.GlobalFlags(),
+			&cli.IntFlag{
+				Name:  "max-open",
+				Usage: "Maximum number of inputs read at once; more are merged in rounds through intermediate files",
+				Value: pkg.DefaultMergeMaxOpen,
+			},
+			&cli.StringFlag{
+				Name:  "temp-dir",
+				Usage: "Directory for intermediate files (defaults to the system temp directory)",
+			},
+		),
+		Action: func(ctx context.Context, cmd *cli.Command) error {
+			args := cmd.Args().Slice()
+			if len(args) < 2 {
+				return fmt.Errorf("merge requires an output and at least one input file: merge OUT IN...")
+			}
+			output, inputs := args[0], args[1:]
+			if err := util.CheckOutputPath(output, inputs...); err != nil {
+				return err
+			}
+			for _, input := range inputs {
+				if _, err := os.Stat(input); err != nil {
+					return fmt.Errorf("failed to open input file: %w", err)
+				}
+			}
+
+			out, err := os.Create(output)
+			if err != nil {
+				return fmt.Errorf("failed to create output file: %w", err)
+			}
+			defer out.Close()
+			w := bufio.NewWriter(out)
+
+			result, err := pkg.Merge(ctx, pkg.MergeConfig{
+				Inputs:  inputs,
+				Output:  w,
+				MaxOpen: cmd.Int("max-open"),
+				TempDir: cmd.String("temp-dir"),
+			})
+			if err == nil {
+				err = w.Flush()
+			}
+			if err != nil {
+				os.Remove(output)
+				return err
+			}
+			if err := out.Close(); err != nil {
+				return err
+			}
+
+			if !util.Quiet(cmd) {
+				fmt.Fprintf(os.Stderr, "Merged %d entries from %d files into %s\n", result.Entries, len(inputs), output)
+			}
+			return nil
+		},
+	}
+}
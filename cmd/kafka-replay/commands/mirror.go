@@ -5,6 +5,7 @@ import (
 	"fmt"
 	"io"
 	"os"
+	"sync/atomic"
 
 	"github.com/lolocompany/kafka-replay/v2/cmd/kafka-replay/config"
 	"github.com/lolocompany/kafka-replay/v2/cmd/kafka-replay/util"
@@ -18,7 +19,7 @@ func MirrorCommand() *cli.Command {
 		Name:        "mirror",
 		Usage:       "Mirror messages from one Kafka topic to another",
 		Description: "Read messages from a source Kafka topic and write them directly to a destination topic without writing to disk.",
-		Flags: append(util.GlobalFlags(),
+		Flags: append(append(append(util.GlobalFlags(), util.RateLimitFlags()...), util.RetryFlags()...),
 			&cli.StringFlag{
 				Name:     "from-topic",
 				Aliases:  []string{"s"},
@@ -47,6 +48,11 @@ func MirrorCommand() *cli.Command {
 				Usage:   "Consumer group ID for source topic (empty by default, uses direct partition access). Cannot be used together with --from-offset.",
 				Value:   "",
 			},
+			&cli.StringFlag{
+				Name:  "isolation",
+				Usage: "Isolation level for transactional source topics: read_uncommitted (default) or read_committed (skip aborted records and transaction markers; not with --from-group)",
+				Value: "read_uncommitted",
+			},
 			&cli.IntFlag{
 				Name:  "from-partition",
 				Usage: "Source partition to read messages from (only used with direct partition access, not consumer groups)",
@@ -80,6 +86,7 @@ func MirrorCommand() *cli.Command {
 				Usage:   "Target partition to write messages to (default: auto-assign)",
 				Value:   -1,
 			},
+			util.PartitionerFlag(),
 			&cli.BoolFlag{
 				Name:  "preserve-timestamps",
 				Usage: "Preserve original message timestamps",
@@ -128,6 +135,13 @@ func MirrorCommand() *cli.Command {
 			fromPartition := cmd.Int("from-partition")
 			partitionFlag := cmd.Int("to-partition")
 			offsetFlag := cmd.Int64("from-offset")
+			isolation, err := kafka.ParseIsolationLevel(cmd.String("isolation"))
+			if err != nil {
+				return fmt.Errorf("--isolation: %w", err)
+			}
+			if groupID != "" && isolation == kafka.ReadCommitted {
+				return fmt.Errorf("--from-group and --isolation read_committed cannot be used together: the consumer group reader does not drop aborted transactions")
+			}
 			limit := cmd.Int("limit")
 			timeout := cmd.Duration("timeout")
 			findStr := cmd.String("find")
@@ -135,6 +149,21 @@ func MirrorCommand() *cli.Command {
 			createTopic := cmd.Bool("to-create-topic")
 			dryRun := cmd.Bool("dry-run")
 			noAck := cmd.Bool("no-ack")
+			limiter, rateLimit, err := util.LoadLimiter(cmd)
+			if err != nil {
+				return err
+			}
+			linger, rateTolerance, err := util.LoadBatching(cmd)
+			if err != nil {
+				return err
+			}
+			retry, err := util.LoadRetryPolicy(cmd)
+			if err != nil {
+				return err
+			}
+			if cmd.IsSet("dead-letter") && dryRun {
+				return fmt.Errorf("--dead-letter and --dry-run cannot be used together: a dry run writes nothing that could fail")
+			}
 
 			// Validate that --from-group and --from-offset are not used together
 			// offsetFlag >= 0 means an explicit offset was provided (not the default -1)
@@ -168,6 +197,13 @@ func MirrorCommand() *cli.Command {
 			if partitionFlag >= 0 {
 				partition = &partitionFlag
 			}
+			partitioner, err := util.LoadPartitioner(cmd)
+			if err != nil {
+				return err
+			}
+			if cmd.IsSet("partitioner") && partition != nil {
+				return fmt.Errorf("--partitioner and --to-partition cannot be used together: --to-partition sets the partition of every message")
+			}
 
 			quiet := util.Quiet(cmd)
 			if !quiet {
@@ -196,15 +232,31 @@ func MirrorCommand() *cli.Command {
 				if findStr != "" {
 					fmt.Fprintf(os.Stderr, "Find filter: %s\n", findStr)
 				}
+				if limiter != nil {
+					fmt.Fprintf(os.Stderr, "Rate limit: %s\n", rateLimit)
+				}
 				if preserveTimestamps {
 					fmt.Fprintln(os.Stderr, "Preserving original timestamps")
 				}
 				if partition != nil {
 					fmt.Fprintf(os.Stderr, "To partition: %d\n", *partition)
+				} else {
+					fmt.Fprintf(os.Stderr, "Partitioner: %s\n", partitioner)
 				}
 				if noAck {
 					fmt.Fprintln(os.Stderr, "No acknowledgment: enabled (faster but less reliable)")
 				}
+				if isolation == kafka.ReadCommitted {
+					fmt.Fprintln(os.Stderr, "Isolation: read_committed")
+				}
+			}
+
+			deadLetter, err := util.OpenDeadLetter(cmd)
+			if err != nil {
+				return err
+			}
+			if deadLetter != nil {
+				defer deadLetter.Close()
 			}
 
 			// Create consumer for source topic (using from brokers)
@@ -214,9 +266,20 @@ func MirrorCommand() *cli.Command {
 				return err
 			}
 			defer consumer.Close()
+			if err := consumer.SetIsolationLevel(isolation); err != nil {
+				return err
+			}
 
 			// Create producer for target topic (using to brokers)
-			producer := kafka.NewProducer(toBrokers, toTopic, createTopic, noAck)
+			producer := kafka.NewProducerWithOptions(kafka.ProducerOptions{
+				Brokers:                toBrokers,
+				Topic:                  toTopic,
+				AllowAutoTopicCreation: createTopic,
+				NoAck:                  noAck,
+				ExplicitPartitions:     partition != nil,
+				Partitioner:            partitioner,
+				BatchTimeout:           producerBatchTimeout,
+			})
 			defer producer.Close()
 
 			var spinner *util.ProgressSpinner
@@ -236,9 +299,11 @@ func MirrorCommand() *cli.Command {
 				}
 			}
 
-			messageCount, err := pkg.Mirror(ctx, pkg.MirrorConfig{
+			var filtered atomic.Int64
+			mirrorCfg := pkg.MirrorConfig{
 				Consumer:           consumer,
 				Producer:           producer,
+				Topic:              toTopic,
 				Offset:             offset,
 				Limit:              limit,
 				Partition:          partition,
@@ -247,7 +312,16 @@ func MirrorCommand() *cli.Command {
 				FindBytes:          findBytes,
 				PreserveTimestamps: preserveTimestamps,
 				OnBytesProcessed:   onBytesProcessed,
-			})
+				OnFiltered:         func() { filtered.Add(1) },
+				Limiter:            limiter,
+				Linger:             linger,
+				RateTolerance:      rateTolerance,
+				Retry:              retry,
+			}
+			if deadLetter != nil {
+				mirrorCfg.DeadLetter = deadLetter.DeadLetter
+			}
+			messageCount, err := pkg.Mirror(ctx, mirrorCfg)
 
 			if spinner != nil {
 				spinner.Close()
@@ -261,8 +335,21 @@ func MirrorCommand() *cli.Command {
 				if dryRun {
 					fmt.Fprintf(os.Stderr, "Dry run completed: validated %d messages (no messages were sent)\n", messageCount)
 				} else {
+					if deadLetter != nil {
+						messageCount -= deadLetter.Count()
+					}
 					fmt.Fprintf(os.Stderr, "Successfully mirrored %d messages from topic '%s' to topic '%s'\n", messageCount, fromTopic, toTopic)
 				}
+				if findStr != "" {
+					fmt.Fprintf(os.Stderr, "Filtered out %d messages not matching --find\n", filtered.Load())
+				}
+				if isolation == kafka.ReadCommitted {
+					aborted, control := consumer.IsolationStats()
+					fmt.Fprintf(os.Stderr, "Skipped %d aborted records and %d transaction markers\n", aborted, control)
+				}
+				if deadLetter != nil && deadLetter.Count() > 0 {
+					fmt.Fprintf(os.Stderr, "Wrote %d messages that could not be sent to %s\n", deadLetter.Count(), deadLetter.Path)
+				}
 			}
 			return nil
 		},
@@ -3,7 +3,11 @@ package commands
 import (
 	"context"
 	"fmt"
+	"io"
 	"os"
+	"path/filepath"
+	"strings"
+	"time"
 
 	"github.com/lolocompany/kafka-replay/v2/cmd/kafka-replay/util"
 	"github.com/lolocompany/kafka-replay/v2/pkg"
@@ -16,12 +20,20 @@ func RecordCommand() *cli.Command {
 		Name:        "record",
 		Usage:       "Record messages from a Kafka topic",
 		Description: "Record messages from a Kafka topic and save them to a file or output location.",
-		Flags: append(util.GlobalFlags(),
+		Flags: append(append(append(util.GlobalFlags(), util.RedactFlags()...), util.SampleFlags()...),
+			&cli.StringSliceFlag{
+				Name:    "topic",
+				Aliases: []string{"t"},
+				Usage:   "Kafka topic(s) to record messages from: names or glob patterns like orders.* (comma-separated or repeated)",
+			},
 			&cli.StringFlag{
-				Name:     "topic",
-				Aliases:  []string{"t"},
-				Usage:    "Kafka topic to record messages from",
-				Required: true,
+				Name:  "topic-regex",
+				Usage: "Record all topics whose name fully matches this regular expression",
+			},
+			&cli.DurationFlag{
+				Name:  "discover-interval",
+				Usage: "With a topic pattern, re-read cluster metadata at this interval and start recording newly created matching topics and partitions (e.g., 30s). 0 disables re-discovery",
+				Value: 0,
 			},
 			&cli.StringFlag{
 				Name:    "group",
@@ -29,11 +41,31 @@ func RecordCommand() *cli.Command {
 				Usage:   "Consumer group ID (empty by default, uses direct partition access). Cannot be used together with --offset.",
 				Value:   "",
 			},
-			&cli.IntFlag{
+			&cli.StringFlag{
+				Name:  "isolation",
+				Usage: "Isolation level for transactional topics: read_uncommitted (default) or read_committed (skip aborted records and transaction markers; not with --group)",
+				Value: "read_uncommitted",
+			},
+			&cli.StringFlag{
+				Name:  "commit",
+				Usage: "When to commit consumer group offsets: after-write (after each written batch is synced to disk), interval (every --commit-interval), or none. Requires --group",
+				Value: string(pkg.CommitAfterWrite),
+			},
+			&cli.DurationFlag{
+				Name:  "commit-interval",
+				Usage: "Commit interval for --commit=interval",
+				Value: 5 * time.Second,
+			},
+			&cli.StringFlag{
 				Name:    "partition",
 				Aliases: []string{"p"},
-				Usage:   "Kafka partition to record messages from",
-				Value:   0,
+				Usage:   "Kafka partition(s) to record messages from: a partition number, a comma-separated list (e.g. 0,3,5), or \"all\". Cannot be used together with --group.",
+				Value:   "0",
+			},
+			&cli.StringFlag{
+				Name:  "order",
+				Usage: "Order of messages when recording several partitions: arrival (as received) or timestamp (merged by message timestamp)",
+				Value: string(pkg.OrderArrival),
 			},
 			&cli.StringFlag{
 				Name:    "output",
@@ -41,12 +73,28 @@ func RecordCommand() *cli.Command {
 				Usage:   "Output file path for recorded messages",
 				Value:   "messages.log",
 			},
+			&cli.StringFlag{
+				Name:  "output-dir",
+				Usage: "Write one file per topic (<topic>.log) into this directory instead of a single --output file",
+			},
 			&cli.Int64Flag{
 				Name:    "offset",
 				Aliases: []string{"O"},
 				Usage:   "Start reading from a specific offset (-1 to use current position, 0 to start from beginning). Cannot be used together with --group.",
 				Value:   -1,
 			},
+			&cli.StringFlag{
+				Name:  "since",
+				Usage: "Start recording from the first message at or after this time (RFC3339 or relative like -2h). Cannot be used together with --offset or --group.",
+			},
+			&cli.StringFlag{
+				Name:  "until",
+				Usage: "Stop recording at the first message after this time (RFC3339 or relative like -1h)",
+			},
+			&cli.BoolFlag{
+				Name:  "until-end",
+				Usage: "Snapshot mode: capture each partition's high watermark at start and exit once every partition has reached it. Cannot be used together with --group.",
+			},
 			&cli.IntFlag{
 				Name:    "limit",
 				Aliases: []string{"l"},
@@ -66,18 +114,44 @@ func RecordCommand() *cli.Command {
 			},
 		),
 		Action: func(ctx context.Context, cmd *cli.Command) error {
+			topics := cmd.StringSlice("topic")
+			topicRegex := cmd.String("topic-regex")
+			if len(topics) == 0 && topicRegex == "" {
+				return fmt.Errorf("--topic or --topic-regex is required")
+			}
+			selector, err := pkg.NewTopicSelector(topics, topicRegex)
+			if err != nil {
+				return err
+			}
+			// A single exact topic keeps the --partition and --group options
+			multiTopic := selector.IsPattern() || len(selector.Names()) > 1
+
 			brokers, err := util.ResolveBrokers(cmd)
 			if err != nil {
 				return err
 			}
-			topic := cmd.String("topic")
 			groupID := cmd.String("group")
-			partition := cmd.Int("partition")
+			partitionStr := cmd.String("partition")
+			order := pkg.RecordOrder(cmd.String("order"))
 			output := cmd.String("output")
+			outputDir := cmd.String("output-dir")
+			discoverInterval := cmd.Duration("discover-interval")
 			offsetFlag := cmd.Int64("offset")
 			limit := cmd.Int("limit")
 			timeout := cmd.Duration("timeout")
 			findStr := cmd.String("find")
+			sinceStr := cmd.String("since")
+			untilStr := cmd.String("until")
+			untilEnd := cmd.Bool("until-end")
+			isolation, err := kafka.ParseIsolationLevel(cmd.String("isolation"))
+			if err != nil {
+				return fmt.Errorf("--isolation: %w", err)
+			}
+			if groupID != "" && isolation == kafka.ReadCommitted {
+				return fmt.Errorf("--group and --isolation read_committed cannot be used together: the consumer group reader does not drop aborted transactions")
+			}
+			commitPolicy := pkg.CommitPolicy(cmd.String("commit"))
+			commitInterval := cmd.Duration("commit-interval")
 
 			// Validate that --group and --offset are not used together
 			// offsetFlag >= 0 means an explicit offset was provided (not the default -1)
@@ -85,6 +159,84 @@ func RecordCommand() *cli.Command {
 				return fmt.Errorf("--group and --offset cannot be used together: consumer groups manage offsets automatically, while --offset requires direct partition access")
 			}
 
+			// Consumer groups assign partitions themselves
+			if groupID != "" && cmd.IsSet("partition") {
+				return fmt.Errorf("--group and --partition cannot be used together: the consumer group assigns partitions")
+			}
+			if groupID != "" && untilEnd {
+				return fmt.Errorf("--group and --until-end cannot be used together: the consumer group assigns partitions, so there is no fixed set of high watermarks")
+			}
+			switch commitPolicy {
+			case pkg.CommitNone, pkg.CommitAfterWrite, pkg.CommitInterval:
+			default:
+				return fmt.Errorf("--commit must be %s, %s or %s, got %q", pkg.CommitAfterWrite, pkg.CommitInterval, pkg.CommitNone, commitPolicy)
+			}
+			if groupID == "" {
+				if cmd.IsSet("commit") || cmd.IsSet("commit-interval") {
+					return fmt.Errorf("--commit and --commit-interval require --group")
+				}
+				commitPolicy = pkg.CommitNone
+			}
+			if commitPolicy == pkg.CommitInterval && commitInterval <= 0 {
+				return fmt.Errorf("--commit-interval must be positive")
+			}
+			if multiTopic {
+				if groupID != "" {
+					return fmt.Errorf("--group supports a single topic")
+				}
+				if cmd.IsSet("partition") {
+					return fmt.Errorf("--partition supports a single topic; all partitions of every selected topic are recorded")
+				}
+			}
+			if discoverInterval > 0 {
+				if !selector.IsPattern() {
+					return fmt.Errorf("--discover-interval requires a topic pattern (glob or --topic-regex)")
+				}
+				if untilEnd {
+					return fmt.Errorf("--discover-interval and --until-end cannot be used together")
+				}
+			}
+			if outputDir != "" && cmd.IsSet("output") {
+				return fmt.Errorf("--output and --output-dir cannot be used together")
+			}
+			allPartitions, partitions, err := util.ParsePartitions(partitionStr)
+			if err != nil {
+				return fmt.Errorf("--partition: %w", err)
+			}
+			if order != pkg.OrderArrival && order != pkg.OrderTimestamp {
+				return fmt.Errorf("--order must be %s or %s, got %q", pkg.OrderArrival, pkg.OrderTimestamp, order)
+			}
+
+			// Resolve --since/--until relative to a single point in time
+			now := time.Now()
+			var since, until *time.Time
+			if sinceStr != "" {
+				if groupID != "" {
+					return fmt.Errorf("--group and --since cannot be used together: consumer groups manage offsets automatically, while --since requires direct partition access")
+				}
+				if offsetFlag >= 0 {
+					return fmt.Errorf("--offset and --since cannot be used together")
+				}
+				t, err := util.ParseTimeBound(sinceStr, now)
+				if err != nil {
+					return fmt.Errorf("--since: %w", err)
+				}
+				since = &t
+			}
+			if untilStr != "" {
+				if groupID != "" {
+					return fmt.Errorf("--group and --until cannot be used together: the consumer group assigns partitions, so --until cannot be resolved to an end offset per partition")
+				}
+				t, err := util.ParseTimeBound(untilStr, now)
+				if err != nil {
+					return fmt.Errorf("--until: %w", err)
+				}
+				until = &t
+			}
+			if since != nil && until != nil && until.Before(*since) {
+				return fmt.Errorf("--until (%s) is before --since (%s)", until.Format(time.RFC3339), since.Format(time.RFC3339))
+			}
+
 			// Convert find string to byte slice if provided
 			var findBytes []byte
 			if findStr != "" {
@@ -108,18 +260,57 @@ func RecordCommand() *cli.Command {
 
 			quiet := util.Quiet(cmd)
 			if !quiet {
-				fmt.Fprintf(os.Stderr, "Recording messages from topic '%s' on brokers %v\n", topic, brokers)
+				if multiTopic {
+					selection := strings.Join(topics, ",")
+					if topicRegex != "" {
+						selection = strings.TrimPrefix(selection+" regex "+topicRegex, " ")
+					}
+					fmt.Fprintf(os.Stderr, "Recording messages from topics matching %s on brokers %v\n", selection, brokers)
+				} else {
+					fmt.Fprintf(os.Stderr, "Recording messages from topic '%s' on brokers %v\n", selector.Names()[0], brokers)
+				}
 				if groupID != "" {
 					fmt.Fprintf(os.Stderr, "Consumer group: %s\n", groupID)
+					switch commitPolicy {
+					case pkg.CommitInterval:
+						fmt.Fprintf(os.Stderr, "Committing offsets every %v\n", commitInterval)
+					case pkg.CommitAfterWrite:
+						fmt.Fprintln(os.Stderr, "Committing offsets after each write is synced")
+					default:
+						fmt.Fprintln(os.Stderr, "Not committing offsets")
+					}
 				} else {
 					fmt.Fprintln(os.Stderr, "Using direct partition access (no consumer group)")
+					if allPartitions || multiTopic {
+						fmt.Fprintln(os.Stderr, "Partitions: all")
+					} else {
+						fmt.Fprintf(os.Stderr, "Partitions: %v\n", partitions)
+					}
+				}
+				if discoverInterval > 0 {
+					fmt.Fprintf(os.Stderr, "Re-discovering topics every %v\n", discoverInterval)
+				}
+				if outputDir != "" {
+					fmt.Fprintf(os.Stderr, "Output directory: %s\n", outputDir)
+				} else {
+					fmt.Fprintf(os.Stderr, "Output file: %s\n", output)
 				}
-				fmt.Fprintf(os.Stderr, "Output file: %s\n", output)
 				if offset != nil {
 					fmt.Fprintf(os.Stderr, "Starting from offset: %d\n", *offset)
+				} else if since != nil {
+					fmt.Fprintf(os.Stderr, "Starting from time: %s\n", since.Format(time.RFC3339))
 				} else {
 					fmt.Fprintln(os.Stderr, "Starting from current position")
 				}
+				if until != nil {
+					fmt.Fprintf(os.Stderr, "Stopping after time: %s\n", until.Format(time.RFC3339))
+				}
+				if untilEnd {
+					fmt.Fprintln(os.Stderr, "Stopping at the current high watermark of each partition")
+				}
+				if isolation == kafka.ReadCommitted {
+					fmt.Fprintln(os.Stderr, "Isolation: read_committed")
+				}
 				if limit > 0 {
 					fmt.Fprintf(os.Stderr, "Message limit: %d\n", limit)
 				}
@@ -130,29 +321,151 @@ func RecordCommand() *cli.Command {
 					fmt.Fprintf(os.Stderr, "Find filter: %s\n", findStr)
 				}
 			}
-			consumer, err := kafka.NewConsumer(ctx, brokers, topic, partition, groupID)
+			redactor, err := util.LoadRedactor(cmd)
 			if err != nil {
 				return err
 			}
-			defer consumer.Close()
-			fileWriter, err := os.Create(output)
+			sampler, err := util.LoadSampler(cmd)
 			if err != nil {
 				return err
 			}
-			defer fileWriter.Close()
+			if sampler != nil && !sampler.Streaming() && limit > 0 {
+				return fmt.Errorf("--limit and --sample-size cannot be used together: the sample is only known once recording stops")
+			}
+
+			var consumers []*kafka.Consumer
+			defer func() {
+				for _, c := range consumers {
+					c.Close()
+				}
+			}()
+			// Every partition that is being recorded, as "topic/partition"
+			recording := make(map[string]bool)
+			addConsumers := func(tp pkg.TopicPartitions) ([]pkg.RecordConsumer, error) {
+				var added []pkg.RecordConsumer
+				for _, t := range tp.Topics() {
+					for _, partition := range tp[t] {
+						id := fmt.Sprintf("%s/%d", t, partition)
+						if recording[id] {
+							continue
+						}
+						consumer, err := kafka.NewConsumer(ctx, brokers, t, partition, "")
+						if err != nil {
+							return added, fmt.Errorf("topic %s partition %d: %w", t, partition, err)
+						}
+						if err := consumer.SetIsolationLevel(isolation); err != nil {
+							consumer.Close()
+							return added, err
+						}
+						recording[id] = true
+						consumers = append(consumers, consumer)
+						added = append(added, consumer)
+					}
+				}
+				return added, nil
+			}
+
+			switch {
+			case groupID != "":
+				consumers = append(consumers, kafka.NewGroupConsumer(brokers, selector.Names()[0], groupID))
+			case multiTopic:
+				tp, err := pkg.DiscoverTopics(ctx, brokers, selector)
+				if err != nil {
+					return err
+				}
+				if len(tp) == 0 && discoverInterval == 0 {
+					return fmt.Errorf("no topics match the selection")
+				}
+				if !quiet {
+					fmt.Fprintf(os.Stderr, "Recording %d topics: %v\n", len(tp), tp.Topics())
+				}
+				if _, err := addConsumers(tp); err != nil {
+					return err
+				}
+			default:
+				topic := selector.Names()[0]
+				if allPartitions {
+					conn, err := kafka.ConnectToAnyBroker(ctx, brokers)
+					if err != nil {
+						return err
+					}
+					partitions, err = kafka.ReadTopicPartitionIDs(conn, topic)
+					conn.Close()
+					if err != nil {
+						return err
+					}
+					if !quiet {
+						fmt.Fprintf(os.Stderr, "Recording %d partitions: %v\n", len(partitions), partitions)
+					}
+				}
+				if _, err := addConsumers(pkg.TopicPartitions{topic: partitions}); err != nil {
+					return err
+				}
+			}
+
+			var discover func(ctx context.Context) ([]pkg.RecordConsumer, error)
+			if discoverInterval > 0 {
+				discover = func(ctx context.Context) ([]pkg.RecordConsumer, error) {
+					tp, err := pkg.DiscoverTopics(ctx, brokers, selector)
+					if err != nil {
+						return nil, err
+					}
+					added, err := addConsumers(tp)
+					if len(added) > 0 && !quiet {
+						fmt.Fprintf(os.Stderr, "\nDiscovered %d new partitions\n", len(added))
+					}
+					return added, err
+				}
+			}
 
 			var spinner *util.ProgressSpinner
 			if !quiet {
 				spinner = util.NewProgressSpinner("Recording messages")
 			}
-			writer := util.CountingWriter(fileWriter, spinner)
 
-			read, messageCount, err := pkg.Record(ctx, pkg.RecordConfig{
-				Consumer:  consumer,
-				Offset:    offset,
-				Output:    writer,
-				Limit:     limit,
-				FindBytes: findBytes,
+			var writer io.WriteCloser
+			var outputForTopic func(topic string) (io.WriteCloser, error)
+			if outputDir != "" {
+				if err := os.MkdirAll(outputDir, 0o755); err != nil {
+					return err
+				}
+				outputForTopic = func(topic string) (io.WriteCloser, error) {
+					f, err := os.Create(filepath.Join(outputDir, topic+".log"))
+					if err != nil {
+						return nil, err
+					}
+					return util.CountingWriter(f, spinner), nil
+				}
+			} else {
+				fileWriter, err := os.Create(output)
+				if err != nil {
+					return err
+				}
+				defer fileWriter.Close()
+				writer = util.CountingWriter(fileWriter, spinner)
+			}
+
+			initial := make([]pkg.RecordConsumer, len(consumers))
+			for i, c := range consumers {
+				initial[i] = c
+			}
+			result, err := pkg.Record(ctx, pkg.RecordConfig{
+				Consumers:        initial,
+				Offset:           offset,
+				Since:            since,
+				Until:            until,
+				UntilEnd:         untilEnd,
+				Output:           writer,
+				OutputForTopic:   outputForTopic,
+				Discover:         discover,
+				DiscoverInterval: discoverInterval,
+				Limit:            limit,
+				FindBytes:        findBytes,
+				Redactor:         redactor,
+				Order:            order,
+				Sampler:          sampler,
+				Commit:           commitPolicy,
+				CommitEvery:      commitInterval,
 			})
 
 			if err != nil {
@@ -163,7 +476,35 @@ func RecordCommand() *cli.Command {
 				spinner.Close()
 			}
 			if !quiet {
-				fmt.Fprintf(os.Stderr, "Recorded %d messages (%d bytes)\n", messageCount, read)
+				fmt.Fprintf(os.Stderr, "Recorded %d messages (%d bytes)\n", result.Messages, result.Bytes)
+				if findStr != "" {
+					fmt.Fprintf(os.Stderr, "Filtered out %d messages not matching --find\n", result.Filtered)
+				}
+				if sampler != nil {
+					fmt.Fprintf(os.Stderr, "Sampled out %d messages\n", result.SampledOut)
+				}
+				if isolation == kafka.ReadCommitted {
+					fmt.Fprintf(os.Stderr, "Skipped %d aborted records and %d transaction markers\n", result.Aborted, result.Control)
+				}
+				if result.Commits > 0 {
+					fmt.Fprintf(os.Stderr, "Committed offsets %d times\n", result.Commits)
+				}
+				if len(result.Partitions) > 1 || untilEnd {
+					for _, p := range result.Partitions {
+						line := fmt.Sprintf("  partition %d: %d messages", p.Partition, p.Messages)
+						if multiTopic {
+							line = fmt.Sprintf("  %s partition %d: %d messages", p.Topic, p.Partition, p.Messages)
+						}
+						if p.Messages > 0 {
+							line += fmt.Sprintf(" (offsets %d-%d)", p.FirstOffset, p.LastOffset)
+						}
+						if p.HighWatermark >= 0 {
+							line += fmt.Sprintf(", high watermark %d", p.HighWatermark)
+						}
+						fmt.Fprintln(os.Stderr, line)
+					}
+				}
+				util.PrintRedactionReport(os.Stderr, redactor)
 			}
 			return nil
 		},
@@ -2,10 +2,16 @@ package commands
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"io"
+	"io/fs"
 	"os"
+	"strconv"
+	"strings"
+	"time"
 
+	"github.com/lolocompany/kafka-replay/v2/cmd/kafka-replay/config"
 	"github.com/lolocompany/kafka-replay/v2/cmd/kafka-replay/util"
 	"github.com/lolocompany/kafka-replay/v2/pkg"
 	"github.com/lolocompany/kafka-replay/v2/pkg/kafka"
@@ -13,17 +19,28 @@ import (
 	"github.com/urfave/cli/v3"
 )
 
+// defaultCheckpointInterval is how often replay saves its --checkpoint file
+const defaultCheckpointInterval = 5 * time.Second
+
+// producerBatchTimeout is how long a producer waits to fill a batch. Replay
+// and mirror batch messages themselves (see --linger), so it only bounds how
+// late each batch is sent.
+const producerBatchTimeout = 5 * time.Millisecond
+
 func ReplayCommand() *cli.Command {
 	return &cli.Command{
 		Name:        "replay",
 		Usage:       "Replay recorded messages to a Kafka topic",
 		Description: "Replay previously recorded messages from a file back to a Kafka topic.",
-		Flags: append(util.GlobalFlags(),
+		Flags: append(append(append(append(append(util.GlobalFlags(), util.RedactFlags()...), util.SampleFlags()...), util.RateLimitFlags()...), util.RetryFlags()...),
 			&cli.StringFlag{
-				Name:     "topic",
-				Aliases:  []string{"t"},
-				Usage:    "Kafka topic to replay messages to",
-				Required: true,
+				Name:    "topic",
+				Aliases: []string{"t"},
+				Usage:   "Kafka topic to replay messages to (this or --target is required)",
+			},
+			&cli.StringSliceFlag{
+				Name:  "target",
+				Usage: "Destination as PROFILE:TOPIC, using the brokers of a config profile (TOPIC alone uses the global brokers). Repeat to replay to several topics or clusters at once",
 			},
 			&cli.StringFlag{
 				Name:     "input",
@@ -31,10 +48,19 @@ func ReplayCommand() *cli.Command {
 				Usage:    "Input file path containing recorded messages",
 				Required: true,
 			},
-			&cli.IntFlag{
-				Name:  "rate",
-				Usage: "Messages per second to replay (0 for maximum speed)",
-				Value: 0,
+			&cli.StringFlag{
+				Name:  "timing",
+				Usage: "Pacing: rate (the rate limit flags or maximum speed) or original (reproduce the recorded gaps between messages)",
+				Value: string(pkg.TimingRate),
+			},
+			&cli.FloatFlag{
+				Name:  "speed",
+				Usage: "Speed-up factor for --timing original (e.g. 2.0 for twice as fast, 0.5 for half speed)",
+				Value: 1,
+			},
+			&cli.DurationFlag{
+				Name:  "max-idle",
+				Usage: "Longest wait between two messages with --timing original, e.g. 5s (default: no limit)",
 			},
 			&cli.BoolFlag{
 				Name:  "preserve-timestamps",
@@ -52,16 +78,58 @@ func ReplayCommand() *cli.Command {
 				Value: false,
 			},
 			&cli.IntFlag{
+				Name:  "loop-count",
+				Usage: "Replay the input this many times, then stop (implies --loop)",
+			},
+			&cli.StringFlag{
+				Name:  "loop-key-prefix",
+				Usage: "Prepend this to keys on each loop iteration; {iteration} is replaced by the iteration number, from 0 (e.g. 'run{iteration}-')",
+			},
+			&cli.StringFlag{
+				Name:  "loop-key-suffix",
+				Usage: "Append this to keys on each loop iteration; {iteration} is replaced by the iteration number, from 0 (e.g. '-{iteration}')",
+			},
+			&cli.StringFlag{
+				Name:  "loop-header",
+				Usage: "Add a " + pkg.IterationHeader + " header with this value; {iteration} is replaced by the iteration number, from 0 (e.g. '{iteration}')",
+			},
+			&cli.BoolFlag{
+				Name:  "loop-shift-timestamps",
+				Usage: "Shift timestamps by the recording's duration on each loop iteration, so every pass continues where the previous one ended (requires --preserve-timestamps)",
+			},
+			&cli.StringFlag{
 				Name:    "partition",
 				Aliases: []string{"p"},
-				Usage:   "Target partition to write messages to (default: auto-assign)",
-				Value:   -1,
+				Usage:   "Target partition to write messages to, or 'original' for the partition each message was recorded from (default: auto-assign)",
+			},
+			util.PartitionerFlag(),
+			&cli.StringFlag{
+				Name:  "partition-map",
+				Usage: "Remap recorded partitions with --partition original, e.g. 0:3,1:4 (unmapped partitions keep their number)",
 			},
 			&cli.BoolFlag{
 				Name:  "dry-run",
 				Usage: "Validate configuration, messages and connectivity without actually sending to Kafka",
 				Value: false,
 			},
+			&cli.StringFlag{
+				Name:  "checkpoint",
+				Usage: "Save the position of the last written batch to this file, so that an interrupted replay can continue with --resume",
+			},
+			&cli.DurationFlag{
+				Name:  "checkpoint-interval",
+				Usage: "How often to save the --checkpoint file (it is also saved when the replay stops)",
+				Value: defaultCheckpointInterval,
+			},
+			&cli.BoolFlag{
+				Name:  "resume",
+				Usage: "Continue from the --checkpoint file instead of the beginning (starts from the beginning if the file does not exist)",
+			},
+			&cli.IntFlag{
+				Name:  "concurrency",
+				Usage: "Number of shards writing at the same time, each with its own batch; messages are sharded by partition with --partition, otherwise by key hash, so the order per partition or key is kept",
+				Value: 1,
+			},
 			&cli.StringFlag{
 				Name:    "find",
 				Aliases: []string{"f"},
@@ -72,26 +140,138 @@ func ReplayCommand() *cli.Command {
 				Usage: "Don't wait for broker acknowledgment (faster but less reliable - messages may be lost if broker fails immediately)",
 				Value: false,
 			},
+			&cli.BoolFlag{
+				Name:  "idempotent",
+				Usage: "Write with an idempotent producer, so that the broker drops batches it has already written when a write is retried",
+			},
+			&cli.StringFlag{
+				Name:  "transactional-id",
+				Usage: "Write each batch in a Kafka transaction with this transactional id (implies --idempotent); read_committed consumers never see part of a batch. With several --target, the target is appended to the id",
+			},
 		),
 		Action: func(ctx context.Context, cmd *cli.Command) error {
-			brokers, err := util.ResolveBrokers(cmd)
+			targets, err := resolveReplayTargets(cmd)
 			if err != nil {
 				return err
 			}
-			topic := cmd.String("topic")
 			input := cmd.String("input")
-			rate := cmd.Int("rate")
 			preserveTimestamps := cmd.Bool("preserve-timestamps")
 			createTopic := cmd.Bool("create-topic")
-			loop := cmd.Bool("loop")
-			partitionFlag := cmd.Int("partition")
+			loopCount := cmd.Int("loop-count")
+			loop := cmd.Bool("loop") || loopCount > 0
+			partitionFlag := cmd.String("partition")
 			dryRun := cmd.Bool("dry-run")
 			findStr := cmd.String("find")
 			noAck := cmd.Bool("no-ack")
+			transactionalID := cmd.String("transactional-id")
+			idempotent := cmd.Bool("idempotent") || transactionalID != ""
+			timing := pkg.ReplayTiming(cmd.String("timing"))
+			speed := cmd.Float("speed")
+			maxIdle := cmd.Duration("max-idle")
+			limiter, rateLimit, err := util.LoadLimiter(cmd)
+			if err != nil {
+				return err
+			}
+			linger, rateTolerance, err := util.LoadBatching(cmd)
+			if err != nil {
+				return err
+			}
+			retry, err := util.LoadRetryPolicy(cmd)
+			if err != nil {
+				return err
+			}
+			if loopCount < 0 {
+				return fmt.Errorf("--loop-count cannot be negative")
+			}
+			variation := pkg.LoopVariation{
+				KeyPrefix: cmd.String("loop-key-prefix"),
+				KeySuffix: cmd.String("loop-key-suffix"),
+				Header:    cmd.String("loop-header"),
+			}
+			shiftTimestamps := cmd.Bool("loop-shift-timestamps")
+			for _, name := range []string{"loop-key-prefix", "loop-key-suffix", "loop-header", "loop-shift-timestamps"} {
+				if cmd.IsSet(name) && !loop {
+					return fmt.Errorf("--%s requires --loop or --loop-count", name)
+				}
+			}
+			if shiftTimestamps && !preserveTimestamps {
+				return fmt.Errorf("--loop-shift-timestamps requires --preserve-timestamps: otherwise messages are sent with the current time")
+			}
+			concurrency := cmd.Int("concurrency")
+			if concurrency < 1 {
+				return fmt.Errorf("--concurrency must be at least 1")
+			}
+
+			switch timing {
+			case pkg.TimingRate:
+				if cmd.IsSet("speed") || cmd.IsSet("max-idle") {
+					return fmt.Errorf("--speed and --max-idle require --timing original")
+				}
+			case pkg.TimingOriginal:
+				if limiter != nil {
+					return fmt.Errorf("rate limits and --timing original cannot be used together: original timing paces messages by their recorded timestamps")
+				}
+				if speed <= 0 {
+					return fmt.Errorf("--speed must be positive")
+				}
+				if maxIdle < 0 {
+					return fmt.Errorf("--max-idle cannot be negative")
+				}
+			default:
+				return fmt.Errorf("invalid --timing %q (use %s or %s)", timing, pkg.TimingRate, pkg.TimingOriginal)
+			}
 
 			var partition *int
-			if partitionFlag >= 0 {
-				partition = &partitionFlag
+			originalPartitions := false
+			switch partitionFlag {
+			case "":
+			case "original":
+				originalPartitions = true
+			default:
+				p, err := strconv.Atoi(partitionFlag)
+				if err != nil || p < 0 {
+					return fmt.Errorf("invalid --partition %q (use a partition number or 'original')", partitionFlag)
+				}
+				partition = &p
+			}
+			partitioner, err := util.LoadPartitioner(cmd)
+			if err != nil {
+				return err
+			}
+			if cmd.IsSet("partitioner") && (partition != nil || originalPartitions) {
+				return fmt.Errorf("--partitioner and --partition cannot be used together: --partition sets the partition of every message")
+			}
+			var partitionMap pkg.PartitionMap
+			if cmd.IsSet("partition-map") {
+				if !originalPartitions {
+					return fmt.Errorf("--partition-map requires --partition original")
+				}
+				if partitionMap, err = pkg.ParsePartitionMap(cmd.String("partition-map")); err != nil {
+					return fmt.Errorf("--partition-map: %w", err)
+				}
+			}
+
+			checkpointPath := cmd.String("checkpoint")
+			if checkpointPath == "" && cmd.Bool("resume") {
+				return fmt.Errorf("--resume requires --checkpoint")
+			}
+			if checkpointPath != "" && dryRun {
+				return fmt.Errorf("--checkpoint and --dry-run cannot be used together: a dry run writes nothing to resume from")
+			}
+			if cmd.Duration("checkpoint-interval") <= 0 {
+				return fmt.Errorf("--checkpoint-interval must be positive")
+			}
+			if cmd.IsSet("transactional-id") && transactionalID == "" {
+				return fmt.Errorf("--transactional-id cannot be empty")
+			}
+			if idempotent && noAck {
+				return fmt.Errorf("--no-ack cannot be used with --idempotent or --transactional-id: idempotent writes wait for all in-sync replicas")
+			}
+			if idempotent && createTopic {
+				return fmt.Errorf("--create-topic cannot be used with --idempotent or --transactional-id: create the topic first")
+			}
+			if cmd.IsSet("dead-letter") && dryRun {
+				return fmt.Errorf("--dead-letter and --dry-run cannot be used together: a dry run writes nothing that could fail")
 			}
 
 			// Convert find string to byte slice if provided
@@ -105,28 +285,74 @@ func ReplayCommand() *cli.Command {
 				if dryRun {
 					fmt.Fprintln(os.Stderr, "DRY RUN MODE: No messages will be sent to Kafka")
 				}
-				fmt.Fprintf(os.Stderr, "Replaying messages to topic '%s' on brokers %v\n", topic, brokers)
+				for _, t := range targets {
+					fmt.Fprintf(os.Stderr, "Replaying messages to topic '%s' on brokers %v\n", t.topic, t.brokers)
+				}
 				fmt.Fprintf(os.Stderr, "Input file: %s\n", input)
-				if rate > 0 {
-					fmt.Fprintf(os.Stderr, "Rate limit: %d messages/second\n", rate)
+				if timing == pkg.TimingOriginal {
+					fmt.Fprintf(os.Stderr, "Timing: original at %gx speed", speed)
+					if maxIdle > 0 {
+						fmt.Fprintf(os.Stderr, ", waiting at most %s between messages", maxIdle)
+					}
+					fmt.Fprintln(os.Stderr)
+				} else if limiter != nil {
+					fmt.Fprintf(os.Stderr, "Rate limit: %s\n", rateLimit)
 				} else {
 					fmt.Fprintln(os.Stderr, "Rate limit: maximum speed")
 				}
 				if preserveTimestamps {
 					fmt.Fprintln(os.Stderr, "Preserving original timestamps")
 				}
-				if loop {
+				if loopCount > 0 {
+					fmt.Fprintf(os.Stderr, "Looping: %d iterations\n", loopCount)
+				} else if loop {
 					fmt.Fprintln(os.Stderr, "Looping: infinite")
 				}
+				if variation.KeyPrefix != "" || variation.KeySuffix != "" {
+					fmt.Fprintf(os.Stderr, "Loop keys: %s<key>%s\n", variation.KeyPrefix, variation.KeySuffix)
+				}
+				if variation.Header != "" {
+					fmt.Fprintf(os.Stderr, "Loop header: %s=%s\n", pkg.IterationHeader, variation.Header)
+				}
 				if partition != nil {
 					fmt.Fprintf(os.Stderr, "Target partition: %d\n", *partition)
 				}
+				if partition == nil && !originalPartitions {
+					fmt.Fprintf(os.Stderr, "Partitioner: %s\n", partitioner)
+				}
+				if originalPartitions {
+					fmt.Fprintln(os.Stderr, "Target partitions: original")
+					if len(partitionMap) > 0 {
+						fmt.Fprintf(os.Stderr, "Partition map: %s\n", cmd.String("partition-map"))
+					}
+				}
 				if findStr != "" {
 					fmt.Fprintf(os.Stderr, "Find filter: %s\n", findStr)
 				}
 				if noAck {
 					fmt.Fprintln(os.Stderr, "No acknowledgment: enabled (faster but less reliable)")
 				}
+				if transactionalID != "" {
+					fmt.Fprintf(os.Stderr, "Transactions: one per batch, transactional id '%s'\n", transactionalID)
+				} else if idempotent {
+					fmt.Fprintln(os.Stderr, "Idempotent producer: enabled")
+				}
+				if concurrency > 1 {
+					shardBy := "key hash"
+					if partition != nil || originalPartitions {
+						shardBy = "partition"
+					}
+					fmt.Fprintf(os.Stderr, "Concurrency: %d shards by %s\n", concurrency, shardBy)
+				}
+			}
+
+			redactor, err := util.LoadRedactor(cmd)
+			if err != nil {
+				return err
+			}
+			sampler, err := util.LoadSampler(cmd)
+			if err != nil {
+				return err
 			}
 
 			// Open input file
@@ -136,6 +362,46 @@ func ReplayCommand() *cli.Command {
 			}
 			defer file.Close()
 
+			deadLetter, err := util.OpenDeadLetter(cmd, input, checkpointPath)
+			if err != nil {
+				return err
+			}
+			if deadLetter != nil {
+				defer deadLetter.Close()
+			}
+
+			var checkpoints *replayCheckpointer
+			if checkpointPath != "" {
+				if checkpoints, err = newReplayCheckpointer(cmd, file, input, quiet); err != nil {
+					return err
+				}
+			}
+
+			if partition != nil || originalPartitions {
+				recorded, err := recordedPartitions(ctx, file, partition)
+				if err != nil {
+					return err
+				}
+				for _, t := range targets {
+					if err := checkTargetPartitions(ctx, t, recorded, partitionMap, createTopic, quiet); err != nil {
+						return err
+					}
+				}
+			}
+			if shiftTimestamps {
+				span, err := pkg.RecordedSpan(ctx, file)
+				if err != nil {
+					return fmt.Errorf("failed to read input file: %w", err)
+				}
+				if _, err := file.Seek(0, io.SeekStart); err != nil {
+					return err
+				}
+				variation.TimestampShift = span
+				if !quiet {
+					fmt.Fprintf(os.Stderr, "Shifting timestamps by %s per iteration\n", span)
+				}
+			}
+
 			var spinner *util.ProgressSpinner
 			if !quiet {
 				spinner = util.NewProgressSpinner("Replaying messages")
@@ -148,25 +414,92 @@ func ReplayCommand() *cli.Command {
 				return fmt.Errorf("failed to create message decoder: %w", err)
 			}
 
-			// Create Kafka producer
-			producer := kafka.NewProducer(brokers, topic, createTopic, noAck)
-			defer producer.Close()
+			// Create a Kafka producer per target
+			replayTargets := make([]*pkg.ReplayTarget, 0, len(targets))
+			for _, t := range targets {
+				producerOpts := kafka.ProducerOptions{
+					Brokers:                t.brokers,
+					Topic:                  t.topic,
+					AllowAutoTopicCreation: createTopic,
+					NoAck:                  noAck,
+					ExplicitPartitions:     partition != nil || originalPartitions,
+					Partitioner:            partitioner,
+					BatchTimeout:           producerBatchTimeout,
+					Idempotent:             idempotent,
+				}
+				if transactionalID != "" {
+					// A transactional id may only be used by one producer at a time
+					producerOpts.TransactionalID = transactionalID
+					if len(targets) > 1 {
+						producerOpts.TransactionalID = transactionalID + "-" + t.name
+					}
+				}
+				producer := kafka.NewProducerWithOptions(producerOpts)
+				defer producer.Close()
+				replayTargets = append(replayTargets, &pkg.ReplayTarget{Name: t.name, Topic: t.topic, Producer: producer})
+			}
 
 			logWriter := io.Writer(os.Stderr)
 			if quiet {
 				logWriter = io.Discard
 			}
-			messageCount, err := pkg.Replay(ctx, pkg.ReplayConfig{
-				Producer:  producer,
+			var stats pkg.ReplayStats
+			replayCfg := pkg.ReplayConfig{
+				Targets:   replayTargets,
 				Decoder:   decoder,
-				Rate:      rate,
+				Limiter:   limiter,
+				Linger:    linger,
 				Loop:      loop,
+				LoopCount: loopCount,
 				Partition: partition,
 				LogWriter: logWriter,
 				DryRun:    dryRun,
 				FindBytes: findBytes,
-			})
+				Redactor:  redactor,
+				Sampler:   sampler,
+				Timing:    timing,
+				Speed:     speed,
+				MaxIdle:   maxIdle,
 
+				OriginalPartitions: originalPartitions,
+				PartitionMap:       partitionMap,
+				RateTolerance:      rateTolerance,
+				Retry:              retry,
+				Concurrency:        concurrency,
+				Stats:              &stats,
+				Variation:          variation,
+			}
+			if deadLetter != nil {
+				replayCfg.DeadLetter = deadLetter.DeadLetter
+			}
+			if checkpoints != nil {
+				replayCfg.Resume = checkpoints.resume
+				replayCfg.OnCheckpoint = checkpoints.update
+			}
+			messageCount, err := pkg.Replay(ctx, replayCfg)
+			failed := 0
+			for _, t := range replayTargets {
+				if t.Failed > 0 {
+					failed++
+				}
+			}
+			// Dead-lettered messages do not fail the replay
+			targetsFailed := failed > 0 && deadLetter == nil
+			if checkpoints != nil {
+				// Save the final position whether or not the replay succeeded.
+				// After a target failed, it is the last batch every target wrote.
+				if saveErr := checkpoints.finish(err == nil && !targetsFailed && (!loop || loopCount > 0)); saveErr != nil && err == nil {
+					err = saveErr
+				}
+			}
+
+			if len(replayTargets) > 1 && !quiet && !dryRun {
+				if spinner != nil {
+					spinner.Close()
+					spinner = nil
+				}
+				printTargetReport(replayTargets)
+			}
 			if err != nil {
 				return err
 			}
@@ -177,11 +510,250 @@ func ReplayCommand() *cli.Command {
 			if !quiet {
 				if dryRun {
 					fmt.Fprintf(os.Stderr, "Dry run completed: validated %d messages (no messages were sent)\n", messageCount)
+				} else if len(targets) == 1 {
+					// Not counting dead letters
+					fmt.Fprintf(os.Stderr, "Successfully replayed %d messages to topic '%s'\n", replayTargets[0].Sent, targets[0].topic)
 				} else {
-					fmt.Fprintf(os.Stderr, "Successfully replayed %d messages to topic '%s'\n", messageCount, topic)
+					fmt.Fprintf(os.Stderr, "Replayed %d messages to %d targets\n", messageCount, len(targets))
 				}
+				printReplayStats(stats)
+				util.PrintRedactionReport(os.Stderr, redactor)
+				if checkpoints != nil {
+					fmt.Fprintf(os.Stderr, "Checkpoint saved to %s\n", checkpointPath)
+				}
+				if deadLetter != nil && deadLetter.Count() > 0 {
+					fmt.Fprintf(os.Stderr, "Wrote %d messages that could not be sent to %s\n", deadLetter.Count(), deadLetter.Path)
+				}
+			}
+			if targetsFailed {
+				return fmt.Errorf("%d of %d targets failed to write some messages", failed, len(replayTargets))
 			}
 			return nil
 		},
 	}
 }
+
+// replayCheckpointer keeps the --checkpoint file up to date, saving it at
+// most once per --checkpoint-interval
+type replayCheckpointer struct {
+	path     string
+	interval time.Duration
+	resume   *pkg.ReplayPosition // Position to resume from with --resume
+	base     int64               // Messages sent by earlier runs
+	cp       pkg.ReplayCheckpoint
+	saved    time.Time
+	dirty    bool
+	err      error // Most recent save error
+}
+
+// newReplayCheckpointer prepares the checkpoint for input, loading the
+// position to resume from with --resume
+func newReplayCheckpointer(cmd *cli.Command, file *os.File, input string, quiet bool) (*replayCheckpointer, error) {
+	info, err := file.Stat()
+	if err != nil {
+		return nil, fmt.Errorf("failed to stat input file: %w", err)
+	}
+	c := &replayCheckpointer{
+		path:     cmd.String("checkpoint"),
+		interval: cmd.Duration("checkpoint-interval"),
+		cp:       pkg.ReplayCheckpoint{Input: input, InputSize: info.Size()},
+		saved:    time.Now(),
+	}
+	if !cmd.Bool("resume") {
+		return c, nil
+	}
+	prev, err := pkg.LoadReplayCheckpoint(c.path)
+	if errors.Is(err, fs.ErrNotExist) {
+		if !quiet {
+			fmt.Fprintf(os.Stderr, "No checkpoint at %s, starting from the beginning\n", c.path)
+		}
+		return c, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if prev.InputSize != info.Size() {
+		return nil, fmt.Errorf("checkpoint %s was saved for a %d-byte input, but %s has %d bytes", c.path, prev.InputSize, input, info.Size())
+	}
+	c.resume = &prev.ReplayPosition
+	c.base = prev.Sent
+	c.cp.ReplayPosition = prev.ReplayPosition
+	c.cp.Sent = prev.Sent
+	if !quiet {
+		fmt.Fprintf(os.Stderr, "Resuming from entry %d of loop %d (byte %d), %d messages sent before\n", prev.Ordinal, prev.Loop, prev.Offset, prev.Sent)
+	}
+	return c, nil
+}
+
+// update records the position after a written batch, called by Replay
+func (c *replayCheckpointer) update(pos pkg.ReplayPosition, sent int64) {
+	c.cp.ReplayPosition = pos
+	c.cp.Sent = c.base + sent
+	c.dirty = true
+	if time.Since(c.saved) >= c.interval {
+		c.save()
+	}
+}
+
+// finish saves the final position
+func (c *replayCheckpointer) finish(completed bool) error {
+	c.cp.Completed = completed
+	if c.dirty || completed {
+		c.save()
+	}
+	return c.err
+}
+
+func (c *replayCheckpointer) save() {
+	c.cp.UpdatedAt = time.Now().UTC()
+	if c.err = pkg.SaveReplayCheckpoint(c.path, c.cp); c.err == nil {
+		c.dirty = false
+	}
+	c.saved = time.Now()
+}
+
+// replayTarget is a destination given by --topic or --target
+type replayTarget struct {
+	name    string // As given on the command line
+	topic   string
+	brokers []string
+}
+
+// resolveReplayTargets resolves --topic or the --target PROFILE:TOPIC list
+func resolveReplayTargets(cmd *cli.Command) ([]replayTarget, error) {
+	topic := cmd.String("topic")
+	specs := cmd.StringSlice("target")
+	if topic != "" && len(specs) > 0 {
+		return nil, fmt.Errorf("--topic and --target cannot be used together: give every destination as --target")
+	}
+	if topic == "" && len(specs) == 0 {
+		return nil, fmt.Errorf("--topic or --target is required")
+	}
+	if topic != "" {
+		brokers, err := util.ResolveBrokers(cmd)
+		if err != nil {
+			return nil, err
+		}
+		return []replayTarget{{name: topic, topic: topic, brokers: brokers}}, nil
+	}
+
+	var cfg config.Config
+	var cfgLoaded bool
+	seen := make(map[string]bool)
+	targets := make([]replayTarget, 0, len(specs))
+	for _, spec := range specs {
+		// Topic names cannot contain ':', so the last one separates the profile
+		profile, topic := "", spec
+		if i := strings.LastIndex(spec, ":"); i >= 0 {
+			profile, topic = spec[:i], spec[i+1:]
+		}
+		if topic == "" {
+			return nil, fmt.Errorf("invalid --target %q (use PROFILE:TOPIC or TOPIC)", spec)
+		}
+		if seen[spec] {
+			return nil, fmt.Errorf("--target %q is given twice", spec)
+		}
+		seen[spec] = true
+
+		var brokers []string
+		if profile == "" {
+			var err error
+			if brokers, err = util.ResolveBrokers(cmd); err != nil {
+				return nil, fmt.Errorf("--target %q: %w", spec, err)
+			}
+		} else {
+			if !cfgLoaded {
+				var err error
+				if cfg, err = util.LoadConfigForCmd(cmd); err != nil {
+					return nil, err
+				}
+				cfgLoaded = true
+			}
+			p, err := config.ResolveProfile(cfg, profile)
+			if err != nil {
+				return nil, fmt.Errorf("--target %q: %w", spec, err)
+			}
+			if len(p.Brokers) == 0 {
+				return nil, fmt.Errorf("--target %q: profile %q has no brokers", spec, profile)
+			}
+			brokers = p.Brokers
+		}
+		targets = append(targets, replayTarget{name: spec, topic: topic, brokers: brokers})
+	}
+	return targets, nil
+}
+
+// printTargetReport prints the per-target counts of a fan-out replay
+func printTargetReport(targets []*pkg.ReplayTarget) {
+	for _, t := range targets {
+		fmt.Fprintf(os.Stderr, "Target %s: %d sent, %d failed", t.Name, t.Sent, t.Failed)
+		if t.Err != nil {
+			fmt.Fprintf(os.Stderr, " (last error: %v)", t.Err)
+		}
+		fmt.Fprintln(os.Stderr)
+	}
+}
+
+// printReplayStats prints the throughput of a replay, and the counts of each
+// shard with --concurrency
+func printReplayStats(stats pkg.ReplayStats) {
+	seconds := stats.Elapsed.Seconds()
+	if seconds <= 0 {
+		return
+	}
+	fmt.Fprintf(os.Stderr, "Throughput: %.0f messages/s, %s/s (%s in %s)\n",
+		float64(stats.Messages())/seconds, util.FormatByteSize(float64(stats.Bytes())/seconds),
+		util.FormatByteSize(float64(stats.Bytes())), stats.Elapsed.Round(time.Millisecond))
+	if len(stats.Shards) < 2 {
+		return
+	}
+	for i, s := range stats.Shards {
+		fmt.Fprintf(os.Stderr, "Shard %d: %d messages, %s in %d batches, %s writing\n",
+			i, s.Messages, util.FormatByteSize(float64(s.Bytes)), s.Batches, s.WriteTime.Round(time.Millisecond))
+	}
+}
+
+// recordedPartitions returns the partitions a replay writes to before
+// mapping: the fixed partition, or every partition in the recording. The
+// file is rewound afterwards.
+func recordedPartitions(ctx context.Context, file *os.File, partition *int) ([]int, error) {
+	if partition != nil {
+		return []int{*partition}, nil
+	}
+	recorded, unknown, err := pkg.RecordedPartitions(ctx, file)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := file.Seek(0, io.SeekStart); err != nil {
+		return nil, err
+	}
+	if unknown > 0 {
+		return nil, fmt.Errorf("--partition original: %d entries have no partition information (recorded with an older version)", unknown)
+	}
+	return recorded, nil
+}
+
+// checkTargetPartitions verifies that the target topic has the partitions a
+// replay writes to, after mapping. A topic that does not exist yet is only
+// accepted with --create-topic, as its partition count is then unknown.
+func checkTargetPartitions(ctx context.Context, target replayTarget, recorded []int, partitionMap pkg.PartitionMap, createTopic, quiet bool) error {
+	conn, err := kafka.ConnectToAnyBroker(ctx, target.brokers)
+	if err != nil {
+		return err
+	}
+	partitions, err := kafka.ReadTopicPartitionIDs(conn, target.topic)
+	conn.Close()
+	if err != nil {
+		if createTopic {
+			if !quiet {
+				fmt.Fprintf(os.Stderr, "Warning: cannot check the partitions of topic '%s' before it is created: %v\n", target.topic, err)
+			}
+			return nil
+		}
+		return err
+	}
+	if err := pkg.CheckPartitions(recorded, partitionMap, partitions); err != nil {
+		return fmt.Errorf("topic '%s': %w", target.topic, err)
+	}
+	return nil
+}
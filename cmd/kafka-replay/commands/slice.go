@@ -0,0 +1,84 @@
+package commands
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"os"
+
+	"github.com/lolocompany/kafka-replay/v2/cmd/kafka-replay/util"
+	"github.com/lolocompany/kafka-replay/v2/pkg"
+	"github.com/urfave/cli/v3"
+)
+
+func SliceCommand() *cli.Command {
+	return &cli.Command{
+		Name:        "slice",
+		Usage:       "Copy a range of messages into a new recording",
+		Description: "Write the messages with index --from up to (not including) --to of IN to OUT. Indexes are 0-based and accept scientific notation such as 1e6.",
+		ArgsUsage:   "IN OUT",
+		Flags: append(util.GlobalFlags(),
+			&cli.StringFlag{
+				Name:  "from",
+				Usage: "Index of the first message to copy",
+				Value: "0",
+			},
+			&cli.StringFlag{
+				Name:  "to",
+				Usage: "Index after the last message to copy (defaults to the end of the file)",
+			},
+		),
+		Action: func(ctx context.Context, cmd *cli.Command) error {
+			args := cmd.Args().Slice()
+			if len(args) != 2 {
+				return fmt.Errorf("slice requires an input and an output file: slice IN OUT --from N --to M")
+			}
+			input, output := args[0], args[1]
+			from, err := util.ParseCount(cmd.String("from"))
+			if err != nil {
+				return fmt.Errorf("--from: %w", err)
+			}
+			to := int64(-1)
+			if cmd.IsSet("to") {
+				if to, err = util.ParseCount(cmd.String("to")); err != nil {
+					return fmt.Errorf("--to: %w", err)
+				}
+				if to < from {
+					return fmt.Errorf("--to must not be before --from")
+				}
+			}
+			if err := util.CheckOutputPath(output, input); err != nil {
+				return err
+			}
+
+			in, err := os.Open(input)
+			if err != nil {
+				return fmt.Errorf("failed to open input file: %w", err)
+			}
+			defer in.Close()
+			out, err := os.Create(output)
+			if err != nil {
+				return fmt.Errorf("failed to create output file: %w", err)
+			}
+			defer out.Close()
+			w := bufio.NewWriter(out)
+
+			n, err := pkg.Slice(ctx, pkg.SliceConfig{Input: in, Output: w, From: from, To: to})
+			if err == nil {
+				err = w.Flush()
+			}
+			if err != nil {
+				os.Remove(output)
+				return err
+			}
+			if err := out.Close(); err != nil {
+				return err
+			}
+
+			if !util.Quiet(cmd) {
+				fmt.Fprintf(os.Stderr, "Copied %d messages to %s\n", n, output)
+			}
+			return nil
+		},
+	}
+}
@@ -0,0 +1,131 @@
+package commands
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/lolocompany/kafka-replay/v2/cmd/kafka-replay/util"
+	"github.com/lolocompany/kafka-replay/v2/pkg"
+	"github.com/urfave/cli/v3"
+)
+
+// splitManifestName is the manifest written next to the split files
+const splitManifestName = "manifest.json"
+
+func SplitCommand() *cli.Command {
+	return &cli.Command{
+		Name:        "split",
+		Usage:       "Split a recording into several files",
+		Description: "Fan the recording IN out into files in --out-dir by key hash, source partition, hour or size, and write a manifest.json listing the produced files.",
+		ArgsUsage:   "IN",
+		Flags: append(util.GlobalFlags(),
+			&cli.StringFlag{
+				Name:     "by",
+				Usage:    "How to split: key-hash:N (N files up to 256, all entries of a key in one), partition (per topic and partition), hour (UTC) or size:500MB",
+				Required: true,
+			},
+			&cli.StringFlag{
+				Name:     "out-dir",
+				Aliases:  []string{"o"},
+				Usage:    "Directory for the produced files and manifest.json (created if missing)",
+				Required: true,
+			},
+		),
+		Action: func(ctx context.Context, cmd *cli.Command) error {
+			args := cmd.Args().Slice()
+			if len(args) != 1 {
+				return fmt.Errorf("split requires one input file: split IN --by MODE --out-dir DIR")
+			}
+			input := args[0]
+			outDir := cmd.String("out-dir")
+			cfg, err := parseSplitBy(cmd.String("by"))
+			if err != nil {
+				return err
+			}
+
+			in, err := os.Open(input)
+			if err != nil {
+				return fmt.Errorf("failed to open input file: %w", err)
+			}
+			defer in.Close()
+			if err := os.MkdirAll(outDir, 0o755); err != nil {
+				return fmt.Errorf("failed to create output directory: %w", err)
+			}
+
+			cfg.Input = in
+			cfg.Create = func(name string) (io.WriteCloser, error) {
+				f, err := os.Create(filepath.Join(outDir, name))
+				if err != nil {
+					return nil, err
+				}
+				return &bufferedFile{Writer: bufio.NewWriter(f), file: f}, nil
+			}
+			manifest, err := pkg.Split(ctx, cfg)
+			if err != nil {
+				return err
+			}
+			manifest.Input = input
+
+			data, err := json.MarshalIndent(manifest, "", "  ")
+			if err != nil {
+				return err
+			}
+			if err := os.WriteFile(filepath.Join(outDir, splitManifestName), append(data, '\n'), 0o644); err != nil {
+				return fmt.Errorf("failed to write manifest: %w", err)
+			}
+
+			if !util.Quiet(cmd) {
+				fmt.Fprintf(os.Stderr, "Split %d entries into %d files in %s\n", manifest.Entries, len(manifest.Files), outDir)
+			}
+			return nil
+		},
+	}
+}
+
+// parseSplitBy parses the --by flag of the split command
+func parseSplitBy(value string) (pkg.SplitConfig, error) {
+	mode, arg, hasArg := strings.Cut(strings.TrimSpace(value), ":")
+	cfg := pkg.SplitConfig{By: pkg.SplitMode(mode)}
+	switch cfg.By {
+	case pkg.SplitByKeyHash:
+		n, err := strconv.Atoi(arg)
+		if err != nil || n <= 0 {
+			return cfg, fmt.Errorf("--by key-hash requires a positive number of files, e.g. key-hash:8")
+		}
+		cfg.Buckets = n
+	case pkg.SplitBySize:
+		size, err := util.ParseByteSize(arg)
+		if err != nil {
+			return cfg, fmt.Errorf("--by size: %w", err)
+		}
+		cfg.MaxBytes = size
+	case pkg.SplitByPartition, pkg.SplitByHour:
+		if hasArg {
+			return cfg, fmt.Errorf("--by %s takes no argument", mode)
+		}
+	default:
+		return cfg, fmt.Errorf("invalid --by %q (use key-hash:N, partition, hour or size:500MB)", value)
+	}
+	return cfg, nil
+}
+
+// bufferedFile is a buffered file that is flushed when closed
+type bufferedFile struct {
+	*bufio.Writer
+	file *os.File
+}
+
+func (b *bufferedFile) Close() error {
+	if err := b.Flush(); err != nil {
+		b.file.Close()
+		return err
+	}
+	return b.file.Close()
+}
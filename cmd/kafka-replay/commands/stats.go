@@ -0,0 +1,160 @@
+package commands
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/lolocompany/kafka-replay/v2/cmd/kafka-replay/output"
+	"github.com/lolocompany/kafka-replay/v2/cmd/kafka-replay/util"
+	"github.com/lolocompany/kafka-replay/v2/pkg"
+	"github.com/urfave/cli/v3"
+)
+
+// statsBarWidth is the width of the largest throughput bar in table output
+const statsBarWidth = 40
+
+func StatsCommand() *cli.Command {
+	return &cli.Command{
+		Name:        "stats",
+		Usage:       "Summarize the contents of a recording",
+		Description: "Read FILE once and report its message count, time range, throughput over time, key and value size percentiles, the number of distinct keys, the most frequent keys and the largest messages with their positions. Memory use does not grow with the size of the recording. Uses global --format (table or json).",
+		ArgsUsage:   "FILE",
+		Flags: append(util.GlobalFlags(),
+			&cli.IntFlag{
+				Name:  "top",
+				Usage: "Number of hot keys and largest messages to show",
+				Value: pkg.DefaultStatsTop,
+			},
+			&cli.DurationFlag{
+				Name:  "interval",
+				Usage: "Width of the throughput buckets, e.g. 1s or 1m (default: chosen for about 60 buckets)",
+			},
+		),
+		Action: func(ctx context.Context, cmd *cli.Command) error {
+			args := cmd.Args().Slice()
+			if len(args) != 1 {
+				return fmt.Errorf("stats requires an input file: stats FILE")
+			}
+			format, err := output.ParseFormat(util.GetFormat(cmd), output.IsTTY(os.Stdout))
+			if err != nil {
+				return err
+			}
+			if format == output.FormatRaw {
+				return fmt.Errorf("format 'raw' is only supported by the 'cat' command")
+			}
+
+			in, err := os.Open(args[0])
+			if err != nil {
+				return fmt.Errorf("failed to open input file: %w", err)
+			}
+			defer in.Close()
+
+			result, err := pkg.Stats(ctx, pkg.StatsConfig{
+				Input:    in,
+				Top:      cmd.Int("top"),
+				Interval: cmd.Duration("interval"),
+			})
+			if err != nil {
+				return err
+			}
+
+			enc := output.NewEncoder(format, os.Stdout)
+			if format != output.FormatTable {
+				return output.EncodeSlice(enc, []pkg.StatsResult{result})
+			}
+			return statsTables(enc, result)
+		},
+	}
+}
+
+type statsTable struct {
+	headers []string
+	rows    [][]string
+}
+
+// statsTables renders a stats result as a series of tables
+func statsTables(enc *output.Encoder, r pkg.StatsResult) error {
+	timeRange := "-"
+	if r.Entries > 0 {
+		timeRange = fmt.Sprintf("%s - %s (%s)", r.FirstTimestamp.UTC().Format(time.RFC3339Nano),
+			r.LastTimestamp.UTC().Format(time.RFC3339Nano), time.Duration(r.DurationSeconds*float64(time.Second)))
+	}
+	peak := "-"
+	if r.PeakRate > 0 {
+		peak = fmt.Sprintf("%d msg/s", r.PeakRate)
+	}
+	tables := []statsTable{
+		{[]string{"METRIC", "VALUE"}, [][]string{
+			{"Entries", fmt.Sprint(r.Entries)},
+			{"File size", fmt.Sprintf("%d bytes", r.Bytes)},
+			{"Time range", timeRange},
+			{"Average rate", fmt.Sprintf("%.2f msg/s", r.AverageRate)},
+			{"Peak rate", peak},
+			{"Distinct keys", fmt.Sprintf("~%d", r.DistinctKeys)},
+			{"Without key", fmt.Sprint(r.Keyless)},
+		}},
+		{[]string{"SIZE", "MIN", "P50", "P90", "P99", "P99.9", "MAX", "MEAN"}, [][]string{
+			sizeRow("Key", r.KeySize),
+			sizeRow("Value", r.ValueSize),
+		}},
+		{[]string{"START (" + r.Interval + ")", "MESSAGES", "RATE", ""}, throughputRows(r.Throughput)},
+	}
+	if len(r.TopKeys) > 0 {
+		var rows [][]string
+		for _, k := range r.TopKeys {
+			count := fmt.Sprint(k.Count)
+			if k.Error > 0 {
+				count = fmt.Sprintf("%d (±%d)", k.Count, k.Error)
+			}
+			rows = append(rows, []string{k.Key, count})
+		}
+		tables = append(tables, statsTable{[]string{"HOT KEY", "COUNT"}, rows})
+	}
+	if len(r.Largest) > 0 {
+		var rows [][]string
+		for _, m := range r.Largest {
+			source := m.Topic
+			if m.Partition != nil {
+				source = fmt.Sprintf("%s/%d@%d", m.Topic, *m.Partition, *m.Offset)
+			}
+			rows = append(rows, []string{fmt.Sprint(m.Position), fmt.Sprint(m.ByteOffset), fmt.Sprint(m.Size), m.Key, source,
+				m.Timestamp.UTC().Format(time.RFC3339Nano)})
+		}
+		tables = append(tables, statsTable{[]string{"POSITION", "BYTE OFFSET", "SIZE", "KEY", "SOURCE", "TIMESTAMP"}, rows})
+	}
+
+	for i, t := range tables {
+		if i > 0 {
+			fmt.Fprintln(os.Stdout)
+		}
+		if err := enc.EncodeTable(t.headers, t.rows); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func sizeRow(name string, s pkg.SizeStats) []string {
+	return []string{name, fmt.Sprint(s.Min), fmt.Sprint(s.P50), fmt.Sprint(s.P90), fmt.Sprint(s.P99),
+		fmt.Sprint(s.P999), fmt.Sprint(s.Max), fmt.Sprintf("%.1f", s.Mean)}
+}
+
+// throughputRows renders the throughput series with a bar per bucket
+func throughputRows(buckets []pkg.ThroughputBucket) [][]string {
+	var peak int64
+	for _, b := range buckets {
+		peak = max(peak, b.Messages)
+	}
+	rows := make([][]string, 0, len(buckets))
+	for _, b := range buckets {
+		bar := ""
+		if peak > 0 {
+			bar = strings.Repeat("#", int((b.Messages*statsBarWidth+peak-1)/peak))
+		}
+		rows = append(rows, []string{b.Start.Format(time.RFC3339), fmt.Sprint(b.Messages), fmt.Sprintf("%.2f/s", b.Rate), bar})
+	}
+	return rows
+}
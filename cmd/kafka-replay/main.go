@@ -20,6 +20,12 @@ func main() {
 			commands.ReplayCommand(),
 			commands.MirrorCommand(),
 			commands.CatCommand(),
+			commands.CompactCommand(),
+			commands.MergeCommand(),
+			commands.SplitCommand(),
+			commands.SliceCommand(),
+			commands.DiffCommand(),
+			commands.StatsCommand(),
 			commands.InspectCommand(),
 			commands.DebugCommand(),
 			commands.VersionCommand(),
@@ -0,0 +1,86 @@
+package util
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// CheckOutputPath returns an error if output is one of the inputs, which
+// would be truncated before it is read.
+func CheckOutputPath(output string, inputs ...string) error {
+	outInfo, err := os.Stat(output)
+	if err != nil {
+		// Output does not exist yet
+		return nil
+	}
+	outAbs, _ := filepath.Abs(output)
+	for _, input := range inputs {
+		inAbs, _ := filepath.Abs(input)
+		if inAbs == outAbs {
+			return fmt.Errorf("output %s is also an input", output)
+		}
+		if inInfo, err := os.Stat(input); err == nil && os.SameFile(inInfo, outInfo) {
+			return fmt.Errorf("output %s is also an input", output)
+		}
+	}
+	return nil
+}
+
+// ParseByteSize parses a size such as 500MB, 1.5GB, 64KiB or 1024 (bytes).
+// Units are powers of 1024.
+func ParseByteSize(s string) (int64, error) {
+	v := strings.ToUpper(strings.TrimSpace(s))
+	units := []struct {
+		suffix string
+		factor float64
+	}{
+		{"TIB", 1 << 40}, {"GIB", 1 << 30}, {"MIB", 1 << 20}, {"KIB", 1 << 10},
+		{"TB", 1 << 40}, {"GB", 1 << 30}, {"MB", 1 << 20}, {"KB", 1 << 10},
+		{"T", 1 << 40}, {"G", 1 << 30}, {"M", 1 << 20}, {"K", 1 << 10},
+		{"B", 1},
+	}
+	factor := 1.0
+	for _, u := range units {
+		if strings.HasSuffix(v, u.suffix) {
+			factor = u.factor
+			v = strings.TrimSpace(strings.TrimSuffix(v, u.suffix))
+			break
+		}
+	}
+	n, err := strconv.ParseFloat(v, 64)
+	if err != nil || n <= 0 {
+		return 0, fmt.Errorf("invalid size %q (use e.g. 500MB, 1GB or a number of bytes)", s)
+	}
+	return int64(n * factor), nil
+}
+
+// FormatByteSize formats a number of bytes in the units of ParseByteSize,
+// e.g. 1.5GB.
+func FormatByteSize(n float64) string {
+	for _, u := range []struct {
+		suffix string
+		factor float64
+	}{{"TB", 1 << 40}, {"GB", 1 << 30}, {"MB", 1 << 20}, {"KB", 1 << 10}} {
+		if n >= u.factor {
+			return strconv.FormatFloat(n/u.factor, 'f', 1, 64) + u.suffix
+		}
+	}
+	return strconv.FormatFloat(n, 'f', 0, 64) + "B"
+}
+
+// ParseCount parses a non-negative message count or index, accepting
+// scientific notation such as 1e6.
+func ParseCount(s string) (int64, error) {
+	v := strings.TrimSpace(s)
+	if n, err := strconv.ParseInt(v, 10, 64); err == nil && n >= 0 {
+		return n, nil
+	}
+	f, err := strconv.ParseFloat(v, 64)
+	if err != nil || f < 0 || f != float64(int64(f)) {
+		return 0, fmt.Errorf("invalid count %q (use a whole number such as 1000 or 1e6)", s)
+	}
+	return int64(f), nil
+}
@@ -0,0 +1,26 @@
+package util
+
+import (
+	"strings"
+
+	"github.com/lolocompany/kafka-replay/v2/pkg/kafka"
+	"github.com/urfave/cli/v3"
+)
+
+// PartitionerFlag returns the --partitioner flag of commands that produce.
+func PartitionerFlag() cli.Flag {
+	names := make([]string, 0, len(kafka.Partitioners()))
+	for _, p := range kafka.Partitioners() {
+		names = append(names, string(p))
+	}
+	return &cli.StringFlag{
+		Name:  "partitioner",
+		Usage: "How messages are assigned to partitions: " + strings.Join(names, ", ") + " (murmur2 places keys like the Java client)",
+		Value: string(kafka.DefaultPartitioner),
+	}
+}
+
+// LoadPartitioner parses the --partitioner flag.
+func LoadPartitioner(cmd *cli.Command) (kafka.Partitioner, error) {
+	return kafka.ParsePartitioner(cmd.String("partitioner"))
+}
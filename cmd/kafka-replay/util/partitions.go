@@ -0,0 +1,38 @@
+package util
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// ParsePartitions parses a --partition value: "all", a single partition
+// (e.g. 0), or a comma-separated list (e.g. 0,3,5). It returns all=true for
+// "all"; otherwise the sorted, de-duplicated partition IDs.
+func ParsePartitions(value string) (all bool, ids []int, err error) {
+	v := strings.TrimSpace(value)
+	if strings.EqualFold(v, "all") {
+		return true, nil, nil
+	}
+	seen := make(map[int]bool)
+	for _, part := range strings.Split(v, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+		id, err := strconv.Atoi(part)
+		if err != nil || id < 0 {
+			return false, nil, fmt.Errorf("invalid partition %q (use \"all\", a partition number, or a comma-separated list like 0,3,5)", part)
+		}
+		if !seen[id] {
+			seen[id] = true
+			ids = append(ids, id)
+		}
+	}
+	if len(ids) == 0 {
+		return false, nil, fmt.Errorf("no partitions given")
+	}
+	sort.Ints(ids)
+	return false, ids, nil
+}
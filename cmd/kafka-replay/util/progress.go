@@ -61,6 +61,15 @@ type writeCloser struct {
 	closer io.Writer
 }
 
+// Sync passes through to the underlying writer (e.g. *os.File) so callers can
+// make written data durable.
+func (wc *writeCloser) Sync() error {
+	if syncer, ok := wc.closer.(interface{ Sync() error }); ok {
+		return syncer.Sync()
+	}
+	return nil
+}
+
 func (wc *writeCloser) Close() error {
 	if closer, ok := wc.closer.(io.Closer); ok {
 		return closer.Close()
@@ -0,0 +1,114 @@
+package util
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/lolocompany/kafka-replay/v2/pkg"
+	"github.com/lolocompany/kafka-replay/v2/pkg/ratelimit"
+	"github.com/urfave/cli/v3"
+)
+
+// RateLimitFlags returns the flags that limit the rate of commands that produce.
+func RateLimitFlags() []cli.Flag {
+	return []cli.Flag{
+		&cli.IntFlag{
+			Name:  "rate",
+			Usage: "Messages per second (0 for maximum speed)",
+			Value: 0,
+		},
+		&cli.StringFlag{
+			Name:  "byte-rate",
+			Usage: "Bytes of keys and values per second, e.g. 20MB/s (can be combined with a message rate)",
+		},
+		&cli.StringFlag{
+			Name:  "ramp",
+			Usage: "Messages per second rising (or falling) linearly, as FROM..TO/DURATION, e.g. 100..5000/10m; the rate then stays at TO",
+		},
+		&cli.StringFlag{
+			Name:  "rate-schedule",
+			Usage: "YAML file of step changes in messages per second (steps: [{after: 0s, rate: 100}, {after: 5m, rate: 2000}])",
+		},
+		&cli.FloatFlag{
+			Name:  "rate-tolerance",
+			Usage: "How far the send rate may stray from the rate limit over any one-second window, as a fraction (smaller means smaller batches)",
+			Value: pkg.DefaultRateTolerance,
+		},
+		&cli.DurationFlag{
+			Name:  "linger",
+			Usage: "Longest time a message waits for its batch to fill before it is sent",
+			Value: pkg.DefaultLinger,
+		},
+	}
+}
+
+// LoadBatching returns the --linger and --rate-tolerance flags.
+func LoadBatching(cmd *cli.Command) (time.Duration, float64, error) {
+	linger, tolerance := cmd.Duration("linger"), cmd.Float("rate-tolerance")
+	if linger <= 0 {
+		return 0, 0, fmt.Errorf("--linger must be positive")
+	}
+	if tolerance <= 0 || tolerance > 1 {
+		return 0, 0, fmt.Errorf("--rate-tolerance must be greater than 0 and at most 1")
+	}
+	return linger, tolerance, nil
+}
+
+// LoadLimiter builds a Limiter from the rate limit flags, along with a
+// description for status output. It returns nil when no limit was given.
+func LoadLimiter(cmd *cli.Command) (*ratelimit.Limiter, string, error) {
+	set := 0
+	for _, name := range []string{"rate", "ramp", "rate-schedule"} {
+		if cmd.IsSet(name) {
+			set++
+		}
+	}
+	if set > 1 {
+		return nil, "", fmt.Errorf("--rate, --ramp and --rate-schedule cannot be used together: each sets the message rate")
+	}
+
+	var messages, bytes ratelimit.Profile
+	switch {
+	case cmd.IsSet("ramp"):
+		r, err := ratelimit.ParseRamp(cmd.String("ramp"))
+		if err != nil {
+			return nil, "", fmt.Errorf("--ramp: %w", err)
+		}
+		messages = r
+	case cmd.IsSet("rate-schedule"):
+		data, err := os.ReadFile(cmd.String("rate-schedule"))
+		if err != nil {
+			return nil, "", fmt.Errorf("failed to read rate schedule: %w", err)
+		}
+		s, err := ratelimit.ParseSchedule(data)
+		if err != nil {
+			return nil, "", fmt.Errorf("--rate-schedule: %w", err)
+		}
+		messages = s
+	case cmd.Int("rate") < 0:
+		return nil, "", fmt.Errorf("--rate cannot be negative")
+	case cmd.Int("rate") > 0:
+		messages = ratelimit.Constant(cmd.Int("rate"))
+	}
+	if cmd.IsSet("byte-rate") {
+		n, err := ParseByteSize(strings.TrimSuffix(strings.ToLower(strings.TrimSpace(cmd.String("byte-rate"))), "/s"))
+		if err != nil {
+			return nil, "", fmt.Errorf("--byte-rate: %w", err)
+		}
+		bytes = ratelimit.Constant(n)
+	}
+
+	var parts []string
+	if messages != nil {
+		parts = append(parts, "messages "+messages.String())
+	}
+	if bytes != nil {
+		parts = append(parts, "bytes "+bytes.String())
+	}
+	if len(parts) == 0 {
+		return nil, "", nil
+	}
+	return ratelimit.New(messages, bytes), strings.Join(parts, ", "), nil
+}
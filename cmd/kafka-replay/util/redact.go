@@ -0,0 +1,53 @@
+package util
+
+import (
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/lolocompany/kafka-replay/v2/pkg/redact"
+	"github.com/urfave/cli/v3"
+)
+
+// RedactFlags returns the flags that enable redaction on a command.
+func RedactFlags() []cli.Flag {
+	return []cli.Flag{
+		&cli.StringFlag{
+			Name:  "redact-rules",
+			Usage: "Path to a YAML/JSON redaction rules file (mask, hash or drop fields selected by JSON path or regex)",
+		},
+		&cli.StringFlag{
+			Name:    "redact-key",
+			Usage:   "Secret key for the HMAC used by 'hash' redaction rules (stable pseudonyms across runs)",
+			Sources: cli.EnvVars("KAFKA_REPLAY_REDACT_KEY"),
+		},
+	}
+}
+
+// LoadRedactor builds a Redactor from --redact-rules and --redact-key.
+// It returns nil when no rules file was given.
+func LoadRedactor(cmd *cli.Command) (*redact.Redactor, error) {
+	path := cmd.String("redact-rules")
+	if path == "" {
+		return nil, nil
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read redaction rules %s: %w", path, err)
+	}
+	rules, err := redact.ParseRules(data)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return redact.New(rules, []byte(cmd.String("redact-key")))
+}
+
+// PrintRedactionReport writes one status line per redaction rule to w.
+func PrintRedactionReport(w io.Writer, r *redact.Redactor) {
+	if r == nil {
+		return
+	}
+	for _, s := range r.Report() {
+		fmt.Fprintf(w, "Redaction rule '%s' (%s %s): %d hits in %d messages\n", s.Rule, s.Action, s.Target, s.Hits, s.Messages)
+	}
+}
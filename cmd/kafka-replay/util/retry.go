@@ -0,0 +1,92 @@
+package util
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/lolocompany/kafka-replay/v2/pkg"
+	"github.com/urfave/cli/v3"
+)
+
+// defaultRetries is the number of times commands retry a failed write
+const defaultRetries = 5
+
+// RetryFlags returns the flags that control how commands that produce handle
+// failed writes.
+func RetryFlags() []cli.Flag {
+	return []cli.Flag{
+		&cli.IntFlag{
+			Name:  "retries",
+			Usage: "Retries of a write that failed with a retriable error, such as leader not available or a timeout (0 to fail at once)",
+			Value: defaultRetries,
+		},
+		&cli.DurationFlag{
+			Name:  "retry-backoff",
+			Usage: "Wait before the first retry, doubled for each further retry",
+			Value: pkg.DefaultRetryBackoff,
+		},
+		&cli.DurationFlag{
+			Name:  "retry-max-backoff",
+			Usage: "Longest wait between retries",
+			Value: pkg.DefaultMaxRetryBackoff,
+		},
+		&cli.StringFlag{
+			Name:  "dead-letter",
+			Usage: "Write messages that still fail after retries, or fail with a fatal error such as message too large, to this recording instead of stopping",
+		},
+	}
+}
+
+// LoadRetryPolicy returns the policy set by the retry flags.
+func LoadRetryPolicy(cmd *cli.Command) (pkg.RetryPolicy, error) {
+	policy := pkg.RetryPolicy{
+		Retries:    cmd.Int("retries"),
+		Backoff:    cmd.Duration("retry-backoff"),
+		MaxBackoff: cmd.Duration("retry-max-backoff"),
+	}
+	if policy.Retries < 0 {
+		return policy, fmt.Errorf("--retries cannot be negative")
+	}
+	if policy.Backoff <= 0 || policy.MaxBackoff <= 0 {
+		return policy, fmt.Errorf("--retry-backoff and --retry-max-backoff must be positive")
+	}
+	if policy.MaxBackoff < policy.Backoff {
+		return policy, fmt.Errorf("--retry-max-backoff cannot be less than --retry-backoff")
+	}
+	return policy, nil
+}
+
+// DeadLetterFile is the recording named by --dead-letter.
+type DeadLetterFile struct {
+	*pkg.DeadLetter
+	Path string
+	file *os.File
+}
+
+// OpenDeadLetter creates the --dead-letter recording, or returns nil if the
+// flag is not set. inputs are files the command reads, which the recording
+// must not overwrite.
+func OpenDeadLetter(cmd *cli.Command, inputs ...string) (*DeadLetterFile, error) {
+	path := cmd.String("dead-letter")
+	if path == "" {
+		return nil, nil
+	}
+	if err := CheckOutputPath(path, inputs...); err != nil {
+		return nil, fmt.Errorf("--dead-letter: %w", err)
+	}
+	file, err := os.Create(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create dead letter file: %w", err)
+	}
+	deadLetter, err := pkg.NewDeadLetter(file)
+	if err != nil {
+		file.Close()
+		return nil, fmt.Errorf("failed to create dead letter file: %w", err)
+	}
+	return &DeadLetterFile{DeadLetter: deadLetter, Path: path, file: file}, nil
+}
+
+// Close closes the recording.
+func (f *DeadLetterFile) Close() error {
+	return f.file.Close()
+}
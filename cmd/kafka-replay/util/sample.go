@@ -0,0 +1,57 @@
+package util
+
+import (
+	"fmt"
+
+	"github.com/lolocompany/kafka-replay/v2/pkg/sample"
+	"github.com/urfave/cli/v3"
+)
+
+// SampleFlags returns the flags that enable sampling on a command.
+func SampleFlags() []cli.Flag {
+	return []cli.Flag{
+		&cli.FloatFlag{
+			Name:  "sample-rate",
+			Usage: "Keep this fraction of messages, e.g. 0.01 for 1% (random, or by key with --sample-by-key)",
+		},
+		&cli.Int64Flag{
+			Name:  "sample-every",
+			Usage: "Keep every Nth message (or the keys whose hash is divisible by N with --sample-by-key)",
+		},
+		&cli.IntFlag{
+			Name:  "sample-size",
+			Usage: "Keep a uniform random sample of N messages over the whole stream (reservoir sampling; held in memory until the end)",
+		},
+		&cli.BoolFlag{
+			Name:  "sample-by-key",
+			Usage: "Sample by a hash of the message key so each key's messages are all kept or all dropped (with --sample-rate or --sample-every)",
+		},
+		&cli.Uint64Flag{
+			Name:  "sample-seed",
+			Usage: "Seed for reproducible sampling (with --sample-by-key, selects a different stable set of keys)",
+		},
+	}
+}
+
+// LoadSampler builds a Sampler from the sampling flags. It returns nil when
+// no sampling mode was given.
+func LoadSampler(cmd *cli.Command) (*sample.Sampler, error) {
+	cfg := sample.Config{
+		Rate:  cmd.Float("sample-rate"),
+		Every: cmd.Int64("sample-every"),
+		Size:  cmd.Int("sample-size"),
+		ByKey: cmd.Bool("sample-by-key"),
+		Seed:  cmd.Uint64("sample-seed"),
+	}
+	if !cmd.IsSet("sample-rate") && !cmd.IsSet("sample-every") && !cmd.IsSet("sample-size") {
+		if cfg.ByKey || cmd.IsSet("sample-seed") {
+			return nil, fmt.Errorf("--sample-by-key and --sample-seed require --sample-rate, --sample-every or --sample-size")
+		}
+		return nil, nil
+	}
+	s, err := sample.New(cfg)
+	if err != nil {
+		return nil, fmt.Errorf("invalid sampling flags: %w", err)
+	}
+	return s, nil
+}
@@ -0,0 +1,27 @@
+package util
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// ParseTimeBound parses a --since/--until style value. It accepts RFC3339
+// timestamps (e.g. 2024-02-02T13:00:00Z), "now", and durations relative to
+// now (e.g. -2h for two hours ago, -15m30s).
+func ParseTimeBound(value string, now time.Time) (time.Time, error) {
+	v := strings.TrimSpace(value)
+	if v == "" {
+		return time.Time{}, fmt.Errorf("empty time value")
+	}
+	if strings.EqualFold(v, "now") {
+		return now, nil
+	}
+	if t, err := time.Parse(time.RFC3339Nano, v); err == nil {
+		return t, nil
+	}
+	if d, err := time.ParseDuration(v); err == nil {
+		return now.Add(d), nil
+	}
+	return time.Time{}, fmt.Errorf("invalid time %q (use RFC3339 like 2024-02-02T13:00:00Z, \"now\", or a relative duration like -2h)", value)
+}
@@ -0,0 +1,37 @@
+package util
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseTimeBound(t *testing.T) {
+	now := time.Date(2024, 2, 2, 13, 0, 0, 0, time.UTC)
+	for _, c := range []struct {
+		value string
+		want  time.Time
+	}{
+		{"2024-02-01T13:15:00Z", time.Date(2024, 2, 1, 13, 15, 0, 0, time.UTC)},
+		{"2024-02-01T14:15:00.5+01:00", time.Date(2024, 2, 1, 13, 15, 0, 500_000_000, time.UTC)},
+		{"now", now},
+		{" NOW ", now},
+		{"-2h", now.Add(-2 * time.Hour)},
+		{"-15m30s", now.Add(-15*time.Minute - 30*time.Second)},
+		{"1h", now.Add(time.Hour)},
+	} {
+		got, err := ParseTimeBound(c.value, now)
+		if err != nil {
+			t.Errorf("ParseTimeBound(%q) failed: %v", c.value, err)
+			continue
+		}
+		if !got.Equal(c.want) {
+			t.Errorf("ParseTimeBound(%q) = %v, want %v", c.value, got, c.want)
+		}
+	}
+
+	for _, value := range []string{"", "yesterday", "2h ago", "2024-02-01", "2024-02-01 13:15:00", "-2d"} {
+		if got, err := ParseTimeBound(value, now); err == nil {
+			t.Errorf("ParseTimeBound(%q) = %v, want an error", value, got)
+		}
+	}
+}
@@ -0,0 +1,150 @@
+package pkg
+
+import (
+	"context"
+	"math"
+	"time"
+
+	"github.com/lolocompany/kafka-replay/v2/pkg/ratelimit"
+	"github.com/segmentio/kafka-go"
+)
+
+const (
+	// DefaultLinger is how long a message waits in a partial batch by default
+	DefaultLinger = 100 * time.Millisecond
+	// DefaultRateTolerance is the default fraction by which the send rate may
+	// stray from a rate limit over any one-second window
+	DefaultRateTolerance = 0.05
+)
+
+// MessageWriter writes messages to Kafka. *kafka.Producer implements it.
+type MessageWriter interface {
+	WriteMessages(ctx context.Context, messages ...kafka.Message) error
+}
+
+// batchWriter collects messages into batches for a write function. A batch is
+// written when it is full, when its first message has waited linger, and
+// before the limiter makes the writer wait. Under a rate limit a batch holds
+// at most tolerance seconds' worth of the current rate and the limiter bursts
+// no more than that, so the rate seen over any second stays within tolerance.
+type batchWriter struct {
+	write     func(ctx context.Context, batch []kafka.Message) error
+	limiter   *ratelimit.Limiter
+	tolerance float64
+	linger    time.Duration
+	timer     *time.Timer // Runs while the batch is not empty
+
+	batch []kafka.Message
+	bytes int64
+	sent  int64 // Messages written
+	stats ReplayShardStats
+
+	// onWrite, if set, is called after each write with the position of the
+	// batch's last message: callers set next before add
+	onWrite    func(pos ReplayPosition, sent int64)
+	next, last ReplayPosition
+}
+
+// newBatchWriter creates a batchWriter. Zero linger and tolerance select the
+// defaults; limiter may be nil.
+func newBatchWriter(write func(ctx context.Context, batch []kafka.Message) error, limiter *ratelimit.Limiter, linger time.Duration, tolerance float64) *batchWriter {
+	if linger <= 0 {
+		linger = DefaultLinger
+	}
+	if tolerance <= 0 {
+		tolerance = DefaultRateTolerance
+	}
+	if limiter != nil {
+		limiter.SetBurst(time.Duration(tolerance * float64(time.Second)))
+	}
+	timer := time.NewTimer(linger)
+	timer.Stop()
+	return &batchWriter{
+		write:     write,
+		limiter:   limiter,
+		tolerance: tolerance,
+		linger:    linger,
+		timer:     timer,
+		batch:     make([]kafka.Message, 0, BatchSize),
+	}
+}
+
+// add appends msg to the batch, waiting for the limiter and writing the batch
+// as needed.
+func (w *batchWriter) add(ctx context.Context, msg kafka.Message) error {
+	size := int64(len(msg.Key) + len(msg.Value))
+	// Under a rate limit, send what was admitted before waiting
+	if w.limiter != nil && w.limiter.Take(1, size) > 0 {
+		if err := w.flush(ctx); err != nil {
+			return err
+		}
+		if err := w.limiter.Wait(ctx); err != nil {
+			return err
+		}
+	}
+
+	if len(w.batch) == 0 {
+		w.timer.Reset(w.linger)
+	}
+	w.batch = append(w.batch, msg)
+	w.bytes += size
+	w.last = w.next
+
+	maxMessages, maxBytes := w.limits()
+	if len(w.batch) >= maxMessages || w.bytes >= maxBytes {
+		return w.flush(ctx)
+	}
+	return nil
+}
+
+// limits returns the batch size at which to write: BatchSize and BatchBytes,
+// or less under a rate limit
+func (w *batchWriter) limits() (int, int64) {
+	maxMessages, maxBytes := BatchSize, int64(BatchBytes)
+	if w.limiter == nil {
+		return maxMessages, maxBytes
+	}
+	messageRate, byteRate := w.limiter.Rates()
+	if messageRate > 0 {
+		maxMessages = int(min(math.Max(messageRate*w.tolerance, 1), BatchSize))
+	}
+	if byteRate > 0 {
+		maxBytes = int64(min(math.Max(byteRate*w.tolerance, 1), BatchBytes))
+	}
+	return maxMessages, maxBytes
+}
+
+// lingerC fires when the batch has waited linger; it is nil while the batch
+// is empty
+func (w *batchWriter) lingerC() <-chan time.Time {
+	if len(w.batch) == 0 {
+		return nil
+	}
+	return w.timer.C
+}
+
+// flush writes the batch, if any, and returns its buffers to the pools.
+func (w *batchWriter) flush(ctx context.Context) error {
+	if len(w.batch) == 0 {
+		return nil
+	}
+	w.timer.Stop()
+	start := time.Now()
+	if err := w.write(ctx, w.batch); err != nil {
+		return err
+	}
+	w.stats.WriteTime += time.Since(start)
+	w.stats.Batches++
+	w.stats.Messages += int64(len(w.batch))
+	for i := range w.batch {
+		w.stats.Bytes += int64(len(w.batch[i].Key) + len(w.batch[i].Value))
+	}
+	returnBatchBuffersToPool(w.batch)
+	w.sent += int64(len(w.batch))
+	w.batch = w.batch[:0]
+	w.bytes = 0
+	if w.onWrite != nil {
+		w.onWrite(w.last, w.sent)
+	}
+	return nil
+}
@@ -0,0 +1,150 @@
+package pkg
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/lolocompany/kafka-replay/v2/pkg/ratelimit"
+	"github.com/lolocompany/kafka-replay/v2/pkg/transcoder"
+	"github.com/segmentio/kafka-go"
+)
+
+// fakeProducer records the size and time of every write and the keys written
+type fakeProducer struct {
+	mu     sync.Mutex
+	writes []fakeWrite
+	keys   []string
+	after  func(total int) // Optional hook after each write
+}
+
+type fakeWrite struct {
+	at       time.Time
+	messages int
+}
+
+func (p *fakeProducer) WriteMessages(ctx context.Context, messages ...kafka.Message) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.writes = append(p.writes, fakeWrite{at: time.Now(), messages: len(messages)})
+	for _, m := range messages {
+		p.keys = append(p.keys, string(m.Key))
+	}
+	if p.after != nil {
+		p.after(len(p.keys))
+	}
+	return nil
+}
+
+func (p *fakeProducer) written() (batches, messages int) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	for _, w := range p.writes {
+		messages += w.messages
+	}
+	return len(p.writes), messages
+}
+
+func TestBatchWriter_Linger(t *testing.T) {
+	producer := &fakeProducer{}
+	w := newBatchWriter(func(ctx context.Context, batch []kafka.Message) error {
+		return producer.WriteMessages(ctx, batch...)
+	}, nil, 20*time.Millisecond, 0)
+	if w.lingerC() != nil {
+		t.Fatal("empty batch has a linger timer")
+	}
+
+	// A slow source: three messages that never fill a batch
+	for i := range 3 {
+		if err := w.add(context.Background(), kafka.Message{Value: []byte{byte(i)}}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if batches, _ := producer.written(); batches != 0 {
+		t.Fatalf("wrote %d batches before the linger interval", batches)
+	}
+	select {
+	case <-w.lingerC():
+	case <-time.After(time.Second):
+		t.Fatal("linger timer did not fire")
+	}
+	if err := w.flush(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if batches, messages := producer.written(); batches != 1 || messages != 3 || w.sent != 3 {
+		t.Errorf("wrote %d batches of %d messages (sent %d), want 1 of 3", batches, messages, w.sent)
+	}
+	if w.lingerC() != nil {
+		t.Error("linger timer still set after flush")
+	}
+}
+
+func TestBatchWriter_Limits(t *testing.T) {
+	write := func(context.Context, []kafka.Message) error { return nil }
+	for _, c := range []struct {
+		limiter      *ratelimit.Limiter
+		tolerance    float64
+		wantMessages int
+		wantBytes    int64
+	}{
+		{nil, 0.05, BatchSize, BatchBytes},
+		{ratelimit.New(ratelimit.Constant(1000), nil), 0.05, 50, BatchBytes},
+		{ratelimit.New(ratelimit.Constant(1000), nil), 0.2, 200, BatchBytes},
+		{ratelimit.New(ratelimit.Constant(5), nil), 0.05, 1, BatchBytes},
+		{ratelimit.New(ratelimit.Constant(1e9), nil), 0.05, BatchSize, BatchBytes},
+		{ratelimit.New(nil, ratelimit.Constant(1<<20)), 0.1, BatchSize, 104857},
+	} {
+		w := newBatchWriter(write, c.limiter, 0, c.tolerance)
+		if m, b := w.limits(); m != c.wantMessages || b != c.wantBytes {
+			t.Errorf("tolerance %g: limits %d, %d; want %d, %d", c.tolerance, m, b, c.wantMessages, c.wantBytes)
+		}
+	}
+
+	// Keys count towards the byte limit, as they do for the limiter
+	w := newBatchWriter(write, nil, time.Hour, 0)
+	if err := w.add(context.Background(), kafka.Message{Key: []byte("key"), Value: []byte("value")}); err != nil {
+		t.Fatal(err)
+	}
+	if w.bytes != 8 {
+		t.Errorf("batch of %d bytes, want 8 for key and value", w.bytes)
+	}
+}
+
+func TestReplay_SmoothRate(t *testing.T) {
+	const rate, count, tolerance = 500, 500, 0.05
+	entries := make([]testEntry, count)
+	for i := range entries {
+		entries[i] = testEntry{"t", fmt.Sprint(i), "v", int64(i)}
+	}
+	decoder, err := transcoder.NewDecodeReader(encodeEntries(t, entries), true)
+	if err != nil {
+		t.Fatalf("NewDecodeReader failed: %v", err)
+	}
+	producer := &fakeProducer{}
+
+	start := time.Now()
+	n, err := Replay(context.Background(), ReplayConfig{Producer: producer, Decoder: decoder, Rate: rate, RateTolerance: tolerance})
+	if err != nil || n != count {
+		t.Fatalf("Replay returned %d, %v", n, err)
+	}
+
+	// Without smoothing this would be a single batch after one second. Every
+	// write must keep the running total near the target rate.
+	allowed := rate*tolerance + rate*0.05 // The tolerance plus 50ms of scheduling slack
+	sent := 0
+	for _, w := range producer.writes {
+		if w.messages > rate*tolerance {
+			t.Errorf("batch of %d messages, want at most %d", w.messages, int(rate*tolerance))
+		}
+		sent += w.messages
+		expected := rate * w.at.Sub(start).Seconds()
+		if d := float64(sent) - expected; d > allowed || d < -allowed {
+			t.Errorf("%d messages sent after %v, expected %.0f", sent, w.at.Sub(start), expected)
+		}
+	}
+	if len(producer.writes) < count/int(rate*tolerance) {
+		t.Errorf("only %d writes", len(producer.writes))
+	}
+}
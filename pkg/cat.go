@@ -9,6 +9,8 @@ import (
 	"strconv"
 	"time"
 
+	"github.com/lolocompany/kafka-replay/v2/pkg/redact"
+	"github.com/lolocompany/kafka-replay/v2/pkg/sample"
 	"github.com/lolocompany/kafka-replay/v2/pkg/transcoder"
 )
 
@@ -17,14 +19,36 @@ type CatConfig struct {
 	PreserveTimestamps bool
 	Formatter          func(timestamp time.Time, key []byte, data []byte) []byte
 	Output             io.Writer
-	FindBytes          []byte // Optional byte sequence to search for in messages
-	CountOnly          bool   // If true, only count messages without outputting them
+	FindBytes          []byte           // Optional byte sequence to search for in messages
+	CountOnly          bool             // If true, only count messages without outputting them
+	Redactor           *redact.Redactor // Optional redaction applied before formatting
+	Sampler            *sample.Sampler  // Optional sampling applied after FindBytes
+	// Skip, Limit and Tail select a range of the messages that pass FindBytes
+	// and Sampler: Skip drops the first ones, Limit stops after that many and
+	// Tail only outputs the last ones. Without filters, skipped messages are
+	// seeked over instead of decoded.
+	Skip  int64
+	Limit int64
+	Tail  int
+}
+
+// catEntry is a message held back for reservoir sampling or --tail
+type catEntry struct {
+	timestamp time.Time
+	key       []byte
+	data      []byte
 }
 
 func Cat(ctx context.Context, cfg CatConfig) (int, error) {
 	if cfg.Output == nil && !cfg.CountOnly {
 		return 0, errors.New("output is required")
 	}
+	if cfg.Skip < 0 || cfg.Limit < 0 || cfg.Tail < 0 {
+		return 0, errors.New("skip, limit and tail must not be negative")
+	}
+	if cfg.Tail > 0 && (cfg.Skip > 0 || cfg.Limit > 0) {
+		return 0, errors.New("tail cannot be combined with skip or limit")
+	}
 	decoder, err := transcoder.NewDecodeReader(cfg.Reader, cfg.PreserveTimestamps)
 	if err != nil {
 		return 0, err
@@ -49,6 +73,78 @@ func Cat(ctx context.Context, cfg CatConfig) (int, error) {
 	keyStorage := make([]byte, keyCap)
 	dataStorage := make([]byte, dataCap)
 
+	var reservoir *sample.Reservoir[catEntry]
+	if cfg.Sampler != nil && !cfg.Sampler.Streaming() {
+		reservoir = sample.NewReservoir[catEntry](cfg.Sampler)
+	}
+
+	emit := func(timestamp time.Time, keyBuf, dataBuf []byte) error {
+		var err error
+		if cfg.Redactor != nil {
+			if keyBuf, dataBuf, err = cfg.Redactor.Apply(keyBuf, dataBuf); err != nil {
+				return err
+			}
+		}
+
+		// Skip formatting and writing if count-only mode
+		if cfg.CountOnly {
+			return nil
+		}
+
+		// Display message
+		formattedMessage := cfg.Formatter(timestamp, keyBuf, dataBuf)
+		_, err = cfg.Output.Write(formattedMessage)
+		return err
+	}
+
+	// Skip without filters: seek over entries instead of decoding them
+	skipped := int64(0)
+	if cfg.FindBytes == nil && cfg.Sampler == nil {
+		for ; skipped < cfg.Skip; skipped++ {
+			if err := decoder.Skip(); err != nil {
+				if err == io.EOF {
+					return 0, nil
+				}
+				return 0, err
+			}
+		}
+	}
+
+	// The last cfg.Tail selected messages, as a ring buffer
+	var tail []catEntry
+	var tailNext int
+	if cfg.Tail > 0 {
+		tail = make([]catEntry, 0, cfg.Tail)
+	}
+
+	// output applies skip, limit and tail to a selected message; it reports
+	// whether the limit was reached
+	output := func(timestamp time.Time, keyBuf, dataBuf []byte) (bool, error) {
+		if skipped < cfg.Skip {
+			skipped++
+			return false, nil
+		}
+		if cfg.Tail > 0 {
+			if len(tail) < cfg.Tail {
+				tail = append(tail, catEntry{})
+			}
+			e := &tail[tailNext]
+			e.timestamp = timestamp
+			e.key = append(e.key[:0], keyBuf...)
+			if keyBuf == nil {
+				e.key = nil
+			}
+			e.data = append(e.data[:0], dataBuf...)
+			tailNext = (tailNext + 1) % cfg.Tail
+			return false, nil
+		}
+		count++
+		if err := emit(timestamp, keyBuf, dataBuf); err != nil {
+			return false, err
+		}
+		return cfg.Limit > 0 && int64(count) >= cfg.Limit, nil
+	}
+
 	for {
 		// Check context cancellation
 		select {
@@ -81,17 +177,41 @@ func Cat(ctx context.Context, cfg CatConfig) (int, error) {
 			continue
 		}
 
-		// Increment count
-		count++
-
-		// Skip formatting and writing if count-only mode
-		if cfg.CountOnly {
+		// Hold back a copy for reservoir sampling; the sample is output at the end
+		if reservoir != nil {
+			reservoir.Add(catEntry{
+				timestamp: timestamp,
+				key:       bytes.Clone(keyBuf),
+				data:      bytes.Clone(dataBuf),
+			})
+			continue
+		}
+		if cfg.Sampler != nil && !cfg.Sampler.Keep(keyBuf) {
 			continue
 		}
 
-		// Display message
-		formattedMessage := cfg.Formatter(timestamp, keyBuf, dataBuf)
-		if _, err := cfg.Output.Write(formattedMessage); err != nil {
+		done, err := output(timestamp, keyBuf, dataBuf)
+		if err != nil || done {
+			return count, err
+		}
+	}
+
+	if reservoir != nil {
+		for _, e := range reservoir.Items() {
+			done, err := output(e.timestamp, e.key, e.data)
+			if err != nil || done {
+				return count, err
+			}
+		}
+	}
+
+	// Output the tail, oldest first
+	if len(tail) == cfg.Tail {
+		tail = append(tail[tailNext:], tail[:tailNext]...)
+	}
+	for _, e := range tail {
+		count++
+		if err := emit(e.timestamp, e.key, e.data); err != nil {
 			return count, err
 		}
 	}
@@ -0,0 +1,328 @@
+package pkg
+
+import (
+	"bufio"
+	"bytes"
+	"container/heap"
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+
+	"github.com/lolocompany/kafka-replay/v2/pkg/transcoder"
+)
+
+const (
+	// DefaultCompactMemory is the default key index size at which compaction
+	// spills to disk
+	DefaultCompactMemory = 256 * 1024 * 1024 // 256MB
+	// compactKeyOverhead approximates the per-key memory of the in-memory index
+	compactKeyOverhead = 64
+)
+
+// CompactConfig holds configuration for the Compact function
+type CompactConfig struct {
+	Input  io.ReadSeeker // Read twice: once to index keys, once to copy the survivors
+	Output io.Writer
+	// MaxMemory bounds the in-memory key index (default DefaultCompactMemory).
+	// Beyond it, the index is spilled to sorted run files in TempDir.
+	MaxMemory int64
+	TempDir   string // Directory for spill files (default os.TempDir())
+}
+
+// CompactResult summarizes a compaction
+type CompactResult struct {
+	Read       int64 // Entries read
+	Written    int64 // Entries written
+	Superseded int64 // Entries replaced by a later entry of the same key
+	Tombstones int64 // Tombstones, which are dropped
+	Keyless    int64 // Entries without a key, which are always kept
+	Spills     int   // Number of key index runs spilled to disk
+}
+
+// Compact reduces a recording to the latest value per key, like Kafka log
+// compaction. An entry with an empty value is a tombstone: it deletes the key
+// and is not written itself. Keys are scoped to their source topic. Entries
+// without a key are kept. Surviving entries keep their timestamps, metadata
+// and original order.
+//
+// Memory is bounded by MaxMemory for the key index plus one bit per input
+// entry; high-cardinality key sets are spilled to disk as sorted runs and
+// merged.
+func Compact(ctx context.Context, cfg CompactConfig) (CompactResult, error) {
+	var result CompactResult
+	if cfg.Input == nil || cfg.Output == nil {
+		return result, errors.New("input and output are required")
+	}
+	if cfg.MaxMemory <= 0 {
+		cfg.MaxMemory = DefaultCompactMemory
+	}
+
+	decoder, err := transcoder.NewDecodeReader(cfg.Input, true)
+	if err != nil {
+		return result, err
+	}
+	reader := newEntryReader(decoder)
+
+	// Pass 1: find the last entry of every key
+	index := make(map[string]int64) // key -> seq<<1 | tombstone
+	var indexBytes int64
+	var runs []*os.File
+	defer func() {
+		for _, f := range runs {
+			f.Close()
+			os.Remove(f.Name())
+		}
+	}()
+	spill := func() error {
+		f, err := writeCompactRun(cfg.TempDir, index)
+		if err != nil {
+			return err
+		}
+		runs = append(runs, f)
+		clear(index)
+		indexBytes = 0
+		return nil
+	}
+
+	keep := &bitset{}
+	var seq int64
+	for ; ; seq++ {
+		if seq%1024 == 0 && ctx.Err() != nil {
+			return result, ctx.Err()
+		}
+		e, err := reader.next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return result, err
+		}
+		result.Read++
+		if e.Key == nil {
+			result.Keyless++
+			keep.set(seq)
+			continue
+		}
+
+		id := compactKey(e.Metadata.Topic, e.Key)
+		entry := seq << 1
+		if len(e.Value) == 0 {
+			entry |= 1
+		}
+		if _, ok := index[id]; !ok {
+			indexBytes += int64(len(id)) + compactKeyOverhead
+		}
+		index[id] = entry
+		if indexBytes >= cfg.MaxMemory {
+			if err := spill(); err != nil {
+				return result, err
+			}
+		}
+	}
+
+	// Mark the survivors: the last entry of each key, unless it is a tombstone
+	survive := func(entry int64) {
+		if entry&1 == 0 {
+			keep.set(entry >> 1)
+		}
+	}
+	if len(runs) == 0 {
+		for _, entry := range index {
+			survive(entry)
+		}
+	} else {
+		if len(index) > 0 {
+			if err := spill(); err != nil {
+				return result, err
+			}
+		}
+		if err := mergeCompactRuns(runs, survive); err != nil {
+			return result, err
+		}
+	}
+	result.Spills = len(runs)
+
+	// Pass 2: copy the survivors in their original order
+	if err := decoder.Reset(); err != nil {
+		return result, err
+	}
+	encoder, err := transcoder.NewEncodeWriter(cfg.Output)
+	if err != nil {
+		return result, err
+	}
+	for i := int64(0); i < seq; i++ {
+		if i%1024 == 0 && ctx.Err() != nil {
+			return result, ctx.Err()
+		}
+		e, err := reader.next()
+		if err != nil {
+			if err == io.EOF {
+				return result, errors.New("input changed during compaction")
+			}
+			return result, err
+		}
+		if !keep.has(i) {
+			if len(e.Value) == 0 {
+				result.Tombstones++
+			} else {
+				result.Superseded++
+			}
+			continue
+		}
+		if err := writeEntry(encoder, e); err != nil {
+			return result, err
+		}
+		result.Written++
+	}
+	return result, nil
+}
+
+// compactKey scopes a message key to its topic
+func compactKey(topic string, key []byte) string {
+	b := binary.AppendUvarint(make([]byte, 0, binary.MaxVarintLen64+len(topic)+len(key)), uint64(len(topic)))
+	b = append(b, topic...)
+	return string(append(b, key...))
+}
+
+// writeCompactRun writes the index sorted by key to a temporary file. Each
+// record is a uvarint key length, the key and a uvarint entry.
+func writeCompactRun(dir string, index map[string]int64) (*os.File, error) {
+	keys := make([]string, 0, len(index))
+	for k := range index {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	f, err := os.CreateTemp(dir, "kafka-replay-compact-*.run")
+	if err != nil {
+		return nil, fmt.Errorf("failed to create spill file: %w", err)
+	}
+	w := bufio.NewWriter(f)
+	var buf []byte
+	for _, k := range keys {
+		buf = binary.AppendUvarint(buf[:0], uint64(len(k)))
+		buf = append(buf, k...)
+		buf = binary.AppendUvarint(buf, uint64(index[k]))
+		if _, err := w.Write(buf); err != nil {
+			break
+		}
+	}
+	if err := w.Flush(); err != nil {
+		f.Close()
+		os.Remove(f.Name())
+		return nil, fmt.Errorf("failed to write spill file: %w", err)
+	}
+	return f, nil
+}
+
+// compactRun reads a spilled run back in key order
+type compactRun struct {
+	r     *bufio.Reader
+	key   []byte
+	entry int64
+}
+
+func (c *compactRun) next() error {
+	n, err := binary.ReadUvarint(c.r)
+	if err != nil {
+		return err
+	}
+	if uint64(cap(c.key)) < n {
+		c.key = make([]byte, n)
+	}
+	c.key = c.key[:n]
+	if _, err := io.ReadFull(c.r, c.key); err != nil {
+		return io.ErrUnexpectedEOF
+	}
+	entry, err := binary.ReadUvarint(c.r)
+	if err != nil {
+		return io.ErrUnexpectedEOF
+	}
+	c.entry = int64(entry)
+	return nil
+}
+
+// runHeap orders runs by their current key
+type runHeap []*compactRun
+
+func (h runHeap) Len() int           { return len(h) }
+func (h runHeap) Less(i, j int) bool { return bytes.Compare(h[i].key, h[j].key) < 0 }
+func (h runHeap) Swap(i, j int)      { h[i], h[j] = h[j], h[i] }
+func (h *runHeap) Push(x any)        { *h = append(*h, x.(*compactRun)) }
+func (h *runHeap) Pop() any {
+	old := *h
+	x := old[len(old)-1]
+	*h = old[:len(old)-1]
+	return x
+}
+
+// mergeCompactRuns merges sorted runs and calls survive with the last entry
+// of every key. Later runs hold later entries, so the largest entry wins.
+func mergeCompactRuns(runs []*os.File, survive func(entry int64)) error {
+	h := make(runHeap, 0, len(runs))
+	for _, f := range runs {
+		if _, err := f.Seek(0, io.SeekStart); err != nil {
+			return err
+		}
+		run := &compactRun{r: bufio.NewReader(f)}
+		if err := run.next(); err != nil {
+			if err == io.EOF {
+				continue
+			}
+			return fmt.Errorf("failed to read spill file: %w", err)
+		}
+		h = append(h, run)
+	}
+	heap.Init(&h)
+
+	var current []byte
+	var last int64
+	started := false
+	for h.Len() > 0 {
+		run := h[0]
+		if !started || !bytes.Equal(run.key, current) {
+			if started {
+				survive(last)
+			}
+			current = append(current[:0], run.key...)
+			last = run.entry
+			started = true
+		} else if run.entry > last {
+			last = run.entry
+		}
+		if err := run.next(); err != nil {
+			if err != io.EOF {
+				return fmt.Errorf("failed to read spill file: %w", err)
+			}
+			heap.Pop(&h)
+			continue
+		}
+		heap.Fix(&h, 0)
+	}
+	if started {
+		survive(last)
+	}
+	return nil
+}
+
+// bitset is a growable set of entry sequence numbers
+type bitset struct {
+	words []uint64
+}
+
+func (b *bitset) set(i int64) {
+	w := int(i / 64)
+	for len(b.words) <= w {
+		b.words = append(b.words, 0)
+	}
+	b.words[w] |= 1 << uint(i%64)
+}
+
+func (b *bitset) has(i int64) bool {
+	w := int(i / 64)
+	return w < len(b.words) && b.words[w]&(1<<uint(i%64)) != 0
+}
@@ -0,0 +1,105 @@
+package pkg
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"testing"
+	"time"
+
+	"github.com/lolocompany/kafka-replay/v2/pkg/transcoder"
+)
+
+// testEntry is a compact description of a recording entry
+type testEntry struct {
+	topic string
+	key   string // "" for no key
+	value string
+	ts    int64 // Unix milliseconds
+}
+
+func encodeEntries(t *testing.T, entries []testEntry) *bytes.Reader {
+	t.Helper()
+	var buf bytes.Buffer
+	enc, err := transcoder.NewEncodeWriter(&buf)
+	if err != nil {
+		t.Fatalf("NewEncodeWriter failed: %v", err)
+	}
+	for i, e := range entries {
+		var key []byte
+		if e.key != "" {
+			key = []byte(e.key)
+		}
+		meta := transcoder.EntryMetadata{Topic: e.topic, Partition: 0, Offset: int64(i)}
+		if _, err := enc.WriteEntry(time.UnixMilli(e.ts), []byte(e.value), key, meta); err != nil {
+			t.Fatalf("WriteEntry failed: %v", err)
+		}
+	}
+	return bytes.NewReader(buf.Bytes())
+}
+
+func decodeEntries(t *testing.T, data []byte) []testEntry {
+	t.Helper()
+	dec, err := transcoder.NewDecodeReader(bytes.NewReader(data), true)
+	if err != nil {
+		t.Fatalf("NewDecodeReader failed: %v", err)
+	}
+	r := newEntryReader(dec)
+	var out []testEntry
+	for {
+		e, err := r.next()
+		if err == io.EOF {
+			return out
+		}
+		if err != nil {
+			t.Fatalf("read failed: %v", err)
+		}
+		out = append(out, testEntry{topic: e.Metadata.Topic, key: string(e.Key), value: string(e.Value), ts: e.Time.UnixMilli()})
+	}
+}
+
+func TestCompact(t *testing.T) {
+	input := []testEntry{
+		{"users", "a", "a1", 1},
+		{"users", "b", "b1", 2},
+		{"users", "", "keyless", 3},
+		{"orders", "a", "order-a", 4}, // Same key, other topic
+		{"users", "a", "a2", 5},
+		{"users", "c", "c1", 6},
+		{"users", "b", "", 7}, // Tombstone
+		{"users", "c", "", 8}, // Tombstone, then a new value
+		{"users", "c", "c2", 9},
+	}
+	want := []testEntry{
+		{"users", "", "keyless", 3},
+		{"orders", "a", "order-a", 4},
+		{"users", "a", "a2", 5},
+		{"users", "c", "c2", 9},
+	}
+
+	for _, maxMemory := range []int64{0, 1} { // In memory, and spilling after every key
+		t.Run(fmt.Sprintf("max-memory=%d", maxMemory), func(t *testing.T) {
+			var out bytes.Buffer
+			res, err := Compact(context.Background(), CompactConfig{
+				Input:     encodeEntries(t, input),
+				Output:    &out,
+				MaxMemory: maxMemory,
+				TempDir:   t.TempDir(),
+			})
+			if err != nil {
+				t.Fatalf("Compact failed: %v", err)
+			}
+			got := decodeEntries(t, out.Bytes())
+			if fmt.Sprint(got) != fmt.Sprint(want) {
+				t.Errorf("got %v\nwant %v", got, want)
+			}
+			if res.Read != 9 || res.Written != 4 || res.Keyless != 1 || res.Tombstones != 2 || res.Superseded != 3 {
+				t.Errorf("unexpected result %+v", res)
+			}
+			if maxMemory == 1 && res.Spills == 0 {
+				t.Errorf("expected spills with a tiny memory limit")
+			}
+		})
+	}
+}
@@ -0,0 +1,53 @@
+package pkg
+
+import (
+	"fmt"
+	"io"
+	"sync"
+	"sync/atomic"
+
+	"github.com/lolocompany/kafka-replay/v2/pkg/transcoder"
+	"github.com/segmentio/kafka-go"
+)
+
+// DeadLetter records messages that could not be written to Kafka, in the
+// recording format, so that they can be inspected and replayed later. It is
+// safe for concurrent use by several targets.
+type DeadLetter struct {
+	mu      sync.Mutex
+	encoder *transcoder.EncodeWriter
+	count   atomic.Int64
+}
+
+// NewDeadLetter writes the file header to w and returns a DeadLetter that
+// appends to it. Closing w is up to the caller.
+func NewDeadLetter(w io.Writer) (*DeadLetter, error) {
+	encoder, err := transcoder.NewEncodeWriter(w)
+	if err != nil {
+		return nil, err
+	}
+	return &DeadLetter{encoder: encoder}, nil
+}
+
+// Add records messages that failed to be written to topic. Messages keep
+// their timestamp and key; the partition and offset are unknown.
+func (d *DeadLetter) Add(topic string, messages []kafka.Message) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	for _, m := range messages {
+		meta := transcoder.EntryMetadata{Topic: topic, Partition: -1, Offset: -1}
+		if m.Topic != "" {
+			meta.Topic = m.Topic
+		}
+		if _, err := d.encoder.WriteEntry(m.Time, m.Value, m.Key, meta); err != nil {
+			return fmt.Errorf("failed to write dead letter: %w", err)
+		}
+		d.count.Add(1)
+	}
+	return nil
+}
+
+// Count returns the number of messages recorded.
+func (d *DeadLetter) Count() int64 {
+	return d.count.Load()
+}
@@ -0,0 +1,468 @@
+package pkg
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash/maphash"
+	"io"
+	"reflect"
+	"sort"
+	"strconv"
+
+	"github.com/lolocompany/kafka-replay/v2/pkg/transcoder"
+)
+
+// DiffMode selects how the entries of two recordings are matched.
+type DiffMode string
+
+const (
+	// DiffPositional compares the Nth entry of one recording with the Nth of the other.
+	DiffPositional DiffMode = "positional"
+	// DiffKeyed matches entries by key and compares the last value of every key.
+	DiffKeyed DiffMode = "keyed"
+	// DiffMultiset ignores order and compares how often each key and value occurs.
+	DiffMultiset DiffMode = "multiset"
+)
+
+const (
+	// DefaultDiffMaxChanges is the default number of changes reported in detail
+	DefaultDiffMaxChanges = 100
+	// diffMaxValueSize is the size at which non-JSON values are truncated in changes
+	diffMaxValueSize = 256
+)
+
+// DiffConfig holds configuration for the Diff function
+type DiffConfig struct {
+	A, B       io.ReadSeeker // Keyed and multiset modes read each input twice
+	Mode       DiffMode      // Default DiffPositional
+	MaxChanges int           // Changes reported in detail (default DefaultDiffMaxChanges); all are counted
+}
+
+// FieldDiff is a difference in a single JSON field. Before is nil for added
+// fields and After is nil for removed ones.
+type FieldDiff struct {
+	Path   string          `json:"path"`
+	Before json.RawMessage `json:"before,omitempty"`
+	After  json.RawMessage `json:"after,omitempty"`
+}
+
+// DiffChange is a single difference between the recordings
+type DiffChange struct {
+	Kind     string      `json:"kind"`               // added, removed or changed
+	Position *int64      `json:"position,omitempty"` // Entry index (positional mode)
+	Key      string      `json:"key,omitempty"`
+	Count    int64       `json:"count,omitempty"`  // Number of occurrences (multiset mode)
+	Fields   []FieldDiff `json:"fields,omitempty"` // Field-level changes of JSON values
+	Before   string      `json:"before,omitempty"` // Non-JSON value before (truncated)
+	After    string      `json:"after,omitempty"`  // Non-JSON value after (truncated)
+}
+
+// DiffResult summarizes the differences between two recordings
+type DiffResult struct {
+	Mode      DiffMode     `json:"mode"`
+	EntriesA  int64        `json:"entriesA"`
+	EntriesB  int64        `json:"entriesB"`
+	Equal     int64        `json:"equal"`
+	Added     int64        `json:"added"`
+	Removed   int64        `json:"removed"`
+	Changed   int64        `json:"changed"`
+	Keyless   int64        `json:"keyless,omitempty"` // Entries without a key, ignored in keyed mode
+	Changes   []DiffChange `json:"changes"`           // The first MaxChanges changes
+	Truncated bool         `json:"truncated"`         // More changes than MaxChanges
+}
+
+// Identical reports whether no differences were found.
+func (r DiffResult) Identical() bool {
+	return r.Added == 0 && r.Removed == 0 && r.Changed == 0
+}
+
+// Diff compares two recordings. Timestamps and source metadata are ignored;
+// entries are compared by key and value. Changed JSON values are reported
+// field by field.
+func Diff(ctx context.Context, cfg DiffConfig) (DiffResult, error) {
+	if cfg.A == nil || cfg.B == nil {
+		return DiffResult{}, errors.New("two inputs are required")
+	}
+	if cfg.Mode == "" {
+		cfg.Mode = DiffPositional
+	}
+	if cfg.MaxChanges <= 0 {
+		cfg.MaxChanges = DefaultDiffMaxChanges
+	}
+	a, err := transcoder.NewDecodeReader(cfg.A, true)
+	if err != nil {
+		return DiffResult{}, fmt.Errorf("first input: %w", err)
+	}
+	b, err := transcoder.NewDecodeReader(cfg.B, true)
+	if err != nil {
+		return DiffResult{}, fmt.Errorf("second input: %w", err)
+	}
+
+	d := &differ{ctx: ctx, cfg: cfg, a: a, b: b, seed: maphash.MakeSeed()}
+	d.result = DiffResult{Mode: cfg.Mode, Changes: []DiffChange{}}
+	switch cfg.Mode {
+	case DiffPositional:
+		err = d.positional()
+	case DiffKeyed:
+		err = d.keyed()
+	case DiffMultiset:
+		err = d.multiset()
+	default:
+		return DiffResult{}, fmt.Errorf("unsupported diff mode %q (use %s, %s or %s)", cfg.Mode, DiffPositional, DiffKeyed, DiffMultiset)
+	}
+	return d.result, err
+}
+
+// differ holds the state of a single Diff
+type differ struct {
+	ctx    context.Context
+	cfg    DiffConfig
+	a, b   *transcoder.DecodeReader
+	seed   maphash.Seed
+	result DiffResult
+}
+
+// add records a change, keeping the first MaxChanges in detail
+func (d *differ) add(c DiffChange) {
+	if len(d.result.Changes) < d.cfg.MaxChanges {
+		d.result.Changes = append(d.result.Changes, c)
+	} else {
+		d.result.Truncated = true
+	}
+}
+
+// detailed reports whether another change would still be kept in detail
+func (d *differ) detailed() bool {
+	return len(d.result.Changes) < d.cfg.MaxChanges
+}
+
+func (d *differ) hash(key, value []byte) uint64 {
+	var h maphash.Hash
+	h.SetSeed(d.seed)
+	h.WriteString(strconv.Itoa(len(key)))
+	h.Write(key)
+	h.Write(value)
+	return h.Sum64()
+}
+
+// scan calls fn for every entry of decoder, from the start
+func (d *differ) scan(decoder *transcoder.DecodeReader, fn func(e Entry)) error {
+	if err := decoder.Reset(); err != nil {
+		return err
+	}
+	r := newEntryReader(decoder)
+	for n := 0; ; n++ {
+		if n%1024 == 0 && d.ctx.Err() != nil {
+			return d.ctx.Err()
+		}
+		e, err := r.next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		fn(e)
+	}
+}
+
+func (d *differ) positional() error {
+	ra, rb := newEntryReader(d.a), newEntryReader(d.b)
+	for i := int64(0); ; i++ {
+		if i%1024 == 0 && d.ctx.Err() != nil {
+			return d.ctx.Err()
+		}
+		ea, errA := ra.next()
+		if errA != nil && errA != io.EOF {
+			return fmt.Errorf("first input: %w", errA)
+		}
+		eb, errB := rb.next()
+		if errB != nil && errB != io.EOF {
+			return fmt.Errorf("second input: %w", errB)
+		}
+		if errA == io.EOF && errB == io.EOF {
+			return nil
+		}
+		pos := i
+		switch {
+		case errB == io.EOF:
+			d.result.EntriesA++
+			d.result.Removed++
+			d.add(DiffChange{Kind: "removed", Position: &pos, Key: string(ea.Key), Before: truncateValue(ea.Value)})
+		case errA == io.EOF:
+			d.result.EntriesB++
+			d.result.Added++
+			d.add(DiffChange{Kind: "added", Position: &pos, Key: string(eb.Key), After: truncateValue(eb.Value)})
+		default:
+			d.result.EntriesA++
+			d.result.EntriesB++
+			if bytes.Equal(ea.Key, eb.Key) && bytes.Equal(ea.Value, eb.Value) {
+				d.result.Equal++
+				continue
+			}
+			d.result.Changed++
+			if d.detailed() {
+				c := changeOf(ea.Value, eb.Value)
+				c.Position, c.Key = &pos, string(ea.Key)
+				if !bytes.Equal(ea.Key, eb.Key) {
+					c.Fields = append([]FieldDiff{{Path: "(key)", Before: jsonString(ea.Key), After: jsonString(eb.Key)}}, c.Fields...)
+				}
+				d.add(c)
+			} else {
+				d.result.Truncated = true
+			}
+		}
+	}
+}
+
+// keyState is the last value hash and the number of entries of a key
+type keyState struct {
+	hash  uint64
+	count int64
+}
+
+func (d *differ) keyed() error {
+	index := func(decoder *transcoder.DecodeReader, entries *int64) (map[string]keyState, error) {
+		keys := make(map[string]keyState)
+		err := d.scan(decoder, func(e Entry) {
+			*entries++
+			if e.Key == nil {
+				d.result.Keyless++
+				return
+			}
+			s := keys[string(e.Key)]
+			keys[string(e.Key)] = keyState{hash: d.hash(nil, e.Value), count: s.count + 1}
+		})
+		return keys, err
+	}
+	keysA, err := index(d.a, &d.result.EntriesA)
+	if err != nil {
+		return fmt.Errorf("first input: %w", err)
+	}
+	keysB, err := index(d.b, &d.result.EntriesB)
+	if err != nil {
+		return fmt.Errorf("second input: %w", err)
+	}
+
+	// Classify keys in sorted order so the detailed changes are deterministic
+	all := make([]string, 0, len(keysA)+len(keysB))
+	for k := range keysA {
+		all = append(all, k)
+	}
+	for k := range keysB {
+		if _, ok := keysA[k]; !ok {
+			all = append(all, k)
+		}
+	}
+	sort.Strings(all)
+	detail := make(map[string]*DiffChange)
+	var order []string
+	for _, k := range all {
+		sa, inA := keysA[k]
+		sb, inB := keysB[k]
+		var kind string
+		switch {
+		case !inB:
+			kind = "removed"
+			d.result.Removed++
+		case !inA:
+			kind = "added"
+			d.result.Added++
+		case sa.hash != sb.hash:
+			kind = "changed"
+			d.result.Changed++
+		default:
+			d.result.Equal++
+			continue
+		}
+		if len(order) < d.cfg.MaxChanges {
+			detail[k] = &DiffChange{Kind: kind, Key: k}
+			order = append(order, k)
+		} else {
+			d.result.Truncated = true
+		}
+	}
+	if len(detail) == 0 {
+		return nil
+	}
+
+	// Second pass: fetch the last values of the keys reported in detail
+	before := make(map[string][]byte)
+	after := make(map[string][]byte)
+	collect := func(values map[string][]byte) func(e Entry) {
+		return func(e Entry) {
+			if _, ok := detail[string(e.Key)]; ok && e.Key != nil {
+				values[string(e.Key)] = append(values[string(e.Key)][:0], e.Value...)
+			}
+		}
+	}
+	if err := d.scan(d.a, collect(before)); err != nil {
+		return fmt.Errorf("first input: %w", err)
+	}
+	if err := d.scan(d.b, collect(after)); err != nil {
+		return fmt.Errorf("second input: %w", err)
+	}
+	for _, k := range order {
+		c := detail[k]
+		switch c.Kind {
+		case "removed":
+			c.Before = truncateValue(before[k])
+		case "added":
+			c.After = truncateValue(after[k])
+		default:
+			changed := changeOf(before[k], after[k])
+			c.Fields, c.Before, c.After = changed.Fields, changed.Before, changed.After
+		}
+		d.add(*c)
+	}
+	return nil
+}
+
+func (d *differ) multiset() error {
+	// Occurrences in B minus occurrences in A, per key and value
+	counts := make(map[uint64]int64)
+	if err := d.scan(d.a, func(e Entry) {
+		d.result.EntriesA++
+		counts[d.hash(e.Key, e.Value)]--
+	}); err != nil {
+		return fmt.Errorf("first input: %w", err)
+	}
+	if err := d.scan(d.b, func(e Entry) {
+		d.result.EntriesB++
+		counts[d.hash(e.Key, e.Value)]++
+	}); err != nil {
+		return fmt.Errorf("second input: %w", err)
+	}
+	for _, n := range counts {
+		if n > 0 {
+			d.result.Added += n
+		} else {
+			d.result.Removed -= n
+		}
+	}
+	d.result.Equal = d.result.EntriesA - d.result.Removed
+	if d.result.Added == 0 && d.result.Removed == 0 {
+		return nil
+	}
+
+	// Second pass: report differing entries in the order they first occur
+	report := func(kind string, surplus func(n int64) int64) func(e Entry) {
+		return func(e Entry) {
+			h := d.hash(e.Key, e.Value)
+			n := surplus(counts[h])
+			if n <= 0 {
+				return
+			}
+			delete(counts, h)
+			if !d.detailed() {
+				d.result.Truncated = true
+				return
+			}
+			c := DiffChange{Kind: kind, Key: string(e.Key), Count: n}
+			if kind == "removed" {
+				c.Before = truncateValue(e.Value)
+			} else {
+				c.After = truncateValue(e.Value)
+			}
+			d.add(c)
+		}
+	}
+	if err := d.scan(d.a, report("removed", func(n int64) int64 { return -n })); err != nil {
+		return fmt.Errorf("first input: %w", err)
+	}
+	if err := d.scan(d.b, report("added", func(n int64) int64 { return n })); err != nil {
+		return fmt.Errorf("second input: %w", err)
+	}
+	return nil
+}
+
+// changeOf describes a changed value: field by field if both values are JSON
+func changeOf(before, after []byte) DiffChange {
+	c := DiffChange{Kind: "changed"}
+	var a, b any
+	if json.Unmarshal(before, &a) == nil && json.Unmarshal(after, &b) == nil {
+		c.Fields = diffJSON("$", a, b, nil)
+		return c
+	}
+	c.Before, c.After = truncateValue(before), truncateValue(after)
+	return c
+}
+
+// diffJSON appends the differences between two decoded JSON values
+func diffJSON(path string, a, b any, diffs []FieldDiff) []FieldDiff {
+	switch av := a.(type) {
+	case map[string]any:
+		bv, ok := b.(map[string]any)
+		if !ok {
+			break
+		}
+		keys := make([]string, 0, len(av)+len(bv))
+		for k := range av {
+			keys = append(keys, k)
+		}
+		for k := range bv {
+			if _, ok := av[k]; !ok {
+				keys = append(keys, k)
+			}
+		}
+		sort.Strings(keys)
+		for _, k := range keys {
+			x, inA := av[k]
+			y, inB := bv[k]
+			p := path + "." + k
+			switch {
+			case !inB:
+				diffs = append(diffs, FieldDiff{Path: p, Before: mustJSON(x)})
+			case !inA:
+				diffs = append(diffs, FieldDiff{Path: p, After: mustJSON(y)})
+			default:
+				diffs = diffJSON(p, x, y, diffs)
+			}
+		}
+		return diffs
+	case []any:
+		bv, ok := b.([]any)
+		if !ok {
+			break
+		}
+		for i := 0; i < max(len(av), len(bv)); i++ {
+			p := fmt.Sprintf("%s[%d]", path, i)
+			switch {
+			case i >= len(bv):
+				diffs = append(diffs, FieldDiff{Path: p, Before: mustJSON(av[i])})
+			case i >= len(av):
+				diffs = append(diffs, FieldDiff{Path: p, After: mustJSON(bv[i])})
+			default:
+				diffs = diffJSON(p, av[i], bv[i], diffs)
+			}
+		}
+		return diffs
+	}
+	if !reflect.DeepEqual(a, b) {
+		diffs = append(diffs, FieldDiff{Path: path, Before: mustJSON(a), After: mustJSON(b)})
+	}
+	return diffs
+}
+
+func mustJSON(v any) json.RawMessage {
+	b, err := json.Marshal(v)
+	if err != nil {
+		return json.RawMessage("null")
+	}
+	return b
+}
+
+func jsonString(b []byte) json.RawMessage {
+	return mustJSON(string(b))
+}
+
+// truncateValue returns a printable prefix of a value
+func truncateValue(v []byte) string {
+	if len(v) > diffMaxValueSize {
+		return string(v[:diffMaxValueSize]) + "..."
+	}
+	return string(v)
+}
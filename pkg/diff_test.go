@@ -0,0 +1,71 @@
+package pkg
+
+import (
+	"context"
+	"testing"
+)
+
+func TestDiff_Positional(t *testing.T) {
+	a := []testEntry{{"t", "k1", `{"id":1,"tags":["a"]}`, 1}, {"t", "k2", "same", 2}, {"t", "k3", "gone", 3}}
+	b := []testEntry{{"t", "k1", `{"id":2,"tags":["a","b"],"new":true}`, 5}, {"t", "k2", "same", 6}}
+
+	res, err := Diff(context.Background(), DiffConfig{A: encodeEntries(t, a), B: encodeEntries(t, b)})
+	if err != nil {
+		t.Fatalf("Diff failed: %v", err)
+	}
+	if res.Equal != 1 || res.Changed != 1 || res.Removed != 1 || res.Added != 0 || res.Identical() {
+		t.Fatalf("unexpected result %+v", res)
+	}
+	changed := res.Changes[0]
+	want := map[string]string{"$.id": `1 -> 2`, "$.new": ` -> true`, "$.tags[1]": ` -> "b"`}
+	if len(changed.Fields) != len(want) {
+		t.Fatalf("fields = %+v, want %v", changed.Fields, want)
+	}
+	for _, f := range changed.Fields {
+		if got := string(f.Before) + " -> " + string(f.After); want[f.Path] != got {
+			t.Errorf("%s: got %q, want %q", f.Path, got, want[f.Path])
+		}
+	}
+	if res.Changes[1].Kind != "removed" || *res.Changes[1].Position != 2 || res.Changes[1].Before != "gone" {
+		t.Errorf("unexpected removal %+v", res.Changes[1])
+	}
+}
+
+func TestDiff_Keyed(t *testing.T) {
+	a := []testEntry{{"t", "k1", "v1", 1}, {"t", "k1", "v2", 2}, {"t", "k2", "x", 3}, {"t", "k3", "y", 4}, {"t", "", "keyless", 5}}
+	b := []testEntry{{"t", "k3", "y", 1}, {"t", "k1", "v3", 2}, {"t", "k4", "z", 3}}
+
+	res, err := Diff(context.Background(), DiffConfig{A: encodeEntries(t, a), B: encodeEntries(t, b), Mode: DiffKeyed})
+	if err != nil {
+		t.Fatalf("Diff failed: %v", err)
+	}
+	if res.Equal != 1 || res.Changed != 1 || res.Removed != 1 || res.Added != 1 || res.Keyless != 1 {
+		t.Fatalf("unexpected result %+v", res)
+	}
+	// Sorted by key: k1 changed, k2 removed, k4 added
+	c := res.Changes
+	if len(c) != 3 || c[0].Key != "k1" || c[0].Before != "v2" || c[0].After != "v3" || c[1].Kind != "removed" || c[2].Kind != "added" || c[2].After != "z" {
+		t.Errorf("unexpected changes %+v", c)
+	}
+}
+
+func TestDiff_Multiset(t *testing.T) {
+	a := []testEntry{{"t", "k", "1", 1}, {"t", "k", "2", 2}, {"t", "k", "2", 3}}
+	b := []testEntry{{"t", "k", "2", 1}, {"t", "k", "1", 2}, {"t", "k", "3", 3}}
+
+	res, err := Diff(context.Background(), DiffConfig{A: encodeEntries(t, a), B: encodeEntries(t, b), Mode: DiffMultiset, MaxChanges: 1})
+	if err != nil {
+		t.Fatalf("Diff failed: %v", err)
+	}
+	if res.Equal != 2 || res.Removed != 1 || res.Added != 1 || !res.Truncated || len(res.Changes) != 1 {
+		t.Fatalf("unexpected result %+v", res)
+	}
+	if c := res.Changes[0]; c.Kind != "removed" || c.Before != "2" || c.Count != 1 {
+		t.Errorf("unexpected change %+v", c)
+	}
+
+	same, err := Diff(context.Background(), DiffConfig{A: encodeEntries(t, a), B: encodeEntries(t, a[:0:0]), Mode: DiffMultiset})
+	if err != nil || same.Removed != 3 {
+		t.Errorf("expected 3 removals against an empty recording, got %+v (%v)", same, err)
+	}
+}
@@ -0,0 +1,68 @@
+package pkg
+
+import (
+	"errors"
+	"time"
+
+	"github.com/lolocompany/kafka-replay/v2/pkg/transcoder"
+)
+
+// Entry is a single decoded entry of a recording
+type Entry struct {
+	Time     time.Time
+	Key      []byte
+	Value    []byte
+	Metadata transcoder.EntryMetadata
+}
+
+// entryReader reads whole entries from a DecodeReader into buffers that grow
+// to fit the largest entry, for file tools that have no fixed size limit
+type entryReader struct {
+	decoder *transcoder.DecodeReader
+	key     []byte
+	data    []byte
+}
+
+func newEntryReader(decoder *transcoder.DecodeReader) *entryReader {
+	return &entryReader{
+		decoder: decoder,
+		key:     make([]byte, keyPoolDefaultCapBytes),
+		data:    make([]byte, valuePoolDefaultCapBytes),
+	}
+}
+
+// next returns the next entry. Key and Value are only valid until the
+// following call; callers that keep them must copy.
+func (r *entryReader) next() (Entry, error) {
+	for {
+		timestamp, keyLen, dataLen, err := r.decoder.Read(r.key, r.data)
+		var tooSmall *transcoder.BufferTooSmallError
+		if errors.As(err, &tooSmall) {
+			if cap(r.key) < tooSmall.KeyNeeded {
+				r.key = make([]byte, tooSmall.KeyNeeded)
+			}
+			if cap(r.data) < tooSmall.DataNeeded {
+				r.data = make([]byte, tooSmall.DataNeeded)
+			}
+			continue
+		}
+		if err != nil {
+			return Entry{}, err
+		}
+		e := Entry{
+			Time:     timestamp,
+			Value:    r.data[:dataLen],
+			Metadata: r.decoder.Metadata(),
+		}
+		if keyLen > 0 {
+			e.Key = r.key[:keyLen]
+		}
+		return e, nil
+	}
+}
+
+// writeEntry writes e to encoder, keeping its source metadata
+func writeEntry(encoder *transcoder.EncodeWriter, e Entry) error {
+	_, err := encoder.WriteEntry(e.Time, e.Value, e.Key, e.Metadata)
+	return err
+}
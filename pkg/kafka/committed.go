@@ -0,0 +1,221 @@
+package kafka
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"sort"
+	"strings"
+	"time"
+
+	kafkago "github.com/segmentio/kafka-go"
+	"github.com/segmentio/kafka-go/protocol"
+	fetchAPI "github.com/segmentio/kafka-go/protocol/fetch"
+)
+
+// IsolationLevel controls which transactional records are read.
+type IsolationLevel int
+
+const (
+	// ReadUncommitted reads all records, including aborted transactional
+	// records and transaction markers.
+	ReadUncommitted IsolationLevel = 0
+	// ReadCommitted reads only committed records and skips transaction markers.
+	ReadCommitted IsolationLevel = 1
+)
+
+// String returns the name used on the command line.
+func (l IsolationLevel) String() string {
+	if l == ReadCommitted {
+		return "read_committed"
+	}
+	return "read_uncommitted"
+}
+
+// ParseIsolationLevel parses "read_uncommitted" or "read_committed".
+func ParseIsolationLevel(s string) (IsolationLevel, error) {
+	switch strings.ToLower(strings.TrimSpace(s)) {
+	case "", "read_uncommitted":
+		return ReadUncommitted, nil
+	case "read_committed":
+		return ReadCommitted, nil
+	default:
+		return ReadUncommitted, fmt.Errorf("invalid isolation level %q (use read_uncommitted or read_committed)", s)
+	}
+}
+
+const (
+	// committedFetchMaxBytes limits the size of a single read_committed fetch
+	committedFetchMaxBytes = 10 * 1024 * 1024 // 10MB
+	// committedFetchMaxWait is how long the broker waits for new data
+	committedFetchMaxWait = 500 * time.Millisecond
+	// controlTypeAbort is the control record type of an abort marker
+	controlTypeAbort = 0
+)
+
+// committedFetch is the decoded result of a read_committed fetch
+type committedFetch struct {
+	messages []Message
+	next     int64 // Offset to fetch next
+	aborted  int64 // Records of aborted transactions that were skipped
+	control  int64 // Transaction markers that were skipped
+}
+
+// fetchCommitted fetches a partition with read_committed isolation.
+//
+// kafka-go's Conn and Reader pass aborted transactional records and
+// transaction markers through as ordinary messages, so the fetch response is
+// decoded here. The broker only returns data up to the last stable offset,
+// together with the aborted transactions in that range; records of those
+// transactions are dropped until their abort marker.
+func fetchCommitted(ctx context.Context, rt kafkago.RoundTripper, addr net.Addr, topic string, partition int, offset int64) (committedFetch, error) {
+	result := committedFetch{next: offset}
+
+	res, err := rt.RoundTrip(ctx, addr, &fetchAPI.Request{
+		ReplicaID:      -1,
+		MaxWaitTime:    int32(committedFetchMaxWait / time.Millisecond),
+		MinBytes:       1,
+		MaxBytes:       committedFetchMaxBytes,
+		IsolationLevel: int8(ReadCommitted),
+		SessionID:      -1,
+		SessionEpoch:   -1,
+		Topics: []fetchAPI.RequestTopic{{
+			Topic: topic,
+			Partitions: []fetchAPI.RequestPartition{{
+				Partition:          int32(partition),
+				CurrentLeaderEpoch: -1,
+				FetchOffset:        offset,
+				LogStartOffset:     -1,
+				PartitionMaxBytes:  committedFetchMaxBytes,
+			}},
+		}},
+	})
+	if err != nil {
+		return result, fmt.Errorf("failed to fetch %s/%d: %w", topic, partition, err)
+	}
+	fetchRes, ok := res.(*fetchAPI.Response)
+	if !ok {
+		return result, fmt.Errorf("unexpected fetch response type %T", res)
+	}
+	if fetchRes.ErrorCode != 0 {
+		return result, fmt.Errorf("failed to fetch %s/%d: %w", topic, partition, kafkago.Error(fetchRes.ErrorCode))
+	}
+
+	var p *fetchAPI.ResponsePartition
+	for i := range fetchRes.Topics {
+		for j := range fetchRes.Topics[i].Partitions {
+			if fetchRes.Topics[i].Topic == topic && int(fetchRes.Topics[i].Partitions[j].Partition) == partition {
+				p = &fetchRes.Topics[i].Partitions[j]
+			}
+		}
+	}
+	if p == nil {
+		return result, fmt.Errorf("fetch response for %s/%d is missing the partition", topic, partition)
+	}
+	if p.ErrorCode != 0 {
+		return result, fmt.Errorf("failed to fetch %s/%d: %w", topic, partition, kafkago.Error(p.ErrorCode))
+	}
+	if p.RecordSet.Records == nil {
+		return result, nil
+	}
+	if closer, ok := p.RecordSet.Records.(io.Closer); ok {
+		defer closer.Close()
+	}
+
+	batches := []protocol.RecordReader{p.RecordSet.Records}
+	if stream, ok := p.RecordSet.Records.(*protocol.RecordStream); ok {
+		batches = stream.Records
+	}
+
+	abortedTxns := append([]fetchAPI.ResponseTransaction(nil), p.AbortedTransactions...)
+	sort.Slice(abortedTxns, func(i, j int) bool { return abortedTxns[i].FirstOffset < abortedTxns[j].FirstOffset })
+	abortedProducers := make(map[int64]bool)
+
+	for _, batch := range batches {
+		// Transactions become aborted from their first offset until their abort marker
+		if b, ok := batch.(interface{ Offset() int64 }); ok {
+			for len(abortedTxns) > 0 && abortedTxns[0].FirstOffset <= b.Offset() {
+				abortedProducers[abortedTxns[0].ProducerID] = true
+				abortedTxns = abortedTxns[1:]
+			}
+		}
+
+		switch b := batch.(type) {
+		case *protocol.ControlBatch:
+			for {
+				cr, err := b.ReadControlRecord()
+				if err != nil {
+					if errors.Is(err, io.EOF) {
+						break
+					}
+					return result, fmt.Errorf("failed to read transaction marker: %w", err)
+				}
+				if cr.Offset >= offset {
+					result.control++
+					result.next = cr.Offset + 1
+				}
+				if cr.Type == controlTypeAbort {
+					delete(abortedProducers, b.ProducerID)
+				}
+			}
+		default:
+			aborted := false
+			if rb, ok := b.(*protocol.RecordBatch); ok {
+				aborted = rb.Attributes.Transactional() && abortedProducers[rb.ProducerID]
+			}
+			for {
+				r, err := batch.ReadRecord()
+				if err != nil {
+					if errors.Is(err, io.EOF) {
+						break
+					}
+					return result, fmt.Errorf("failed to read record: %w", err)
+				}
+				msg, err := readRecord(topic, partition, r)
+				if err != nil {
+					return result, err
+				}
+				// Batches may start before the requested offset
+				if msg.Offset < offset {
+					continue
+				}
+				result.next = msg.Offset + 1
+				if aborted {
+					result.aborted++
+					continue
+				}
+				result.messages = append(result.messages, msg)
+			}
+		}
+	}
+	return result, nil
+}
+
+// readRecord copies a fetched record into a Message and releases its buffers
+func readRecord(topic string, partition int, r *protocol.Record) (Message, error) {
+	msg := Message{Topic: topic, Partition: partition, Offset: r.Offset, Time: r.Time}
+	if r.Key != nil {
+		key, err := protocol.ReadAll(r.Key)
+		r.Key.Close()
+		if err != nil {
+			return msg, fmt.Errorf("failed to read record key: %w", err)
+		}
+		if len(key) > 0 {
+			msg.Key = key
+		}
+	}
+	msg.Value = []byte{}
+	if r.Value != nil {
+		value, err := protocol.ReadAll(r.Value)
+		r.Value.Close()
+		if err != nil {
+			return msg, fmt.Errorf("failed to read record value: %w", err)
+		}
+		if value != nil {
+			msg.Value = value
+		}
+	}
+	return msg, nil
+}
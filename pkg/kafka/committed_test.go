@@ -0,0 +1,109 @@
+package kafka
+
+import (
+	"context"
+	"net"
+	"testing"
+
+	"github.com/segmentio/kafka-go/protocol"
+	fetchAPI "github.com/segmentio/kafka-go/protocol/fetch"
+)
+
+// fakeFetch is a RoundTripper returning a fixed fetch response
+type fakeFetch struct {
+	partition fetchAPI.ResponsePartition
+}
+
+func (f *fakeFetch) RoundTrip(ctx context.Context, addr net.Addr, req protocol.Message) (protocol.Message, error) {
+	return &fetchAPI.Response{Topics: []fetchAPI.ResponseTopic{{
+		Topic:      "orders",
+		Partitions: []fetchAPI.ResponsePartition{f.partition},
+	}}}, nil
+}
+
+func records(offsets ...int64) protocol.RecordReader {
+	rs := make([]protocol.Record, len(offsets))
+	for i, o := range offsets {
+		rs[i] = protocol.Record{Offset: o, Value: protocol.NewBytes([]byte{byte(o)})}
+	}
+	return protocol.NewRecordReader(rs...)
+}
+
+func marker(offset int64, controlType int16) protocol.RecordReader {
+	cr := protocol.ControlRecord{Offset: offset, Type: controlType}
+	return protocol.NewRecordReader(cr.Record())
+}
+
+func TestFetchCommitted_DropsAbortedAndMarkers(t *testing.T) {
+	const committedPID, abortedPID = 1, 2
+	rt := &fakeFetch{partition: fetchAPI.ResponsePartition{
+		AbortedTransactions: []fetchAPI.ResponseTransaction{{ProducerID: abortedPID, FirstOffset: 12}},
+		RecordSet: protocol.RecordSet{Records: &protocol.RecordStream{Records: []protocol.RecordReader{
+			// Plain records; 9 is before the requested offset
+			&protocol.RecordBatch{BaseOffset: 9, Records: records(9, 10, 11)},
+			// Aborted transaction interleaved with a committed one
+			&protocol.RecordBatch{BaseOffset: 12, ProducerID: abortedPID, Attributes: protocol.Transactional, Records: records(12, 13)},
+			&protocol.RecordBatch{BaseOffset: 14, ProducerID: committedPID, Attributes: protocol.Transactional, Records: records(14)},
+			&protocol.ControlBatch{BaseOffset: 15, ProducerID: abortedPID, Records: marker(15, controlTypeAbort)},
+			&protocol.ControlBatch{BaseOffset: 16, ProducerID: committedPID, Records: marker(16, 1)},
+			// The producer's next transaction is not aborted
+			&protocol.RecordBatch{BaseOffset: 17, ProducerID: abortedPID, Attributes: protocol.Transactional, Records: records(17)},
+		}}},
+	}}
+
+	res, err := fetchCommitted(context.Background(), rt, nil, "orders", 0, 10)
+	if err != nil {
+		t.Fatalf("fetchCommitted failed: %v", err)
+	}
+
+	var got []int64
+	for _, m := range res.messages {
+		got = append(got, m.Offset)
+		if m.Topic != "orders" || m.Value[0] != byte(m.Offset) {
+			t.Errorf("unexpected message %+v", m)
+		}
+	}
+	want := []int64{10, 11, 14, 17}
+	if len(got) != len(want) {
+		t.Fatalf("offsets = %v, want %v", got, want)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Fatalf("offsets = %v, want %v", got, want)
+		}
+	}
+	if res.aborted != 2 || res.control != 2 {
+		t.Errorf("aborted=%d control=%d, want 2 and 2", res.aborted, res.control)
+	}
+	if res.next != 18 {
+		t.Errorf("next = %d, want 18", res.next)
+	}
+}
+
+func TestFetchCommitted_EmptyAdvancesPastMarkers(t *testing.T) {
+	rt := &fakeFetch{partition: fetchAPI.ResponsePartition{
+		RecordSet: protocol.RecordSet{Records: &protocol.RecordStream{Records: []protocol.RecordReader{
+			&protocol.ControlBatch{BaseOffset: 5, ProducerID: 1, Records: marker(5, 1)},
+		}}},
+	}}
+
+	res, err := fetchCommitted(context.Background(), rt, nil, "orders", 0, 5)
+	if err != nil {
+		t.Fatalf("fetchCommitted failed: %v", err)
+	}
+	if len(res.messages) != 0 || res.next != 6 || res.control != 1 {
+		t.Errorf("expected only a skipped marker, got %d messages, next=%d, control=%d", len(res.messages), res.next, res.control)
+	}
+}
+
+func TestParseIsolationLevel(t *testing.T) {
+	if l, err := ParseIsolationLevel("read_committed"); err != nil || l != ReadCommitted {
+		t.Errorf("read_committed: got %v, %v", l, err)
+	}
+	if l, err := ParseIsolationLevel(""); err != nil || l != ReadUncommitted {
+		t.Errorf("empty: got %v, %v", l, err)
+	}
+	if _, err := ParseIsolationLevel("serializable"); err == nil {
+		t.Errorf("expected error for unknown level")
+	}
+}
@@ -4,7 +4,9 @@ import (
 	"context"
 	"fmt"
 	"io"
+	"net"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	kafkago "github.com/segmentio/kafka-go"
@@ -22,6 +24,65 @@ type Consumer struct {
 	mu    sync.Mutex
 	// usingGroup indicates whether we're using consumer group mode
 	usingGroup bool
+	// manualCommit disables the commit on read in consumer group mode;
+	// offsets are only committed through Commit
+	manualCommit bool
+	// topic and partition the consumer reads from (partition is -1 in group mode)
+	topic     string
+	partition int
+	// isolation, addr and buffered are used for read_committed reads in direct
+	// partition mode, which bypass the Conn's batch reader
+	isolation IsolationLevel
+	addr      net.Addr
+	buffered  []Message
+	// aborted and control count records skipped by read_committed reads
+	aborted atomic.Int64
+	control atomic.Int64
+}
+
+// Message is a single message read from Kafka together with its source position.
+type Message struct {
+	Topic     string
+	Partition int
+	Offset    int64
+	Time      time.Time
+	Key       []byte // nil if the message has no key
+	Value     []byte
+}
+
+// SetIsolationLevel selects which transactional records are read. It must be
+// called before the first read.
+// Note: ReadCommitted only works in direct partition mode (no consumer group);
+// kafka-go's group reader does not drop aborted records.
+func (c *Consumer) SetIsolationLevel(level IsolationLevel) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.usingGroup && level == ReadCommitted {
+		return fmt.Errorf("read_committed is not supported when using consumer groups")
+	}
+	c.isolation = level
+	return nil
+}
+
+// IsolationStats returns the number of aborted transactional records and
+// transaction markers skipped so far by read_committed reads.
+func (c *Consumer) IsolationStats() (aborted int64, control int64) {
+	return c.aborted.Load(), c.control.Load()
+}
+
+// Topic returns the topic the consumer reads from.
+func (c *Consumer) Topic() string {
+	return c.topic
+}
+
+// Partition returns the partition the consumer reads from, or -1 when
+// partitions are assigned by a consumer group.
+func (c *Consumer) Partition() int {
+	if c.usingGroup {
+		return -1
+	}
+	return c.partition
 }
 
 // SetOffset sets the offset to a specific value.
@@ -35,10 +96,131 @@ func (c *Consumer) SetOffset(offset int64) error {
 		return fmt.Errorf("SetOffset is not supported when using consumer groups; offsets are managed automatically")
 	}
 
+	c.buffered = nil
 	_, err := c.conn.Seek(offset, kafkago.SeekStart)
 	return err
 }
 
+// SeekToTime positions the consumer at the first message whose timestamp is
+// equal to or after t, using Kafka's ListOffsets-by-timestamp lookup. If no
+// such message exists yet, the consumer is positioned at the end of the partition.
+// Note: This only works in direct partition mode (no consumer group).
+func (c *Consumer) SeekToTime(t time.Time) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.usingGroup {
+		return fmt.Errorf("SeekToTime is not supported when using consumer groups; offsets are managed automatically")
+	}
+
+	c.buffered = nil
+	offset, err := c.conn.ReadOffset(t)
+	if err != nil {
+		return fmt.Errorf("failed to look up offset for %s: %w", t.Format(time.RFC3339), err)
+	}
+	if offset < 0 {
+		_, err = c.conn.Seek(0, kafkago.SeekEnd)
+		return err
+	}
+	_, err = c.conn.Seek(offset, kafkago.SeekAbsolute)
+	return err
+}
+
+// OffsetAfterTime returns the offset of the first message whose timestamp is
+// after t, using the same lookup as SeekToTime, or -1 if there is none yet.
+// Note: This only works in direct partition mode (no consumer group).
+func (c *Consumer) OffsetAfterTime(t time.Time) (int64, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.usingGroup {
+		return 0, fmt.Errorf("OffsetAfterTime is not supported when using consumer groups")
+	}
+
+	// Timestamps have millisecond precision
+	offset, err := c.conn.ReadOffset(t.Truncate(time.Millisecond).Add(time.Millisecond))
+	if err != nil {
+		return 0, fmt.Errorf("failed to look up offset after %s: %w", t.Format(time.RFC3339), err)
+	}
+	if offset < 0 {
+		return -1, nil
+	}
+	return offset, nil
+}
+
+// Position returns the offset of the next message to be read. While a batch is
+// being consumed it reports the start of the following batch fetch, so callers
+// should use message offsets within a batch.
+// Note: This only works in direct partition mode (no consumer group).
+func (c *Consumer) Position() (int64, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.usingGroup {
+		return 0, fmt.Errorf("Position is not supported when using consumer groups")
+	}
+	return c.position()
+}
+
+// position resolves the connection offset to an absolute offset; c.mu must be held.
+func (c *Consumer) position() (int64, error) {
+	offset, whence := c.conn.Offset()
+	if whence == kafkago.SeekAbsolute {
+		return offset, nil
+	}
+	first, last, err := c.conn.ReadOffsets()
+	if err != nil {
+		return 0, fmt.Errorf("failed to read offsets: %w", err)
+	}
+	if whence == kafkago.SeekStart {
+		return first + offset, nil
+	}
+	return last - offset, nil
+}
+
+// HighWatermark returns the offset following the last message currently
+// available in the partition.
+// Note: This only works in direct partition mode (no consumer group).
+func (c *Consumer) HighWatermark() (int64, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.usingGroup {
+		return 0, fmt.Errorf("HighWatermark is not supported when using consumer groups")
+	}
+
+	last, err := c.conn.ReadLastOffset()
+	if err != nil {
+		return 0, fmt.Errorf("failed to read high watermark: %w", err)
+	}
+	return last, nil
+}
+
+// ManualCommit reports whether offsets are only committed through Commit.
+func (c *Consumer) ManualCommit() bool {
+	return c.manualCommit
+}
+
+// Commit commits the offsets following the given messages to the consumer
+// group. Only the topic, partition and offset of each message are used.
+// Note: This only works in consumer group mode.
+func (c *Consumer) Commit(ctx context.Context, msgs ...Message) error {
+	if !c.usingGroup {
+		return fmt.Errorf("Commit is only supported when using consumer groups")
+	}
+	if len(msgs) == 0 {
+		return nil
+	}
+	converted := make([]kafkago.Message, len(msgs))
+	for i, m := range msgs {
+		converted[i] = kafkago.Message{Topic: m.Topic, Partition: m.Partition, Offset: m.Offset}
+	}
+	if err := c.reader.CommitMessages(ctx, converted...); err != nil {
+		return fmt.Errorf("failed to commit offsets: %w", err)
+	}
+	return nil
+}
+
 func (c *Consumer) Close() error {
 	c.mu.Lock()
 	defer c.mu.Unlock()
@@ -60,31 +242,30 @@ func (c *Consumer) Close() error {
 	return nil
 }
 
-// ReadNextMessage reads the next complete message from Kafka
-// Returns the message timestamp, key, value, and error
-func (c *Consumer) ReadNextMessage(ctx context.Context) (time.Time, []byte, []byte, error) {
+// ReadNextMessage reads the next complete message from Kafka.
+// The returned key and value are copies owned by the caller.
+func (c *Consumer) ReadNextMessage(ctx context.Context) (Message, error) {
 	if c.usingGroup {
 		// Use Reader for consumer group mode
-		msg, err := c.reader.ReadMessage(ctx)
-		if err != nil {
-			return time.Time{}, nil, nil, err
+		read := c.reader.ReadMessage
+		if c.manualCommit {
+			read = c.reader.FetchMessage
 		}
-
-		// Return the message timestamp, key, and value
-		var key []byte
-		if len(msg.Key) > 0 {
-			key = make([]byte, len(msg.Key))
-			copy(key, msg.Key)
+		msg, err := read(ctx)
+		if err != nil {
+			return Message{}, err
 		}
-		value := make([]byte, len(msg.Value))
-		copy(value, msg.Value)
-		return msg.Time, key, value, nil
+		return copyMessage(msg), nil
 	}
 
 	// Use direct partition mode (Conn + Batch)
 	c.mu.Lock()
 	defer c.mu.Unlock()
 
+	if c.isolation == ReadCommitted {
+		return c.readCommitted(ctx)
+	}
+
 	// If we don't have a batch or it's exhausted, read a new one
 	if c.batch == nil {
 		// Set up batch reading with context cancellation support
@@ -103,9 +284,9 @@ func (c *Consumer) ReadNextMessage(ctx context.Context) (time.Time, []byte, []by
 
 		select {
 		case <-ctx.Done():
-			return time.Time{}, nil, nil, ctx.Err()
+			return Message{}, ctx.Err()
 		case err := <-errChan:
-			return time.Time{}, nil, nil, err
+			return Message{}, err
 		case b := <-batchChan:
 			c.batch = b
 		}
@@ -120,10 +301,45 @@ func (c *Consumer) ReadNextMessage(ctx context.Context) (time.Time, []byte, []by
 			c.batch.Close()
 			c.batch = nil
 		}
-		return time.Time{}, nil, nil, err
+		return Message{}, err
 	}
+	return copyMessage(msg), nil
+}
+
+// readCommitted returns the next message of a read_committed fetch, fetching
+// when the previous one is used up. Like the batch reader it returns io.EOF
+// when a fetch yields no messages; c.mu must be held.
+func (c *Consumer) readCommitted(ctx context.Context) (Message, error) {
+	if len(c.buffered) == 0 {
+		pos, err := c.position()
+		if err != nil {
+			return Message{}, err
+		}
+		res, err := fetchCommitted(ctx, kafkago.DefaultTransport, c.addr, c.topic, c.partition, pos)
+		if err != nil {
+			if ctx.Err() != nil {
+				return Message{}, ctx.Err()
+			}
+			return Message{}, err
+		}
+		c.aborted.Add(res.aborted)
+		c.control.Add(res.control)
+		if _, err := c.conn.Seek(res.next, kafkago.SeekAbsolute|kafkago.SeekDontCheck); err != nil {
+			return Message{}, err
+		}
+		c.buffered = res.messages
+		if len(c.buffered) == 0 {
+			return Message{}, io.EOF
+		}
+	}
+	msg := c.buffered[0]
+	c.buffered = c.buffered[1:]
+	return msg, nil
+}
 
-	// Return the message timestamp, key, and value
+// copyMessage converts a kafka-go message, copying key and value out of the
+// reader's buffers.
+func copyMessage(msg kafkago.Message) Message {
 	var key []byte
 	if len(msg.Key) > 0 {
 		key = make([]byte, len(msg.Key))
@@ -131,34 +347,23 @@ func (c *Consumer) ReadNextMessage(ctx context.Context) (time.Time, []byte, []by
 	}
 	value := make([]byte, len(msg.Value))
 	copy(value, msg.Value)
-	return msg.Time, key, value, nil
+	return Message{
+		Topic:     msg.Topic,
+		Partition: msg.Partition,
+		Offset:    msg.Offset,
+		Time:      msg.Time,
+		Key:       key,
+		Value:     value,
+	}
 }
 
 // NewConsumer creates a new Consumer. If groupID is provided and non-empty, it uses
-// kafka.Reader with consumer group support. Otherwise, it uses kafka.DialLeader for
-// direct partition access.
+// kafka.Reader with consumer group support; partition is then ignored, the group
+// assigns partitions and offsets are committed as messages are read. Otherwise,
+// it uses kafka.DialLeader for direct partition access.
 func NewConsumer(ctx context.Context, brokers []string, topic string, partition int, groupID string) (*Consumer, error) {
 	if groupID != "" {
-		// Use kafka.Reader for consumer group mode
-		readerConfig := kafkago.ReaderConfig{
-			Brokers:  brokers,
-			Topic:    topic,
-			GroupID:  groupID,
-			MinBytes: 1,
-			MaxBytes: 10 * 1024 * 1024, // 10MB
-		}
-
-		// If partition is specified (>= 0), set it; otherwise Reader will handle partition assignment
-		if partition >= 0 {
-			readerConfig.Partition = partition
-		}
-
-		reader := kafkago.NewReader(readerConfig)
-
-		return &Consumer{
-			reader:     reader,
-			usingGroup: true,
-		}, nil
+		return newGroupConsumer(brokers, topic, groupID, false), nil
 	}
 
 	// Use direct partition mode (kafka.DialLeader)
@@ -183,5 +388,34 @@ func NewConsumer(ctx context.Context, brokers []string, topic string, partition
 	return &Consumer{
 		conn:       conn,
 		usingGroup: false,
+		topic:      topic,
+		partition:  partition,
+		addr:       kafkago.TCP(brokers...),
 	}, nil
 }
+
+// NewGroupConsumer creates a consumer group Consumer that reads every partition
+// assigned by the group. It never commits on its own: offsets are committed
+// only through Commit, so callers can commit after messages are stored.
+func NewGroupConsumer(brokers []string, topic string, groupID string) *Consumer {
+	return newGroupConsumer(brokers, topic, groupID, true)
+}
+
+func newGroupConsumer(brokers []string, topic string, groupID string, manualCommit bool) *Consumer {
+	// Partition must not be set: it would disable group assignment
+	reader := kafkago.NewReader(kafkago.ReaderConfig{
+		Brokers:  brokers,
+		Topic:    topic,
+		GroupID:  groupID,
+		MinBytes: 1,
+		MaxBytes: 10 * 1024 * 1024, // 10MB
+	})
+
+	return &Consumer{
+		reader:       reader,
+		usingGroup:   true,
+		manualCommit: manualCommit,
+		topic:        topic,
+		partition:    -1,
+	}
+}
@@ -3,6 +3,7 @@ package kafka
 import (
 	"context"
 	"fmt"
+	"sort"
 	"time"
 
 	kafkago "github.com/segmentio/kafka-go"
@@ -135,6 +136,26 @@ func ReadAllPartitions(conn *Conn) ([]Partition, error) {
 	return result, nil
 }
 
+// ReadTopicPartitionIDs returns the sorted partition IDs of a single topic.
+// It returns an error if the topic does not exist.
+func ReadTopicPartitionIDs(conn *Conn, topic string) ([]int, error) {
+	partitions, err := conn.conn.ReadPartitions(topic)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get partitions for topic %s: %w", topic, err)
+	}
+	ids := make([]int, 0, len(partitions))
+	for _, p := range partitions {
+		if p.Topic == topic {
+			ids = append(ids, p.ID)
+		}
+	}
+	if len(ids) == 0 {
+		return nil, fmt.Errorf("topic %s not found", topic)
+	}
+	sort.Ints(ids)
+	return ids, nil
+}
+
 // DialLeader connects to the leader broker for a specific topic-partition
 func DialLeader(ctx context.Context, network, address, topic string, partitionID int) (*Conn, error) {
 	conn, err := kafkago.DialLeader(ctx, network, address, topic, partitionID)
@@ -0,0 +1,112 @@
+package kafka
+
+import (
+	"fmt"
+	"math/rand/v2"
+	"strings"
+	"sync"
+
+	"github.com/segmentio/kafka-go"
+)
+
+// Partitioner selects how a Producer assigns messages to partitions.
+type Partitioner string
+
+const (
+	// PartitionerMurmur2 hashes keys like the Java client's default
+	// partitioner, so keyed messages land on the same partitions as they would
+	// from a Java producer. Messages without a key go to random partitions.
+	PartitionerMurmur2 Partitioner = "murmur2"
+	// PartitionerCRC32 hashes keys like librdkafka's default "consistent_random"
+	// partitioner. Messages without a key go to random partitions.
+	PartitionerCRC32 Partitioner = "crc32"
+	// PartitionerRoundRobin ignores keys and cycles through the partitions.
+	PartitionerRoundRobin Partitioner = "round-robin"
+	// PartitionerLeastBytes ignores keys and picks the partition that has
+	// received the fewest bytes.
+	PartitionerLeastBytes Partitioner = "least-bytes"
+	// PartitionerSticky hashes keys like PartitionerMurmur2 and sends messages
+	// without a key to one partition until stickyBatchBytes have been sent,
+	// like the Java client's sticky partitioner, for fewer and larger batches.
+	PartitionerSticky Partitioner = "sticky"
+)
+
+// DefaultPartitioner is the partitioner used when none is set
+const DefaultPartitioner = PartitionerMurmur2
+
+// stickyBatchBytes is the number of keyless bytes sent to one partition
+// before the sticky partitioner moves on (the Java client's default batch.size)
+const stickyBatchBytes = 16 * 1024
+
+// Partitioners lists the supported partitioners.
+func Partitioners() []Partitioner {
+	return []Partitioner{PartitionerMurmur2, PartitionerCRC32, PartitionerRoundRobin, PartitionerLeastBytes, PartitionerSticky}
+}
+
+// ParsePartitioner parses a partitioner name.
+func ParsePartitioner(s string) (Partitioner, error) {
+	for _, p := range Partitioners() {
+		if strings.EqualFold(s, string(p)) {
+			return p, nil
+		}
+	}
+	names := make([]string, 0, len(Partitioners()))
+	for _, p := range Partitioners() {
+		names = append(names, string(p))
+	}
+	return "", fmt.Errorf("unknown partitioner %q (use %s)", s, strings.Join(names, ", "))
+}
+
+// balancer returns the kafka-go balancer implementing p
+func (p Partitioner) balancer() kafka.Balancer {
+	switch p {
+	case PartitionerCRC32:
+		return kafka.CRC32Balancer{}
+	case PartitionerRoundRobin:
+		return &kafka.RoundRobin{}
+	case PartitionerLeastBytes:
+		return &kafka.LeastBytes{}
+	case PartitionerSticky:
+		return &stickyBalancer{}
+	default:
+		return kafka.Murmur2Balancer{}
+	}
+}
+
+// stickyBalancer hashes keyed messages with murmur2 and keeps keyless
+// messages on one randomly chosen partition for stickyBatchBytes
+type stickyBalancer struct {
+	keyed kafka.Murmur2Balancer
+
+	mu        sync.Mutex
+	partition int
+	bytes     int
+	started   bool
+}
+
+func (b *stickyBalancer) Balance(msg kafka.Message, partitions ...int) int {
+	if msg.Key != nil {
+		return b.keyed.Balance(msg, partitions...)
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if !b.started || b.bytes >= stickyBatchBytes || !contains(partitions, b.partition) {
+		next := partitions[rand.IntN(len(partitions))]
+		// Move to a different partition when there is a choice
+		for len(partitions) > 1 && b.started && next == b.partition {
+			next = partitions[rand.IntN(len(partitions))]
+		}
+		b.partition, b.bytes, b.started = next, 0, true
+	}
+	b.bytes += len(msg.Value)
+	return b.partition
+}
+
+func contains(partitions []int, p int) bool {
+	for _, q := range partitions {
+		if q == p {
+			return true
+		}
+	}
+	return false
+}
@@ -10,25 +10,80 @@ import (
 
 type Producer struct {
 	writer *kafka.Writer
+	txn    *txnWriter       // Used instead of writer by idempotent and transactional producers
+	client *kafka.Transport // Connections of txn
+}
+
+// DefaultBatchTimeout is how long the writer waits to fill a batch by default
+const DefaultBatchTimeout = 500 * time.Millisecond
+
+// ProducerOptions configures a Producer
+type ProducerOptions struct {
+	Brokers                []string
+	Topic                  string
+	AllowAutoTopicCreation bool
+	NoAck                  bool
+	// BatchTimeout is how long the writer waits to fill a batch before sending
+	// it (default DefaultBatchTimeout). Each synchronous write can take this
+	// long, so lower it when messages are sent one at a time on a schedule.
+	BatchTimeout time.Duration
+	// ExplicitPartitions writes every message to its Message.Partition. By
+	// default the partition is chosen by the Partitioner and
+	// Message.Partition is ignored.
+	ExplicitPartitions bool
+	// Partitioner assigns messages to partitions unless ExplicitPartitions is
+	// set (default DefaultPartitioner).
+	Partitioner Partitioner
+	// Idempotent writes every record batch with a producer id and sequence
+	// number, so that the broker drops batches it has already written, and
+	// waits for all in-sync replicas. It cannot be combined with NoAck or
+	// AllowAutoTopicCreation.
+	Idempotent bool
+	// TransactionalID makes the producer idempotent and writes each
+	// WriteMessages call in one transaction with this transactional id.
+	TransactionalID string
+}
+
+// explicitBalancer sends each message to the partition it names
+type explicitBalancer struct{}
+
+func (explicitBalancer) Balance(msg kafka.Message, partitions ...int) int {
+	return msg.Partition
 }
 
 func NewProducer(brokers []string, topic string, allowAutoTopicCreation bool, noAck bool) *Producer {
+	return NewProducerWithOptions(ProducerOptions{
+		Brokers:                brokers,
+		Topic:                  topic,
+		AllowAutoTopicCreation: allowAutoTopicCreation,
+		NoAck:                  noAck,
+	})
+}
+
+// NewProducerWithOptions creates a producer from options
+func NewProducerWithOptions(opts ProducerOptions) *Producer {
 	requiredAcks := kafka.RequireOne // Default: wait for leader acknowledgment (reliable)
-	if noAck {
+	if opts.NoAck {
 		requiredAcks = kafka.RequireNone // No acknowledgment wait = maximum speed (less reliable)
 	}
-	return &Producer{
+	if opts.Idempotent || opts.TransactionalID != "" {
+		return newTxnProducer(opts)
+	}
+	if opts.BatchTimeout <= 0 {
+		opts.BatchTimeout = DefaultBatchTimeout
+	}
+	producer := &Producer{
 		writer: &kafka.Writer{
-			Addr:                   kafka.TCP(brokers...),
-			Topic:                  topic,
-			AllowAutoTopicCreation: allowAutoTopicCreation,
+			Addr:                   kafka.TCP(opts.Brokers...),
+			Topic:                  opts.Topic,
+			AllowAutoTopicCreation: opts.AllowAutoTopicCreation,
 			// Optimized for maximum throughput
 			// Based on Apache Kafka best practices and kafka-go documentation:
 			// - Large batches reduce per-message overhead
 			// - Longer timeout allows more accumulation before sending
 			// - Snappy compression reduces network bandwidth with minimal CPU cost
 			BatchSize:    10000,                 // Large batch size for high throughput
-			BatchTimeout: 500 * time.Millisecond, // Wait up to 500ms to accumulate more messages
+			BatchTimeout: opts.BatchTimeout,     // Wait up to 500ms (by default) to accumulate more messages
 			BatchBytes:   50 * 1024 * 1024,      // Max 50MB per batch - allows larger batches
 			WriteTimeout: 30 * time.Second,      // 30 second timeout for writes
 			Async:        false,                  // Synchronous writes (Async=true can complicate error handling)
@@ -36,15 +91,45 @@ func NewProducer(brokers []string, topic string, allowAutoTopicCreation bool, no
 			Compression:  kafka.Snappy,          // Snappy compression: fast, reduces network overhead
 		},
 	}
+	if opts.ExplicitPartitions {
+		producer.writer.Balancer = explicitBalancer{}
+	} else {
+		producer.writer.Balancer = opts.Partitioner.balancer()
+	}
+	return producer
+}
+
+// newTxnProducer creates an idempotent or transactional producer
+func newTxnProducer(opts ProducerOptions) *Producer {
+	transport := &kafka.Transport{}
+	txn := &txnWriter{
+		client: &kafka.Client{
+			Addr:      kafka.TCP(opts.Brokers...),
+			Timeout:   30 * time.Second,
+			Transport: transport,
+		},
+		topic:           opts.Topic,
+		transactionalID: opts.TransactionalID,
+	}
+	if !opts.ExplicitPartitions {
+		txn.balancer = opts.Partitioner.balancer()
+	}
+	return &Producer{txn: txn, client: transport}
 }
 
 // WriteMessages writes multiple messages to Kafka
 func (p *Producer) WriteMessages(ctx context.Context, messages ...kafka.Message) error {
+	if p.txn != nil {
+		return p.txn.WriteMessages(ctx, messages...)
+	}
 	return p.writer.WriteMessages(ctx, messages...)
 }
 
 // Close closes the underlying writer
 func (p *Producer) Close() error {
+	if p.client != nil {
+		p.client.CloseIdleConnections()
+	}
 	if p.writer == nil {
 		return nil
 	}
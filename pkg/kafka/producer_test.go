@@ -0,0 +1,66 @@
+package kafka
+
+import (
+	"testing"
+
+	"github.com/segmentio/kafka-go"
+)
+
+func TestNewProducerWithOptions_ExplicitPartitions(t *testing.T) {
+	p := NewProducerWithOptions(ProducerOptions{Brokers: []string{"localhost:0"}, Topic: "t", ExplicitPartitions: true})
+	defer p.Close()
+	if got := p.writer.Balancer.Balance(kafka.Message{Partition: 2}, 0, 1, 2, 3); got != 2 {
+		t.Errorf("explicit balancer chose partition %d, want 2", got)
+	}
+	if p.writer.BatchTimeout != DefaultBatchTimeout {
+		t.Errorf("batch timeout %v, want the default", p.writer.BatchTimeout)
+	}
+
+	if p := NewProducer([]string{"localhost:0"}, "t", false, false); p.writer.Balancer != (kafka.Murmur2Balancer{}) {
+		t.Errorf("expected murmur2 by default, got %T", p.writer.Balancer)
+	}
+}
+
+func TestParsePartitioner(t *testing.T) {
+	for _, p := range Partitioners() {
+		if got, err := ParsePartitioner(string(p)); err != nil || got != p {
+			t.Errorf("ParsePartitioner(%q) = %q, %v", p, got, err)
+		}
+	}
+	if _, err := ParsePartitioner("random"); err == nil {
+		t.Errorf("expected an error for an unknown partitioner")
+	}
+}
+
+func TestMurmur2_JavaCompatible(t *testing.T) {
+	// Java murmur2 hashes of these keys (from librdkafka's test vectors) are
+	// 0xd067cf64, 0x9fc97b14 and 0x5a4b5ca1; the Java client picks
+	// (hash & 0x7fffffff) % 10 of 10 partitions
+	for key, want := range map[string]int{"kafka": 0, "1234": 0, "4": 3} {
+		got := PartitionerMurmur2.balancer().Balance(kafka.Message{Key: []byte(key)}, 0, 1, 2, 3, 4, 5, 6, 7, 8, 9)
+		if got != want {
+			t.Errorf("key %q: partition %d, want %d", key, got, want)
+		}
+	}
+}
+
+func TestStickyBalancer(t *testing.T) {
+	b := PartitionerSticky.balancer()
+	partitions := []int{0, 1, 2, 3}
+	value := make([]byte, 1024)
+
+	first := b.Balance(kafka.Message{Value: value}, partitions...)
+	for i := 1; i < stickyBatchBytes/len(value); i++ {
+		if p := b.Balance(kafka.Message{Value: value}, partitions...); p != first {
+			t.Fatalf("message %d went to partition %d, want sticky partition %d", i, p, first)
+		}
+	}
+	if p := b.Balance(kafka.Message{Value: value}, partitions...); p == first {
+		t.Errorf("expected a new partition after %d bytes", stickyBatchBytes)
+	}
+
+	keyed := kafka.Message{Key: []byte("hello"), Value: value}
+	if b.Balance(keyed, partitions...) != PartitionerMurmur2.balancer().Balance(keyed, partitions...) {
+		t.Errorf("keyed messages must be hashed with murmur2")
+	}
+}
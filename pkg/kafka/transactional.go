@@ -0,0 +1,452 @@
+package kafka
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"math"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/segmentio/kafka-go"
+	"github.com/segmentio/kafka-go/protocol"
+)
+
+const (
+	// transactionTimeout is how long the broker lets a transaction stay open
+	// before aborting it (the Java client's default transaction.timeout.ms)
+	transactionTimeout = 60 * time.Second
+	// abortTimeout bounds the abort of a failed transaction, which is sent
+	// even when the write was canceled
+	abortTimeout = 10 * time.Second
+	// maxRecordBatchBytes bounds the uncompressed size of one record batch,
+	// below the broker's default message.max.bytes of 1 MB. Larger
+	// partition batches are sent as several produce requests.
+	maxRecordBatchBytes = 900 * 1024
+	// concurrentTxnRetries and concurrentTxnBackoff bound how long adding
+	// partitions waits for the previous transaction to finish
+	concurrentTxnRetries = 50
+	concurrentTxnBackoff = 100 * time.Millisecond
+)
+
+// Offsets into a version 2 record batch (after the record set's 4-byte size)
+const (
+	batchCRCOffset        = 17
+	batchAttributesOffset = 21
+	batchProducerIDOffset = 43
+	batchEpochOffset      = 51
+	batchSequenceOffset   = 53
+
+	transactionalAttribute = 1 << 4
+)
+
+var castagnoli = crc32.MakeTable(crc32.Castagnoli)
+
+// txnClient is the part of kafka.Client used by a txnWriter. The client
+// routes produce requests to the partition leaders and transaction requests
+// to the transaction coordinator.
+type txnClient interface {
+	Metadata(ctx context.Context, req *kafka.MetadataRequest) (*kafka.MetadataResponse, error)
+	InitProducerID(ctx context.Context, req *kafka.InitProducerIDRequest) (*kafka.InitProducerIDResponse, error)
+	AddPartitionsToTxn(ctx context.Context, req *kafka.AddPartitionsToTxnRequest) (*kafka.AddPartitionsToTxnResponse, error)
+	RawProduce(ctx context.Context, req *kafka.RawProduceRequest) (*kafka.ProduceResponse, error)
+	EndTxn(ctx context.Context, req *kafka.EndTxnRequest) (*kafka.EndTxnResponse, error)
+}
+
+// txnWriter writes messages as an idempotent producer, and with a
+// transactional id wraps each WriteMessages call in a transaction. kafka-go's
+// Writer cannot do either, so record batches are encoded here with the
+// producer id, epoch and per-partition sequence numbers that let the broker
+// drop batches it has already written, and sent as raw produce requests.
+type txnWriter struct {
+	client          txnClient
+	topic           string
+	transactionalID string         // Empty for an idempotent producer without transactions
+	balancer        kafka.Balancer // nil writes every message to its Message.Partition
+
+	mu         sync.Mutex              // One write, and so one transaction, at a time
+	partitions []int                   // Partitions of the topic, loaded on the first write
+	session    *kafka.ProducerSession  // nil until initialized, and after a failure that needs a new one
+	sequences  map[int]int32           // Next sequence number per partition
+	unresolved map[int][]kafka.Message // Failed record batch per partition, without transactions
+}
+
+// WriteMessages writes msgs. With a transactional id they are committed in
+// one transaction, or the transaction is aborted and an error returned, so
+// read_committed consumers see all of them or none. Without one, the
+// messages of partitions that failed are reported in a kafka.WriteErrors.
+func (w *txnWriter) WriteMessages(ctx context.Context, msgs ...kafka.Message) error {
+	if len(msgs) == 0 {
+		return nil
+	}
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.partitions == nil {
+		if err := w.loadPartitions(ctx); err != nil {
+			return err
+		}
+	}
+	batches, err := w.assign(msgs)
+	if err != nil {
+		return err
+	}
+	if w.transactionalID == "" {
+		return w.writeIdempotent(ctx, msgs, batches)
+	}
+	return w.writeTransaction(ctx, batches)
+}
+
+// loadPartitions reads the partitions of the topic
+func (w *txnWriter) loadPartitions(ctx context.Context) error {
+	res, err := w.client.Metadata(ctx, &kafka.MetadataRequest{Topics: []string{w.topic}})
+	if err != nil {
+		return fmt.Errorf("failed to read metadata of topic '%s': %w", w.topic, err)
+	}
+	if len(res.Topics) == 0 {
+		return fmt.Errorf("topic '%s' not found", w.topic)
+	}
+	if err := res.Topics[0].Error; err != nil {
+		return fmt.Errorf("failed to read metadata of topic '%s': %w", w.topic, err)
+	}
+	partitions := make([]int, 0, len(res.Topics[0].Partitions))
+	for _, p := range res.Topics[0].Partitions {
+		partitions = append(partitions, p.ID)
+	}
+	if len(partitions) == 0 {
+		return fmt.Errorf("topic '%s' has no partitions", w.topic)
+	}
+	slices.Sort(partitions)
+	w.partitions = partitions
+	return nil
+}
+
+// partitionBatch holds the messages of a write that go to one partition, in
+// order, with their indexes in the write
+type partitionBatch struct {
+	partition int
+	msgs      []kafka.Message
+	indexes   []int
+}
+
+// assign groups msgs by partition, ordered by partition
+func (w *txnWriter) assign(msgs []kafka.Message) ([]*partitionBatch, error) {
+	byPartition := make(map[int]*partitionBatch)
+	for i, msg := range msgs {
+		p := msg.Partition
+		if w.balancer != nil {
+			p = w.balancer.Balance(msg, w.partitions...)
+		} else if !contains(w.partitions, p) {
+			return nil, fmt.Errorf("topic '%s' has no partition %d", w.topic, p)
+		}
+		b := byPartition[p]
+		if b == nil {
+			b = &partitionBatch{partition: p}
+			byPartition[p] = b
+		}
+		b.msgs = append(b.msgs, msg)
+		b.indexes = append(b.indexes, i)
+	}
+	batches := make([]*partitionBatch, 0, len(byPartition))
+	for _, b := range byPartition {
+		batches = append(batches, b)
+	}
+	slices.SortFunc(batches, func(a, b *partitionBatch) int { return a.partition - b.partition })
+	return batches, nil
+}
+
+// initSession gets a producer id and epoch. With a transactional id this
+// bumps the epoch, which fences older producers with the same id and aborts
+// a transaction they left open. Sequence numbers start again at 0.
+func (w *txnWriter) initSession(ctx context.Context) error {
+	req := &kafka.InitProducerIDRequest{TransactionalID: w.transactionalID}
+	if w.transactionalID != "" {
+		req.TransactionTimeoutMs = int(transactionTimeout / time.Millisecond)
+	}
+	res, err := w.client.InitProducerID(ctx, req)
+	if err == nil {
+		err = res.Error
+	}
+	if err != nil {
+		return fmt.Errorf("failed to initialize producer id: %w", err)
+	}
+	w.session = res.Producer
+	w.sequences = make(map[int]int32)
+	w.unresolved = make(map[int][]kafka.Message)
+	return nil
+}
+
+// partitionResult is the outcome of writing a partitionBatch
+type partitionResult struct {
+	sent     int             // Messages written
+	sequence int32           // Next sequence number
+	failed   []kafka.Message // Record batch that failed
+	err      error
+}
+
+// writePartitions writes each batch to its partition, concurrently, and
+// advances the sequence numbers of what was written
+func (w *txnWriter) writePartitions(ctx context.Context, batches []*partitionBatch) []partitionResult {
+	results := make([]partitionResult, len(batches))
+	var wg sync.WaitGroup
+	for i, b := range batches {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			results[i] = w.writePartition(ctx, b, w.sequences[b.partition])
+		}()
+	}
+	wg.Wait()
+	for i, b := range batches {
+		w.sequences[b.partition] = results[i].sequence
+	}
+	return results
+}
+
+// writePartition writes b in record batches of at most maxRecordBatchBytes,
+// starting at sequence number seq. It stops at the first that fails.
+func (w *txnWriter) writePartition(ctx context.Context, b *partitionBatch, seq int32) partitionResult {
+	res := partitionResult{sequence: seq}
+	for _, chunk := range recordBatches(b.msgs) {
+		records, err := encodeRecordBatch(chunk, *w.session, res.sequence, w.transactionalID != "")
+		if err == nil {
+			err = w.produce(ctx, b.partition, records)
+		}
+		if err != nil {
+			res.failed, res.err = chunk, err
+			return res
+		}
+		res.sent += len(chunk)
+		res.sequence = nextSequence(res.sequence, len(chunk))
+	}
+	return res
+}
+
+// produce sends one encoded record batch to a partition
+func (w *txnWriter) produce(ctx context.Context, partition int, records []byte) error {
+	res, err := w.client.RawProduce(ctx, &kafka.RawProduceRequest{
+		Topic:           w.topic,
+		Partition:       partition,
+		RequiredAcks:    kafka.RequireAll, // Idempotence requires acknowledgment by all in-sync replicas
+		TransactionalID: w.transactionalID,
+		RawRecords:      protocol.RawRecordSet{Reader: bytes.NewReader(records)},
+	})
+	if err == nil {
+		err = res.Error
+	}
+	// The broker has written this batch before, when an earlier attempt's
+	// acknowledgment was lost
+	if errors.Is(err, kafka.DuplicateSequenceNumber) {
+		return nil
+	}
+	return err
+}
+
+// writeIdempotent writes msgs without a transaction. A record batch that
+// failed may have been written anyway, so it is resent with the same sequence
+// number, letting the broker drop it if so. A partition that gets different
+// messages instead needs a new producer id: with the old one the broker
+// would drop them as a duplicate.
+func (w *txnWriter) writeIdempotent(ctx context.Context, msgs []kafka.Message, batches []*partitionBatch) error {
+	for _, b := range batches {
+		if prev, ok := w.unresolved[b.partition]; ok && !sameMessages(prev, recordBatches(b.msgs)[0]) {
+			w.session = nil
+		}
+	}
+	if w.session == nil {
+		if err := w.initSession(ctx); err != nil {
+			return err
+		}
+	}
+
+	var errs kafka.WriteErrors
+	for i, res := range w.writePartitions(ctx, batches) {
+		b := batches[i]
+		if res.err == nil {
+			delete(w.unresolved, b.partition)
+			continue
+		}
+		w.unresolved[b.partition] = res.failed
+		var kafkaErr kafka.Error
+		if errors.As(res.err, &kafkaErr) && !kafkaErr.Temporary() {
+			// Such as an out of order sequence number or an unknown producer id
+			w.session = nil
+		}
+		if errs == nil {
+			errs = make(kafka.WriteErrors, len(msgs))
+		}
+		for _, j := range b.indexes[res.sent:] {
+			errs[j] = res.err
+		}
+	}
+	if errs != nil {
+		return errs
+	}
+	return nil
+}
+
+// writeTransaction writes the batches in one transaction. If anything fails
+// the transaction is aborted and the next write starts with a new epoch.
+func (w *txnWriter) writeTransaction(ctx context.Context, batches []*partitionBatch) error {
+	if w.session == nil {
+		if err := w.initSession(ctx); err != nil {
+			return err
+		}
+	}
+	if err := w.addPartitions(ctx, batches); err != nil {
+		w.abort(ctx)
+		return fmt.Errorf("transaction aborted: %w", err)
+	}
+	for _, res := range w.writePartitions(ctx, batches) {
+		if res.err != nil {
+			w.abort(ctx)
+			return fmt.Errorf("transaction aborted: %w", res.err)
+		}
+	}
+	res, err := w.client.EndTxn(ctx, &kafka.EndTxnRequest{
+		TransactionalID: w.transactionalID,
+		ProducerID:      w.session.ProducerID,
+		ProducerEpoch:   w.session.ProducerEpoch,
+		Committed:       true,
+	})
+	if err == nil {
+		err = res.Error
+	}
+	if err != nil {
+		// Whether the commit happened is unknown; a new epoch completes or
+		// aborts it
+		w.session = nil
+		return fmt.Errorf("failed to commit transaction: %w", err)
+	}
+	return nil
+}
+
+// addPartitions adds the partitions of batches to the transaction, waiting
+// while the previous transaction of this transactional id is being ended
+func (w *txnWriter) addPartitions(ctx context.Context, batches []*partitionBatch) error {
+	partitions := make([]kafka.AddPartitionToTxn, len(batches))
+	for i, b := range batches {
+		partitions[i] = kafka.AddPartitionToTxn{Partition: b.partition}
+	}
+	req := &kafka.AddPartitionsToTxnRequest{
+		TransactionalID: w.transactionalID,
+		ProducerID:      w.session.ProducerID,
+		ProducerEpoch:   w.session.ProducerEpoch,
+		Topics:          map[string][]kafka.AddPartitionToTxn{w.topic: partitions},
+	}
+	for attempt := 0; ; attempt++ {
+		res, err := w.client.AddPartitionsToTxn(ctx, req)
+		if err != nil {
+			return fmt.Errorf("failed to add partitions to transaction: %w", err)
+		}
+		for _, p := range res.Topics[w.topic] {
+			if p.Error != nil {
+				err = p.Error
+				break
+			}
+		}
+		if !errors.Is(err, kafka.ConcurrentTransactions) || attempt >= concurrentTxnRetries {
+			if err != nil {
+				return fmt.Errorf("failed to add partitions to transaction: %w", err)
+			}
+			return nil
+		}
+		t := time.NewTimer(concurrentTxnBackoff)
+		select {
+		case <-ctx.Done():
+			t.Stop()
+			return ctx.Err()
+		case <-t.C:
+		}
+	}
+}
+
+// abort aborts the open transaction, even if ctx was canceled, so that
+// read_committed consumers are not held up until it times out. The next
+// write starts with a new epoch, which also aborts the transaction if this
+// fails.
+func (w *txnWriter) abort(ctx context.Context) {
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), abortTimeout)
+	defer cancel()
+	w.client.EndTxn(ctx, &kafka.EndTxnRequest{
+		TransactionalID: w.transactionalID,
+		ProducerID:      w.session.ProducerID,
+		ProducerEpoch:   w.session.ProducerEpoch,
+		Committed:       false,
+	})
+	w.session = nil
+}
+
+// recordBatches splits the messages of a partition into record batches of at
+// most maxRecordBatchBytes (or a single larger message)
+func recordBatches(msgs []kafka.Message) [][]kafka.Message {
+	var batches [][]kafka.Message
+	start, size := 0, 0
+	for i, msg := range msgs {
+		n := len(msg.Key) + len(msg.Value)
+		for _, h := range msg.Headers {
+			n += len(h.Key) + len(h.Value)
+		}
+		if i > start && size+n > maxRecordBatchBytes {
+			batches = append(batches, msgs[start:i])
+			start, size = i, 0
+		}
+		size += n
+	}
+	return append(batches, msgs[start:])
+}
+
+// encodeRecordBatch encodes msgs as a record set of one Snappy compressed
+// record batch of producer session s, starting at sequence number seq.
+// kafka-go always encodes batches without a producer, so the header is
+// patched and its checksum recomputed.
+func encodeRecordBatch(msgs []kafka.Message, s kafka.ProducerSession, seq int32, transactional bool) ([]byte, error) {
+	records := make([]protocol.Record, len(msgs))
+	for i, msg := range msgs {
+		records[i] = protocol.Record{
+			Time:    msg.Time,
+			Key:     protocol.NewBytes(msg.Key),
+			Value:   protocol.NewBytes(msg.Value),
+			Headers: msg.Headers,
+		}
+	}
+	rs := protocol.RecordSet{
+		Version:    2,
+		Attributes: protocol.Attributes(kafka.Snappy),
+		Records:    protocol.NewRecordReader(records...),
+	}
+	var buf bytes.Buffer
+	if _, err := rs.WriteTo(&buf); err != nil {
+		return nil, fmt.Errorf("failed to encode record batch: %w", err)
+	}
+	b := buf.Bytes()
+	batch := b[4:]
+	binary.BigEndian.PutUint64(batch[batchProducerIDOffset:], uint64(s.ProducerID))
+	binary.BigEndian.PutUint16(batch[batchEpochOffset:], uint16(s.ProducerEpoch))
+	binary.BigEndian.PutUint32(batch[batchSequenceOffset:], uint32(seq))
+	if transactional {
+		attributes := binary.BigEndian.Uint16(batch[batchAttributesOffset:])
+		binary.BigEndian.PutUint16(batch[batchAttributesOffset:], attributes|transactionalAttribute)
+	}
+	binary.BigEndian.PutUint32(batch[batchCRCOffset:], crc32.Checksum(batch[batchAttributesOffset:], castagnoli))
+	return b, nil
+}
+
+// nextSequence returns the sequence number after n records from seq. Like
+// Kafka's, sequence numbers wrap around to 0 after math.MaxInt32.
+func nextSequence(seq int32, n int) int32 {
+	return int32((int64(seq) + int64(n)) % (math.MaxInt32 + 1))
+}
+
+// sameMessages reports whether a and b hold the same messages
+func sameMessages(a, b []kafka.Message) bool {
+	return slices.EqualFunc(a, b, func(x, y kafka.Message) bool {
+		return bytes.Equal(x.Key, y.Key) && bytes.Equal(x.Value, y.Value) && x.Time.Equal(y.Time) &&
+			slices.EqualFunc(x.Headers, y.Headers, func(h, g kafka.Header) bool {
+				return h.Key == g.Key && bytes.Equal(h.Value, g.Value)
+			})
+	})
+}
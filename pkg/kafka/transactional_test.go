@@ -0,0 +1,272 @@
+package kafka
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"reflect"
+	"slices"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/segmentio/kafka-go"
+	"github.com/segmentio/kafka-go/protocol"
+)
+
+// fakeTxnClient records the requests of a txnWriter. Produce requests are
+// recorded as "produce P seq S pid I epoch E".
+type fakeTxnClient struct {
+	partitions []int
+	fail       map[int]error // Error of the next produce request per partition
+
+	mu      sync.Mutex
+	calls   []string
+	produce []string // Kept apart, as partitions are written concurrently
+	epoch   int
+}
+
+func (c *fakeTxnClient) record(call string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.calls = append(c.calls, call)
+}
+
+// take returns the requests since the last call, with the produce requests
+// sorted and last
+func (c *fakeTxnClient) take() []string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	slices.Sort(c.produce)
+	calls := append(c.calls, c.produce...)
+	c.calls, c.produce = nil, nil
+	return calls
+}
+
+func (c *fakeTxnClient) Metadata(ctx context.Context, req *kafka.MetadataRequest) (*kafka.MetadataResponse, error) {
+	c.record("metadata")
+	topic := kafka.Topic{Name: req.Topics[0]}
+	for _, p := range c.partitions {
+		topic.Partitions = append(topic.Partitions, kafka.Partition{Topic: topic.Name, ID: p})
+	}
+	return &kafka.MetadataResponse{Topics: []kafka.Topic{topic}}, nil
+}
+
+func (c *fakeTxnClient) InitProducerID(ctx context.Context, req *kafka.InitProducerIDRequest) (*kafka.InitProducerIDResponse, error) {
+	c.record(fmt.Sprintf("init %q", req.TransactionalID))
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.epoch++
+	return &kafka.InitProducerIDResponse{Producer: &kafka.ProducerSession{ProducerID: 7, ProducerEpoch: c.epoch}}, nil
+}
+
+func (c *fakeTxnClient) AddPartitionsToTxn(ctx context.Context, req *kafka.AddPartitionsToTxnRequest) (*kafka.AddPartitionsToTxnResponse, error) {
+	var partitions []int
+	for _, p := range req.Topics["t"] {
+		partitions = append(partitions, p.Partition)
+	}
+	c.record(fmt.Sprintf("add %v", partitions))
+	return &kafka.AddPartitionsToTxnResponse{}, nil
+}
+
+func (c *fakeTxnClient) RawProduce(ctx context.Context, req *kafka.RawProduceRequest) (*kafka.ProduceResponse, error) {
+	batch, err := readRecordBatch(req.RawRecords.Reader)
+	if err != nil {
+		return nil, err
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.produce = append(c.produce, fmt.Sprintf("produce %d seq %d pid %d epoch %d", req.Partition, batch.BaseSequence, batch.ProducerID, batch.ProducerEpoch))
+	if err := c.fail[req.Partition]; err != nil {
+		delete(c.fail, req.Partition)
+		return nil, err
+	}
+	return &kafka.ProduceResponse{}, nil
+}
+
+func (c *fakeTxnClient) EndTxn(ctx context.Context, req *kafka.EndTxnRequest) (*kafka.EndTxnResponse, error) {
+	c.record(fmt.Sprintf("end commit=%v", req.Committed))
+	return &kafka.EndTxnResponse{}, nil
+}
+
+// readRecordBatch decodes a record set of one record batch, checking its CRC
+func readRecordBatch(r io.Reader) (*protocol.RecordBatch, error) {
+	var rs protocol.RecordSet
+	if _, err := rs.ReadFrom(r); err != nil {
+		return nil, err
+	}
+	stream, ok := rs.Records.(*protocol.RecordStream)
+	if !ok || len(stream.Records) != 1 {
+		return nil, fmt.Errorf("expected one record batch, got %T", rs.Records)
+	}
+	batch, ok := stream.Records[0].(*protocol.RecordBatch)
+	if !ok {
+		return nil, fmt.Errorf("expected a record batch, got %T", stream.Records[0])
+	}
+	return batch, nil
+}
+
+// partitionMessages returns one message per partition
+func partitionMessages(partitions ...int) []kafka.Message {
+	msgs := make([]kafka.Message, len(partitions))
+	for i, p := range partitions {
+		msgs[i] = kafka.Message{Partition: p, Key: []byte("k"), Value: []byte(fmt.Sprint(i))}
+	}
+	return msgs
+}
+
+func TestEncodeRecordBatch(t *testing.T) {
+	msgs := []kafka.Message{
+		{Key: []byte("a"), Value: []byte("1"), Time: time.UnixMilli(1000)},
+		{Value: []byte("2"), Time: time.UnixMilli(2000), Headers: []kafka.Header{{Key: "h", Value: []byte("v")}}},
+	}
+	b, err := encodeRecordBatch(msgs, kafka.ProducerSession{ProducerID: 42, ProducerEpoch: 3}, 17, true)
+	if err != nil {
+		t.Fatalf("encodeRecordBatch failed: %v", err)
+	}
+
+	batch, err := readRecordBatch(bytes.NewReader(b))
+	if err != nil {
+		t.Fatalf("failed to read the batch back: %v", err)
+	}
+	if batch.ProducerID != 42 || batch.ProducerEpoch != 3 || batch.BaseSequence != 17 {
+		t.Errorf("producer %d epoch %d sequence %d, want 42, 3 and 17", batch.ProducerID, batch.ProducerEpoch, batch.BaseSequence)
+	}
+	if !batch.Attributes.Transactional() || batch.Attributes.Compression() != kafka.Snappy {
+		t.Errorf("attributes %v, want transactional and snappy", batch.Attributes)
+	}
+	for i, want := range msgs {
+		r, err := batch.ReadRecord()
+		if err != nil {
+			t.Fatalf("record %d: %v", i, err)
+		}
+		key, _ := protocol.ReadAll(r.Key)
+		value, _ := protocol.ReadAll(r.Value)
+		if !bytes.Equal(key, want.Key) || !bytes.Equal(value, want.Value) || !r.Time.Equal(want.Time) || len(r.Headers) != len(want.Headers) {
+			t.Errorf("record %d: key %q value %q at %v with %d headers, want %q %q at %v with %d", i, key, value, r.Time, len(r.Headers), want.Key, want.Value, want.Time, len(want.Headers))
+		}
+	}
+
+	// A changed header no longer matches the checksum
+	b[4+batchSequenceOffset+3]++
+	if _, err := readRecordBatch(bytes.NewReader(b)); err == nil {
+		t.Errorf("expected a checksum error after changing the sequence")
+	}
+
+	b, err = encodeRecordBatch(msgs, kafka.ProducerSession{ProducerID: 42}, 0, false)
+	if err != nil {
+		t.Fatalf("encodeRecordBatch failed: %v", err)
+	}
+	if batch, err := readRecordBatch(bytes.NewReader(b)); err != nil || batch.Attributes.Transactional() {
+		t.Errorf("expected a valid batch that is not transactional, got %v", err)
+	}
+}
+
+func TestTxnWriter_Transaction(t *testing.T) {
+	client := &fakeTxnClient{partitions: []int{0, 1, 2}, fail: map[int]error{}}
+	w := &txnWriter{client: client, topic: "t", transactionalID: "replay-1"}
+	ctx := context.Background()
+
+	if err := w.WriteMessages(ctx, partitionMessages(1, 0, 1)...); err != nil {
+		t.Fatalf("write failed: %v", err)
+	}
+	want := []string{"metadata", `init "replay-1"`, "add [0 1]", "end commit=true", "produce 0 seq 0 pid 7 epoch 1", "produce 1 seq 0 pid 7 epoch 1"}
+	if got := client.take(); !reflect.DeepEqual(got, want) {
+		t.Errorf("first transaction:\n got %q\nwant %q", got, want)
+	}
+
+	// Sequence numbers continue in the next transaction
+	if err := w.WriteMessages(ctx, partitionMessages(1, 2)...); err != nil {
+		t.Fatalf("write failed: %v", err)
+	}
+	want = []string{"add [1 2]", "end commit=true", "produce 1 seq 2 pid 7 epoch 1", "produce 2 seq 0 pid 7 epoch 1"}
+	if got := client.take(); !reflect.DeepEqual(got, want) {
+		t.Errorf("second transaction:\n got %q\nwant %q", got, want)
+	}
+
+	// A failed partition aborts the transaction, and the next one starts
+	// with a new epoch
+	client.fail[2] = kafka.NotEnoughReplicas
+	if err := w.WriteMessages(ctx, partitionMessages(0, 2)...); !errors.Is(err, kafka.NotEnoughReplicas) {
+		t.Fatalf("write returned %v, want the produce error", err)
+	}
+	want = []string{"add [0 2]", "end commit=false", "produce 0 seq 1 pid 7 epoch 1", "produce 2 seq 1 pid 7 epoch 1"}
+	if got := client.take(); !reflect.DeepEqual(got, want) {
+		t.Errorf("failed transaction:\n got %q\nwant %q", got, want)
+	}
+	if err := w.WriteMessages(ctx, partitionMessages(0, 2)...); err != nil {
+		t.Fatalf("write failed: %v", err)
+	}
+	want = []string{`init "replay-1"`, "add [0 2]", "end commit=true", "produce 0 seq 0 pid 7 epoch 2", "produce 2 seq 0 pid 7 epoch 2"}
+	if got := client.take(); !reflect.DeepEqual(got, want) {
+		t.Errorf("retried transaction:\n got %q\nwant %q", got, want)
+	}
+
+	if err := w.WriteMessages(ctx, partitionMessages(5)...); err == nil {
+		t.Errorf("expected an error for a partition the topic does not have")
+	}
+}
+
+func TestTxnWriter_Idempotent(t *testing.T) {
+	client := &fakeTxnClient{partitions: []int{0, 1}, fail: map[int]error{}}
+	w := &txnWriter{client: client, topic: "t"}
+	ctx := context.Background()
+
+	// Only the messages of the failed partition are reported
+	msgs := partitionMessages(0, 1, 1)
+	client.fail[1] = kafka.RequestTimedOut
+	err := w.WriteMessages(ctx, msgs...)
+	var writeErrs kafka.WriteErrors
+	if !errors.As(err, &writeErrs) || writeErrs[0] != nil || writeErrs[1] == nil || writeErrs[2] == nil {
+		t.Fatalf("write returned %v, want errors for the messages to partition 1", err)
+	}
+	want := []string{"metadata", `init ""`, "produce 0 seq 0 pid 7 epoch 1", "produce 1 seq 0 pid 7 epoch 1"}
+	if got := client.take(); !reflect.DeepEqual(got, want) {
+		t.Errorf("first write:\n got %q\nwant %q", got, want)
+	}
+
+	// The same batch is resent with the same sequence number, so the broker
+	// drops it if the first attempt was written
+	if err := w.WriteMessages(ctx, msgs[1:]...); err != nil {
+		t.Fatalf("retry failed: %v", err)
+	}
+	want = []string{"produce 1 seq 0 pid 7 epoch 1"}
+	if got := client.take(); !reflect.DeepEqual(got, want) {
+		t.Errorf("retry:\n got %q\nwant %q", got, want)
+	}
+
+	// Different messages after a failure need a new producer id
+	client.fail[0] = kafka.RequestTimedOut
+	w.WriteMessages(ctx, partitionMessages(0)...)
+	client.take()
+	if err := w.WriteMessages(ctx, partitionMessages(0, 0)...); err != nil {
+		t.Fatalf("write failed: %v", err)
+	}
+	want = []string{`init ""`, "produce 0 seq 0 pid 7 epoch 2"}
+	if got := client.take(); !reflect.DeepEqual(got, want) {
+		t.Errorf("write after an unresolved failure:\n got %q\nwant %q", got, want)
+	}
+
+	// A batch the broker has already written counts as written
+	client.fail[1] = kafka.DuplicateSequenceNumber
+	if err := w.WriteMessages(ctx, partitionMessages(1)...); err != nil {
+		t.Errorf("duplicate sequence number returned %v, want success", err)
+	}
+}
+
+func TestRecordBatches(t *testing.T) {
+	value := make([]byte, maxRecordBatchBytes/2)
+	msgs := []kafka.Message{{Value: value}, {Value: value}, {Value: value}, {Value: make([]byte, maxRecordBatchBytes+1)}, {Value: []byte("x")}}
+	var sizes []int
+	for _, b := range recordBatches(msgs) {
+		sizes = append(sizes, len(b))
+	}
+	if !reflect.DeepEqual(sizes, []int{2, 1, 1, 1}) {
+		t.Errorf("record batches of %v messages, want [2 1 1 1]", sizes)
+	}
+	if nextSequence(2147483640, 10) != 2 {
+		t.Errorf("sequence numbers must wrap around to 0")
+	}
+}
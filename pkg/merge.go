@@ -0,0 +1,194 @@
+package pkg
+
+import (
+	"bufio"
+	"container/heap"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/lolocompany/kafka-replay/v2/pkg/transcoder"
+)
+
+// DefaultMergeMaxOpen is the default number of inputs merged at once
+const DefaultMergeMaxOpen = 64
+
+// MergeConfig holds configuration for the Merge function
+type MergeConfig struct {
+	Inputs []string // Recording files; on equal timestamps earlier inputs come first
+	Output io.Writer
+	// MaxOpen bounds the number of inputs read at once (default
+	// DefaultMergeMaxOpen). More inputs are merged in rounds through
+	// intermediate files in TempDir, so memory does not grow with the number
+	// of inputs.
+	MaxOpen int
+	TempDir string // Directory for intermediate files (default os.TempDir())
+}
+
+// MergeResult summarizes a merge
+type MergeResult struct {
+	Entries int64 // Entries written
+	Rounds  int   // Merge rounds (1 unless there were more than MaxOpen inputs)
+}
+
+// Merge interleaves several recordings into one by timestamp with a k-way
+// merge. Ties are broken by input order, and entries of one input keep their
+// relative order, so the result is stable. Topic, partition and offset of
+// every entry are kept.
+func Merge(ctx context.Context, cfg MergeConfig) (MergeResult, error) {
+	var result MergeResult
+	if len(cfg.Inputs) == 0 {
+		return result, errors.New("at least one input is required")
+	}
+	if cfg.Output == nil {
+		return result, errors.New("output is required")
+	}
+	if cfg.MaxOpen <= 0 {
+		cfg.MaxOpen = DefaultMergeMaxOpen
+	}
+	if cfg.MaxOpen < 2 {
+		cfg.MaxOpen = 2
+	}
+
+	// Merge consecutive groups into intermediate files until the rest fits.
+	// Groups are contiguous, so the tie-break by input order is preserved.
+	inputs := cfg.Inputs
+	var temps []string
+	defer func() {
+		for _, name := range temps {
+			os.Remove(name)
+		}
+	}()
+	for len(inputs) > cfg.MaxOpen {
+		var next []string
+		for start := 0; start < len(inputs); start += cfg.MaxOpen {
+			group := inputs[start:min(start+cfg.MaxOpen, len(inputs))]
+			if len(group) == 1 {
+				next = append(next, group[0])
+				continue
+			}
+			name, err := mergeToTemp(ctx, group, cfg.TempDir)
+			if err != nil {
+				return result, err
+			}
+			temps = append(temps, name)
+			next = append(next, name)
+		}
+		inputs = next
+		result.Rounds++
+	}
+
+	n, err := mergeFiles(ctx, inputs, cfg.Output)
+	result.Entries = n
+	result.Rounds++
+	return result, err
+}
+
+// mergeToTemp merges inputs into a new temporary file and returns its name
+func mergeToTemp(ctx context.Context, inputs []string, dir string) (string, error) {
+	f, err := os.CreateTemp(dir, "kafka-replay-merge-*.bin")
+	if err != nil {
+		return "", fmt.Errorf("failed to create intermediate file: %w", err)
+	}
+	w := bufio.NewWriter(f)
+	_, err = mergeFiles(ctx, inputs, w)
+	if err == nil {
+		err = w.Flush()
+	}
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(f.Name())
+		return "", err
+	}
+	return f.Name(), nil
+}
+
+// mergeFiles opens inputs and merges them into output
+func mergeFiles(ctx context.Context, inputs []string, output io.Writer) (int64, error) {
+	readers := make([]io.ReadSeeker, 0, len(inputs))
+	for _, name := range inputs {
+		f, err := os.Open(name)
+		if err != nil {
+			return 0, fmt.Errorf("failed to open input file: %w", err)
+		}
+		defer f.Close()
+		readers = append(readers, f)
+	}
+	return mergeReaders(ctx, readers, inputs, output)
+}
+
+// mergeSource is the current entry of one merge input
+type mergeSource struct {
+	index  int
+	reader *entryReader
+	entry  Entry
+}
+
+// mergeHeap orders sources by timestamp, then input order
+type mergeHeap []*mergeSource
+
+func (h mergeHeap) Len() int { return len(h) }
+func (h mergeHeap) Less(i, j int) bool {
+	if !h[i].entry.Time.Equal(h[j].entry.Time) {
+		return h[i].entry.Time.Before(h[j].entry.Time)
+	}
+	return h[i].index < h[j].index
+}
+func (h mergeHeap) Swap(i, j int) { h[i], h[j] = h[j], h[i] }
+func (h *mergeHeap) Push(x any)   { *h = append(*h, x.(*mergeSource)) }
+func (h *mergeHeap) Pop() any {
+	old := *h
+	x := old[len(old)-1]
+	*h = old[:len(old)-1]
+	return x
+}
+
+// mergeReaders merges decoded inputs into output; names are used in errors
+func mergeReaders(ctx context.Context, inputs []io.ReadSeeker, names []string, output io.Writer) (int64, error) {
+	h := make(mergeHeap, 0, len(inputs))
+	for i, in := range inputs {
+		decoder, err := transcoder.NewDecodeReader(in, true)
+		if err != nil {
+			return 0, fmt.Errorf("%s: %w", names[i], err)
+		}
+		src := &mergeSource{index: i, reader: newEntryReader(decoder)}
+		if src.entry, err = src.reader.next(); err != nil {
+			if err == io.EOF {
+				continue
+			}
+			return 0, fmt.Errorf("%s: %w", names[i], err)
+		}
+		h = append(h, src)
+	}
+	heap.Init(&h)
+
+	encoder, err := transcoder.NewEncodeWriter(output)
+	if err != nil {
+		return 0, err
+	}
+	var written int64
+	for h.Len() > 0 {
+		if written%1024 == 0 && ctx.Err() != nil {
+			return written, ctx.Err()
+		}
+		src := h[0]
+		if err := writeEntry(encoder, src.entry); err != nil {
+			return written, err
+		}
+		written++
+
+		if src.entry, err = src.reader.next(); err != nil {
+			if err != io.EOF {
+				return written, fmt.Errorf("%s: %w", names[src.index], err)
+			}
+			heap.Pop(&h)
+			continue
+		}
+		heap.Fix(&h, 0)
+	}
+	return written, nil
+}
@@ -0,0 +1,62 @@
+package pkg
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func writeRecording(t *testing.T, dir, name string, entries []testEntry) string {
+	t.Helper()
+	r := encodeEntries(t, entries)
+	path := filepath.Join(dir, name)
+	data := make([]byte, r.Len())
+	r.Read(data)
+	if err := os.WriteFile(path, data, 0o644); err != nil {
+		t.Fatalf("WriteFile failed: %v", err)
+	}
+	return path
+}
+
+func TestMerge(t *testing.T) {
+	dir := t.TempDir()
+	inputs := []string{
+		writeRecording(t, dir, "a.bin", []testEntry{{"a", "k", "a1", 1}, {"a", "k", "a2", 3}, {"a", "k", "a3", 3}}),
+		writeRecording(t, dir, "b.bin", []testEntry{{"b", "k", "b1", 2}, {"b", "k", "b2", 3}}),
+		writeRecording(t, dir, "empty.bin", nil),
+		writeRecording(t, dir, "c.bin", []testEntry{{"c", "", "c1", 0}, {"c", "", "c2", 3}, {"c", "", "c3", 9}}),
+	}
+	want := []testEntry{
+		{"c", "", "c1", 0},
+		{"a", "k", "a1", 1},
+		{"b", "k", "b1", 2},
+		{"a", "k", "a2", 3}, // Ties in input order, stable within an input
+		{"a", "k", "a3", 3},
+		{"b", "k", "b2", 3},
+		{"c", "", "c2", 3},
+		{"c", "", "c3", 9},
+	}
+
+	for _, maxOpen := range []int{0, 2} { // Single round, and rounds through intermediate files
+		t.Run(fmt.Sprintf("max-open=%d", maxOpen), func(t *testing.T) {
+			var out bytes.Buffer
+			res, err := Merge(context.Background(), MergeConfig{Inputs: inputs, Output: &out, MaxOpen: maxOpen, TempDir: t.TempDir()})
+			if err != nil {
+				t.Fatalf("Merge failed: %v", err)
+			}
+			got := decodeEntries(t, out.Bytes())
+			if fmt.Sprint(got) != fmt.Sprint(want) {
+				t.Errorf("got %v\nwant %v", got, want)
+			}
+			if res.Entries != int64(len(want)) {
+				t.Errorf("Entries = %d, want %d", res.Entries, len(want))
+			}
+			if maxOpen == 2 && res.Rounds < 2 {
+				t.Errorf("expected several rounds, got %d", res.Rounds)
+			}
+		})
+	}
+}
@@ -10,13 +10,15 @@ import (
 	"time"
 
 	kafkapkg "github.com/lolocompany/kafka-replay/v2/pkg/kafka"
+	"github.com/lolocompany/kafka-replay/v2/pkg/ratelimit"
 	"github.com/segmentio/kafka-go"
 )
 
 // MirrorConfig holds configuration for the Mirror function
 type MirrorConfig struct {
 	Consumer   *kafkapkg.Consumer
-	Producer   *kafkapkg.Producer
+	Producer   MessageWriter
+	Topic      string // Destination topic, recorded with dead letters
 	Offset     *int64
 	Limit      int
 	Partition  *int // Optional partition to write to (nil for auto-assignment)
@@ -25,6 +27,12 @@ type MirrorConfig struct {
 	FindBytes  []byte // Optional byte sequence to search for in messages
 	PreserveTimestamps bool // Preserve original message timestamps
 	OnBytesProcessed func(int64) // Optional callback to report bytes processed
+	OnFiltered func() // Optional callback for each message skipped by FindBytes
+	Limiter *ratelimit.Limiter // Optional message and byte rate limit
+	Linger time.Duration // How long a message may wait for its batch to fill (default DefaultLinger)
+	RateTolerance float64 // Allowed deviation from the Limiter's rate (default DefaultRateTolerance)
+	Retry RetryPolicy // Retries of writes that fail with a retriable error (zero for none)
+	DeadLetter *DeadLetter // Optional; records messages that still fail instead of stopping the mirror
 }
 
 func Mirror(ctx context.Context, cfg MirrorConfig) (int64, error) {
@@ -75,7 +83,7 @@ func Mirror(ctx context.Context, cfg MirrorConfig) (int64, error) {
 			}
 
 			// Read next complete message from Kafka consumer
-			timestamp, key, messageData, err := cfg.Consumer.ReadNextMessage(ctx)
+			msg, err := cfg.Consumer.ReadNextMessage(ctx)
 			if err != nil {
 				if err == io.EOF {
 					// End of batch, continue to read next batch
@@ -92,10 +100,14 @@ func Mirror(ctx context.Context, cfg MirrorConfig) (int64, error) {
 				}
 				return
 			}
+			timestamp, key, messageData := msg.Time, msg.Key, msg.Value
 
 			// Filter by find bytes if specified
 			if cfg.FindBytes != nil && !bytes.Contains(messageData, cfg.FindBytes) {
 				// Skip this message, continue to next one
+				if cfg.OnFiltered != nil {
+					cfg.OnFiltered()
+				}
 				continue
 			}
 
@@ -163,45 +175,39 @@ func Mirror(ctx context.Context, cfg MirrorConfig) (int64, error) {
 	}()
 
 	// Writer goroutine: receives messages, batches them, and writes to Kafka
-	var messagesSent int64
-
-	batch := make([]kafka.Message, 0, BatchSize)
-	var batchBytes int64
-
-	flushBatch := func() error {
-		if len(batch) == 0 {
-			return nil
-		}
-
+	sender := delivery{retry: cfg.Retry, deadLetter: cfg.DeadLetter, log: cfg.LogWriter}
+	writer := newBatchWriter(func(ctx context.Context, batch []kafka.Message) error {
 		// In dry-run mode, skip actual writing but still validate
 		// The fact that we got here means reading succeeded, so validation passes
-		if !cfg.DryRun {
-			if err := cfg.Producer.WriteMessages(ctx, batch...); err != nil {
-				return fmt.Errorf("failed to write batch to Kafka: %w", err)
-			}
+		if cfg.DryRun {
+			return nil
+		}
+		if _, err := sender.send(ctx, cfg.Producer, cfg.Topic, "", batch); err != nil {
+			return fmt.Errorf("failed to write batch to Kafka: %w", err)
 		}
-		returnBatchBuffersToPool(batch)
-		messagesSent += int64(len(batch))
-		batch = batch[:0]
-		batchBytes = 0
 		return nil
-	}
+	}, cfg.Limiter, cfg.Linger, cfg.RateTolerance)
 
 	// Receive messages from reader goroutine and batch them
 	for {
 		select {
 		case <-ctx.Done():
 			// Flush any pending batch before returning
-			if err := flushBatch(); err != nil {
-				return messagesSent, err
+			if err := writer.flush(ctx); err != nil {
+				return writer.sent, err
 			}
-			return messagesSent, ctx.Err()
+			return writer.sent, ctx.Err()
 		case err := <-errChan:
 			// Error from reader goroutine
-			if flushErr := flushBatch(); flushErr != nil {
-				return messagesSent, flushErr
+			if flushErr := writer.flush(ctx); flushErr != nil {
+				return writer.sent, flushErr
+			}
+			return writer.sent, err
+		case <-writer.lingerC():
+			// A slow source must not hold messages back
+			if err := writer.flush(ctx); err != nil {
+				return writer.sent, err
 			}
-			return messagesSent, err
 		case msg, ok := <-msgChan:
 			if !ok {
 				// Channel closed, reader finished
@@ -210,31 +216,23 @@ func Mirror(ctx context.Context, cfg MirrorConfig) (int64, error) {
 				case err := <-errChan:
 					if err != nil {
 						// Error occurred, flush batch and return error
-						if flushErr := flushBatch(); flushErr != nil {
-							return messagesSent, flushErr
+						if flushErr := writer.flush(ctx); flushErr != nil {
+							return writer.sent, flushErr
 						}
-						return messagesSent, err
+						return writer.sent, err
 					}
 				default:
 					// No error, proceed normally
 				}
 				// Flush any remaining messages
-				if err := flushBatch(); err != nil {
-					return messagesSent, err
+				if err := writer.flush(ctx); err != nil {
+					return writer.sent, err
 				}
-				return messagesSent, nil
+				return writer.sent, nil
 			}
 
-			// Add message to batch
-			batch = append(batch, msg)
-			batchBytes += int64(len(msg.Value))
-
-			// Flush batch if it reaches size or byte limit
-			// The kafka-go Writer will further batch these internally for optimal throughput
-			if len(batch) >= BatchSize || batchBytes >= BatchBytes {
-				if err := flushBatch(); err != nil {
-					return messagesSent, err
-				}
+			if err := writer.add(ctx, msg); err != nil {
+				return writer.sent, err
 			}
 		}
 	}
@@ -0,0 +1,132 @@
+package ratelimit
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Profile is a rate per second that may change over time.
+type Profile interface {
+	// Rate returns the rate per second after elapsed time
+	Rate(elapsed time.Duration) float64
+	String() string
+}
+
+// Constant is a fixed rate per second.
+type Constant float64
+
+func (c Constant) Rate(time.Duration) float64 { return float64(c) }
+
+func (c Constant) String() string { return formatRate(float64(c)) + "/s" }
+
+// Ramp changes the rate linearly from From to To over Duration and then
+// stays at To.
+type Ramp struct {
+	From, To float64
+	Duration time.Duration
+}
+
+func (r Ramp) Rate(elapsed time.Duration) float64 {
+	if elapsed >= r.Duration {
+		return r.To
+	}
+	return r.From + (r.To-r.From)*float64(elapsed)/float64(r.Duration)
+}
+
+func (r Ramp) String() string {
+	return fmt.Sprintf("%s..%s/s over %s", formatRate(r.From), formatRate(r.To), r.Duration)
+}
+
+// ParseRamp parses a ramp written as FROM..TO/DURATION, e.g. "100..5000/10m".
+func ParseRamp(s string) (Ramp, error) {
+	rates, duration, ok := strings.Cut(s, "/")
+	from, to, ok2 := strings.Cut(rates, "..")
+	if !ok || !ok2 {
+		return Ramp{}, fmt.Errorf("invalid ramp %q (expected FROM..TO/DURATION, e.g. 100..5000/10m)", s)
+	}
+	r := Ramp{}
+	var err error
+	if r.From, err = strconv.ParseFloat(strings.TrimSpace(from), 64); err != nil || r.From < 0 {
+		return Ramp{}, fmt.Errorf("invalid start rate in ramp %q", s)
+	}
+	if r.To, err = strconv.ParseFloat(strings.TrimSpace(to), 64); err != nil || r.To < 0 {
+		return Ramp{}, fmt.Errorf("invalid end rate in ramp %q", s)
+	}
+	if r.From == 0 && r.To == 0 {
+		return Ramp{}, fmt.Errorf("ramp %q never sends anything", s)
+	}
+	if r.Duration, err = time.ParseDuration(strings.TrimSpace(duration)); err != nil || r.Duration <= 0 {
+		return Ramp{}, fmt.Errorf("invalid duration in ramp %q", s)
+	}
+	return r, nil
+}
+
+// Step sets the rate from After onwards.
+type Step struct {
+	After time.Duration `yaml:"after"`
+	Rate  float64       `yaml:"rate"`
+}
+
+// Schedule is a sequence of step changes in rate, sorted by After. The last
+// step's rate holds until the end.
+type Schedule []Step
+
+func (s Schedule) Rate(elapsed time.Duration) float64 {
+	i := sort.Search(len(s), func(i int) bool { return s[i].After > elapsed })
+	if i == 0 {
+		return 0
+	}
+	return s[i-1].Rate
+}
+
+func (s Schedule) String() string {
+	steps := make([]string, len(s))
+	for i, step := range s {
+		steps[i] = fmt.Sprintf("%s/s after %s", formatRate(step.Rate), step.After)
+	}
+	return strings.Join(steps, ", ")
+}
+
+// ParseSchedule parses a YAML schedule such as
+//
+//	steps:
+//	  - after: 0s
+//	    rate: 100
+//	  - after: 5m
+//	    rate: 2000
+//
+// The first step must start at 0s and later steps must come in order.
+func ParseSchedule(data []byte) (Schedule, error) {
+	var doc struct {
+		Steps Schedule `yaml:"steps"`
+	}
+	if err := yaml.Unmarshal(data, &doc); err != nil {
+		return nil, fmt.Errorf("invalid schedule: %w", err)
+	}
+	s := doc.Steps
+	if len(s) == 0 {
+		return nil, errors.New("schedule has no steps")
+	}
+	if s[0].After != 0 {
+		return nil, errors.New("the first step of a schedule must start after 0s")
+	}
+	for i, step := range s {
+		if step.Rate < 0 {
+			return nil, fmt.Errorf("step %d has a negative rate", i+1)
+		}
+		if i > 0 && step.After <= s[i-1].After {
+			return nil, fmt.Errorf("step %d does not start after step %d", i+1, i)
+		}
+	}
+	return s, nil
+}
+
+func formatRate(r float64) string {
+	return strconv.FormatFloat(r, 'f', -1, 64)
+}
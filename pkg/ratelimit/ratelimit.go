@@ -0,0 +1,168 @@
+// Package ratelimit paces a stream of messages with token buckets for
+// messages and bytes per second. The rate of each bucket follows a Profile
+// over time: a constant rate, a linear ramp, or a schedule of step changes.
+package ratelimit
+
+import (
+	"context"
+	"math"
+	"sync"
+	"time"
+)
+
+// maxSleep bounds a single sleep in Wait, so a profile whose rate rises (or
+// resumes after a pause) takes effect promptly
+const maxSleep = 250 * time.Millisecond
+
+// Limiter paces messages against a message rate and a byte rate. Tokens are
+// taken when a message is admitted and may run into debt; Wait blocks until
+// the debt is paid back. Idle time builds up at most one burst of tokens,
+// one second's worth by default. The profiles' clock starts with the first
+// Take. A Limiter is safe for concurrent use.
+type Limiter struct {
+	mu       sync.Mutex
+	messages *bucket
+	bytes    *bucket
+	burst    float64 // Seconds of tokens idle time can build up
+	start    time.Time
+	started  bool
+
+	now   func() time.Time
+	sleep func(ctx context.Context, d time.Duration) error
+}
+
+// New creates a Limiter. A nil profile leaves that dimension unlimited.
+func New(messages, bytes Profile) *Limiter {
+	l := &Limiter{burst: 1, now: time.Now, sleep: sleep}
+	if messages != nil {
+		l.messages = &bucket{profile: messages}
+	}
+	if bytes != nil {
+		l.bytes = &bucket{profile: bytes}
+	}
+	return l
+}
+
+// SetBurst sets how much idle time can build up in tokens: after a pause, up
+// to d worth of the current rate is admitted at once.
+func (l *Limiter) SetBurst(d time.Duration) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.burst = d.Seconds()
+}
+
+// Rates returns the current message and byte rates per second, 0 where
+// unlimited.
+func (l *Limiter) Rates() (messages, bytes float64) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	var elapsed time.Duration
+	if l.started {
+		elapsed = l.now().Sub(l.start)
+	}
+	if l.messages != nil {
+		messages = l.messages.profile.Rate(elapsed)
+	}
+	if l.bytes != nil {
+		bytes = l.bytes.profile.Rate(elapsed)
+	}
+	return messages, bytes
+}
+
+// Take admits messages totalling bytes and returns how long to wait before
+// admitting more (0 if no wait is needed).
+func (l *Limiter) Take(messages, bytes int64) time.Duration {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	elapsed := l.elapsed()
+	if l.messages != nil {
+		l.messages.take(elapsed, l.burst, float64(messages))
+	}
+	if l.bytes != nil {
+		l.bytes.take(elapsed, l.burst, float64(bytes))
+	}
+	return l.delay(elapsed)
+}
+
+// Wait blocks until the tokens taken so far are paid back or ctx is done.
+func (l *Limiter) Wait(ctx context.Context) error {
+	for {
+		l.mu.Lock()
+		d := l.delay(l.elapsed())
+		l.mu.Unlock()
+		if d <= 0 {
+			return nil
+		}
+		if err := l.sleep(ctx, min(d, maxSleep)); err != nil {
+			return err
+		}
+	}
+}
+
+// elapsed returns the time since the first Take, starting the clock if needed
+func (l *Limiter) elapsed() time.Duration {
+	now := l.now()
+	if !l.started {
+		l.start, l.started = now, true
+	}
+	return now.Sub(l.start)
+}
+
+// delay returns the longer of the buckets' waits
+func (l *Limiter) delay(elapsed time.Duration) time.Duration {
+	var d time.Duration
+	for _, b := range []*bucket{l.messages, l.bytes} {
+		if b != nil {
+			d = max(d, b.delay(elapsed, l.burst))
+		}
+	}
+	return d
+}
+
+// bucket is a token bucket whose refill rate follows a profile
+type bucket struct {
+	profile Profile
+	tokens  float64
+	last    time.Duration // Elapsed time of the last refill
+}
+
+// refill adds the tokens since the last refill at the rate the interval
+// started with, so a step up in rate only counts from when it happens
+func (b *bucket) refill(elapsed time.Duration, burst float64) float64 {
+	b.tokens += b.profile.Rate(b.last) * (elapsed - b.last).Seconds()
+	b.last = elapsed
+	rate := b.profile.Rate(elapsed)
+	// Idle time may build up one burst, and always at least one token
+	if limit := math.Max(rate*burst, 1); b.tokens > limit {
+		b.tokens = limit
+	}
+	return rate
+}
+
+func (b *bucket) take(elapsed time.Duration, burst, n float64) {
+	b.refill(elapsed, burst)
+	b.tokens -= n
+}
+
+func (b *bucket) delay(elapsed time.Duration, burst float64) time.Duration {
+	rate := b.refill(elapsed, burst)
+	if b.tokens >= 0 {
+		return 0
+	}
+	if rate <= 0 {
+		// Paused: check the profile again later
+		return maxSleep
+	}
+	return time.Duration(-b.tokens / rate * float64(time.Second))
+}
+
+func sleep(ctx context.Context, d time.Duration) error {
+	t := time.NewTimer(d)
+	defer t.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-t.C:
+		return nil
+	}
+}
@@ -0,0 +1,195 @@
+package ratelimit
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+// fakeClock makes a Limiter sleep in simulated time
+type fakeClock struct{ now time.Time }
+
+func newTestLimiter(messages, bytes Profile) (*Limiter, *fakeClock) {
+	c := &fakeClock{now: time.Unix(0, 0)}
+	l := New(messages, bytes)
+	l.now = func() time.Time { return c.now }
+	l.sleep = func(ctx context.Context, d time.Duration) error {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		c.now = c.now.Add(d)
+		return nil
+	}
+	return l, c
+}
+
+// send admits n messages of size bytes one at a time and returns the
+// simulated time it took
+func send(t *testing.T, l *Limiter, c *fakeClock, n int, size int64) time.Duration {
+	t.Helper()
+	start := c.now
+	for range n {
+		if l.Take(1, size) > 0 {
+			if err := l.Wait(context.Background()); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+	return c.now.Sub(start)
+}
+
+func near(got, want time.Duration) bool {
+	d := got - want
+	return d > -time.Millisecond && d < time.Millisecond
+}
+
+func TestLimiterMessageRate(t *testing.T) {
+	l, c := newTestLimiter(Constant(10), nil)
+	if d := send(t, l, c, 20, 0); !near(d, 2*time.Second) {
+		t.Errorf("20 messages at 10/s took %s, want 2s", d)
+	}
+}
+
+func TestLimiterByteRate(t *testing.T) {
+	l, c := newTestLimiter(nil, Constant(1000))
+	if d := send(t, l, c, 4, 500); !near(d, 2*time.Second) {
+		t.Errorf("2000 bytes at 1000 B/s took %s, want 2s", d)
+	}
+	// The slower of both limits applies
+	l, c = newTestLimiter(Constant(100), Constant(1000))
+	if d := send(t, l, c, 10, 200); !near(d, 2*time.Second) {
+		t.Errorf("took %s, want 2s", d)
+	}
+}
+
+func TestLimiterBurstAfterIdle(t *testing.T) {
+	l, c := newTestLimiter(Constant(10), nil)
+	send(t, l, c, 1, 0)
+	c.now = c.now.Add(time.Minute)
+	// A minute of idle time only builds up one second of tokens
+	if d := l.Take(10, 0); d != 0 {
+		t.Errorf("burst of 10 waits %s", d)
+	}
+	if d := l.Take(1, 0); !near(d, 100*time.Millisecond) {
+		t.Errorf("message after burst waits %s, want 100ms", d)
+	}
+}
+
+func TestLimiterLargeTake(t *testing.T) {
+	l, c := newTestLimiter(Constant(100), nil)
+	if d := l.Take(500, 0); !near(d, 5*time.Second) {
+		t.Errorf("take of 500 at 100/s waits %s, want 5s", d)
+	}
+	if err := l.Wait(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if d := c.now.Sub(time.Unix(0, 0)); !near(d, 5*time.Second) {
+		t.Errorf("waited %s, want 5s", d)
+	}
+}
+
+func TestLimiterRamp(t *testing.T) {
+	l, c := newTestLimiter(Ramp{From: 0, To: 100, Duration: 10 * time.Second}, nil)
+	// The area under the ramp: 500 messages in the first 10s
+	if d := send(t, l, c, 500, 0); d < 9900*time.Millisecond || d > 10100*time.Millisecond {
+		t.Errorf("500 messages took %s, want about 10s", d)
+	}
+	// Then the rate holds at 100/s
+	if d := send(t, l, c, 100, 0); d < 950*time.Millisecond || d > 1050*time.Millisecond {
+		t.Errorf("100 messages took %s, want about 1s", d)
+	}
+}
+
+func TestLimiterSchedulePause(t *testing.T) {
+	s := Schedule{{After: 0, Rate: 10}, {After: time.Second, Rate: 0}, {After: 3 * time.Second, Rate: 10}}
+	l, c := newTestLimiter(s, nil)
+	// 10 messages in the first second, nothing for 2s, then 10 more
+	if d := send(t, l, c, 20, 0); d < 3900*time.Millisecond || d > 4300*time.Millisecond {
+		t.Errorf("20 messages took %s, want about 4s", d)
+	}
+}
+
+func TestLimiterWaitCanceled(t *testing.T) {
+	l, _ := newTestLimiter(Constant(1), nil)
+	l.Take(10, 0)
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if err := l.Wait(ctx); !errors.Is(err, context.Canceled) {
+		t.Errorf("Wait returned %v, want context.Canceled", err)
+	}
+}
+
+func TestParseRamp(t *testing.T) {
+	r, err := ParseRamp("100..5000/10m")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if r != (Ramp{From: 100, To: 5000, Duration: 10 * time.Minute}) {
+		t.Errorf("got %+v", r)
+	}
+	if got := r.Rate(5 * time.Minute); got != 2550 {
+		t.Errorf("rate halfway %g, want 2550", got)
+	}
+	for _, bad := range []string{"", "100", "100..5000", "100-5000/10m", "a..5000/10m", "100..5000/x", "100..5000/0s", "0..0/1m", "-1..10/1m"} {
+		if _, err := ParseRamp(bad); err == nil {
+			t.Errorf("ParseRamp(%q) succeeded", bad)
+		}
+	}
+}
+
+func TestParseSchedule(t *testing.T) {
+	s, err := ParseSchedule([]byte("steps:\n  - after: 0s\n    rate: 100\n  - after: 5m\n    rate: 2000\n  - after: 15m\n    rate: 0\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, c := range []struct {
+		elapsed time.Duration
+		want    float64
+	}{{0, 100}, {5*time.Minute - 1, 100}, {5 * time.Minute, 2000}, {time.Hour, 0}} {
+		if got := s.Rate(c.elapsed); got != c.want {
+			t.Errorf("rate after %s = %g, want %g", c.elapsed, got, c.want)
+		}
+	}
+
+	for _, bad := range []string{
+		"steps: []",
+		"steps:\n  - after: 1m\n    rate: 10\n",
+		"steps:\n  - after: 0s\n    rate: -1\n",
+		"steps:\n  - after: 0s\n    rate: 1\n  - after: 0s\n    rate: 2\n",
+		"steps: nope",
+	} {
+		if _, err := ParseSchedule([]byte(bad)); err == nil {
+			t.Errorf("ParseSchedule(%q) succeeded", bad)
+		}
+	}
+}
+
+func TestLimiterSetBurst(t *testing.T) {
+	l, c := newTestLimiter(Constant(100), nil)
+	l.SetBurst(100 * time.Millisecond)
+	send(t, l, c, 1, 0)
+	c.now = c.now.Add(time.Minute)
+	// A burst of 100ms at 100/s is 10 messages
+	if d := l.Take(10, 0); d != 0 {
+		t.Errorf("burst of 10 waits %s", d)
+	}
+	if d := l.Take(1, 0); !near(d, 10*time.Millisecond) {
+		t.Errorf("message after burst waits %s, want 10ms", d)
+	}
+}
+
+func TestLimiterRates(t *testing.T) {
+	l, c := newTestLimiter(Ramp{From: 100, To: 200, Duration: 10 * time.Second}, Constant(1000))
+	if m, b := l.Rates(); m != 100 || b != 1000 {
+		t.Errorf("rates before start %g, %g", m, b)
+	}
+	l.Take(1, 0)
+	c.now = c.now.Add(5 * time.Second)
+	if m, _ := l.Rates(); m != 150 {
+		t.Errorf("message rate after 5s %g, want 150", m)
+	}
+	if m, b := New(nil, nil).Rates(); m != 0 || b != 0 {
+		t.Errorf("unlimited rates %g, %g", m, b)
+	}
+}
@@ -4,89 +4,650 @@ import (
 	"bytes"
 	"context"
 	"errors"
+	"fmt"
 	"io"
+	"sort"
+	"sync/atomic"
+	"time"
 
 	kafka "github.com/lolocompany/kafka-replay/v2/pkg/kafka"
+	"github.com/lolocompany/kafka-replay/v2/pkg/redact"
+	"github.com/lolocompany/kafka-replay/v2/pkg/sample"
 	"github.com/lolocompany/kafka-replay/v2/pkg/transcoder"
 )
 
+// RecordOrder selects how messages from several partitions are interleaved in
+// a single recording.
+type RecordOrder string
+
+const (
+	// OrderArrival writes messages in the order they are received.
+	OrderArrival RecordOrder = "arrival"
+	// OrderTimestamp merges partitions by message timestamp. Partitions that
+	// have been idle for longer than mergeIdleTimeout do not hold back the others.
+	OrderTimestamp RecordOrder = "timestamp"
+)
+
+// CommitPolicy selects when a consumer group's offsets are committed while recording.
+type CommitPolicy string
+
+const (
+	// CommitNone never commits offsets.
+	CommitNone CommitPolicy = "none"
+	// CommitAfterWrite commits after each written batch has been synced to the output.
+	CommitAfterWrite CommitPolicy = "after-write"
+	// CommitInterval syncs the output and commits at a fixed interval.
+	CommitInterval CommitPolicy = "interval"
+)
+
+const (
+	// finalCommitTimeout bounds the commit made when recording stops
+	finalCommitTimeout = 10 * time.Second
+	// recordQueueSize is the number of messages buffered between the partition
+	// readers and the writer
+	recordQueueSize = 1024
+	// mergeIdleTimeout is how long a timestamp merge waits for a partition
+	// without buffered messages before writing the other partitions past it
+	mergeIdleTimeout = time.Second
+)
+
+// RecordConsumer reads messages for Record: from a single partition, or from
+// the partitions a consumer group assigns. It is implemented by *kafka.Consumer;
+// see there for which methods only apply to one of the two modes.
+type RecordConsumer interface {
+	Topic() string
+	Partition() int // -1 in consumer group mode
+	SetOffset(offset int64) error
+	SeekToTime(t time.Time) error
+	OffsetAfterTime(t time.Time) (int64, error)
+	Position() (int64, error)
+	HighWatermark() (int64, error)
+	ReadNextMessage(ctx context.Context) (kafka.Message, error)
+	ManualCommit() bool
+	Commit(ctx context.Context, msgs ...kafka.Message) error
+	IsolationStats() (aborted int64, control int64)
+}
+
 // RecordConfig holds configuration for the Record function
 type RecordConfig struct {
-	Consumer  *kafka.Consumer
-	Offset    *int64
+	Consumers []RecordConsumer // One consumer per partition, or a single consumer group reader
+	Offset    *int64           // Optional start offset, applied to every partition
+	Since     *time.Time       // Optional start time; resolved to an offset via ListOffsets
+	Until     *time.Time       // Optional end time; each partition stops at its first message after it, or at its high watermark if the time has passed
+	UntilEnd  bool             // Stop each partition at the high watermark captured at start (direct mode only)
 	Output    io.WriteCloser
-	Limit     int
-	FindBytes []byte // Optional byte sequence to search for in messages
+	// OutputForTopic, if set instead of Output, opens one output per topic the
+	// first time a message of that topic is written
+	OutputForTopic func(topic string) (io.WriteCloser, error)
+	// Discover, if set, is called every DiscoverInterval to add consumers for
+	// partitions that appeared after the start (e.g. newly created topics).
+	// Added consumers read from their current position; Offset and Since
+	// only apply to the initial Consumers. Recording then only stops on
+	// Limit, an error or cancellation.
+	Discover         func(ctx context.Context) ([]RecordConsumer, error)
+	DiscoverInterval time.Duration
+	Limit            int
+	FindBytes        []byte           // Optional byte sequence to search for in messages
+	Redactor         *redact.Redactor // Optional redaction applied before messages are written
+	Order            RecordOrder      // How partitions are interleaved (default OrderArrival)
+	// Sampler optionally samples messages after FindBytes. A reservoir sample
+	// is written when recording stops, and offsets are only committed after it.
+	Sampler *sample.Sampler
+	// Commit controls when offsets of manually committing consumers (see
+	// kafka.NewGroupConsumer) are committed; other consumers never commit here
+	Commit      CommitPolicy
+	CommitEvery time.Duration // Commit interval for CommitInterval
+}
+
+// PartitionStats holds per-partition counts of a recording
+type PartitionStats struct {
+	Topic         string
+	Partition     int
+	Messages      int64
+	FirstOffset   int64 // -1 if no message was recorded
+	LastOffset    int64 // -1 if no message was recorded
+	HighWatermark int64 // High watermark captured at start (-1 unless UntilEnd)
+}
+
+// RecordResult summarizes a recording
+type RecordResult struct {
+	Bytes      int64 // Total bytes written to all outputs
+	Messages   int64
+	Commits    int64            // Number of offset commits (consumer group mode)
+	Filtered   int64            // Messages skipped by FindBytes
+	SampledOut int64            // Messages dropped by sampling
+	Aborted    int64            // Aborted transactional records skipped (read_committed)
+	Control    int64            // Transaction markers skipped (read_committed)
+	Partitions []PartitionStats // Sorted by topic and partition
+}
+
+// recordItem is a message (or end-of-partition marker) passed from a
+// partition reader to the writer
+type recordItem struct {
+	source int
+	msg    kafka.Message
+	skip   bool // Filtered out; only its offset is committed
+	done   bool
 }
 
-func Record(ctx context.Context, cfg RecordConfig) (int64, int64, error) {
-	if cfg.Consumer == nil {
-		return 0, 0, errors.New("consumer is required")
+func Record(ctx context.Context, cfg RecordConfig) (RecordResult, error) {
+	if len(cfg.Consumers) == 0 && cfg.Discover == nil {
+		return RecordResult{}, errors.New("consumer is required")
+	}
+	if (cfg.Output == nil) == (cfg.OutputForTopic == nil) {
+		return RecordResult{}, errors.New("exactly one of output or output for topic is required")
 	}
-	if cfg.Output == nil {
-		return 0, 0, errors.New("output is required")
+	if cfg.Discover != nil && cfg.DiscoverInterval <= 0 {
+		return RecordResult{}, errors.New("discover interval must be positive")
+	}
+	if cfg.Limit > 0 && cfg.Sampler != nil && !cfg.Sampler.Streaming() {
+		return RecordResult{}, errors.New("a limit cannot be combined with a sample size")
+	}
+	if cfg.Discover != nil && cfg.UntilEnd {
+		return RecordResult{}, errors.New("discovery cannot be combined with stopping at the high watermark")
+	}
+	switch cfg.Commit {
+	case "":
+		cfg.Commit = CommitNone
+	case CommitNone, CommitAfterWrite:
+	case CommitInterval:
+		if cfg.CommitEvery <= 0 {
+			return RecordResult{}, errors.New("commit interval must be positive")
+		}
+	default:
+		return RecordResult{}, fmt.Errorf("unsupported commit policy %q (use %s, %s or %s)", cfg.Commit, CommitNone, CommitAfterWrite, CommitInterval)
+	}
+	switch cfg.Order {
+	case "":
+		cfg.Order = OrderArrival
+	case OrderArrival, OrderTimestamp:
+	default:
+		return RecordResult{}, fmt.Errorf("unsupported order %q (use %s or %s)", cfg.Order, OrderArrival, OrderTimestamp)
 	}
 
-	// Set offset if specified
-	// Note: When using consumer groups, SetOffset will fail as offsets are managed automatically.
-	// In that case, we skip setting the offset and let the consumer group handle it.
-	if cfg.Offset != nil {
-		if err := cfg.Consumer.SetOffset(*cfg.Offset); err != nil {
-			// If SetOffset fails (e.g., when using consumer groups), we continue anyway.
-			// Consumer groups manage offsets automatically, so this is expected behavior.
-			// We only return the error if it's not related to consumer group offset management.
-			// For now, we'll just log and continue - consumer groups will use committed offsets.
+	stats := make(map[string]*PartitionStats)
+	trackPartition := func(consumer RecordConsumer) {
+		// Direct partition consumers are reported even when nothing is recorded
+		if consumer.Partition() >= 0 {
+			stats[partitionID(consumer.Topic(), consumer.Partition())] = &PartitionStats{
+				Topic:         consumer.Topic(),
+				Partition:     consumer.Partition(),
+				FirstOffset:   -1,
+				LastOffset:    -1,
+				HighWatermark: -1,
+			}
 		}
 	}
 
-	// Create message encoder
-	encoder, err := transcoder.NewEncodeWriter(cfg.Output)
-	if err != nil {
-		return 0, 0, err
+	ends := make([]int64, len(cfg.Consumers))
+	for i, consumer := range cfg.Consumers {
+		ends[i] = -1
+		// Set offset if specified
+		// Note: When using consumer groups, SetOffset will fail as offsets are managed automatically.
+		// In that case, we skip setting the offset and let the consumer group handle it.
+		if cfg.Offset != nil {
+			_ = consumer.SetOffset(*cfg.Offset)
+		}
+
+		// Resolve the start time to an offset. Unlike --offset this is not optional
+		// best-effort: recording from the wrong position would silently widen the window.
+		if cfg.Since != nil {
+			if err := consumer.SeekToTime(*cfg.Since); err != nil {
+				return RecordResult{}, err
+			}
+		}
+		trackPartition(consumer)
 	}
-	defer encoder.Close()
 
-	var messageCount int64
+	// Capture every high watermark before reading anything, so the snapshot
+	// covers the same point in time on all partitions
+	if cfg.UntilEnd {
+		for i, consumer := range cfg.Consumers {
+			end, err := consumer.HighWatermark()
+			if err != nil {
+				return RecordResult{}, err
+			}
+			ends[i] = end
+			stats[partitionID(consumer.Topic(), consumer.Partition())].HighWatermark = end
+		}
+	}
 
-	for {
-		// Check if we've reached the message limit
-		if cfg.Limit > 0 && messageCount >= int64(cfg.Limit) {
-			break
+	// Resolve the end time to offsets, so that partitions without messages
+	// after it stop too: at the first message after it, or at the high
+	// watermark if there is none. An end time still in the future has no
+	// offsets yet, so then each partition stops at its first message after it.
+	if cfg.Until != nil && !cfg.Until.After(time.Now()) {
+		for i, consumer := range cfg.Consumers {
+			if consumer.Partition() < 0 {
+				continue
+			}
+			end, err := consumer.OffsetAfterTime(*cfg.Until)
+			if err == nil && end < 0 {
+				end, err = consumer.HighWatermark()
+			}
+			if err != nil {
+				return RecordResult{}, err
+			}
+			if ends[i] < 0 || end < ends[i] {
+				ends[i] = end
+			}
+		}
+	}
+
+	// Create message encoders: a single one, or one per topic on first use
+	var encoder *transcoder.EncodeWriter
+	encoders := make(map[string]*transcoder.EncodeWriter)
+	var err error
+	if cfg.Output != nil {
+		encoder, err = transcoder.NewEncodeWriter(cfg.Output)
+		if err != nil {
+			return RecordResult{}, err
+		}
+		defer encoder.Close()
+	} else {
+		defer func() {
+			for _, e := range encoders {
+				e.Close()
+			}
+		}()
+	}
+	encoderFor := func(topic string) (*transcoder.EncodeWriter, error) {
+		if encoder != nil {
+			return encoder, nil
 		}
+		if e, ok := encoders[topic]; ok {
+			return e, nil
+		}
+		output, err := cfg.OutputForTopic(topic)
+		if err != nil {
+			return nil, err
+		}
+		e, err := transcoder.NewEncodeWriter(output)
+		if err != nil {
+			output.Close()
+			return nil, err
+		}
+		encoders[topic] = e
+		return e, nil
+	}
+
+	// Readers are stopped when the writer returns (limit reached or error)
+	readCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	// Every reader sends an end-of-partition marker when it returns; errors
+	// are sent to errChan first, so they are visible once the marker arrives
+	items := make(chan recordItem, recordQueueSize)
+	errChan := make(chan error, 1)
+	active := 0
+	var filtered atomic.Int64
+
+	// Timestamp merge state: one queue per reader
+	var queues [][]recordItem
+	var open []bool
+	var lastSeen []time.Time
+	sources := make([]RecordConsumer, 0, len(cfg.Consumers))
+
+	startReader := func(consumer RecordConsumer, end int64) {
+		source := len(queues)
+		queues = append(queues, nil)
+		open = append(open, true)
+		lastSeen = append(lastSeen, time.Now())
+		sources = append(sources, consumer)
+		active++
+		go func() {
+			if err := readPartition(readCtx, source, consumer, end, cfg, items, &filtered); err != nil {
+				select {
+				case errChan <- err:
+				default:
+				}
+			}
+			select {
+			case items <- recordItem{source: source, done: true}:
+			case <-readCtx.Done():
+			}
+		}()
+	}
+	for i, consumer := range cfg.Consumers {
+		startReader(consumer, ends[i])
+	}
+
+	// A reservoir sample is only known once recording stops. Offsets are not
+	// committed before it has been written.
+	var reservoir *sample.Reservoir[kafka.Message]
+	if cfg.Sampler != nil && !cfg.Sampler.Streaming() {
+		reservoir = sample.NewReservoir[kafka.Message](cfg.Sampler)
+	}
+	holdCommits := reservoir != nil
+
+	var messageCount, commits, sampledOut int64
+	result := func() RecordResult {
+		r := RecordResult{Messages: messageCount, Commits: commits, Filtered: filtered.Load(), SampledOut: sampledOut}
+		for _, consumer := range sources {
+			aborted, control := consumer.IsolationStats()
+			r.Aborted += aborted
+			r.Control += control
+		}
+		if encoder != nil {
+			r.Bytes = encoder.TotalBytes()
+		}
+		for _, e := range encoders {
+			r.Bytes += e.TotalBytes()
+		}
+		for _, s := range stats {
+			r.Partitions = append(r.Partitions, *s)
+		}
+		sort.Slice(r.Partitions, func(i, j int) bool {
+			if r.Partitions[i].Topic != r.Partitions[j].Topic {
+				return r.Partitions[i].Topic < r.Partitions[j].Topic
+			}
+			return r.Partitions[i].Partition < r.Partitions[j].Partition
+		})
+		return r
+	}
+
+	// Offsets waiting to be committed: the last handled message per partition
+	// of each manually committing consumer
+	pending := make(map[string]recordItem)
+	uncommitted := 0
 
-		// Check context cancellation
+	// commit makes everything written so far durable and then commits the
+	// pending offsets, so a committed offset is never ahead of the file
+	commit := func(ctx context.Context) error {
+		if len(pending) == 0 || holdCommits {
+			return nil
+		}
+		if encoder != nil {
+			if err := encoder.Sync(); err != nil {
+				return fmt.Errorf("failed to sync output: %w", err)
+			}
+		}
+		for _, e := range encoders {
+			if err := e.Sync(); err != nil {
+				return fmt.Errorf("failed to sync output: %w", err)
+			}
+		}
+		bySource := make(map[int][]kafka.Message)
+		for _, item := range pending {
+			bySource[item.source] = append(bySource[item.source], item.msg)
+		}
+		for source, msgs := range bySource {
+			if err := sources[source].Commit(ctx, msgs...); err != nil {
+				return err
+			}
+		}
+		clear(pending)
+		uncommitted = 0
+		commits++
+		return nil
+	}
+
+	// write writes a single message; it reports whether the limit was reached
+	write := func(msg kafka.Message) (bool, error) {
+		key, value := msg.Key, msg.Value
+		var err error
+		// Redact before anything reaches the output
+		if cfg.Redactor != nil {
+			if key, value, err = cfg.Redactor.Apply(key, value); err != nil {
+				return false, err
+			}
+		}
+
+		enc, err := encoderFor(msg.Topic)
+		if err != nil {
+			return false, err
+		}
+		if _, err := enc.WriteEntry(msg.Time, value, key, transcoder.EntryMetadata{
+			Topic:     msg.Topic,
+			Partition: msg.Partition,
+			Offset:    msg.Offset,
+		}); err != nil {
+			return false, err
+		}
+		messageCount++
+
+		id := partitionID(msg.Topic, msg.Partition)
+		s, ok := stats[id]
+		if !ok {
+			s = &PartitionStats{Topic: msg.Topic, Partition: msg.Partition, HighWatermark: -1}
+			stats[id] = s
+		}
+		if s.Messages == 0 {
+			s.FirstOffset = msg.Offset
+		}
+		s.Messages++
+		s.LastOffset = msg.Offset
+
+		return cfg.Limit > 0 && messageCount >= int64(cfg.Limit), nil
+	}
+
+	// handle writes a single message unless it is filtered or sampled out, in
+	// which case only its offset is recorded; it reports whether the limit was reached
+	handle := func(item recordItem) (bool, error) {
+		msg := item.msg
+		if cfg.Commit != CommitNone && sources[item.source].ManualCommit() {
+			pending[partitionID(msg.Topic, msg.Partition)] = recordItem{source: item.source, msg: kafka.Message{
+				Topic:     msg.Topic,
+				Partition: msg.Partition,
+				Offset:    msg.Offset,
+			}}
+			uncommitted++
+		}
+		if item.skip {
+			return false, nil
+		}
+		if reservoir != nil {
+			reservoir.Add(msg)
+			return false, nil
+		}
+		if cfg.Sampler != nil && !cfg.Sampler.Keep(msg.Key) {
+			sampledOut++
+			return false, nil
+		}
+		return write(msg)
+	}
+
+	// emitMerged writes queued messages in timestamp order for as long as no
+	// active partition could still deliver an earlier message
+	emitMerged := func(now time.Time) (bool, error) {
+		for {
+			best := -1
+			for i := range queues {
+				if len(queues[i]) == 0 {
+					if open[i] && now.Sub(lastSeen[i]) < mergeIdleTimeout {
+						return false, nil
+					}
+					continue
+				}
+				if best < 0 || queues[i][0].msg.Time.Before(queues[best][0].msg.Time) {
+					best = i
+				}
+			}
+			if best < 0 {
+				return false, nil
+			}
+			item := queues[best][0]
+			queues[best] = queues[best][1:]
+			if done, err := handle(item); done || err != nil {
+				return done, err
+			}
+		}
+	}
+
+	var tick <-chan time.Time
+	if cfg.Order == OrderTimestamp {
+		ticker := time.NewTicker(mergeIdleTimeout / 2)
+		defer ticker.Stop()
+		tick = ticker.C
+	}
+	var discoverTick <-chan time.Time
+	if cfg.Discover != nil {
+		ticker := time.NewTicker(cfg.DiscoverInterval)
+		defer ticker.Stop()
+		discoverTick = ticker.C
+	}
+	var commitTick <-chan time.Time
+	if cfg.Commit == CommitInterval {
+		ticker := time.NewTicker(cfg.CommitEvery)
+		defer ticker.Stop()
+		commitTick = ticker.C
+	}
+
+	run := func() error {
+		for active > 0 || cfg.Discover != nil {
+			select {
+			case <-ctx.Done():
+				return ctx.Err()
+			case err := <-errChan:
+				return err
+			case now := <-tick:
+				if done, err := emitMerged(now); done || err != nil {
+					return err
+				}
+			case <-commitTick:
+				if err := commit(ctx); err != nil {
+					return err
+				}
+			case <-discoverTick:
+				added, err := cfg.Discover(ctx)
+				if err != nil {
+					return err
+				}
+				for _, consumer := range added {
+					trackPartition(consumer)
+					startReader(consumer, -1)
+				}
+			case item := <-items:
+				if item.done {
+					active--
+					open[item.source] = false
+				} else if cfg.Order == OrderArrival {
+					if done, err := handle(item); done || err != nil {
+						return err
+					}
+				} else {
+					queues[item.source] = append(queues[item.source], item)
+					lastSeen[item.source] = time.Now()
+				}
+				if cfg.Order == OrderTimestamp {
+					if done, err := emitMerged(time.Now()); done || err != nil {
+						return err
+					}
+				}
+				// Commit once the readers have nothing more queued, or at
+				// least every BatchSize messages under sustained load
+				if cfg.Commit == CommitAfterWrite && (len(items) == 0 || uncommitted >= BatchSize) {
+					if err := commit(ctx); err != nil {
+						return err
+					}
+				}
+			}
+		}
+
+		// All readers finished; check for an error before returning
 		select {
-		case <-ctx.Done():
-			return encoder.TotalBytes(), messageCount, ctx.Err()
+		case err := <-errChan:
+			return err
 		default:
 		}
+		return nil
+	}
+
+	err = run()
+
+	// Write the reservoir sample when recording ends or is stopped, but not
+	// after a failure
+	if reservoir != nil && (err == nil || ctx.Err() != nil) {
+		items := reservoir.Items()
+		sampledOut = reservoir.Seen() - int64(len(items))
+		for _, msg := range items {
+			if _, writeErr := write(msg); writeErr != nil {
+				return result(), writeErr
+			}
+		}
+		holdCommits = false
+	}
 
+	// Commit what has been written, even when stopped by cancellation or the
+	// limit. The context may already be done, so the final commit gets its own.
+	if cfg.Commit != CommitNone {
+		commitCtx, cancelCommit := context.WithTimeout(context.Background(), finalCommitTimeout)
+		defer cancelCommit()
+		if commitErr := commit(commitCtx); commitErr != nil && err == nil {
+			err = commitErr
+		}
+	}
+	return result(), err
+}
+
+// readPartition reads messages from a single consumer and passes the ones
+// matching the filters to the writer, counting the others in filtered. It
+// returns when the partition has moved past cfg.Until or reached end (the
+// captured high watermark, -1 for none).
+func readPartition(ctx context.Context, source int, consumer RecordConsumer, end int64, cfg RecordConfig, items chan<- recordItem, filtered *atomic.Int64) error {
+	// reachedEnd checks the consumer position; it is called between batches so
+	// trailing control records or compacted gaps cannot keep the reader waiting
+	reachedEnd := func() (bool, error) {
+		if end < 0 {
+			return false, nil
+		}
+		pos, err := consumer.Position()
+		if err != nil {
+			return false, err
+		}
+		return pos >= end, nil
+	}
+
+	if done, err := reachedEnd(); err != nil || done {
+		return err
+	}
+
+	commitsOffsets := cfg.Commit != CommitNone && consumer.ManualCommit()
+	for {
 		// Read next complete message
-		timestamp, key, messageData, err := cfg.Consumer.ReadNextMessage(ctx)
+		msg, err := consumer.ReadNextMessage(ctx)
 		if err != nil {
 			if err == io.EOF {
 				// End of batch, continue to read next batch
+				if done, err := reachedEnd(); err != nil || done {
+					return err
+				}
 				continue
 			}
-			// Check if context was canceled
+			// Cancellation is reported by the writer
 			if ctx.Err() != nil {
-				return encoder.TotalBytes(), messageCount, ctx.Err()
+				return nil
 			}
-			return encoder.TotalBytes(), messageCount, err
+			return err
 		}
 
-		// Filter by find bytes if specified
-		if cfg.FindBytes != nil && !bytes.Contains(messageData, cfg.FindBytes) {
-			// Skip this message, continue to next one
-			continue
+		// Stop once the partition has moved past the requested time window
+		if cfg.Until != nil && msg.Time.After(*cfg.Until) {
+			return nil
 		}
 
-		// Write the matching message (version 2 format with key)
-		if _, err := encoder.Write(timestamp, messageData, key); err != nil {
-			return encoder.TotalBytes(), messageCount, err
+		// Filter by find bytes if specified. Filtered messages are still
+		// passed on when offsets are committed, so the commit can move past them.
+		skip := cfg.FindBytes != nil && !bytes.Contains(msg.Value, cfg.FindBytes)
+		if skip {
+			filtered.Add(1)
+		}
+		if !skip || commitsOffsets {
+			select {
+			case items <- recordItem{source: source, msg: msg, skip: skip}:
+			case <-ctx.Done():
+				return nil
+			}
+		}
+
+		// The last message before the captured high watermark ends the snapshot
+		if end >= 0 && msg.Offset+1 >= end {
+			return nil
 		}
-		messageCount++
 	}
+}
 
-	return encoder.TotalBytes(), messageCount, nil
+// partitionID identifies a topic partition in the per-partition stats
+func partitionID(topic string, partition int) string {
+	return fmt.Sprintf("%s/%d", topic, partition)
 }
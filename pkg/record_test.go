@@ -0,0 +1,470 @@
+package pkg
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"reflect"
+	"sort"
+	"testing"
+	"time"
+
+	kafka "github.com/lolocompany/kafka-replay/v2/pkg/kafka"
+	"github.com/lolocompany/kafka-replay/v2/pkg/sample"
+	"github.com/lolocompany/kafka-replay/v2/pkg/transcoder"
+)
+
+// fakeConsumer serves msgs like a consumer of a single partition, or like a
+// manually committing consumer group reader with group. Once they are
+// exhausted it reports the end of a batch with eof, and otherwise waits like
+// a consumer at the end of a partition.
+type fakeConsumer struct {
+	topic     string
+	partition int
+	msgs      []kafka.Message
+	end       int64 // Position once msgs are exhausted
+	hwm       int64 // Returned by HighWatermark
+	eof       bool
+	next      int
+
+	group    bool
+	delay    time.Duration                    // Wait before each message
+	onCommit func(msgs []kafka.Message) error // Called by Commit in group mode
+	onEnd    func()                           // Called once msgs are exhausted
+}
+
+// newFakeConsumer returns a consumer of partition with a message at each of
+// offsets, timestamped ms milliseconds after the epoch. Its high watermark
+// follows the last message.
+func newFakeConsumer(partition int, offsets []int64, ms []int64) *fakeConsumer {
+	c := &fakeConsumer{topic: "t", partition: partition}
+	for i, offset := range offsets {
+		c.msgs = append(c.msgs, kafka.Message{
+			Topic:     "t",
+			Partition: partition,
+			Offset:    offset,
+			Time:      time.UnixMilli(ms[i]),
+			Value:     []byte(fmt.Sprintf("%d/%d", partition, offset)),
+		})
+		c.end = offset + 1
+	}
+	c.hwm = c.end
+	return c
+}
+
+func (c *fakeConsumer) Topic() string                  { return c.topic }
+func (c *fakeConsumer) ManualCommit() bool             { return c.group }
+func (c *fakeConsumer) SetOffset(offset int64) error   { return nil }
+func (c *fakeConsumer) SeekToTime(t time.Time) error   { return nil }
+func (c *fakeConsumer) HighWatermark() (int64, error)  { return c.hwm, nil }
+func (c *fakeConsumer) IsolationStats() (int64, int64) { return 0, 0 }
+
+func (c *fakeConsumer) OffsetAfterTime(t time.Time) (int64, error) {
+	for _, m := range c.msgs {
+		if m.Time.After(t) {
+			return m.Offset, nil
+		}
+	}
+	return -1, nil
+}
+
+func (c *fakeConsumer) Partition() int {
+	if c.group {
+		return -1
+	}
+	return c.partition
+}
+
+func (c *fakeConsumer) Commit(ctx context.Context, msgs ...kafka.Message) error {
+	if !c.group {
+		return fmt.Errorf("Commit is only supported when using consumer groups")
+	}
+	return c.onCommit(msgs)
+}
+
+func (c *fakeConsumer) Position() (int64, error) {
+	if c.next < len(c.msgs) {
+		return c.msgs[c.next].Offset, nil
+	}
+	return c.end, nil
+}
+
+func (c *fakeConsumer) ReadNextMessage(ctx context.Context) (kafka.Message, error) {
+	if c.next < len(c.msgs) {
+		time.Sleep(c.delay)
+		c.next++
+		if c.next == len(c.msgs) && c.onEnd != nil {
+			c.onEnd()
+		}
+		return c.msgs[c.next-1], nil
+	}
+	if c.eof {
+		return kafka.Message{}, io.EOF
+	}
+	<-ctx.Done()
+	return kafka.Message{}, ctx.Err()
+}
+
+// recordedMessages decodes a recording into messages with their source
+// partition and offset
+func recordedMessages(t *testing.T, data []byte) []kafka.Message {
+	t.Helper()
+	dec, err := transcoder.NewDecodeReader(bytes.NewReader(data), true)
+	if err != nil {
+		t.Fatalf("NewDecodeReader failed: %v", err)
+	}
+	r := newEntryReader(dec)
+	var out []kafka.Message
+	for {
+		e, err := r.next()
+		if err == io.EOF {
+			return out
+		}
+		if err != nil {
+			t.Fatalf("read failed: %v", err)
+		}
+		out = append(out, kafka.Message{
+			Topic:     e.Metadata.Topic,
+			Partition: e.Metadata.Partition,
+			Offset:    e.Metadata.Offset,
+			Time:      e.Time,
+			Value:     bytes.Clone(e.Value),
+		})
+	}
+}
+
+// nopCloser is an in-memory recording output
+type nopCloser struct {
+	bytes.Buffer
+}
+
+func (*nopCloser) Close() error { return nil }
+
+// record runs Record with a deadline, so that a reader that never stops fails
+// the test instead of hanging it
+func record(t *testing.T, cfg RecordConfig) (RecordResult, []kafka.Message, error) {
+	t.Helper()
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	out := &nopCloser{}
+	if cfg.Output == nil {
+		cfg.Output = out
+	}
+	result, err := Record(ctx, cfg)
+	if ctx.Err() != nil {
+		t.Fatalf("Record did not stop: %v", err)
+	}
+	if out, ok := cfg.Output.(*nopCloser); ok {
+		return result, recordedMessages(t, out.Bytes()), err
+	}
+	return result, nil, err
+}
+
+func TestRecord_ArrivalOrder(t *testing.T) {
+	p0 := newFakeConsumer(0, []int64{0, 1, 2}, []int64{30, 10, 20})
+	p1 := newFakeConsumer(1, []int64{0, 1}, []int64{5, 15})
+	p0.eof, p1.eof = true, true
+
+	result, got, err := record(t, RecordConfig{Consumers: []RecordConsumer{p0, p1}, UntilEnd: true})
+	if err != nil {
+		t.Fatalf("Record failed: %v", err)
+	}
+	if result.Messages != 5 || len(got) != 5 {
+		t.Fatalf("recorded %d messages (%d in the file), want 5", result.Messages, len(got))
+	}
+	// Partitions interleave as they arrive, but each keeps its own order
+	next := map[int]int{}
+	for _, m := range got {
+		want := []*fakeConsumer{p0, p1}[m.Partition].msgs[next[m.Partition]]
+		if m.Offset != want.Offset || !m.Time.Equal(want.Time) || m.Topic != "t" {
+			t.Errorf("got partition %d offset %d at %v, want offset %d at %v", m.Partition, m.Offset, m.Time, want.Offset, want.Time)
+		}
+		next[m.Partition]++
+	}
+}
+
+func TestRecord_TimestampMerge(t *testing.T) {
+	p0 := newFakeConsumer(0, []int64{0, 1, 2}, []int64{1, 4, 5})
+	// Partition 1 goes idle after two messages, without reaching its high
+	// watermark; the merge must not wait for it forever
+	p1 := newFakeConsumer(1, []int64{0, 1}, []int64{2, 3})
+
+	start := time.Now()
+	_, got, err := record(t, RecordConfig{Consumers: []RecordConsumer{p0, p1}, Order: OrderTimestamp, Limit: 5})
+	if err != nil {
+		t.Fatalf("Record failed: %v", err)
+	}
+	var times []int64
+	for _, m := range got {
+		times = append(times, m.Time.UnixMilli())
+	}
+	if want := []int64{1, 2, 3, 4, 5}; !reflect.DeepEqual(times, want) {
+		t.Errorf("timestamps %v, want %v", times, want)
+	}
+	if elapsed := time.Since(start); elapsed < mergeIdleTimeout {
+		t.Errorf("messages after the idle partition written after %s, want at least %s", elapsed, mergeIdleTimeout)
+	}
+}
+
+func TestRecord_Limit(t *testing.T) {
+	offsets := []int64{0, 1, 2, 3, 4, 5, 6, 7}
+	for _, order := range []RecordOrder{OrderArrival, OrderTimestamp} {
+		p0 := newFakeConsumer(0, offsets, offsets)
+		p1 := newFakeConsumer(1, offsets, offsets)
+		result, got, err := record(t, RecordConfig{Consumers: []RecordConsumer{p0, p1}, Order: order, Limit: 5})
+		if err != nil {
+			t.Fatalf("Record with %s order failed: %v", order, err)
+		}
+		if result.Messages != 5 || len(got) != 5 {
+			t.Errorf("%s order recorded %d messages (%d in the file), want 5", order, result.Messages, len(got))
+		}
+		var counted int64
+		for _, p := range result.Partitions {
+			counted += p.Messages
+		}
+		if counted != 5 {
+			t.Errorf("%s order counted %d messages in the partition stats, want 5", order, counted)
+		}
+	}
+}
+
+func TestRecord_PartitionStats(t *testing.T) {
+	// Offsets with compacted gaps, and a partition without messages
+	p0 := newFakeConsumer(0, []int64{100, 102, 105}, []int64{1, 2, 3})
+	p1 := newFakeConsumer(1, []int64{7}, []int64{4})
+	p2 := newFakeConsumer(2, nil, nil)
+	p2.end, p2.hwm = 40, 40
+	for _, c := range []*fakeConsumer{p0, p1, p2} {
+		c.eof = true
+	}
+
+	result, _, err := record(t, RecordConfig{Consumers: []RecordConsumer{p2, p0, p1}, UntilEnd: true})
+	if err != nil {
+		t.Fatalf("Record failed: %v", err)
+	}
+	want := []PartitionStats{
+		{Topic: "t", Partition: 0, Messages: 3, FirstOffset: 100, LastOffset: 105, HighWatermark: 106},
+		{Topic: "t", Partition: 1, Messages: 1, FirstOffset: 7, LastOffset: 7, HighWatermark: 8},
+		{Topic: "t", Partition: 2, Messages: 0, FirstOffset: -1, LastOffset: -1, HighWatermark: 40},
+	}
+	if !reflect.DeepEqual(result.Partitions, want) {
+		t.Errorf("partition stats\n%+v\nwant\n%+v", result.Partitions, want)
+	}
+}
+
+func TestRecord_UntilEnd(t *testing.T) {
+	for _, c := range []struct {
+		name     string
+		consumer func() *fakeConsumer
+		find     []byte
+		want     []int64 // Recorded offsets
+	}{
+		{"messages after the high watermark", func() *fakeConsumer {
+			c := newFakeConsumer(0, []int64{0, 1, 2, 3, 4}, []int64{1, 2, 3, 4, 5})
+			c.hwm = 3
+			return c
+		}, nil, []int64{0, 1, 2}},
+		{"trailing control records", func() *fakeConsumer {
+			// Transaction markers at offsets 5 and 6 are never returned as messages
+			c := newFakeConsumer(0, []int64{0, 1, 2, 3, 4}, []int64{1, 2, 3, 4, 5})
+			c.end, c.hwm, c.eof = 7, 7, true
+			return c
+		}, nil, []int64{0, 1, 2, 3, 4}},
+		{"compacted gaps", func() *fakeConsumer {
+			return newFakeConsumer(0, []int64{0, 3, 9}, []int64{1, 2, 3})
+		}, nil, []int64{0, 3, 9}},
+		{"compacted tail", func() *fakeConsumer {
+			c := newFakeConsumer(0, []int64{0, 3}, []int64{1, 2})
+			c.end, c.hwm, c.eof = 10, 10, true
+			return c
+		}, nil, []int64{0, 3}},
+		{"empty partition", func() *fakeConsumer {
+			// Reading would wait for new messages
+			c := newFakeConsumer(0, nil, nil)
+			c.end, c.hwm = 5, 5
+			return c
+		}, nil, nil},
+		{"last message filtered", func() *fakeConsumer {
+			c := newFakeConsumer(0, []int64{0, 1, 2}, []int64{1, 2, 3})
+			c.msgs[2].Value = []byte("other")
+			return c
+		}, []byte("0/"), []int64{0, 1}},
+	} {
+		t.Run(c.name, func(t *testing.T) {
+			consumer := c.consumer()
+			result, got, err := record(t, RecordConfig{Consumers: []RecordConsumer{consumer}, UntilEnd: true, FindBytes: c.find})
+			if err != nil {
+				t.Fatalf("Record failed: %v", err)
+			}
+			var offsets []int64
+			for _, m := range got {
+				offsets = append(offsets, m.Offset)
+			}
+			if !reflect.DeepEqual(offsets, c.want) {
+				t.Errorf("recorded offsets %v, want %v", offsets, c.want)
+			}
+			if len(result.Partitions) != 1 || result.Partitions[0].Messages != int64(len(c.want)) || result.Partitions[0].HighWatermark != consumer.hwm {
+				t.Errorf("partition stats %+v, want %d messages and high watermark %d", result.Partitions, len(c.want), consumer.hwm)
+			}
+		})
+	}
+}
+
+func TestRecord_Until(t *testing.T) {
+	// Partition 0 has no message after the end time and would wait for one
+	p0 := newFakeConsumer(0, []int64{0, 1}, []int64{10, 20})
+	p1 := newFakeConsumer(1, []int64{0, 1, 2}, []int64{10, 20, 30})
+	until := time.UnixMilli(25)
+	result, got, err := record(t, RecordConfig{Consumers: []RecordConsumer{p0, p1}, Until: &until})
+	if err != nil {
+		t.Fatalf("Record failed: %v", err)
+	}
+	var recorded []string
+	for _, m := range got {
+		recorded = append(recorded, string(m.Value))
+	}
+	sort.Strings(recorded)
+	if want := []string{"0/0", "0/1", "1/0", "1/1"}; !reflect.DeepEqual(recorded, want) || result.Messages != 4 {
+		t.Errorf("recorded %v (%d messages), want %v", recorded, result.Messages, want)
+	}
+}
+
+// syncWriter is a recording output that tracks how much of it was synced
+type syncWriter struct {
+	bytes.Buffer
+	synced int // Length of the buffer at the last Sync
+	syncs  int
+}
+
+func (w *syncWriter) Sync() error {
+	w.synced = w.Len()
+	w.syncs++
+	return nil
+}
+
+func (*syncWriter) Close() error { return nil }
+
+func TestRecord_Commit(t *testing.T) {
+	// A consumer group reader with 3 partitions of 10 messages each.
+	// Messages without "keep" are filtered, including the last of partition 0.
+	newGroup := func() *fakeConsumer {
+		c := &fakeConsumer{topic: "t", group: true, delay: time.Millisecond}
+		for i := range 30 {
+			value := "keep"
+			if i%5 == 2 {
+				value = "skip"
+			}
+			c.msgs = append(c.msgs, kafka.Message{Topic: "t", Partition: i % 3, Offset: int64(i / 3), Time: time.UnixMilli(int64(i)), Value: []byte(value)})
+		}
+		return c
+	}
+	const kept = 24
+
+	// checkCommit fails the test unless every message kept up to each
+	// committed offset is in the synced part of w
+	checkCommit := func(t *testing.T, c *fakeConsumer, w *syncWriter, committed []kafka.Message) {
+		t.Helper()
+		if w.synced != w.Len() {
+			t.Errorf("commit with %d of %d bytes synced", w.synced, w.Len())
+		}
+		synced := map[string]bool{}
+		for _, m := range recordedMessages(t, w.Bytes()[:w.synced]) {
+			synced[partitionID(m.Topic, m.Partition)+fmt.Sprint("@", m.Offset)] = true
+		}
+		for _, commit := range committed {
+			for _, m := range c.msgs {
+				id := partitionID(m.Topic, m.Partition) + fmt.Sprint("@", m.Offset)
+				if m.Partition == commit.Partition && m.Offset <= commit.Offset && string(m.Value) == "keep" && !synced[id] {
+					t.Errorf("offset %d of partition %d committed before message %s was synced", commit.Offset, commit.Partition, id)
+				}
+			}
+		}
+	}
+
+	for _, c := range []struct {
+		policy     CommitPolicy
+		minCommits int
+	}{
+		{CommitAfterWrite, 2},
+		{CommitInterval, 2},
+		{CommitNone, 0},
+	} {
+		t.Run(string(c.policy), func(t *testing.T) {
+			consumer := newGroup()
+			w := &syncWriter{}
+			calls := 0
+			last := map[int]int64{}
+			consumer.onCommit = func(msgs []kafka.Message) error {
+				checkCommit(t, consumer, w, msgs)
+				calls++
+				for _, m := range msgs {
+					last[m.Partition] = m.Offset
+				}
+				return nil
+			}
+
+			result, _, err := record(t, RecordConfig{
+				Consumers:   []RecordConsumer{consumer},
+				Output:      w,
+				Limit:       kept,
+				FindBytes:   []byte("keep"),
+				Commit:      c.policy,
+				CommitEvery: 5 * time.Millisecond,
+			})
+			if err != nil {
+				t.Fatalf("Record failed: %v", err)
+			}
+			if result.Messages != kept || result.Filtered != 30-kept {
+				t.Errorf("recorded %d and filtered %d messages, want %d and %d", result.Messages, result.Filtered, kept, 30-kept)
+			}
+			if int(result.Commits) != calls || calls < c.minCommits {
+				t.Errorf("%d commits (%d reported), want at least %d", calls, result.Commits, c.minCommits)
+			}
+			if w.syncs < calls {
+				t.Errorf("%d syncs for %d commits", w.syncs, calls)
+			}
+			if c.policy == CommitNone {
+				return
+			}
+			// The final commit covers the limit, and filtered messages before it
+			if want := map[int]int64{0: 9, 1: 9, 2: 9}; !reflect.DeepEqual(last, want) {
+				t.Errorf("last committed offsets %v, want %v", last, want)
+			}
+		})
+	}
+
+	t.Run("reservoir", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+		consumer := newGroup()
+		consumer.onEnd = cancel
+		sampler, err := sample.New(sample.Config{Size: 5, Seed: 1})
+		if err != nil {
+			t.Fatal(err)
+		}
+		w := &syncWriter{}
+		calls := 0
+		consumer.onCommit = func(msgs []kafka.Message) error {
+			// Nothing is committed before the sample has been written
+			if got := len(recordedMessages(t, w.Bytes()[:w.synced])); got != 5 || w.synced != w.Len() {
+				t.Errorf("commit with %d synced messages, want the sample of 5", got)
+			}
+			calls++
+			return nil
+		}
+
+		result, err := Record(ctx, RecordConfig{
+			Consumers: []RecordConsumer{consumer},
+			Output:    w,
+			Sampler:   sampler,
+			Commit:    CommitAfterWrite,
+		})
+		if err != context.Canceled {
+			t.Fatalf("Record returned %v, want context.Canceled", err)
+		}
+		if calls != 1 || result.Commits != 1 {
+			t.Errorf("%d commits (%d reported), want only the final one", calls, result.Commits)
+		}
+	})
+}
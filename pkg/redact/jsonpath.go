@@ -0,0 +1,180 @@
+package redact
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// segmentKind identifies how a path segment selects children of a JSON node.
+type segmentKind int
+
+const (
+	segmentField    segmentKind = iota // .name
+	segmentAnyField                    // .*
+	segmentAnyIndex                    // [*]
+	segmentIndex                       // [N]
+)
+
+type segment struct {
+	kind  segmentKind
+	name  string
+	index int
+}
+
+// parsePath parses a simple JSON path such as "$.user.email", "items[*].phone"
+// or "$.accounts[0].id". Supported segments are object fields, "*" (any field),
+// "[*]" (any array element) and "[N]" (a specific array element).
+func parsePath(path string) ([]segment, error) {
+	p := strings.TrimSpace(path)
+	p = strings.TrimPrefix(p, "$")
+	p = strings.TrimPrefix(p, ".")
+	if p == "" {
+		return nil, fmt.Errorf("invalid path %q: no fields selected", path)
+	}
+
+	var segs []segment
+	for _, part := range strings.Split(p, ".") {
+		if part == "" {
+			return nil, fmt.Errorf("invalid path %q: empty segment", path)
+		}
+		name := part
+		var indexes []string
+		if i := strings.IndexByte(part, '['); i >= 0 {
+			name = part[:i]
+			rest := part[i:]
+			for rest != "" {
+				if rest[0] != '[' {
+					return nil, fmt.Errorf("invalid path %q: unexpected %q", path, rest)
+				}
+				end := strings.IndexByte(rest, ']')
+				if end < 0 {
+					return nil, fmt.Errorf("invalid path %q: missing ']'", path)
+				}
+				indexes = append(indexes, rest[1:end])
+				rest = rest[end+1:]
+			}
+		}
+		switch name {
+		case "":
+			if len(indexes) == 0 {
+				return nil, fmt.Errorf("invalid path %q: empty segment", path)
+			}
+		case "*":
+			segs = append(segs, segment{kind: segmentAnyField})
+		default:
+			segs = append(segs, segment{kind: segmentField, name: name})
+		}
+		for _, idx := range indexes {
+			if idx == "*" {
+				segs = append(segs, segment{kind: segmentAnyIndex})
+				continue
+			}
+			n, err := strconv.Atoi(idx)
+			if err != nil || n < 0 {
+				return nil, fmt.Errorf("invalid path %q: bad index %q", path, idx)
+			}
+			segs = append(segs, segment{kind: segmentIndex, index: n})
+		}
+	}
+	return segs, nil
+}
+
+// visitFunc is called for every value selected by a path. It returns the
+// replacement value, or drop=true to remove the value from its parent, and
+// whether the value changed at all.
+type visitFunc func(v any) (replacement any, drop, changed bool)
+
+// walk applies visit to every value under node selected by segs. Objects are
+// modified in place; arrays may be rebuilt when elements are dropped, so the
+// (possibly new) node is returned along with the number of changed values.
+func walk(node any, segs []segment, visit visitFunc) (any, int) {
+	if len(segs) == 0 {
+		return node, 0
+	}
+	seg, rest := segs[0], segs[1:]
+	hits := 0
+
+	switch n := node.(type) {
+	case map[string]any:
+		var keys []string
+		switch seg.kind {
+		case segmentField:
+			if _, ok := n[seg.name]; ok {
+				keys = []string{seg.name}
+			}
+		case segmentAnyField:
+			keys = make([]string, 0, len(n))
+			for k := range n {
+				keys = append(keys, k)
+			}
+		}
+		for _, k := range keys {
+			if len(rest) == 0 {
+				replacement, drop, changed := visit(n[k])
+				if !changed {
+					continue
+				}
+				if drop {
+					delete(n, k)
+				} else {
+					n[k] = replacement
+				}
+				hits++
+				continue
+			}
+			child, h := walk(n[k], rest, visit)
+			n[k] = child
+			hits += h
+		}
+		return n, hits
+
+	case []any:
+		var indexes []int
+		switch seg.kind {
+		case segmentAnyIndex:
+			indexes = make([]int, len(n))
+			for i := range n {
+				indexes[i] = i
+			}
+		case segmentIndex:
+			if seg.index < len(n) {
+				indexes = []int{seg.index}
+			}
+		}
+		var dropped map[int]bool
+		for _, i := range indexes {
+			if len(rest) == 0 {
+				replacement, drop, changed := visit(n[i])
+				if !changed {
+					continue
+				}
+				if drop {
+					if dropped == nil {
+						dropped = make(map[int]bool)
+					}
+					dropped[i] = true
+				} else {
+					n[i] = replacement
+				}
+				hits++
+				continue
+			}
+			child, h := walk(n[i], rest, visit)
+			n[i] = child
+			hits += h
+		}
+		if len(dropped) == 0 {
+			return n, hits
+		}
+		kept := make([]any, 0, len(n)-len(dropped))
+		for i, v := range n {
+			if !dropped[i] {
+				kept = append(kept, v)
+			}
+		}
+		return kept, hits
+	}
+
+	return node, 0
+}
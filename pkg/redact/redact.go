@@ -0,0 +1,317 @@
+// Package redact masks, pseudonymizes or drops sensitive data in recorded
+// messages. Rules select data either by JSON path (for JSON payloads) or by
+// regular expression (for any payload) and apply one of three actions.
+package redact
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"regexp"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Action is what a rule does with the data it selects.
+type Action string
+
+const (
+	// ActionMask replaces the selected data with a fixed replacement string.
+	ActionMask Action = "mask"
+	// ActionHash replaces the selected data with a keyed HMAC-SHA256 digest,
+	// giving stable pseudonyms across runs that use the same key.
+	ActionHash Action = "hash"
+	// ActionDrop removes the selected JSON field (or regex match) entirely.
+	ActionDrop Action = "drop"
+)
+
+// Target selects which part of the message a rule applies to.
+type Target string
+
+const (
+	TargetValue Target = "value" // Message value (default)
+	TargetKey   Target = "key"   // Message key
+)
+
+// DefaultReplacement is the string used by ActionMask when a rule does not
+// set its own replacement.
+const DefaultReplacement = "****"
+
+// hashBytes is the number of HMAC bytes kept for pseudonyms (hex encoded, so
+// pseudonyms are twice this long).
+const hashBytes = 16
+
+// ErrHashKeyRequired is returned when a rule uses ActionHash but no HMAC key
+// was provided.
+var ErrHashKeyRequired = errors.New("hash action requires an HMAC key")
+
+// Rule describes a single redaction rule.
+//
+// Path selects fields of JSON payloads (e.g. "$.user.email", "$.items[*].phone").
+// Pattern is a regular expression. When both are set, the pattern is applied
+// to the string values selected by Path; when only Pattern is set, it is
+// applied to the raw payload bytes.
+type Rule struct {
+	Name        string `yaml:"name" json:"name"`
+	Path        string `yaml:"path,omitempty" json:"path,omitempty"`
+	Pattern     string `yaml:"pattern,omitempty" json:"pattern,omitempty"`
+	Action      Action `yaml:"action" json:"action"`
+	Target      Target `yaml:"target,omitempty" json:"target,omitempty"`
+	Replacement string `yaml:"replacement,omitempty" json:"replacement,omitempty"`
+}
+
+// Rules is the top-level structure of a rules file.
+type Rules struct {
+	Rules []Rule `yaml:"rules" json:"rules"`
+}
+
+// ParseRules parses a YAML (or JSON) rules document.
+func ParseRules(data []byte) ([]Rule, error) {
+	var doc Rules
+	if err := yaml.Unmarshal(data, &doc); err != nil {
+		return nil, fmt.Errorf("failed to parse redaction rules: %w", err)
+	}
+	if len(doc.Rules) == 0 {
+		return nil, errors.New("redaction rules file contains no rules")
+	}
+	return doc.Rules, nil
+}
+
+// RuleStats reports how often a rule matched.
+type RuleStats struct {
+	Rule     string `json:"rule"`
+	Action   Action `json:"action"`
+	Target   Target `json:"target"`
+	Hits     int64  `json:"hits"`     // Number of fields or regex matches redacted
+	Messages int64  `json:"messages"` // Number of messages with at least one hit
+}
+
+type compiledRule struct {
+	Rule
+	path    []segment
+	pattern *regexp.Regexp
+}
+
+// Redactor applies a set of rules to message keys and values.
+// A Redactor is not safe for concurrent use.
+type Redactor struct {
+	rules   []compiledRule
+	hmacKey []byte
+	stats   []RuleStats
+	hasPath map[Target]bool
+}
+
+// New compiles rules into a Redactor. hmacKey is required when any rule uses
+// ActionHash.
+func New(rules []Rule, hmacKey []byte) (*Redactor, error) {
+	r := &Redactor{
+		rules:   make([]compiledRule, 0, len(rules)),
+		hmacKey: hmacKey,
+		stats:   make([]RuleStats, 0, len(rules)),
+		hasPath: make(map[Target]bool),
+	}
+	for i, rule := range rules {
+		if rule.Name == "" {
+			rule.Name = fmt.Sprintf("rule-%d", i+1)
+		}
+		if rule.Target == "" {
+			rule.Target = TargetValue
+		}
+		if rule.Target != TargetValue && rule.Target != TargetKey {
+			return nil, fmt.Errorf("rule %q: unsupported target %q (use value or key)", rule.Name, rule.Target)
+		}
+		switch rule.Action {
+		case ActionMask:
+			if rule.Replacement == "" {
+				rule.Replacement = DefaultReplacement
+			}
+		case ActionHash:
+			if len(hmacKey) == 0 {
+				return nil, fmt.Errorf("rule %q: %w", rule.Name, ErrHashKeyRequired)
+			}
+		case ActionDrop:
+		default:
+			return nil, fmt.Errorf("rule %q: unsupported action %q (use mask, hash or drop)", rule.Name, rule.Action)
+		}
+		if rule.Path == "" && rule.Pattern == "" {
+			return nil, fmt.Errorf("rule %q: path or pattern is required", rule.Name)
+		}
+
+		c := compiledRule{Rule: rule}
+		if rule.Path != "" {
+			segs, err := parsePath(rule.Path)
+			if err != nil {
+				return nil, fmt.Errorf("rule %q: %w", rule.Name, err)
+			}
+			c.path = segs
+			r.hasPath[rule.Target] = true
+		}
+		if rule.Pattern != "" {
+			re, err := regexp.Compile(rule.Pattern)
+			if err != nil {
+				return nil, fmt.Errorf("rule %q: invalid pattern: %w", rule.Name, err)
+			}
+			c.pattern = re
+		}
+		r.rules = append(r.rules, c)
+		r.stats = append(r.stats, RuleStats{Rule: rule.Name, Action: rule.Action, Target: rule.Target})
+	}
+	return r, nil
+}
+
+// Apply redacts key and value and returns the results. Slices are returned
+// unchanged when no rule matched. Path rules run before pattern-only rules;
+// path rules are skipped for payloads that are not valid JSON.
+func (r *Redactor) Apply(key, value []byte) ([]byte, []byte, error) {
+	hits := make([]int64, len(r.rules))
+
+	var err error
+	if key, err = r.applyTarget(TargetKey, key, hits); err != nil {
+		return nil, nil, err
+	}
+	if value, err = r.applyTarget(TargetValue, value, hits); err != nil {
+		return nil, nil, err
+	}
+
+	for i, h := range hits {
+		if h > 0 {
+			r.stats[i].Hits += h
+			r.stats[i].Messages++
+		}
+	}
+	return key, value, nil
+}
+
+// Report returns a copy of the per-rule hit counters accumulated so far.
+func (r *Redactor) Report() []RuleStats {
+	out := make([]RuleStats, len(r.stats))
+	copy(out, r.stats)
+	return out
+}
+
+func (r *Redactor) applyTarget(target Target, data []byte, hits []int64) ([]byte, error) {
+	if len(data) == 0 {
+		return data, nil
+	}
+
+	if r.hasPath[target] {
+		var doc any
+		dec := json.NewDecoder(bytes.NewReader(data))
+		dec.UseNumber()
+		if err := dec.Decode(&doc); err == nil && !dec.More() {
+			changed := false
+			for i := range r.rules {
+				rule := &r.rules[i]
+				if rule.Target != target || rule.path == nil {
+					continue
+				}
+				var n int
+				doc, n = walk(doc, rule.path, func(v any) (any, bool, bool) {
+					return r.redactJSONValue(rule, v)
+				})
+				if n > 0 {
+					hits[i] += int64(n)
+					changed = true
+				}
+			}
+			if changed {
+				out, err := marshalJSON(doc)
+				if err != nil {
+					return nil, err
+				}
+				data = out
+			}
+		}
+	}
+
+	for i := range r.rules {
+		rule := &r.rules[i]
+		if rule.Target != target || rule.path != nil {
+			continue
+		}
+		var n int
+		data, n = r.replaceMatches(rule, data)
+		hits[i] += int64(n)
+	}
+	return data, nil
+}
+
+// redactJSONValue applies a path rule to a single selected JSON value, as a
+// visitFunc. Rules with a pattern only rewrite the matching parts of string
+// values, and leave values without a match unchanged.
+func (r *Redactor) redactJSONValue(rule *compiledRule, v any) (any, bool, bool) {
+	if rule.pattern != nil {
+		s, ok := v.(string)
+		if !ok {
+			return v, false, false
+		}
+		out, n := r.replaceMatches(rule, []byte(s))
+		if n == 0 {
+			return v, false, false
+		}
+		return string(out), false, true
+	}
+	switch rule.Action {
+	case ActionDrop:
+		return nil, true, true
+	case ActionHash:
+		return r.pseudonym(jsonScalarBytes(v)), false, true
+	default:
+		return rule.Replacement, false, true
+	}
+}
+
+// replaceMatches rewrites every match of the rule's pattern in data and
+// returns the result with the number of matches.
+func (r *Redactor) replaceMatches(rule *compiledRule, data []byte) ([]byte, int) {
+	n := 0
+	out := rule.pattern.ReplaceAllFunc(data, func(m []byte) []byte {
+		n++
+		switch rule.Action {
+		case ActionDrop:
+			return nil
+		case ActionHash:
+			return []byte(r.pseudonym(m))
+		default:
+			return []byte(rule.Replacement)
+		}
+	})
+	if n == 0 {
+		return data, 0
+	}
+	return out, n
+}
+
+// pseudonym returns the truncated, hex-encoded HMAC-SHA256 of b.
+func (r *Redactor) pseudonym(b []byte) string {
+	mac := hmac.New(sha256.New, r.hmacKey)
+	mac.Write(b)
+	return hex.EncodeToString(mac.Sum(nil)[:hashBytes])
+}
+
+// jsonScalarBytes returns the bytes hashed for a JSON value: the raw string
+// for strings, and the canonical JSON encoding for everything else.
+func jsonScalarBytes(v any) []byte {
+	if s, ok := v.(string); ok {
+		return []byte(s)
+	}
+	b, err := marshalJSON(v)
+	if err != nil {
+		return []byte(fmt.Sprint(v))
+	}
+	return b
+}
+
+func marshalJSON(v any) ([]byte, error) {
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	enc.SetEscapeHTML(false)
+	if err := enc.Encode(v); err != nil {
+		return nil, fmt.Errorf("failed to encode redacted JSON: %w", err)
+	}
+	return bytes.TrimSuffix(buf.Bytes(), []byte("\n")), nil
+}
@@ -0,0 +1,167 @@
+package redact
+
+import (
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestRedactor_JSONPathActions(t *testing.T) {
+	r, err := New([]Rule{
+		{Name: "email", Path: "$.user.email", Action: ActionHash},
+		{Name: "phones", Path: "$.user.phones[*]", Action: ActionMask},
+		{Name: "ssn", Path: "$.user.ssn", Action: ActionDrop},
+	}, []byte("secret"))
+	if err != nil {
+		t.Fatalf("New failed: %v", err)
+	}
+
+	value := []byte(`{"user":{"email":"a@example.com","phones":["+4670000000","+4671111111"],"ssn":"19900101-1234","age":42}}`)
+	_, out, err := r.Apply(nil, value)
+	if err != nil {
+		t.Fatalf("Apply failed: %v", err)
+	}
+
+	var doc struct {
+		User map[string]any `json:"user"`
+	}
+	if err := json.Unmarshal(out, &doc); err != nil {
+		t.Fatalf("redacted value is not valid JSON: %v (%s)", err, out)
+	}
+	email, _ := doc.User["email"].(string)
+	if email == "" || email == "a@example.com" || len(email) != 2*hashBytes {
+		t.Errorf("email should be replaced by a %d-char pseudonym, got %q", 2*hashBytes, email)
+	}
+	for _, p := range doc.User["phones"].([]any) {
+		if p != DefaultReplacement {
+			t.Errorf("phone should be masked, got %v", p)
+		}
+	}
+	if _, ok := doc.User["ssn"]; ok {
+		t.Errorf("ssn should be dropped")
+	}
+	if doc.User["age"] != float64(42) {
+		t.Errorf("untouched fields must be preserved, got age=%v", doc.User["age"])
+	}
+
+	report := r.Report()
+	want := map[string]int64{"email": 1, "phones": 2, "ssn": 1}
+	for _, s := range report {
+		if s.Hits != want[s.Rule] || s.Messages != 1 {
+			t.Errorf("rule %s: expected %d hits in 1 message, got %d hits in %d messages", s.Rule, want[s.Rule], s.Hits, s.Messages)
+		}
+	}
+}
+
+func TestRedactor_HashIsStable(t *testing.T) {
+	rules := []Rule{{Name: "account", Pattern: `acct-[0-9]+`, Action: ActionHash, Target: TargetKey}}
+	r1, _ := New(rules, []byte("k1"))
+	r2, _ := New(rules, []byte("k1"))
+	r3, _ := New(rules, []byte("k2"))
+
+	k1, _, _ := r1.Apply([]byte("acct-123"), nil)
+	k2, _, _ := r2.Apply([]byte("acct-123"), nil)
+	k3, _, _ := r3.Apply([]byte("acct-123"), nil)
+	if string(k1) != string(k2) {
+		t.Errorf("same key must give same pseudonym: %q vs %q", k1, k2)
+	}
+	if string(k1) == string(k3) {
+		t.Errorf("different keys must give different pseudonyms")
+	}
+}
+
+func TestRedactor_PatternOnRawAndNonJSON(t *testing.T) {
+	r, err := New([]Rule{
+		{Name: "email-field", Path: "$.email", Action: ActionMask},
+		{Name: "email-any", Pattern: `[a-z]+@[a-z]+\.com`, Action: ActionMask, Replacement: "<email>"},
+	}, nil)
+	if err != nil {
+		t.Fatalf("New failed: %v", err)
+	}
+
+	_, out, err := r.Apply(nil, []byte("plain text from bob@example.com and eve@example.com"))
+	if err != nil {
+		t.Fatalf("Apply failed: %v", err)
+	}
+	if string(out) != "plain text from <email> and <email>" {
+		t.Errorf("unexpected output %q", out)
+	}
+	report := r.Report()
+	if report[0].Hits != 0 || report[1].Hits != 2 {
+		t.Errorf("unexpected report %+v", report)
+	}
+
+	unchanged := []byte("nothing to see")
+	_, out, _ = r.Apply(nil, unchanged)
+	if &out[0] != &unchanged[0] {
+		t.Errorf("unmatched values should be returned unchanged")
+	}
+}
+
+func TestRedactor_PathWithPattern(t *testing.T) {
+	r, err := New([]Rule{{Name: "secret", Path: "$.email", Pattern: `secret`, Action: ActionMask}}, nil)
+	if err != nil {
+		t.Fatalf("New failed: %v", err)
+	}
+
+	value := []byte(`{"b":1, "email":"a@b.com","a":2}`)
+	_, out, err := r.Apply(nil, value)
+	if err != nil {
+		t.Fatalf("Apply failed: %v", err)
+	}
+	if &out[0] != &value[0] {
+		t.Errorf("value without a match should be returned unchanged, got %s", out)
+	}
+	if report := r.Report(); report[0].Hits != 0 || report[0].Messages != 0 {
+		t.Errorf("expected no hits, got %d hits in %d messages", report[0].Hits, report[0].Messages)
+	}
+
+	_, out, err = r.Apply(nil, []byte(`{"email":"my-secret@b.com"}`))
+	if err != nil {
+		t.Fatalf("Apply failed: %v", err)
+	}
+	if string(out) != `{"email":"my-`+DefaultReplacement+`@b.com"}` {
+		t.Errorf("unexpected output %s", out)
+	}
+	if report := r.Report(); report[0].Hits != 1 || report[0].Messages != 1 {
+		t.Errorf("expected 1 hit in 1 message, got %d hits in %d messages", report[0].Hits, report[0].Messages)
+	}
+}
+
+func TestNew_Validation(t *testing.T) {
+	if _, err := New([]Rule{{Name: "h", Path: "$.a", Action: ActionHash}}, nil); !errors.Is(err, ErrHashKeyRequired) {
+		t.Errorf("expected ErrHashKeyRequired, got %v", err)
+	}
+	if _, err := New([]Rule{{Name: "x", Path: "$.a", Action: "explode"}}, nil); err == nil || !strings.Contains(err.Error(), "unsupported action") {
+		t.Errorf("expected unsupported action error, got %v", err)
+	}
+	if _, err := New([]Rule{{Name: "x", Action: ActionMask}}, nil); err == nil {
+		t.Errorf("expected error for rule without path or pattern")
+	}
+	if _, err := New([]Rule{{Name: "x", Path: "$.a[", Action: ActionMask}}, nil); err == nil {
+		t.Errorf("expected error for invalid path")
+	}
+}
+
+func TestParseRules(t *testing.T) {
+	rules, err := ParseRules([]byte(`
+rules:
+  - name: email
+    path: $.email
+    action: hash
+  - name: phone
+    pattern: '\+[0-9]{8,}'
+    action: mask
+    target: key
+`))
+	if err != nil {
+		t.Fatalf("ParseRules failed: %v", err)
+	}
+	if len(rules) != 2 || rules[0].Action != ActionHash || rules[1].Target != TargetKey {
+		t.Errorf("unexpected rules %+v", rules)
+	}
+	if _, err := ParseRules([]byte("rules: []")); err == nil {
+		t.Errorf("expected error for empty rules")
+	}
+}
@@ -9,9 +9,12 @@ import (
 	"os"
 	"strconv"
 	"sync"
+	"sync/atomic"
 	"time"
 
-	kafkapkg "github.com/lolocompany/kafka-replay/v2/pkg/kafka"
+	"github.com/lolocompany/kafka-replay/v2/pkg/ratelimit"
+	"github.com/lolocompany/kafka-replay/v2/pkg/redact"
+	"github.com/lolocompany/kafka-replay/v2/pkg/sample"
 	"github.com/lolocompany/kafka-replay/v2/pkg/transcoder"
 	"github.com/segmentio/kafka-go"
 )
@@ -65,38 +68,256 @@ const (
 
 // ReplayConfig holds configuration for the Replay function
 type ReplayConfig struct {
-	Producer  *kafkapkg.Producer
+	Producer  MessageWriter // Single destination; use Targets for several
 	Decoder   *transcoder.DecodeReader
-	Rate      int
+	Rate      int // Messages per second (0 for no limit); shorthand for a constant Limiter
 	Loop      bool
+	LoopCount int  // Number of passes over the input with Loop (0 for no limit)
 	Partition *int // Optional partition to write to (nil for auto-assignment)
 	LogWriter io.Writer
-	DryRun    bool   // If true, validate messages without actually sending to Kafka
-	FindBytes []byte // Optional byte sequence to search for in messages
+	DryRun    bool             // If true, validate messages without actually sending to Kafka
+	FindBytes []byte           // Optional byte sequence to search for in messages
+	Redactor  *redact.Redactor // Optional redaction applied before messages are sent
+	// Sampler optionally samples messages after FindBytes. A reservoir sample
+	// is drawn from one full pass over the file and replayed on every loop.
+	Sampler *sample.Sampler
+	// Timing selects the pacing (default TimingRate). TimingOriginal waits the
+	// recorded gap between messages divided by Speed, never longer than
+	// MaxIdle (0 for no limit), and cannot be combined with Rate or Limiter.
+	Timing  ReplayTiming
+	Speed   float64 // Speed-up factor for TimingOriginal (default 1)
+	MaxIdle time.Duration
+	// OriginalPartitions writes every message to the partition it was recorded
+	// from, mapped through PartitionMap. Entries without partition information
+	// fail the replay. Like Partition, it requires a producer created with
+	// ExplicitPartitions.
+	OriginalPartitions bool
+	PartitionMap       PartitionMap
+	// Targets fans the replay out to several destinations that share the
+	// reader, filters and pacing. Each batch is written to all targets
+	// concurrently; the replay only stops when every target fails a batch.
+	Targets []*ReplayTarget
+	// Limiter optionally paces messages by message and byte rate profiles,
+	// across loops. It cannot be combined with Rate or TimingOriginal. Replay
+	// sets its burst to RateTolerance.
+	Limiter *ratelimit.Limiter
+	// Linger is how long a message may wait for its batch to fill (default
+	// DefaultLinger).
+	Linger time.Duration
+	// RateTolerance bounds how far the send rate may stray from a rate limit
+	// over any one-second window, as a fraction (default
+	// DefaultRateTolerance). Smaller values mean smaller batches.
+	RateTolerance float64
+	// Resume starts at a position reported to OnCheckpoint by an earlier
+	// replay of the same input. It cannot be combined with a sample size.
+	Resume *ReplayPosition
+	// OnCheckpoint, if set, is called after each batch is written, with the
+	// position after which nothing remains unwritten and the number of
+	// messages written so far. Calls never overlap. Once a target fails to
+	// write part of a batch (and the messages were not dead-lettered), it is
+	// no longer called, so that a resumed replay sends that batch again. It
+	// cannot be combined with a sample size.
+	OnCheckpoint func(pos ReplayPosition, sent int64)
+	// Retry controls how writes that fail with a retriable error, such as
+	// leader not available or a timeout, are retried. The zero value does
+	// not retry.
+	Retry RetryPolicy
+	// DeadLetter, if set, records messages that still fail after retries
+	// instead of stopping the replay. They count towards the returned total
+	// and a target's Failed count.
+	DeadLetter *DeadLetter
+	// Concurrency is the number of shards that write at the same time, each
+	// with its own batch (default 1). Messages are assigned to shards by
+	// partition when Partition or OriginalPartitions is set, and otherwise by
+	// key hash, so the order of each partition or key is kept.
+	Concurrency int
+	// Stats, if set, is filled in with per-shard write counts when Replay
+	// returns.
+	Stats *ReplayStats
+	// Variation changes keys, headers and timestamps on each loop iteration.
+	Variation LoopVariation
+}
+
+// replayEntry is a decoded message on its way to the writer
+type replayEntry struct {
+	msg      kafka.Message
+	recorded time.Time      // Recorded timestamp, for TimingOriginal
+	pos      ReplayPosition // Position after the entry, with OnCheckpoint
 }
 
 func Replay(ctx context.Context, cfg ReplayConfig) (int64, error) {
-	if cfg.Producer == nil {
+	targets := cfg.Targets
+	switch {
+	case cfg.Producer != nil && len(targets) > 0:
+		return 0, errors.New("producer and targets cannot be used together")
+	case cfg.Producer != nil:
+		targets = []*ReplayTarget{{Producer: cfg.Producer}}
+	case len(targets) == 0:
 		return 0, errors.New("producer is required")
 	}
+	for _, t := range targets {
+		if t.Producer == nil {
+			return 0, fmt.Errorf("target %s has no producer", t.Name)
+		}
+	}
 	if cfg.Decoder == nil {
 		return 0, errors.New("decoder is required")
 	}
 	if cfg.LogWriter == nil {
 		cfg.LogWriter = os.Stderr
 	}
+	if cfg.OriginalPartitions && cfg.Partition != nil {
+		return 0, errors.New("a fixed partition cannot be used with original partitions")
+	}
+	if len(cfg.PartitionMap) > 0 && !cfg.OriginalPartitions {
+		return 0, errors.New("a partition map requires original partitions")
+	}
+	if cfg.LoopCount < 0 {
+		return 0, errors.New("loop count cannot be negative")
+	}
+	if cfg.LoopCount > 0 && !cfg.Loop {
+		return 0, errors.New("a loop count requires loop")
+	}
+	var variator *loopVariator
+	if cfg.Variation.enabled() {
+		variator = newLoopVariator(cfg.Variation)
+	}
+	concurrency := cfg.Concurrency
+	switch {
+	case concurrency < 0:
+		return 0, errors.New("concurrency cannot be negative")
+	case concurrency == 0:
+		concurrency = 1
+	}
+	limiter := cfg.Limiter
+	if cfg.Rate > 0 {
+		if limiter != nil {
+			return 0, errors.New("rate and limiter cannot be used together")
+		}
+		limiter = ratelimit.New(ratelimit.Constant(cfg.Rate), nil)
+	}
+	var scheduler *timingScheduler
+	switch cfg.Timing {
+	case "", TimingRate:
+	case TimingOriginal:
+		if limiter != nil {
+			return 0, errors.New("rate cannot be used with original timing")
+		}
+		if cfg.Speed < 0 || cfg.MaxIdle < 0 {
+			return 0, errors.New("speed and max idle cannot be negative")
+		}
+		scheduler = newTimingScheduler(cfg.Speed, cfg.MaxIdle)
+	default:
+		return 0, fmt.Errorf("unsupported timing %q (use %s or %s)", cfg.Timing, TimingRate, TimingOriginal)
+	}
 
 	// Channel to pass messages from reader to writer goroutine
 	// Buffered to allow some pipelining while maintaining backpressure
-	msgChan := make(chan kafka.Message, BatchSize)
-	
+	msgChan := make(chan replayEntry, BatchSize)
+
 	// Channel to signal completion and pass errors
 	errChan := make(chan error, 1)
 
+	var reservoir *sample.Reservoir[replayEntry]
+	if cfg.Sampler != nil && !cfg.Sampler.Streaming() {
+		if cfg.Resume != nil || cfg.OnCheckpoint != nil {
+			return 0, errors.New("a sample size cannot be used with checkpoints: the sample is replayed out of file order")
+		}
+		reservoir = sample.NewReservoir[replayEntry](cfg.Sampler)
+	}
+
+	// Position of the next entry, tracked for checkpoints
+	var pos ReplayPosition
+	if cfg.Resume != nil {
+		if err := cfg.Decoder.SeekTo(cfg.Resume.Offset); err != nil {
+			return 0, fmt.Errorf("failed to resume: %w", err)
+		}
+		pos = *cfg.Resume
+	}
+
+	// Canceled on return, so that the reader also stops after a write error
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
 	// Reader goroutine: reads from decoder and sends messages to channel
 	go func() {
 		defer close(msgChan)
-		
+
+		// A resumed replay may already have done every iteration
+		if cfg.LoopCount > 0 && pos.Loop >= int64(cfg.LoopCount) {
+			return
+		}
+
+		// send redacts and varies a message of the given loop iteration held
+		// in pooled buffers, waits until it is due under original timing and
+		// passes it to the writer goroutine. It returns false if the reader
+		// must stop.
+		send := func(entry replayEntry, iteration int64) bool {
+			// Build Kafka message with pooled buffers (returned to pool after flush)
+			kafkaMsg := &entry.msg
+			preserved := kafkaMsg.Time.Equal(entry.recorded)
+			if scheduler != nil {
+				if !scheduler.wait(ctx, entry.recorded) {
+					returnKeySlice(kafkaMsg.Key)
+					returnValueSlice(kafkaMsg.Value)
+					return false
+				}
+				// Timestamps not preserved from the recording are the send time
+				if !kafkaMsg.Time.Equal(entry.recorded) {
+					kafkaMsg.Time = time.Now().UTC()
+				}
+			}
+			if cfg.Redactor != nil {
+				redactedKey, redactedValue, err := cfg.Redactor.Apply(kafkaMsg.Key, kafkaMsg.Value)
+				if err != nil {
+					returnKeySlice(kafkaMsg.Key)
+					returnValueSlice(kafkaMsg.Value)
+					select {
+					case errChan <- err:
+					case <-ctx.Done():
+					}
+					return false
+				}
+				kafkaMsg.Key = copyIntoPooled(kafkaMsg.Key, redactedKey, returnKeySlice)
+				kafkaMsg.Value = copyIntoPooled(kafkaMsg.Value, redactedValue, returnValueSlice)
+			}
+			if variator != nil {
+				variator.apply(kafkaMsg, iteration, preserved)
+			}
+
+			// Send message to writer goroutine
+			select {
+			case msgChan <- entry:
+				// Message sent successfully
+				return true
+			case <-ctx.Done():
+				// Context canceled, return buffers and exit
+				returnKeySlice(kafkaMsg.Key)
+				returnValueSlice(kafkaMsg.Value)
+				return false
+			}
+		}
+
+		// sendReservoir sends the reservoir sample, once or for every loop iteration
+		sendReservoir := func() {
+			items := reservoir.Items()
+			for iteration := int64(0); ; iteration++ {
+				for _, item := range items {
+					// Copy into pooled buffers, the writer returns them to the pool after flush
+					if item.msg.Key != nil {
+						item.msg.Key = append(getKeySlice()[:0], item.msg.Key...)
+					}
+					item.msg.Value = append(getValueSlice()[:0], item.msg.Value...)
+					if !send(item, iteration) {
+						return
+					}
+				}
+				if !cfg.Loop || len(items) == 0 || (cfg.LoopCount > 0 && iteration+1 >= int64(cfg.LoopCount)) {
+					return
+				}
+			}
+		}
+
 		for {
 			// Check context cancellation
 			select {
@@ -118,7 +339,11 @@ func Replay(ctx context.Context, cfg ReplayConfig) (int64, error) {
 
 				if err == io.EOF {
 					// End of file reached
-					if cfg.Loop {
+					if reservoir != nil {
+						sendReservoir()
+						return
+					}
+					if cfg.Loop && (cfg.LoopCount == 0 || pos.Loop+1 < int64(cfg.LoopCount)) {
 						// In loop mode: reset and continue without flushing.
 						// This allows batches to accumulate across loop iterations for better throughput.
 						if err := cfg.Decoder.Reset(); err != nil {
@@ -128,6 +353,8 @@ func Replay(ctx context.Context, cfg ReplayConfig) (int64, error) {
 							}
 							return
 						}
+						pos.Loop++
+						pos.Ordinal = 0
 						continue
 					}
 					// No more looping, exit normally
@@ -145,6 +372,19 @@ func Replay(ctx context.Context, cfg ReplayConfig) (int64, error) {
 				return
 			}
 
+			pos.Ordinal++
+			if cfg.OnCheckpoint != nil {
+				if pos.Offset, err = cfg.Decoder.Offset(); err != nil {
+					returnKeySlice(keyBuf)
+					returnValueSlice(dataBuf)
+					select {
+					case errChan <- err:
+					case <-ctx.Done():
+					}
+					return
+				}
+			}
+
 			// Limit buffers to the valid decoded lengths
 			if keyLen > 0 {
 				keyBuf = keyBuf[:keyLen]
@@ -163,139 +403,131 @@ func Replay(ctx context.Context, cfg ReplayConfig) (int64, error) {
 				continue
 			}
 
-			// Build Kafka message with pooled buffers (returned to pool after flush)
-			kafkaMsg := kafka.Message{
-				Key:   keyBuf,
-				Value: dataBuf,
-				Time:  timestamp,
+			entry := replayEntry{
+				msg: kafka.Message{
+					Key:   keyBuf,
+					Value: dataBuf,
+					Time:  timestamp,
+				},
+				recorded: cfg.Decoder.RecordedTime(),
+				pos:      pos,
 			}
 			// Set partition if specified in config (nil means auto-assignment)
 			if cfg.Partition != nil {
-				kafkaMsg.Partition = *cfg.Partition
+				entry.msg.Partition = *cfg.Partition
+			}
+			if cfg.OriginalPartitions {
+				meta := cfg.Decoder.Metadata()
+				if !meta.HasPartition() {
+					returnKeySlice(keyBuf)
+					returnValueSlice(dataBuf)
+					select {
+					case errChan <- errors.New("cannot replay into original partitions: the recording has entries without partition information"):
+					case <-ctx.Done():
+					}
+					return
+				}
+				entry.msg.Partition = cfg.PartitionMap.Target(meta.Partition)
 			}
 
-			// Send message to writer goroutine
-			select {
-			case msgChan <- kafkaMsg:
-				// Message sent successfully
-			case <-ctx.Done():
-				// Context canceled, return buffers and exit
+			// Hold back a copy for reservoir sampling; the sample is sent at the end of the file
+			if reservoir != nil {
+				entry.msg.Key = bytes.Clone(keyBuf)
+				entry.msg.Value = bytes.Clone(dataBuf)
+				reservoir.Add(entry)
+				returnKeySlice(keyBuf)
+				returnValueSlice(dataBuf)
+				continue
+			}
+			if cfg.Sampler != nil && !cfg.Sampler.Keep(keyBuf) {
 				returnKeySlice(keyBuf)
 				returnValueSlice(dataBuf)
+				continue
+			}
+
+			if !send(entry, pos.Loop) {
 				return
 			}
 		}
 	}()
 
-	// Writer goroutine: receives messages, batches them, and writes to Kafka
-	var messagesSent int64
-	var rateStartTime time.Time
-	if cfg.Rate > 0 {
-		rateStartTime = time.Now()
-	}
-
-	batch := make([]kafka.Message, 0, BatchSize)
-	var batchBytes int64
-
-	flushBatch := func() error {
-		if len(batch) == 0 {
+	// Writer: batches messages, per shard, and writes them to Kafka
+	sender := delivery{retry: cfg.Retry, deadLetter: cfg.DeadLetter, log: cfg.LogWriter}
+	// Set once a target lost part of a batch: the checkpoint stays before it.
+	// A shard reports its checkpoint after its write returns, so no position
+	// past the lost batch is reported.
+	var targetFailed atomic.Bool
+	write := func(ctx context.Context, batch []kafka.Message) error {
+		// In dry-run mode, skip actual writing but still validate
+		// The fact that we got here means decoding succeeded, so validation passes
+		if cfg.DryRun {
 			return nil
 		}
-
-		// Rate limiting: ensure we don't exceed the rate limit
-		if cfg.Rate > 0 {
-			batchSize := int64(len(batch))
-			elapsed := time.Since(rateStartTime)
-
-			// Calculate how many messages we should have sent by now
-			expectedMessages := int64(float64(cfg.Rate) * elapsed.Seconds())
-
-			// If we're about to exceed the rate, wait
-			if messagesSent+batchSize > expectedMessages {
-				// Calculate how long to wait
-				// We want: messagesSent + batchSize <= rate * (elapsed + waitTime)
-				// So: waitTime >= (messagesSent + batchSize) / rate - elapsed
-				requiredTime := time.Duration(float64(messagesSent+batchSize) / float64(cfg.Rate) * float64(time.Second))
-				waitTime := requiredTime - elapsed
-
-				if waitTime > 0 {
-					select {
-					case <-ctx.Done():
-						return ctx.Err()
-					case <-time.After(waitTime):
-						// Wait complete, proceed
-					}
-					// Update elapsed time after waiting
-					elapsed = time.Since(rateStartTime)
-				}
-			}
+		failed, err := writeTargets(ctx, targets, batch, sender)
+		if failed > 0 && err == nil && cfg.OnCheckpoint != nil && !targetFailed.Swap(true) {
+			fmt.Fprintln(cfg.LogWriter, "A target failed to write a batch: the checkpoint is no longer advanced, so that a resumed replay sends it again")
 		}
-
-		// In dry-run mode, skip actual writing but still validate
-		// The fact that we got here means decoding succeeded, so validation passes
-		if !cfg.DryRun {
-			if err := cfg.Producer.WriteMessages(ctx, batch...); err != nil {
-				return fmt.Errorf("failed to write batch to Kafka: %w", err)
+		return err
+	}
+	onCheckpoint := cfg.OnCheckpoint
+	if onCheckpoint != nil {
+		onCheckpoint = func(pos ReplayPosition, sent int64) {
+			if !targetFailed.Load() {
+				cfg.OnCheckpoint(pos, sent)
 			}
 		}
-		returnBatchBuffersToPool(batch)
-		messagesSent += int64(len(batch))
-		batch = batch[:0]
-		batchBytes = 0
-		return nil
 	}
-
-	// Receive messages from reader goroutine and batch them
-	for {
-		select {
-		case <-ctx.Done():
-			// Flush any pending batch before returning
-			if err := flushBatch(); err != nil {
-				return messagesSent, err
-			}
-			return messagesSent, ctx.Err()
-		case err := <-errChan:
-			// Error from reader goroutine
-			if flushErr := flushBatch(); flushErr != nil {
-				return messagesSent, flushErr
+	writers := make([]*batchWriter, concurrency)
+	for i := range writers {
+		writers[i] = newBatchWriter(write, limiter, cfg.Linger, cfg.RateTolerance)
+	}
+	start := time.Now()
+	var err error
+	if concurrency == 1 {
+		writers[0].onWrite = onCheckpoint
+		// Under original timing, flush as soon as no further message is due
+		err = runShard(ctx, writers[0], msgChan, scheduler != nil)
+	} else {
+		var progress *replayProgress
+		if onCheckpoint != nil {
+			var resume ReplayPosition
+			if cfg.Resume != nil {
+				resume = *cfg.Resume
 			}
-			return messagesSent, err
-		case msg, ok := <-msgChan:
-			if !ok {
-				// Channel closed, reader finished
-				// Check for any error from reader goroutine
-				select {
-				case err := <-errChan:
-					if err != nil {
-						// Error occurred, flush batch and return error
-						if flushErr := flushBatch(); flushErr != nil {
-							return messagesSent, flushErr
-						}
-						return messagesSent, err
-					}
-				default:
-					// No error, proceed normally
-				}
-				// Flush any remaining messages
-				if err := flushBatch(); err != nil {
-					return messagesSent, err
-				}
-				return messagesSent, nil
+			progress = newReplayProgress(concurrency, resume, onCheckpoint)
+			for i, w := range writers {
+				w.onWrite = func(_ ReplayPosition, sent int64) { progress.write(i, sent) }
 			}
+		}
+		sharder := &replaySharder{shards: concurrency, byPartition: cfg.Partition != nil || cfg.OriginalPartitions}
+		err = writeShards(ctx, cancel, writers, msgChan, sharder, progress, scheduler != nil)
+	}
 
-			// Add message to batch
-			batch = append(batch, msg)
-			batchBytes += int64(len(msg.Value))
-
-			// Flush batch if it reaches size or byte limit
-			// The kafka-go Writer will further batch these internally for optimal throughput
-			if len(batch) >= BatchSize || batchBytes >= BatchBytes {
-				if err := flushBatch(); err != nil {
-					return messagesSent, err
-				}
-			}
+	var sent int64
+	for _, w := range writers {
+		sent += w.sent
+	}
+	if cfg.Stats != nil {
+		cfg.Stats.Elapsed = time.Since(start)
+		cfg.Stats.Shards = make([]ReplayShardStats, len(writers))
+		for i, w := range writers {
+			cfg.Stats.Shards[i] = w.stats
 		}
 	}
+	if err == nil {
+		// The reader may have stopped on cancellation
+		err = ctx.Err()
+	}
+	if err != nil {
+		return sent, err
+	}
+	// The reader closed the channel at the end of the input or after an error
+	select {
+	case err := <-errChan:
+		return sent, err
+	default:
+		return sent, nil
+	}
 }
 
 // getKeySlice returns a key buffer slice from the pool.
@@ -324,6 +556,19 @@ func returnValueSlice(value []byte) {
 	valueBufPool.Put(value[:cap(value)])
 }
 
+// copyIntoPooled copies data into the pooled buffer buf when it fits, so the
+// pool keeps its default-sized buffers. Otherwise buf is returned to the pool
+// via release and data is used as is.
+func copyIntoPooled(buf []byte, data []byte, release func([]byte)) []byte {
+	if cap(buf) >= len(data) {
+		buf = buf[:len(data)]
+		copy(buf, data)
+		return buf
+	}
+	release(buf)
+	return data
+}
+
 // returnBatchBuffersToPool returns Key and Value buffers from batch messages to their pools.
 // Call after the producer has finished with the batch (after WriteMessages returns).
 func returnBatchBuffersToPool(batch []kafka.Message) {
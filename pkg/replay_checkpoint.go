@@ -0,0 +1,71 @@
+package pkg
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// ReplayPosition is a place in a replay: the entry after the last message
+// written to Kafka.
+type ReplayPosition struct {
+	Loop    int64 `json:"loop"`    // Loop iteration, counted from 0
+	Offset  int64 `json:"offset"`  // Byte offset of the next entry in the input
+	Ordinal int64 `json:"ordinal"` // Index of the next entry within the loop iteration
+}
+
+// ReplayCheckpoint is the progress of a replay, saved so that it can be
+// resumed.
+type ReplayCheckpoint struct {
+	Input     string `json:"input"`
+	InputSize int64  `json:"inputSize"` // Guards against resuming with a different file
+	ReplayPosition
+	Sent      int64     `json:"sent"`      // Messages written, over all resumed runs
+	Completed bool      `json:"completed"` // The replay reached the end of the input
+	UpdatedAt time.Time `json:"updatedAt"`
+}
+
+// LoadReplayCheckpoint reads a checkpoint written by SaveReplayCheckpoint.
+func LoadReplayCheckpoint(path string) (*ReplayCheckpoint, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var cp ReplayCheckpoint
+	if err := json.Unmarshal(data, &cp); err != nil {
+		return nil, fmt.Errorf("invalid checkpoint %s: %w", path, err)
+	}
+	return &cp, nil
+}
+
+// SaveReplayCheckpoint writes cp to path atomically: it writes a temporary
+// file next to path and renames it, so a crash leaves either the old or the
+// new checkpoint.
+func SaveReplayCheckpoint(path string, cp ReplayCheckpoint) error {
+	data, err := json.MarshalIndent(cp, "", "  ")
+	if err != nil {
+		return err
+	}
+	f, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".*.tmp")
+	if err != nil {
+		return fmt.Errorf("failed to write checkpoint: %w", err)
+	}
+	defer os.Remove(f.Name()) // No-op after the rename
+	if _, err := f.Write(append(data, '\n')); err != nil {
+		f.Close()
+		return fmt.Errorf("failed to write checkpoint: %w", err)
+	}
+	if err := f.Sync(); err != nil {
+		f.Close()
+		return fmt.Errorf("failed to write checkpoint: %w", err)
+	}
+	if err := f.Close(); err != nil {
+		return fmt.Errorf("failed to write checkpoint: %w", err)
+	}
+	if err := os.Rename(f.Name(), path); err != nil {
+		return fmt.Errorf("failed to write checkpoint: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,272 @@
+package pkg
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"reflect"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/lolocompany/kafka-replay/v2/pkg/ratelimit"
+	"github.com/lolocompany/kafka-replay/v2/pkg/sample"
+	"github.com/lolocompany/kafka-replay/v2/pkg/transcoder"
+)
+
+func TestSaveReplayCheckpoint(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "replay.checkpoint")
+	cp := ReplayCheckpoint{
+		Input:          "in.bin",
+		InputSize:      1234,
+		ReplayPosition: ReplayPosition{Loop: 2, Offset: 400, Ordinal: 7},
+		Sent:           27,
+		UpdatedAt:      time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC),
+	}
+	for range 2 {
+		if err := SaveReplayCheckpoint(path, cp); err != nil {
+			t.Fatal(err)
+		}
+	}
+	got, err := LoadReplayCheckpoint(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(*got, cp) {
+		t.Errorf("loaded %+v, want %+v", *got, cp)
+	}
+	if files, _ := os.ReadDir(dir); len(files) != 1 {
+		t.Errorf("%d files in the directory, want only the checkpoint", len(files))
+	}
+}
+
+func TestReplay_Resume(t *testing.T) {
+	entries := make([]testEntry, 10)
+	for i := range entries {
+		entries[i] = testEntry{"t", fmt.Sprint(i), "v", int64(i)}
+	}
+	data := encodedBytes(t, entries)
+	size := int64(len(data))
+	newDecoder := func() *transcoder.DecodeReader {
+		// A reader per replay, as a canceled replay's reader may still be running
+		decoder, err := transcoder.NewDecodeReader(bytes.NewReader(data), true)
+		if err != nil {
+			t.Fatalf("NewDecodeReader failed: %v", err)
+		}
+		return decoder
+	}
+
+	// The position after the fourth entry
+	decoder := newDecoder()
+	for range 4 {
+		if err := decoder.Skip(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	offset, err := decoder.Offset()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	producer := &fakeProducer{}
+	var last ReplayPosition
+	var sent int64
+	n, err := Replay(context.Background(), ReplayConfig{
+		Producer:     producer,
+		Decoder:      newDecoder(),
+		Resume:       &ReplayPosition{Offset: offset, Ordinal: 4},
+		OnCheckpoint: func(pos ReplayPosition, s int64) { last, sent = pos, s },
+	})
+	if err != nil || n != 6 {
+		t.Fatalf("Replay returned %d, %v", n, err)
+	}
+	if want := []string{"4", "5", "6", "7", "8", "9"}; !reflect.DeepEqual(producer.keys, want) {
+		t.Errorf("resumed replay sent %v, want %v", producer.keys, want)
+	}
+	if want := (ReplayPosition{Offset: size, Ordinal: 10}); last != want || sent != 6 {
+		t.Errorf("last checkpoint %+v after %d messages, want %+v after 6", last, sent, want)
+	}
+
+	// Resuming at the end of the file sends nothing without --loop
+	producer = &fakeProducer{}
+	if n, err := Replay(context.Background(), ReplayConfig{Producer: producer, Decoder: newDecoder(), Resume: &last}); err != nil || n != 0 {
+		t.Errorf("Replay at the end returned %d, %v", n, err)
+	}
+}
+
+func TestReplay_CheckpointAcrossLoops(t *testing.T) {
+	entries := make([]testEntry, 10)
+	for i := range entries {
+		entries[i] = testEntry{"t", fmt.Sprint(i), "v", int64(i)}
+	}
+	data := encodedBytes(t, entries)
+	newDecoder := func() *transcoder.DecodeReader {
+		// A reader per replay, as a canceled replay's reader may still be running
+		decoder, err := transcoder.NewDecodeReader(bytes.NewReader(data), true)
+		if err != nil {
+			t.Fatalf("NewDecodeReader failed: %v", err)
+		}
+		return decoder
+	}
+
+	// Loop until a few batches have been written
+	ctx, cancel := context.WithCancel(context.Background())
+	producer := &fakeProducer{after: func(total int) {
+		if total >= 2*BatchSize {
+			cancel()
+		}
+	}}
+	var checkpoints []ReplayPosition
+	var sent []int64
+	Replay(ctx, ReplayConfig{
+		Producer: producer,
+		Decoder:  newDecoder(),
+		Loop:     true,
+		OnCheckpoint: func(pos ReplayPosition, s int64) {
+			checkpoints = append(checkpoints, pos)
+			sent = append(sent, s)
+		},
+	})
+	cancel()
+	if len(checkpoints) < 2 {
+		t.Fatalf("%d checkpoints, want at least 2", len(checkpoints))
+	}
+	for i, pos := range checkpoints {
+		if got := pos.Loop*10 + pos.Ordinal; got != sent[i] {
+			t.Errorf("checkpoint %+v after %d messages", pos, sent[i])
+		}
+	}
+
+	// Resuming continues with the next loop iteration
+	last := checkpoints[len(checkpoints)-1]
+	ctx, cancel = context.WithCancel(context.Background())
+	defer cancel()
+	producer = &fakeProducer{after: func(int) { cancel() }}
+	var resumed ReplayPosition
+	Replay(ctx, ReplayConfig{
+		Producer:     producer,
+		Decoder:      newDecoder(),
+		Loop:         true,
+		Resume:       &last,
+		OnCheckpoint: func(pos ReplayPosition, _ int64) { resumed = pos },
+	})
+	if len(producer.keys) == 0 {
+		t.Fatal("resumed replay sent nothing")
+	}
+	wantFirst := fmt.Sprint(last.Ordinal % 10)
+	if producer.keys[0] != wantFirst {
+		t.Errorf("resumed replay starts with %q, want %q", producer.keys[0], wantFirst)
+	}
+	if got := resumed.Loop*10 + resumed.Ordinal - (last.Loop*10 + last.Ordinal); got != int64(len(producer.keys)) {
+		t.Errorf("resumed checkpoint %+v after %d messages from %+v", resumed, len(producer.keys), last)
+	}
+}
+
+func TestReplay_CheckpointWithConcurrency(t *testing.T) {
+	entries := make([]testEntry, 100)
+	for i := range entries {
+		entries[i] = testEntry{"t", fmt.Sprint(i), "v", int64(i)}
+	}
+	data := encodedBytes(t, entries)
+	decoder, err := transcoder.NewDecodeReader(bytes.NewReader(data), true)
+	if err != nil {
+		t.Fatalf("NewDecodeReader failed: %v", err)
+	}
+	var last ReplayPosition
+	var sent int64
+	n, err := Replay(context.Background(), ReplayConfig{
+		Producer:     &fakeProducer{},
+		Decoder:      decoder,
+		Concurrency:  3,
+		Linger:       time.Millisecond,
+		OnCheckpoint: func(pos ReplayPosition, s int64) { last, sent = pos, s },
+	})
+	if err != nil || n != 100 {
+		t.Fatalf("Replay returned %d, %v", n, err)
+	}
+	if want := (ReplayPosition{Offset: int64(len(data)), Ordinal: 100}); last != want || sent != 100 {
+		t.Errorf("last checkpoint %+v after %d messages, want %+v after 100", last, sent, want)
+	}
+}
+
+func TestReplay_CheckpointWithSampleSize(t *testing.T) {
+	decoder, err := transcoder.NewDecodeReader(encodeEntries(t, []testEntry{{"t", "a", "1", 0}}), true)
+	if err != nil {
+		t.Fatalf("NewDecodeReader failed: %v", err)
+	}
+	sampler, err := sample.New(sample.Config{Size: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = Replay(context.Background(), ReplayConfig{Producer: &fakeProducer{}, Decoder: decoder, Sampler: sampler, OnCheckpoint: func(ReplayPosition, int64) {}})
+	if err == nil {
+		t.Error("expected an error combining a sample size and checkpoints")
+	}
+}
+
+func TestReplay_CheckpointWithFailedTarget(t *testing.T) {
+	entries := make([]testEntry, 10)
+	for i := range entries {
+		entries[i] = testEntry{"t", fmt.Sprint(i), "v", int64(i)}
+	}
+	data := encodedBytes(t, entries)
+	replay := func(targets []*ReplayTarget, resume *ReplayPosition) (last *ReplayPosition) {
+		decoder, err := transcoder.NewDecodeReader(bytes.NewReader(data), true)
+		if err != nil {
+			t.Fatal(err)
+		}
+		// Batches of at most two messages
+		_, err = Replay(context.Background(), ReplayConfig{
+			Targets:       targets,
+			Decoder:       decoder,
+			Limiter:       ratelimit.New(ratelimit.Constant(1000), nil),
+			RateTolerance: 0.002,
+			LogWriter:     io.Discard,
+			Resume:        resume,
+			OnCheckpoint:  func(pos ReplayPosition, _ int64) { last = &pos },
+		})
+		if err != nil {
+			t.Fatalf("Replay failed: %v", err)
+		}
+		return last
+	}
+
+	// Target b loses the batch with message 4, but a writes it, so the
+	// replay goes on
+	a, b := &targetProducer{}, &targetProducer{fail: failOn("4", errors.New("boom"))}
+	last := replay([]*ReplayTarget{{Name: "a", Producer: a}, {Name: "b", Producer: b}}, nil)
+	lost := 0 // Messages b wrote before the lost batch
+	for lost < len(b.keys()) && b.keys()[lost] == fmt.Sprint(lost) {
+		lost++
+	}
+	if len(a.keys()) != 10 || lost > 4 || !slices.Contains(b.keys(), "9") {
+		t.Fatalf("a wrote %v and b wrote %v, want all but b's batch with 4", a.keys(), b.keys())
+	}
+	// The checkpoint stays after the last batch b wrote before the failure
+	if last == nil || last.Ordinal != int64(lost) {
+		t.Fatalf("last checkpoint %+v, want ordinal %d, before the batch b lost", last, lost)
+	}
+
+	// Resuming sends b what it lost
+	b.fail = nil
+	replay([]*ReplayTarget{{Name: "a", Producer: a}, {Name: "b", Producer: b}}, last)
+	for i := range entries {
+		if !slices.Contains(b.keys(), fmt.Sprint(i)) {
+			t.Errorf("b never received message %d, even after resuming", i)
+		}
+	}
+}
+
+func encodedBytes(t *testing.T, entries []testEntry) []byte {
+	t.Helper()
+	data, err := io.ReadAll(encodeEntries(t, entries))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return data
+}
@@ -0,0 +1,127 @@
+package pkg
+
+import (
+	"context"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/lolocompany/kafka-replay/v2/pkg/transcoder"
+	"github.com/segmentio/kafka-go"
+)
+
+// IterationHeader is the header that LoopVariation.Header adds to messages
+const IterationHeader = "replay-iteration"
+
+// iterationPlaceholder is replaced by the loop iteration in LoopVariation
+// templates
+const iterationPlaceholder = "{iteration}"
+
+// LoopVariation changes messages on each loop iteration, so that consumers
+// that deduplicate see new messages on every pass. In the templates,
+// {iteration} is replaced by the iteration number, counted from 0.
+type LoopVariation struct {
+	KeyPrefix string // Template prepended to keys; messages without a key keep none
+	KeySuffix string // Template appended to keys
+	Header    string // Template for the value of an IterationHeader header ("" for none)
+	// TimestampShift is added to the timestamps of each iteration once per
+	// iteration, e.g. the span of the recording (see RecordedSpan), so that
+	// every pass continues where the previous one ended. It only applies to
+	// timestamps preserved from the recording.
+	TimestampShift time.Duration
+}
+
+// enabled reports whether v changes anything
+func (v LoopVariation) enabled() bool {
+	return v.KeyPrefix != "" || v.KeySuffix != "" || v.Header != "" || v.TimestampShift != 0
+}
+
+// loopVariator applies a LoopVariation, expanding its templates once per
+// iteration
+type loopVariator struct {
+	LoopVariation
+	iteration      int64
+	prefix, suffix []byte
+	header         []byte
+}
+
+func newLoopVariator(v LoopVariation) *loopVariator {
+	l := &loopVariator{LoopVariation: v}
+	l.expand(0)
+	return l
+}
+
+func (l *loopVariator) expand(iteration int64) {
+	n := strconv.FormatInt(iteration, 10)
+	l.iteration = iteration
+	l.prefix = []byte(strings.ReplaceAll(l.KeyPrefix, iterationPlaceholder, n))
+	l.suffix = []byte(strings.ReplaceAll(l.KeySuffix, iterationPlaceholder, n))
+	l.header = nil
+	if l.Header != "" {
+		l.header = []byte(strings.ReplaceAll(l.Header, iterationPlaceholder, n))
+	}
+}
+
+// apply varies msg, held in pooled buffers, for iteration. preserved tells
+// whether msg's timestamp is the recorded one.
+func (l *loopVariator) apply(msg *kafka.Message, iteration int64, preserved bool) {
+	if iteration != l.iteration {
+		l.expand(iteration)
+	}
+	if msg.Key != nil && len(l.prefix)+len(l.suffix) > 0 {
+		msg.Key = affix(msg.Key, l.prefix, l.suffix)
+	}
+	if l.header != nil {
+		// Recordings have no headers, and the value is only read
+		msg.Headers = []kafka.Header{{Key: IterationHeader, Value: l.header}}
+	}
+	if l.TimestampShift != 0 && preserved {
+		msg.Time = msg.Time.Add(time.Duration(iteration) * l.TimestampShift)
+	}
+}
+
+// affix returns prefix + key + suffix, in key's pooled buffer when it fits
+func affix(key, prefix, suffix []byte) []byte {
+	n := len(prefix) + len(key) + len(suffix)
+	if cap(key) < n {
+		out := make([]byte, 0, n)
+		out = append(append(append(out, prefix...), key...), suffix...)
+		returnKeySlice(key)
+		return out
+	}
+	out := key[:n]
+	copy(out[len(prefix):], key)
+	copy(out, prefix)
+	copy(out[len(prefix)+len(key):], suffix)
+	return out
+}
+
+// RecordedSpan returns the time from the earliest to the latest timestamp in
+// a recording.
+func RecordedSpan(ctx context.Context, input io.ReadSeeker) (time.Duration, error) {
+	decoder, err := transcoder.NewDecodeReader(input, true)
+	if err != nil {
+		return 0, err
+	}
+	reader := newEntryReader(decoder)
+	var first, last time.Time
+	for entries := 0; ; entries++ {
+		if entries%1024 == 0 && ctx.Err() != nil {
+			return 0, ctx.Err()
+		}
+		e, err := reader.next()
+		if err == io.EOF {
+			return last.Sub(first), nil
+		}
+		if err != nil {
+			return 0, err
+		}
+		if entries == 0 || e.Time.Before(first) {
+			first = e.Time
+		}
+		if entries == 0 || e.Time.After(last) {
+			last = e.Time
+		}
+	}
+}
@@ -0,0 +1,138 @@
+package pkg
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/lolocompany/kafka-replay/v2/pkg/sample"
+	"github.com/lolocompany/kafka-replay/v2/pkg/transcoder"
+	"github.com/segmentio/kafka-go"
+)
+
+// copyingProducer keeps a copy of every message written
+type copyingProducer struct {
+	mu       sync.Mutex
+	messages []kafka.Message
+}
+
+func (p *copyingProducer) WriteMessages(ctx context.Context, messages ...kafka.Message) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	for _, m := range messages {
+		m.Key = bytes.Clone(m.Key)
+		m.Value = bytes.Clone(m.Value)
+		p.messages = append(p.messages, m)
+	}
+	return nil
+}
+
+func (p *copyingProducer) keys() []string {
+	keys := make([]string, len(p.messages))
+	for i, m := range p.messages {
+		keys[i] = string(m.Key)
+	}
+	return keys
+}
+
+func TestReplay_LoopCount(t *testing.T) {
+	input := []testEntry{{"t", "a", "1", 0}, {"t", "b", "2", 1}}
+	newDecoder := func() *transcoder.DecodeReader {
+		decoder, err := transcoder.NewDecodeReader(encodeEntries(t, input), true)
+		if err != nil {
+			t.Fatalf("NewDecodeReader failed: %v", err)
+		}
+		return decoder
+	}
+
+	producer := &copyingProducer{}
+	n, err := Replay(context.Background(), ReplayConfig{Producer: producer, Decoder: newDecoder(), Loop: true, LoopCount: 3})
+	if err != nil || n != 6 {
+		t.Fatalf("Replay returned %d, %v", n, err)
+	}
+	if want := []string{"a", "b", "a", "b", "a", "b"}; !reflect.DeepEqual(producer.keys(), want) {
+		t.Errorf("sent %v, want %v", producer.keys(), want)
+	}
+
+	// A reservoir sample is replayed the same number of times
+	sampler, err := sample.New(sample.Config{Size: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	n, err = Replay(context.Background(), ReplayConfig{Producer: &copyingProducer{}, Decoder: newDecoder(), Sampler: sampler, Loop: true, LoopCount: 4})
+	if err != nil || n != 4 {
+		t.Errorf("sampled Replay returned %d, %v", n, err)
+	}
+
+	if _, err := Replay(context.Background(), ReplayConfig{Producer: &copyingProducer{}, Decoder: newDecoder(), LoopCount: 2}); err == nil {
+		t.Error("expected an error for a loop count without loop")
+	}
+}
+
+func TestReplay_LoopVariation(t *testing.T) {
+	input := []testEntry{{"t", "a", "1", 1000}, {"t", "", "2", 2000}, {"t", "b", "3", 4000}}
+	decoder, err := transcoder.NewDecodeReader(encodeEntries(t, input), true)
+	if err != nil {
+		t.Fatalf("NewDecodeReader failed: %v", err)
+	}
+	producer := &copyingProducer{}
+	_, err = Replay(context.Background(), ReplayConfig{
+		Producer:  producer,
+		Decoder:   decoder,
+		Loop:      true,
+		LoopCount: 2,
+		Variation: LoopVariation{
+			KeyPrefix:      "p{iteration}:",
+			KeySuffix:      "-{iteration}",
+			Header:         "run-{iteration}",
+			TimestampShift: 3 * time.Second,
+		},
+	})
+	if err != nil {
+		t.Fatalf("Replay failed: %v", err)
+	}
+
+	// Messages without a key keep none
+	if want := []string{"p0:a-0", "", "p0:b-0", "p1:a-1", "", "p1:b-1"}; !reflect.DeepEqual(producer.keys(), want) {
+		t.Errorf("keys %v, want %v", producer.keys(), want)
+	}
+	for i, m := range producer.messages {
+		iteration := i / len(input)
+		want := []kafka.Header{{Key: IterationHeader, Value: []byte(fmt.Sprint("run-", iteration))}}
+		if !reflect.DeepEqual(m.Headers, want) {
+			t.Errorf("message %d headers %v, want %v", i, m.Headers, want)
+		}
+		wantTime := time.UnixMilli(input[i%len(input)].ts).Add(time.Duration(iteration) * 3 * time.Second)
+		if !m.Time.Equal(wantTime) {
+			t.Errorf("message %d at %v, want %v", i, m.Time, wantTime)
+		}
+	}
+}
+
+func TestAffix(t *testing.T) {
+	// In the key's buffer when it fits
+	buf := make([]byte, 3, 16)
+	copy(buf, "key")
+	got := affix(buf, []byte("pre-"), []byte("-suf"))
+	if string(got) != "pre-key-suf" || &got[0] != &buf[0] {
+		t.Errorf("affix in place = %q", got)
+	}
+	if got := affix([]byte("key"), []byte("a-long-prefix/"), nil); string(got) != "a-long-prefix/key" {
+		t.Errorf("affix = %q", got)
+	}
+}
+
+func TestRecordedSpan(t *testing.T) {
+	input := []testEntry{{"t", "a", "1", 5000}, {"t", "b", "2", 1000}, {"t", "c", "3", 61000}}
+	span, err := RecordedSpan(context.Background(), encodeEntries(t, input))
+	if err != nil || span != time.Minute {
+		t.Errorf("RecordedSpan = %v, %v; want 1m", span, err)
+	}
+	if span, err := RecordedSpan(context.Background(), encodeEntries(t, nil)); err != nil || span != 0 {
+		t.Errorf("empty RecordedSpan = %v, %v", span, err)
+	}
+}
@@ -0,0 +1,106 @@
+package pkg
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/lolocompany/kafka-replay/v2/pkg/transcoder"
+)
+
+// PartitionMap remaps recorded partitions to target partitions. Partitions
+// that are not in the map keep their number.
+type PartitionMap map[int]int
+
+// ParsePartitionMap parses a comma-separated list of SRC:DST pairs, e.g.
+// "0:3,1:4".
+func ParsePartitionMap(s string) (PartitionMap, error) {
+	m := make(PartitionMap)
+	for _, pair := range strings.Split(s, ",") {
+		src, dst, ok := strings.Cut(strings.TrimSpace(pair), ":")
+		if !ok {
+			return nil, fmt.Errorf("invalid partition mapping %q (expected SRC:DST)", pair)
+		}
+		from, err := strconv.Atoi(strings.TrimSpace(src))
+		if err != nil || from < 0 {
+			return nil, fmt.Errorf("invalid source partition in %q", pair)
+		}
+		to, err := strconv.Atoi(strings.TrimSpace(dst))
+		if err != nil || to < 0 {
+			return nil, fmt.Errorf("invalid target partition in %q", pair)
+		}
+		if _, dup := m[from]; dup {
+			return nil, fmt.Errorf("partition %d is mapped twice", from)
+		}
+		m[from] = to
+	}
+	return m, nil
+}
+
+// Target returns the target partition of a recorded partition
+func (m PartitionMap) Target(partition int) int {
+	if to, ok := m[partition]; ok {
+		return to
+	}
+	return partition
+}
+
+// RecordedPartitions returns the sorted source partitions of a recording and
+// the number of entries without partition information (version 1 and 2 files
+// or entries recorded without it).
+func RecordedPartitions(ctx context.Context, input io.ReadSeeker) ([]int, int64, error) {
+	decoder, err := transcoder.NewDecodeReader(input, true)
+	if err != nil {
+		return nil, 0, err
+	}
+	reader := newEntryReader(decoder)
+	seen := make(map[int]bool)
+	var entries, unknown int64
+	for {
+		if entries%1024 == 0 && ctx.Err() != nil {
+			return nil, 0, ctx.Err()
+		}
+		e, err := reader.next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, 0, err
+		}
+		entries++
+		if !e.Metadata.HasPartition() {
+			unknown++
+			continue
+		}
+		seen[e.Metadata.Partition] = true
+	}
+	partitions := make([]int, 0, len(seen))
+	for p := range seen {
+		partitions = append(partitions, p)
+	}
+	sort.Ints(partitions)
+	return partitions, unknown, nil
+}
+
+// CheckPartitions verifies that every recorded partition, after mapping, is
+// one of the target topic's partitions.
+func CheckPartitions(recorded []int, m PartitionMap, target []int) error {
+	exists := make(map[int]bool, len(target))
+	for _, p := range target {
+		exists[p] = true
+	}
+	for _, p := range recorded {
+		to := m.Target(p)
+		if exists[to] {
+			continue
+		}
+		if to != p {
+			return fmt.Errorf("recorded partition %d is mapped to partition %d, but the target topic has %d partitions", p, to, len(target))
+		}
+		return fmt.Errorf("the recording uses partition %d, but the target topic has %d partitions", p, len(target))
+	}
+	return nil
+}
@@ -0,0 +1,63 @@
+package pkg
+
+import (
+	"bytes"
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/lolocompany/kafka-replay/v2/pkg/transcoder"
+)
+
+func TestParsePartitionMap(t *testing.T) {
+	m, err := ParsePartitionMap("0:3, 1:4")
+	if err != nil {
+		t.Fatalf("ParsePartitionMap failed: %v", err)
+	}
+	if m.Target(0) != 3 || m.Target(1) != 4 || m.Target(2) != 2 {
+		t.Errorf("unexpected map %v", m)
+	}
+	for _, bad := range []string{"0", "a:1", "0:-1", "0:1,0:2", ""} {
+		if _, err := ParsePartitionMap(bad); err == nil {
+			t.Errorf("expected an error for %q", bad)
+		}
+	}
+}
+
+func TestRecordedPartitions(t *testing.T) {
+	var buf bytes.Buffer
+	enc, err := transcoder.NewEncodeWriter(&buf)
+	if err != nil {
+		t.Fatalf("NewEncodeWriter failed: %v", err)
+	}
+	for _, p := range []int{2, 0, 2, -1} {
+		meta := transcoder.EntryMetadata{Topic: "t", Partition: p, Offset: -1}
+		if _, err := enc.WriteEntry(time.UnixMilli(0), []byte("v"), nil, meta); err != nil {
+			t.Fatalf("WriteEntry failed: %v", err)
+		}
+	}
+	partitions, unknown, err := RecordedPartitions(context.Background(), bytes.NewReader(buf.Bytes()))
+	if err != nil {
+		t.Fatalf("RecordedPartitions failed: %v", err)
+	}
+	if len(partitions) != 2 || partitions[0] != 0 || partitions[1] != 2 || unknown != 1 {
+		t.Errorf("got partitions %v with %d unknown", partitions, unknown)
+	}
+}
+
+func TestCheckPartitions(t *testing.T) {
+	target := []int{0, 1, 2}
+	if err := CheckPartitions([]int{0, 2}, nil, target); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+	if err := CheckPartitions([]int{0, 5}, nil, target); err == nil || !strings.Contains(err.Error(), "partition 5") {
+		t.Errorf("expected an error for partition 5, got %v", err)
+	}
+	if err := CheckPartitions([]int{0, 5}, PartitionMap{5: 1}, target); err != nil {
+		t.Errorf("unexpected error with a map: %v", err)
+	}
+	if err := CheckPartitions([]int{0}, PartitionMap{0: 9}, target); err == nil || !strings.Contains(err.Error(), "mapped to partition 9") {
+		t.Errorf("expected an error for the mapped partition, got %v", err)
+	}
+}
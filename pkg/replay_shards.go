@@ -0,0 +1,204 @@
+package pkg
+
+import (
+	"context"
+	"hash/fnv"
+	"sync"
+	"time"
+
+	"github.com/segmentio/kafka-go"
+)
+
+// ReplayStats summarizes the writes of a replay
+type ReplayStats struct {
+	Elapsed time.Duration
+	Shards  []ReplayShardStats // One per shard, see ReplayConfig.Concurrency
+}
+
+// ReplayShardStats counts the writes of one shard
+type ReplayShardStats struct {
+	Messages  int64
+	Bytes     int64 // Keys and values
+	Batches   int64
+	WriteTime time.Duration // Time spent waiting for writes
+}
+
+// Messages returns the number of messages written by all shards.
+func (s ReplayStats) Messages() int64 {
+	var n int64
+	for _, shard := range s.Shards {
+		n += shard.Messages
+	}
+	return n
+}
+
+// Bytes returns the bytes of keys and values written by all shards.
+func (s ReplayStats) Bytes() int64 {
+	var n int64
+	for _, shard := range s.Shards {
+		n += shard.Bytes
+	}
+	return n
+}
+
+// replaySharder assigns messages to shards: by partition when it is set
+// explicitly, so that each partition keeps its order, and otherwise by key
+// hash, so that each key does. Messages without a key are spread round-robin.
+type replaySharder struct {
+	shards      int
+	byPartition bool
+	keyless     int
+}
+
+func (s *replaySharder) shard(msg kafka.Message) int {
+	switch {
+	case s.byPartition:
+		return msg.Partition % s.shards
+	case msg.Key == nil:
+		s.keyless++
+		return s.keyless % s.shards
+	default:
+		h := fnv.New32a()
+		h.Write(msg.Key)
+		return int(h.Sum32() % uint32(s.shards))
+	}
+}
+
+// replayProgress finds the checkpoint position of a sharded replay: the
+// position before the earliest message that some shard has not written yet,
+// so that resuming never skips a message still waiting in a slower shard.
+type replayProgress struct {
+	mu           sync.Mutex
+	pending      [][]ReplayPosition // Per shard, the position before each message not yet written
+	written      []int64            // Per shard, messages written
+	prev         ReplayPosition     // Position after the last dispatched message
+	onCheckpoint func(pos ReplayPosition, sent int64)
+}
+
+func newReplayProgress(shards int, start ReplayPosition, onCheckpoint func(ReplayPosition, int64)) *replayProgress {
+	return &replayProgress{
+		pending:      make([][]ReplayPosition, shards),
+		written:      make([]int64, shards),
+		prev:         start,
+		onCheckpoint: onCheckpoint,
+	}
+}
+
+// dispatch records that the message ending at pos was passed to shard
+func (p *replayProgress) dispatch(shard int, pos ReplayPosition) {
+	p.mu.Lock()
+	p.pending[shard] = append(p.pending[shard], p.prev)
+	p.prev = pos
+	p.mu.Unlock()
+}
+
+// write records that shard has written sent messages in total, and reports
+// the checkpoint position. Calls to onCheckpoint never overlap.
+func (p *replayProgress) write(shard int, sent int64) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.pending[shard] = p.pending[shard][sent-p.written[shard]:]
+	p.written[shard] = sent
+
+	pos := p.prev
+	var total int64
+	for i, pending := range p.pending {
+		if len(pending) > 0 && before(pending[0], pos) {
+			pos = pending[0]
+		}
+		total += p.written[i]
+	}
+	p.onCheckpoint(pos, total)
+}
+
+// before reports whether a comes before b in a replay
+func before(a, b ReplayPosition) bool {
+	if a.Loop != b.Loop {
+		return a.Loop < b.Loop
+	}
+	return a.Ordinal < b.Ordinal
+}
+
+// runShard batches the entries from in with w until in is closed or ctx is
+// canceled. With flushWhenIdle the batch is written as soon as in is empty.
+func runShard(ctx context.Context, w *batchWriter, in <-chan replayEntry, flushWhenIdle bool) error {
+	for {
+		select {
+		case <-ctx.Done():
+			// Flush any pending batch before returning
+			if err := w.flush(ctx); err != nil {
+				return err
+			}
+			return ctx.Err()
+		case <-w.lingerC():
+			if err := w.flush(ctx); err != nil {
+				return err
+			}
+		case entry, ok := <-in:
+			if !ok {
+				// Channel closed, reader finished
+				return w.flush(ctx)
+			}
+			w.next = entry.pos
+			if err := w.add(ctx, entry.msg); err != nil {
+				return err
+			}
+			if flushWhenIdle && len(in) == 0 {
+				if err := w.flush(ctx); err != nil {
+					return err
+				}
+			}
+		}
+	}
+}
+
+// writeShards spreads the entries from in over len(writers) shards that write
+// concurrently, each with its own batch, and returns the first error. cancel
+// stops the others after an error. With progress, dispatched and written
+// messages are tracked for checkpoints.
+func writeShards(ctx context.Context, cancel context.CancelFunc, writers []*batchWriter, in <-chan replayEntry, sharder *replaySharder, progress *replayProgress, flushWhenIdle bool) error {
+	shardChans := make([]chan replayEntry, len(writers))
+	for i := range shardChans {
+		shardChans[i] = make(chan replayEntry, BatchSize/len(writers)+1)
+	}
+
+	// Dispatcher: routes each entry to its shard
+	go func() {
+		defer func() {
+			for _, c := range shardChans {
+				close(c)
+			}
+		}()
+		for entry := range in {
+			i := sharder.shard(entry.msg)
+			if progress != nil {
+				progress.dispatch(i, entry.pos)
+			}
+			select {
+			case shardChans[i] <- entry:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+
+	var mu sync.Mutex
+	var firstErr error
+	var wg sync.WaitGroup
+	for i, w := range writers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if err := runShard(ctx, w, shardChans[i], flushWhenIdle); err != nil {
+				mu.Lock()
+				if firstErr == nil {
+					firstErr = err
+				}
+				mu.Unlock()
+				cancel()
+			}
+		}()
+	}
+	wg.Wait()
+	return firstErr
+}
@@ -0,0 +1,122 @@
+package pkg
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"sync"
+	"testing"
+
+	"github.com/lolocompany/kafka-replay/v2/pkg/transcoder"
+	"github.com/segmentio/kafka-go"
+)
+
+// keyOrderProducer records the values written per key
+type keyOrderProducer struct {
+	mu     sync.Mutex
+	values map[string][]int
+}
+
+func (p *keyOrderProducer) WriteMessages(ctx context.Context, messages ...kafka.Message) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	for _, m := range messages {
+		v, err := strconv.Atoi(string(m.Value))
+		if err != nil {
+			return err
+		}
+		p.values[string(m.Key)] = append(p.values[string(m.Key)], v)
+	}
+	return nil
+}
+
+func TestReplaySharder(t *testing.T) {
+	s := &replaySharder{shards: 4}
+	for i := range 20 {
+		key := []byte(fmt.Sprint("key-", i))
+		if a, b := s.shard(kafka.Message{Key: key}), s.shard(kafka.Message{Key: key}); a != b {
+			t.Errorf("key %s in shards %d and %d", key, a, b)
+		}
+	}
+	seen := map[int]bool{}
+	for range 4 {
+		seen[s.shard(kafka.Message{})] = true
+	}
+	if len(seen) != 4 {
+		t.Errorf("messages without a key went to %d of 4 shards", len(seen))
+	}
+
+	s = &replaySharder{shards: 4, byPartition: true}
+	if got := s.shard(kafka.Message{Key: []byte("a"), Partition: 6}); got != 2 {
+		t.Errorf("partition 6 in shard %d, want 2", got)
+	}
+}
+
+func TestReplay_Concurrency(t *testing.T) {
+	const count, keys, shards = 2000, 16, 4
+	entries := make([]testEntry, count)
+	var size int64
+	for i := range entries {
+		entries[i] = testEntry{"t", fmt.Sprint("k", i%keys), fmt.Sprint(i), int64(i)}
+		size += int64(len(entries[i].key) + len(entries[i].value))
+	}
+	decoder, err := transcoder.NewDecodeReader(encodeEntries(t, entries), true)
+	if err != nil {
+		t.Fatalf("NewDecodeReader failed: %v", err)
+	}
+	producer := &keyOrderProducer{values: map[string][]int{}}
+	var stats ReplayStats
+
+	n, err := Replay(context.Background(), ReplayConfig{Producer: producer, Decoder: decoder, Concurrency: shards, Stats: &stats})
+	if err != nil || n != count {
+		t.Fatalf("Replay returned %d, %v", n, err)
+	}
+	if len(producer.values) != keys {
+		t.Fatalf("%d keys written, want %d", len(producer.values), keys)
+	}
+	for key, values := range producer.values {
+		for i := 1; i < len(values); i++ {
+			if values[i] < values[i-1] {
+				t.Errorf("key %s out of order: %d after %d", key, values[i], values[i-1])
+				break
+			}
+		}
+	}
+	if len(stats.Shards) != shards || stats.Messages() != count {
+		t.Fatalf("stats for %d shards with %d messages", len(stats.Shards), stats.Messages())
+	}
+	for i, s := range stats.Shards {
+		if s.Messages == 0 || s.Batches == 0 {
+			t.Errorf("shard %d wrote %d messages in %d batches", i, s.Messages, s.Batches)
+		}
+	}
+	if stats.Bytes() != size {
+		t.Errorf("%d bytes written, want %d", stats.Bytes(), size)
+	}
+}
+
+func TestReplayProgress(t *testing.T) {
+	var last ReplayPosition
+	var sent int64
+	start := ReplayPosition{Ordinal: 3}
+	p := newReplayProgress(2, start, func(pos ReplayPosition, s int64) { last, sent = pos, s })
+	at := func(ordinal int64) ReplayPosition { return ReplayPosition{Ordinal: ordinal} }
+
+	p.dispatch(0, at(4))
+	p.dispatch(1, at(5))
+	p.dispatch(1, at(6))
+	// Shard 1 finished first, but the message of shard 0 is still pending
+	p.write(1, 2)
+	if last != start || sent != 2 {
+		t.Errorf("checkpoint %+v after %d messages, want %+v after 2", last, sent, start)
+	}
+	p.dispatch(1, at(7))
+	p.write(0, 1)
+	if last != at(6) || sent != 3 {
+		t.Errorf("checkpoint %+v after %d messages, want %+v after 3", last, sent, at(6))
+	}
+	p.write(1, 3)
+	if last != at(7) || sent != 4 {
+		t.Errorf("checkpoint %+v after %d messages, want %+v after 4", last, sent, at(7))
+	}
+}
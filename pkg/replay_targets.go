@@ -0,0 +1,77 @@
+package pkg
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+
+	"github.com/segmentio/kafka-go"
+)
+
+// ReplayTarget is one destination of a replay. Replay fills in the counters.
+type ReplayTarget struct {
+	Name     string // Shown in reports, e.g. "cluster-a:orders-v1"
+	Topic    string // Destination topic, recorded with dead letters
+	Producer MessageWriter
+
+	mu     sync.Mutex // Guards the counters while shards write concurrently
+	Sent   int64      // Messages written
+	Failed int64      // Messages this target failed to write, after retries
+	Err    error      // Most recent write error
+}
+
+// count adds the outcome of a write to the counters
+func (t *ReplayTarget) count(sent, failed int, err error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.Sent += int64(sent)
+	t.Failed += int64(failed)
+	if err != nil {
+		t.Err = err
+	}
+}
+
+// writeTargets writes a batch to every target concurrently and waits for all
+// of them, retrying and dead-lettering failed messages as d allows. Failures
+// are counted per target; the batch only fails if every target failed to
+// write it, so one unavailable destination does not stop the others. It
+// returns the number of targets that failed to write part of the batch.
+// Messages that were dead-lettered do not count as failed.
+func writeTargets(ctx context.Context, targets []*ReplayTarget, batch []kafka.Message, d delivery) (int, error) {
+	if len(targets) == 1 {
+		t := targets[0]
+		failed, err := d.send(ctx, t.Producer, t.Topic, t.Name, batch)
+		t.count(len(batch)-failed, failed, err)
+		if err != nil {
+			return 1, fmt.Errorf("failed to write batch to Kafka: %w", err)
+		}
+		return 0, nil
+	}
+
+	counts := make([]int, len(targets))
+	errs := make([]error, len(targets))
+	var wg sync.WaitGroup
+	for i, t := range targets {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			// Each producer gets its own slice; keys and values are shared read-only
+			counts[i], errs[i] = d.send(ctx, t.Producer, t.Topic, t.Name, append([]kafka.Message(nil), batch...))
+		}()
+	}
+	wg.Wait()
+
+	failed := 0
+	for i, t := range targets {
+		t.count(len(batch)-counts[i], counts[i], errs[i])
+		if errs[i] != nil {
+			failed++
+			errs[i] = fmt.Errorf("%s: %w", t.Name, errs[i])
+		}
+	}
+	if failed == len(targets) {
+		return failed, fmt.Errorf("failed to write batch to any target: %w", errors.Join(errs...))
+	}
+	return failed, nil
+}
@@ -0,0 +1,166 @@
+package pkg
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"reflect"
+	"slices"
+	"sync"
+	"testing"
+	"time"
+
+	kafkapkg "github.com/lolocompany/kafka-replay/v2/pkg/kafka"
+	"github.com/lolocompany/kafka-replay/v2/pkg/ratelimit"
+	"github.com/lolocompany/kafka-replay/v2/pkg/transcoder"
+	"github.com/segmentio/kafka-go"
+)
+
+// targetProducer is the producer of one replay target. It records the keys
+// it wrote, and fails the writes that fail returns an error for.
+type targetProducer struct {
+	fail func(keys []string) error // Optional
+
+	mu      sync.Mutex
+	written []string
+}
+
+func (p *targetProducer) WriteMessages(ctx context.Context, messages ...kafka.Message) error {
+	keys := make([]string, len(messages))
+	for i, m := range messages {
+		keys[i] = string(m.Key)
+	}
+	if p.fail != nil {
+		if err := p.fail(keys); err != nil {
+			return err
+		}
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.written = append(p.written, keys...)
+	return nil
+}
+
+func (p *targetProducer) keys() []string {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return slices.Clone(p.written)
+}
+
+// failOn fails every write of a batch containing key
+func failOn(key string, err error) func([]string) error {
+	return func(keys []string) error {
+		if slices.Contains(keys, key) {
+			return err
+		}
+		return nil
+	}
+}
+
+func TestReplay_Targets(t *testing.T) {
+	input := []testEntry{{"t", "a", "1", 0}, {"t", "b", "2", 1}}
+	newDecoder := func() *transcoder.DecodeReader {
+		decoder, err := transcoder.NewDecodeReader(encodeEntries(t, input), true)
+		if err != nil {
+			t.Fatalf("NewDecodeReader failed: %v", err)
+		}
+		return decoder
+	}
+	producer := kafkapkg.NewProducer([]string{"localhost:0"}, "t", false, false)
+	defer producer.Close()
+	targets := []*ReplayTarget{{Name: "a:t", Producer: producer}, {Name: "b:t", Producer: producer}}
+
+	n, err := Replay(context.Background(), ReplayConfig{Targets: targets, Decoder: newDecoder(), DryRun: true})
+	if err != nil || n != 2 {
+		t.Fatalf("Replay returned %d, %v", n, err)
+	}
+
+	if _, err := Replay(context.Background(), ReplayConfig{Producer: producer, Targets: targets, Decoder: newDecoder()}); err == nil {
+		t.Errorf("expected an error for both a producer and targets")
+	}
+	if _, err := Replay(context.Background(), ReplayConfig{Targets: []*ReplayTarget{{Name: "x"}}, Decoder: newDecoder()}); err == nil {
+		t.Errorf("expected an error for a target without a producer")
+	}
+}
+
+func TestReplay_TargetsFanOut(t *testing.T) {
+	entries := make([]testEntry, 10)
+	want := make([]string, len(entries))
+	for i := range entries {
+		entries[i] = testEntry{"t", fmt.Sprint(i), "v", int64(i)}
+		want[i] = fmt.Sprint(i)
+	}
+	rate := 1000.0
+	replay := func(targets ...*ReplayTarget) (int64, error) {
+		decoder, err := transcoder.NewDecodeReader(encodeEntries(t, entries), true)
+		if err != nil {
+			t.Fatal(err)
+		}
+		// Batches of at most two messages, paced by one limiter for all targets
+		return Replay(context.Background(), ReplayConfig{
+			Targets:       targets,
+			Decoder:       decoder,
+			Limiter:       ratelimit.New(ratelimit.Constant(rate), nil),
+			RateTolerance: 2 / rate,
+			LogWriter:     io.Discard,
+		})
+	}
+	count := func(target *ReplayTarget) string {
+		return fmt.Sprintf("%s: %d sent, %d failed", target.Name, target.Sent, target.Failed)
+	}
+
+	// Every target gets every message once, from a single read of the input
+	a, b := &targetProducer{}, &targetProducer{}
+	targets := []*ReplayTarget{{Name: "a", Producer: a}, {Name: "b", Producer: b}}
+	if n, err := replay(targets...); err != nil || n != 10 {
+		t.Fatalf("Replay returned %d, %v", n, err)
+	}
+	for i, p := range []*targetProducer{a, b} {
+		if !reflect.DeepEqual(p.keys(), want) {
+			t.Errorf("%s wrote %v, want %v", targets[i].Name, p.keys(), want)
+		}
+		if got := count(targets[i]); got != targets[i].Name+": 10 sent, 0 failed" {
+			t.Errorf("counted %s", got)
+		}
+	}
+
+	// The rate limit applies to each message once, not once per target: ten
+	// messages at 100/s take 0.1s, not 0.2s
+	rate = 100
+	start := time.Now()
+	if _, err := replay(&ReplayTarget{Name: "a", Producer: &targetProducer{}}, &ReplayTarget{Name: "b", Producer: &targetProducer{}}); err != nil {
+		t.Fatal(err)
+	}
+	if elapsed := time.Since(start); elapsed < 50*time.Millisecond || elapsed > 150*time.Millisecond {
+		t.Errorf("replay at 100 messages/s took %s, want about 100ms", elapsed)
+	}
+	rate = 1000
+
+	// One failed target is counted, and the others go on
+	boom := errors.New("boom")
+	a, b = &targetProducer{fail: failOn("4", boom)}, &targetProducer{}
+	targets = []*ReplayTarget{{Name: "a", Producer: a}, {Name: "b", Producer: b}}
+	if n, err := replay(targets...); err != nil || n != 10 {
+		t.Fatalf("Replay with one failed target returned %d, %v", n, err)
+	}
+	lost := 10 - int64(len(a.keys()))
+	if lost == 0 || targets[0].Sent != 10-lost || targets[0].Failed != lost || !errors.Is(targets[0].Err, boom) {
+		t.Errorf("counted %s (error %v) after losing %d messages", count(targets[0]), targets[0].Err, lost)
+	}
+	if got := count(targets[1]); got != "b: 10 sent, 0 failed" || targets[1].Err != nil {
+		t.Errorf("counted %s (error %v)", got, targets[1].Err)
+	}
+
+	// The replay fails when every target fails the same batch
+	a, b = &targetProducer{fail: failOn("4", boom)}, &targetProducer{fail: failOn("4", boom)}
+	targets = []*ReplayTarget{{Name: "a", Producer: a}, {Name: "b", Producer: b}}
+	if _, err := replay(targets...); !errors.Is(err, boom) {
+		t.Fatalf("Replay with every target failing returned %v", err)
+	}
+	for i, p := range []*targetProducer{a, b} {
+		if slices.Contains(p.keys(), "4") || targets[i].Failed == 0 || targets[i].Sent != int64(len(p.keys())) {
+			t.Errorf("counted %s after writing %v", count(targets[i]), p.keys())
+		}
+	}
+}
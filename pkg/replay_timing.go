@@ -0,0 +1,78 @@
+package pkg
+
+import (
+	"context"
+	"time"
+)
+
+// ReplayTiming selects how Replay paces messages.
+type ReplayTiming string
+
+const (
+	// TimingRate sends as fast as possible, or at ReplayConfig.Rate.
+	TimingRate ReplayTiming = "rate"
+	// TimingOriginal reproduces the recorded gaps between messages, scaled by
+	// ReplayConfig.Speed and clamped to ReplayConfig.MaxIdle.
+	TimingOriginal ReplayTiming = "original"
+)
+
+// timingScheduler computes when each message is due under TimingOriginal.
+// Message times are kept relative to the start of the replay rather than to
+// the previous send, so time spent writing does not add up as drift; a
+// replay that falls behind catches up by sending without waiting.
+type timingScheduler struct {
+	speed   float64
+	maxIdle time.Duration
+	now     func() time.Time
+
+	started bool
+	start   time.Time     // Wall time of the first message
+	last    time.Time     // Recorded time of the previous message
+	offset  time.Duration // Due time of the previous message relative to start
+}
+
+func newTimingScheduler(speed float64, maxIdle time.Duration) *timingScheduler {
+	if speed <= 0 {
+		speed = 1
+	}
+	return &timingScheduler{speed: speed, maxIdle: maxIdle, now: time.Now}
+}
+
+// delay returns how long to wait before sending a message recorded at t
+func (s *timingScheduler) delay(t time.Time) time.Duration {
+	if !s.started {
+		s.started = true
+		s.start = s.now()
+		s.last = t
+		return 0
+	}
+	gap := t.Sub(s.last)
+	s.last = t
+	if gap < 0 {
+		// Out of order, or the start of a new loop iteration
+		gap = 0
+	}
+	wait := time.Duration(float64(gap) / s.speed)
+	if s.maxIdle > 0 && wait > s.maxIdle {
+		wait = s.maxIdle
+	}
+	s.offset += wait
+	return s.start.Add(s.offset).Sub(s.now())
+}
+
+// wait blocks until the message recorded at t is due. It returns false if
+// ctx is canceled first.
+func (s *timingScheduler) wait(ctx context.Context, t time.Time) bool {
+	d := s.delay(t)
+	if d <= 0 {
+		return ctx.Err() == nil
+	}
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return true
+	case <-ctx.Done():
+		return false
+	}
+}
@@ -0,0 +1,68 @@
+package pkg
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	kafkapkg "github.com/lolocompany/kafka-replay/v2/pkg/kafka"
+	"github.com/lolocompany/kafka-replay/v2/pkg/transcoder"
+)
+
+func TestTimingScheduler(t *testing.T) {
+	base := time.Unix(1_700_000_000, 0)
+	now := base
+	s := newTimingScheduler(2, 5*time.Second)
+	s.now = func() time.Time { return now }
+
+	steps := []struct {
+		recorded time.Duration // Relative to the first message
+		elapsed  time.Duration // Wall time passed since the start when the message is read
+		want     time.Duration
+	}{
+		{0, 0, 0},
+		{2 * time.Second, 0, time.Second}, // Half the gap at speed 2
+		{3 * time.Second, 2 * time.Second, -500 * time.Millisecond}, // Behind schedule: no wait
+		{8 * time.Hour, 2 * time.Second, 4500 * time.Millisecond},   // Overnight lull clamped to 5s
+		{8*time.Hour + time.Second, 6500 * time.Millisecond, 500 * time.Millisecond},
+		{time.Second, 7 * time.Second, 0}, // Loop restart: no wait
+		{3 * time.Second, 7 * time.Second, time.Second},
+	}
+	for i, step := range steps {
+		now = base.Add(step.elapsed)
+		if got := s.delay(base.Add(step.recorded)); got != step.want {
+			t.Errorf("step %d: delay %v, want %v", i, got, step.want)
+		}
+	}
+}
+
+func TestReplay_OriginalTiming(t *testing.T) {
+	// Gaps of 0, 200ms and 400ms, replayed at double speed
+	input := []testEntry{{"t", "a", "1", 0}, {"t", "b", "2", 200}, {"t", "c", "3", 600}}
+	decoder, err := transcoder.NewDecodeReader(encodeEntries(t, input), false)
+	if err != nil {
+		t.Fatalf("NewDecodeReader failed: %v", err)
+	}
+	producer := kafkapkg.NewProducer([]string{"localhost:0"}, "t", false, false)
+	defer producer.Close()
+
+	start := time.Now()
+	n, err := Replay(context.Background(), ReplayConfig{
+		Producer: producer,
+		Decoder:  decoder,
+		DryRun:   true,
+		Timing:   TimingOriginal,
+		Speed:    2,
+	})
+	elapsed := time.Since(start)
+	if err != nil || n != 3 {
+		t.Fatalf("Replay returned %d, %v", n, err)
+	}
+	if elapsed < 300*time.Millisecond || elapsed > 2*time.Second {
+		t.Errorf("replay took %v, want about 300ms", elapsed)
+	}
+
+	if _, err := Replay(context.Background(), ReplayConfig{Producer: producer, Decoder: decoder, Timing: TimingOriginal, Rate: 10}); err == nil {
+		t.Errorf("expected an error combining rate and original timing")
+	}
+}
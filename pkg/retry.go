@@ -0,0 +1,171 @@
+package pkg
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"syscall"
+	"time"
+
+	"github.com/segmentio/kafka-go"
+)
+
+const (
+	// DefaultRetryBackoff is the wait before the first retry
+	DefaultRetryBackoff = 500 * time.Millisecond
+	// DefaultMaxRetryBackoff is the longest wait between retries
+	DefaultMaxRetryBackoff = 30 * time.Second
+)
+
+// RetryPolicy controls how writes that failed with a retriable error are
+// retried. The zero value does not retry.
+type RetryPolicy struct {
+	Retries    int           // Retries after the first attempt
+	Backoff    time.Duration // Wait before the first retry, doubled for each further retry (default DefaultRetryBackoff)
+	MaxBackoff time.Duration // Longest wait between retries (default DefaultMaxRetryBackoff)
+}
+
+// backoff returns the wait before retry number n, counted from 0
+func (p RetryPolicy) backoff(n int) time.Duration {
+	d, limit := p.Backoff, p.MaxBackoff
+	if d <= 0 {
+		d = DefaultRetryBackoff
+	}
+	if limit <= 0 {
+		limit = DefaultMaxRetryBackoff
+	}
+	for range n {
+		if d >= limit/2 {
+			return limit
+		}
+		d *= 2
+	}
+	return min(d, limit)
+}
+
+// retriable reports whether a failed write may succeed if retried: Kafka
+// errors the protocol marks as retriable (such as leader not available or a
+// request timeout), and network errors and timeouts, as when a broker
+// restarts. Errors such as message too large or authorization failures are
+// fatal.
+func retriable(err error) bool {
+	var kafkaErr kafka.Error
+	if errors.As(err, &kafkaErr) {
+		return kafkaErr.Temporary()
+	}
+	var tooLarge kafka.MessageTooLargeError
+	if errors.As(err, &tooLarge) {
+		return false
+	}
+	var netErr net.Error
+	if errors.As(err, &netErr) {
+		return true
+	}
+	return errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) ||
+		errors.Is(err, syscall.ECONNREFUSED) || errors.Is(err, syscall.ECONNRESET) ||
+		errors.Is(err, context.DeadlineExceeded)
+}
+
+// delivery writes batches with retries, and dead-letters the messages that
+// still fail
+type delivery struct {
+	retry      RetryPolicy
+	deadLetter *DeadLetter // Optional
+	log        io.Writer
+}
+
+// send writes batch to w. It returns the number of messages that could not be
+// written, and an error unless all of them were dead-lettered. topic and name
+// identify the destination in the dead letter file and in log messages.
+func (d delivery) send(ctx context.Context, w MessageWriter, topic, name string, batch []kafka.Message) (int, error) {
+	failed, err := writeWithRetry(ctx, w, batch, d.retry, func(attempt int, wait time.Duration, err error) {
+		dest := ""
+		if name != "" {
+			dest = " to " + name
+		}
+		fmt.Fprintf(d.log, "Write%s failed (attempt %d of %d), retrying in %s: %v\n", dest, attempt, d.retry.Retries+1, wait, err)
+	})
+	if len(failed) == 0 {
+		return 0, nil
+	}
+	if d.deadLetter == nil || ctx.Err() != nil {
+		return len(failed), err
+	}
+	if dlErr := d.deadLetter.Add(topic, failed); dlErr != nil {
+		return len(failed), fmt.Errorf("failed to write dead letters after %w: %w", err, dlErr)
+	}
+	return len(failed), nil
+}
+
+// writeWithRetry writes batch to w, retrying the messages that failed with a
+// retriable error as policy allows. It returns the messages that could not be
+// written and the error that stopped them. onRetry is called before each
+// wait.
+func writeWithRetry(ctx context.Context, w MessageWriter, batch []kafka.Message, policy RetryPolicy, onRetry func(attempt int, wait time.Duration, err error)) ([]kafka.Message, error) {
+	var failed []kafka.Message
+	var failErr error // Error of the most recent message added to failed
+	pending := batch
+	for attempt := 0; ; {
+		err := w.WriteMessages(ctx, pending...)
+		if err == nil {
+			return failed, failErr
+		}
+		if ctx.Err() != nil {
+			return append(failed, pending...), err
+		}
+
+		// A message over the size limit stops the write before anything is
+		// sent: drop it and write the rest right away
+		var tooLarge kafka.MessageTooLargeError
+		if errors.As(err, &tooLarge) {
+			failed, failErr = append(failed, tooLarge.Message), err
+			pending = tooLarge.Remaining
+			if len(pending) == 0 {
+				return failed, failErr
+			}
+			continue
+		}
+
+		var retry []kafka.Message
+		retryErr := err
+		var writeErrs kafka.WriteErrors
+		if errors.As(err, &writeErrs) && len(writeErrs) == len(pending) {
+			// Only some partitions may have failed
+			for i, msgErr := range writeErrs {
+				switch {
+				case msgErr == nil:
+				case retriable(msgErr):
+					retry, retryErr = append(retry, pending[i]), msgErr
+				default:
+					failed, failErr = append(failed, pending[i]), msgErr
+				}
+			}
+		} else if retriable(err) {
+			retry = pending
+		} else {
+			failed, failErr = append(failed, pending...), err
+		}
+
+		if len(retry) == 0 {
+			return failed, failErr
+		}
+		if attempt >= policy.Retries {
+			return append(failed, retry...), retryErr
+		}
+		wait := policy.backoff(attempt)
+		attempt++
+		if onRetry != nil {
+			onRetry(attempt, wait, retryErr)
+		}
+		t := time.NewTimer(wait)
+		select {
+		case <-ctx.Done():
+			t.Stop()
+			return append(failed, retry...), ctx.Err()
+		case <-t.C:
+		}
+		pending = retry
+	}
+}
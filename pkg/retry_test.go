@@ -0,0 +1,222 @@
+package pkg
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"reflect"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/lolocompany/kafka-replay/v2/pkg/transcoder"
+	"github.com/segmentio/kafka-go"
+)
+
+// failingProducer fails writes as its fail function decides and records the
+// keys of every attempt
+type failingProducer struct {
+	attempts [][]string
+	fail     func(attempt int, messages []kafka.Message) error
+}
+
+func (p *failingProducer) WriteMessages(ctx context.Context, messages ...kafka.Message) error {
+	keys := make([]string, len(messages))
+	for i, m := range messages {
+		keys[i] = string(m.Key)
+	}
+	p.attempts = append(p.attempts, keys)
+	return p.fail(len(p.attempts)-1, messages)
+}
+
+func keyedMessages(keys ...string) []kafka.Message {
+	messages := make([]kafka.Message, len(keys))
+	for i, k := range keys {
+		messages[i] = kafka.Message{Key: []byte(k), Value: []byte("v")}
+	}
+	return messages
+}
+
+func TestRetriable(t *testing.T) {
+	for _, c := range []struct {
+		err  error
+		want bool
+	}{
+		{kafka.LeaderNotAvailable, true},
+		{kafka.NotLeaderForPartition, true},
+		{kafka.RequestTimedOut, true},
+		{fmt.Errorf("wrapped: %w", kafka.NotEnoughReplicas), true},
+		{&net.OpError{Op: "dial", Err: syscall.ECONNREFUSED}, true},
+		{io.ErrUnexpectedEOF, true},
+		{context.DeadlineExceeded, true},
+		{kafka.MessageSizeTooLarge, false},
+		{kafka.TopicAuthorizationFailed, false},
+		{kafka.SASLAuthenticationFailed, false},
+		{kafka.MessageTooLargeError{}, false},
+		{errors.New("unknown"), false},
+	} {
+		if got := retriable(c.err); got != c.want {
+			t.Errorf("retriable(%v) = %v, want %v", c.err, got, c.want)
+		}
+	}
+}
+
+func TestRetryPolicy_Backoff(t *testing.T) {
+	p := RetryPolicy{Backoff: 100 * time.Millisecond, MaxBackoff: time.Second}
+	var got []time.Duration
+	for n := range 6 {
+		got = append(got, p.backoff(n))
+	}
+	want := []time.Duration{100 * time.Millisecond, 200 * time.Millisecond, 400 * time.Millisecond, 800 * time.Millisecond, time.Second, time.Second}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("backoffs %v, want %v", got, want)
+	}
+}
+
+func TestWriteWithRetry(t *testing.T) {
+	policy := RetryPolicy{Retries: 3, Backoff: time.Millisecond, MaxBackoff: time.Millisecond}
+	ctx := context.Background()
+
+	t.Run("retriable then success", func(t *testing.T) {
+		p := &failingProducer{fail: func(attempt int, _ []kafka.Message) error {
+			if attempt < 2 {
+				return kafka.LeaderNotAvailable
+			}
+			return nil
+		}}
+		retries := 0
+		failed, err := writeWithRetry(ctx, p, keyedMessages("a", "b"), policy, func(int, time.Duration, error) { retries++ })
+		if len(failed) != 0 || err != nil {
+			t.Fatalf("failed %d messages: %v", len(failed), err)
+		}
+		if len(p.attempts) != 3 || retries != 2 {
+			t.Errorf("%d attempts and %d retries, want 3 and 2", len(p.attempts), retries)
+		}
+	})
+
+	t.Run("retries exhausted", func(t *testing.T) {
+		p := &failingProducer{fail: func(int, []kafka.Message) error { return kafka.RequestTimedOut }}
+		failed, err := writeWithRetry(ctx, p, keyedMessages("a", "b"), policy, nil)
+		if len(failed) != 2 || !errors.Is(err, kafka.RequestTimedOut) {
+			t.Fatalf("failed %d messages: %v", len(failed), err)
+		}
+		if len(p.attempts) != 4 {
+			t.Errorf("%d attempts, want 4", len(p.attempts))
+		}
+	})
+
+	t.Run("fatal", func(t *testing.T) {
+		p := &failingProducer{fail: func(int, []kafka.Message) error { return kafka.TopicAuthorizationFailed }}
+		failed, err := writeWithRetry(ctx, p, keyedMessages("a", "b"), policy, nil)
+		if len(failed) != 2 || !errors.Is(err, kafka.TopicAuthorizationFailed) {
+			t.Fatalf("failed %d messages: %v", len(failed), err)
+		}
+		if len(p.attempts) != 1 {
+			t.Errorf("%d attempts, want 1", len(p.attempts))
+		}
+	})
+
+	t.Run("partial write errors", func(t *testing.T) {
+		// a is written, b is retried until it succeeds, c is too large
+		p := &failingProducer{fail: func(attempt int, messages []kafka.Message) error {
+			if attempt > 0 {
+				return nil
+			}
+			return kafka.WriteErrors{nil, kafka.NotLeaderForPartition, kafka.MessageSizeTooLarge}
+		}}
+		failed, err := writeWithRetry(ctx, p, keyedMessages("a", "b", "c"), policy, nil)
+		if len(failed) != 1 || string(failed[0].Key) != "c" || !errors.Is(err, kafka.MessageSizeTooLarge) {
+			t.Fatalf("failed %v: %v", failed, err)
+		}
+		if want := [][]string{{"a", "b", "c"}, {"b"}}; !reflect.DeepEqual(p.attempts, want) {
+			t.Errorf("attempts %v, want %v", p.attempts, want)
+		}
+	})
+
+	t.Run("message too large", func(t *testing.T) {
+		p := &failingProducer{fail: func(attempt int, messages []kafka.Message) error {
+			if attempt > 0 {
+				return nil
+			}
+			return kafka.MessageTooLargeError{Message: messages[1], Remaining: []kafka.Message{messages[0], messages[2]}}
+		}}
+		failed, _ := writeWithRetry(ctx, p, keyedMessages("a", "b", "c"), RetryPolicy{}, nil)
+		if len(failed) != 1 || string(failed[0].Key) != "b" {
+			t.Fatalf("failed %v, want b", failed)
+		}
+		if want := [][]string{{"a", "b", "c"}, {"a", "c"}}; !reflect.DeepEqual(p.attempts, want) {
+			t.Errorf("attempts %v, want %v", p.attempts, want)
+		}
+	})
+
+	t.Run("canceled", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(ctx)
+		p := &failingProducer{fail: func(int, []kafka.Message) error {
+			cancel()
+			return kafka.LeaderNotAvailable
+		}}
+		long := RetryPolicy{Retries: 3, Backoff: time.Hour}
+		if _, err := writeWithRetry(ctx, p, keyedMessages("a"), long, nil); !errors.Is(err, context.Canceled) && !errors.Is(err, kafka.LeaderNotAvailable) {
+			t.Fatalf("got %v", err)
+		}
+		if len(p.attempts) != 1 {
+			t.Errorf("%d attempts after cancel, want 1", len(p.attempts))
+		}
+	})
+}
+
+func TestReplay_DeadLetter(t *testing.T) {
+	input := []testEntry{{"t", "a", "1", 1000}, {"t", "b", "2", 2000}, {"t", "c", "3", 3000}}
+	newDecoder := func() *transcoder.DecodeReader {
+		decoder, err := transcoder.NewDecodeReader(encodeEntries(t, input), true)
+		if err != nil {
+			t.Fatalf("NewDecodeReader failed: %v", err)
+		}
+		return decoder
+	}
+	// Messages with key b are rejected
+	rejectB := func(_ int, messages []kafka.Message) error {
+		errs := make(kafka.WriteErrors, len(messages))
+		for i, m := range messages {
+			if string(m.Key) == "b" {
+				errs[i] = kafka.MessageSizeTooLarge
+			}
+		}
+		if errs.Count() == 0 {
+			return nil
+		}
+		return errs
+	}
+
+	// Without a dead letter the replay fails
+	target := &ReplayTarget{Name: "x:out", Topic: "out", Producer: &failingProducer{fail: rejectB}}
+	if _, err := Replay(context.Background(), ReplayConfig{Targets: []*ReplayTarget{target}, Decoder: newDecoder(), LogWriter: io.Discard}); err == nil {
+		t.Fatal("expected an error without a dead letter")
+	}
+
+	var buf bytes.Buffer
+	deadLetter, err := NewDeadLetter(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	target = &ReplayTarget{Name: "x:out", Topic: "out", Producer: &failingProducer{fail: rejectB}}
+	n, err := Replay(context.Background(), ReplayConfig{
+		Targets:    []*ReplayTarget{target},
+		Decoder:    newDecoder(),
+		LogWriter:  io.Discard,
+		Retry:      RetryPolicy{Retries: 2, Backoff: time.Millisecond},
+		DeadLetter: deadLetter,
+	})
+	if err != nil || n != 3 {
+		t.Fatalf("Replay returned %d, %v", n, err)
+	}
+	if target.Sent != 2 || target.Failed != 1 || deadLetter.Count() != 1 {
+		t.Errorf("sent %d, failed %d, dead-lettered %d; want 2, 1, 1", target.Sent, target.Failed, deadLetter.Count())
+	}
+	if got, want := decodeEntries(t, buf.Bytes()), []testEntry{{"out", "b", "2", 2000}}; !reflect.DeepEqual(got, want) {
+		t.Errorf("dead letters %v, want %v", got, want)
+	}
+}
@@ -0,0 +1,159 @@
+// Package sample selects a subset of a message stream: a random fraction,
+// every Nth message, or a fixed-size uniform sample (reservoir sampling).
+// Fraction and every-Nth sampling can hash the message key instead, so all
+// messages of an entity are either kept or dropped together.
+package sample
+
+import (
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"math/rand/v2"
+	"sort"
+	"time"
+)
+
+// Config selects a sampling mode. Exactly one of Rate, Every and Size must be set.
+type Config struct {
+	Rate  float64 // Keep this fraction of messages, in (0, 1]
+	Every int64   // Keep every Nth message
+	Size  int     // Keep a uniform sample of this many messages (reservoir sampling)
+	ByKey bool    // Decide Rate and Every by hashing the key (key-consistent sampling)
+	// Seed makes random sampling reproducible (0 picks a random seed). For
+	// key-consistent sampling it selects a different, but stable, subset of keys.
+	Seed uint64
+}
+
+// Sampler decides which messages of a stream are kept. A Sampler is not safe
+// for concurrent use.
+type Sampler struct {
+	cfg  Config
+	rng  *rand.Rand
+	seen int64
+}
+
+// New validates cfg and creates a Sampler.
+func New(cfg Config) (*Sampler, error) {
+	modes := 0
+	if cfg.Rate != 0 {
+		modes++
+		if cfg.Rate < 0 || cfg.Rate > 1 {
+			return nil, fmt.Errorf("sample rate must be in (0, 1], got %g", cfg.Rate)
+		}
+	}
+	if cfg.Every != 0 {
+		modes++
+		if cfg.Every < 0 {
+			return nil, fmt.Errorf("sample every must be positive, got %d", cfg.Every)
+		}
+	}
+	if cfg.Size != 0 {
+		modes++
+		if cfg.Size < 0 {
+			return nil, fmt.Errorf("sample size must be positive, got %d", cfg.Size)
+		}
+		if cfg.ByKey {
+			return nil, errors.New("key-consistent sampling is not supported with a sample size")
+		}
+	}
+	if modes != 1 {
+		return nil, errors.New("exactly one of sample rate, every or size must be set")
+	}
+
+	seed := cfg.Seed
+	if seed == 0 {
+		seed = uint64(time.Now().UnixNano())
+	}
+	return &Sampler{cfg: cfg, rng: rand.New(rand.NewPCG(seed, seed>>32|seed<<32))}, nil
+}
+
+// Streaming reports whether Keep can decide per message. It is false for
+// reservoir sampling, which only knows the sample once the stream has ended.
+func (s *Sampler) Streaming() bool {
+	return s.cfg.Size == 0
+}
+
+// Keep reports whether the message with the given key is kept. It must only
+// be called for streaming samplers. Messages without a key are sampled
+// randomly even in key-consistent mode.
+func (s *Sampler) Keep(key []byte) bool {
+	s.seen++
+	if s.cfg.ByKey && len(key) > 0 {
+		h := hashKey(key, s.cfg.Seed)
+		if s.cfg.Every > 0 {
+			return h%uint64(s.cfg.Every) == 0
+		}
+		return float64(h>>11)/(1<<53) < s.cfg.Rate
+	}
+	if s.cfg.Every > 0 {
+		return s.seen%s.cfg.Every == 0
+	}
+	return s.rng.Float64() < s.cfg.Rate
+}
+
+// hashKey returns a well-mixed 64-bit hash of key
+func hashKey(key []byte, seed uint64) uint64 {
+	h := fnv.New64a()
+	h.Write(key)
+	x := h.Sum64() ^ seed
+	// splitmix64 finalizer, so every bit depends on the whole key
+	x ^= x >> 30
+	x *= 0xbf58476d1ce4e5b9
+	x ^= x >> 27
+	x *= 0x94d049bb133111eb
+	x ^= x >> 31
+	return x
+}
+
+// Reservoir keeps a uniform random sample of fixed size from a stream of
+// unknown length (Algorithm R).
+type Reservoir[T any] struct {
+	size  int
+	rng   *rand.Rand
+	seen  int64
+	items []reservoirItem[T]
+}
+
+type reservoirItem[T any] struct {
+	seq   int64
+	value T
+}
+
+// NewReservoir creates a reservoir for a Sampler configured with a sample size.
+func NewReservoir[T any](s *Sampler) *Reservoir[T] {
+	return &Reservoir[T]{size: s.cfg.Size, rng: s.rng}
+}
+
+// Add offers v to the reservoir. It returns the value that is no longer part
+// of the sample (v itself or an evicted one) and true, or false if nothing was
+// dropped, so callers can release buffers.
+func (r *Reservoir[T]) Add(v T) (T, bool) {
+	r.seen++
+	if len(r.items) < r.size {
+		r.items = append(r.items, reservoirItem[T]{seq: r.seen, value: v})
+		var zero T
+		return zero, false
+	}
+	j := r.rng.Int64N(r.seen)
+	if j >= int64(r.size) {
+		return v, true
+	}
+	evicted := r.items[j].value
+	r.items[j] = reservoirItem[T]{seq: r.seen, value: v}
+	return evicted, true
+}
+
+// Seen returns the number of values offered so far.
+func (r *Reservoir[T]) Seen() int64 {
+	return r.seen
+}
+
+// Items returns the sample in stream order.
+func (r *Reservoir[T]) Items() []T {
+	sort.Slice(r.items, func(i, j int) bool { return r.items[i].seq < r.items[j].seq })
+	out := make([]T, len(r.items))
+	for i, it := range r.items {
+		out[i] = it.value
+	}
+	return out
+}
@@ -0,0 +1,104 @@
+package sample
+
+import (
+	"fmt"
+	"math"
+	"testing"
+)
+
+func TestSampler_Every(t *testing.T) {
+	s, err := New(Config{Every: 100})
+	if err != nil {
+		t.Fatalf("New failed: %v", err)
+	}
+	kept := 0
+	for i := 1; i <= 1000; i++ {
+		if s.Keep(nil) {
+			kept++
+			if i%100 != 0 {
+				t.Errorf("kept message %d, expected only every 100th", i)
+			}
+		}
+	}
+	if kept != 10 {
+		t.Errorf("kept %d messages, want 10", kept)
+	}
+}
+
+func TestSampler_Rate(t *testing.T) {
+	s, _ := New(Config{Rate: 0.1, Seed: 42})
+	kept := 0
+	const n = 100000
+	for i := 0; i < n; i++ {
+		if s.Keep(nil) {
+			kept++
+		}
+	}
+	if got := float64(kept) / n; math.Abs(got-0.1) > 0.01 {
+		t.Errorf("kept fraction %.3f, want about 0.1", got)
+	}
+}
+
+func TestSampler_ByKeyIsConsistent(t *testing.T) {
+	a, _ := New(Config{Rate: 0.2, ByKey: true})
+	b, _ := New(Config{Rate: 0.2, ByKey: true})
+	kept := 0
+	for i := 0; i < 5000; i++ {
+		key := []byte(fmt.Sprintf("user-%d", i%1000))
+		ka, kb := a.Keep(key), b.Keep(key)
+		if ka != kb {
+			t.Fatalf("key %s sampled differently across samplers", key)
+		}
+		if ka {
+			kept++
+		}
+		// Every message of a key gets the same decision
+		if ka != a.Keep(key) {
+			t.Fatalf("key %s sampled differently within a stream", key)
+		}
+	}
+	if kept < 500 || kept > 1500 {
+		t.Errorf("kept %d of 5000 messages, want about 1000", kept)
+	}
+}
+
+func TestReservoir(t *testing.T) {
+	s, err := New(Config{Size: 10, Seed: 7})
+	if err != nil {
+		t.Fatalf("New failed: %v", err)
+	}
+	if s.Streaming() {
+		t.Fatalf("reservoir sampler must not be streaming")
+	}
+	r := NewReservoir[int](s)
+	dropped := 0
+	for i := 0; i < 1000; i++ {
+		if _, ok := r.Add(i); ok {
+			dropped++
+		}
+	}
+	items := r.Items()
+	if len(items) != 10 || dropped != 990 || r.Seen() != 1000 {
+		t.Fatalf("got %d items, %d dropped, %d seen", len(items), dropped, r.Seen())
+	}
+	for i := 1; i < len(items); i++ {
+		if items[i] <= items[i-1] {
+			t.Errorf("items not in stream order: %v", items)
+		}
+	}
+}
+
+func TestNew_Validation(t *testing.T) {
+	invalid := []Config{
+		{},
+		{Rate: 0.5, Every: 10},
+		{Rate: 1.5},
+		{Every: -1},
+		{Size: 10, ByKey: true},
+	}
+	for _, cfg := range invalid {
+		if _, err := New(cfg); err == nil {
+			t.Errorf("expected error for %+v", cfg)
+		}
+	}
+}
@@ -0,0 +1,99 @@
+package sketch
+
+import (
+	"math"
+	"math/bits"
+)
+
+// histogramSubBuckets is the number of linear sub-buckets per power of two,
+// which bounds the relative error of percentiles to 1/histogramSubBuckets
+const histogramSubBuckets = 16
+
+// Histogram records non-negative values in logarithmic buckets for
+// approximate percentiles in constant memory. Min, max and mean are exact.
+type Histogram struct {
+	counts [64 * histogramSubBuckets]int64
+	count  int64
+	sum    int64
+	min    int64
+	max    int64
+}
+
+// Add records a value; negative values are recorded as 0.
+func (h *Histogram) Add(v int64) {
+	if v < 0 {
+		v = 0
+	}
+	if h.count == 0 || v < h.min {
+		h.min = v
+	}
+	if v > h.max {
+		h.max = v
+	}
+	h.count++
+	h.sum += v
+	h.counts[bucketOf(v)]++
+}
+
+// Count returns the number of recorded values.
+func (h *Histogram) Count() int64 { return h.count }
+
+// Min returns the smallest recorded value.
+func (h *Histogram) Min() int64 { return h.min }
+
+// Max returns the largest recorded value.
+func (h *Histogram) Max() int64 { return h.max }
+
+// Mean returns the average of the recorded values.
+func (h *Histogram) Mean() float64 {
+	if h.count == 0 {
+		return 0
+	}
+	return float64(h.sum) / float64(h.count)
+}
+
+// Percentile returns an upper bound of the p-th percentile (0-100), within
+// the bucket resolution and never above Max.
+func (h *Histogram) Percentile(p float64) int64 {
+	if h.count == 0 {
+		return 0
+	}
+	rank := int64(p / 100 * float64(h.count))
+	if rank >= h.count {
+		rank = h.count - 1
+	}
+	var seen int64
+	for b, n := range h.counts {
+		seen += n
+		if seen > rank {
+			return max(min(bucketUpper(b), h.max), h.min)
+		}
+	}
+	return h.max
+}
+
+// bucketOf maps a value to its bucket: exact below histogramSubBuckets, then
+// histogramSubBuckets linear buckets per power of two
+func bucketOf(v int64) int {
+	if v < histogramSubBuckets {
+		return int(v)
+	}
+	exp := bits.Len64(uint64(v)) - 1 // v in [2^exp, 2^(exp+1))
+	shift := exp - 4                 // log2(histogramSubBuckets)
+	sub := int(v>>shift) - histogramSubBuckets
+	return (exp-3)*histogramSubBuckets + sub
+}
+
+// bucketUpper returns the largest value of bucket b
+func bucketUpper(b int) int64 {
+	if b < histogramSubBuckets {
+		return int64(b)
+	}
+	exp := b/histogramSubBuckets + 3
+	sub := b % histogramSubBuckets
+	shift := exp - 4
+	if exp == 62 && sub == histogramSubBuckets-1 {
+		return math.MaxInt64 // The top bucket would overflow
+	}
+	return (int64(histogramSubBuckets+sub+1) << shift) - 1
+}
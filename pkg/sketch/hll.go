@@ -0,0 +1,67 @@
+// Package sketch provides small-memory summaries of large streams: a
+// HyperLogLog distinct counter, a space-saving top-K counter and a
+// logarithmic histogram for percentiles.
+package sketch
+
+import (
+	"hash/fnv"
+	"math"
+	"math/bits"
+)
+
+// hllPrecision is the number of index bits (2^14 registers, ~0.8% standard error)
+const hllPrecision = 14
+
+// HyperLogLog estimates the number of distinct values added to it in 16KB.
+type HyperLogLog struct {
+	registers [1 << hllPrecision]uint8
+}
+
+// NewHyperLogLog creates an empty HyperLogLog.
+func NewHyperLogLog() *HyperLogLog {
+	return &HyperLogLog{}
+}
+
+// Add adds a value.
+func (h *HyperLogLog) Add(v []byte) {
+	x := hash64(v)
+	idx := x >> (64 - hllPrecision)
+	rank := uint8(bits.LeadingZeros64(x<<hllPrecision|1<<(hllPrecision-1))) + 1
+	if rank > h.registers[idx] {
+		h.registers[idx] = rank
+	}
+}
+
+// Count returns the estimated number of distinct values.
+func (h *HyperLogLog) Count() uint64 {
+	const m = float64(1 << hllPrecision)
+	sum := 0.0
+	zeros := 0
+	for _, r := range h.registers {
+		sum += 1 / float64(uint64(1)<<r)
+		if r == 0 {
+			zeros++
+		}
+	}
+	alpha := 0.7213 / (1 + 1.079/m)
+	estimate := alpha * m * m / sum
+	// Small range correction: linear counting is more accurate
+	if estimate <= 2.5*m && zeros > 0 {
+		estimate = m * math.Log(m/float64(zeros))
+	}
+	return uint64(estimate + 0.5)
+}
+
+// hash64 returns a well-mixed 64-bit hash of v
+func hash64(v []byte) uint64 {
+	h := fnv.New64a()
+	h.Write(v)
+	x := h.Sum64()
+	// splitmix64 finalizer, FNV alone leaves the high bits poorly mixed
+	x ^= x >> 30
+	x *= 0xbf58476d1ce4e5b9
+	x ^= x >> 27
+	x *= 0x94d049bb133111eb
+	x ^= x >> 31
+	return x
+}
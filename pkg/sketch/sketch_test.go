@@ -0,0 +1,89 @@
+package sketch
+
+import (
+	"fmt"
+	"math"
+	"testing"
+)
+
+func TestHyperLogLog(t *testing.T) {
+	for _, n := range []int{0, 10, 1000, 100_000} {
+		h := NewHyperLogLog()
+		for i := range n {
+			h.Add([]byte(fmt.Sprintf("key-%d", i)))
+			h.Add([]byte(fmt.Sprintf("key-%d", i))) // Duplicates do not count
+		}
+		got := float64(h.Count())
+		if math.Abs(got-float64(n)) > 0.03*float64(n)+1 {
+			t.Errorf("n=%d: estimated %v", n, got)
+		}
+	}
+}
+
+func TestTopK(t *testing.T) {
+	k := NewTopK(20)
+	// key-0 occurs 1000 times, key-1 500, key-2 250, plus a long tail of singletons
+	for i := range 5000 {
+		switch {
+		case i%5 == 0:
+			k.Add([]byte("key-0"))
+		case i%10 == 1:
+			k.Add([]byte("key-1"))
+		case i%20 == 2:
+			k.Add([]byte("key-2"))
+		default:
+			k.Add([]byte(fmt.Sprintf("tail-%d", i)))
+		}
+	}
+	top := k.Top(3)
+	if len(top) != 3 {
+		t.Fatalf("got %d values, want 3", len(top))
+	}
+	for i, want := range []struct {
+		value string
+		count int64
+	}{{"key-0", 1000}, {"key-1", 500}, {"key-2", 250}} {
+		if top[i].Value != want.value || top[i].Count-top[i].Error > want.count || top[i].Count < want.count {
+			t.Errorf("top[%d] = %+v, want %s with count %d", i, top[i], want.value, want.count)
+		}
+	}
+}
+
+func TestHistogram(t *testing.T) {
+	var h Histogram
+	for v := int64(1); v <= 10000; v++ {
+		h.Add(v)
+	}
+	if h.Count() != 10000 || h.Min() != 1 || h.Max() != 10000 || h.Mean() != 5000.5 {
+		t.Errorf("count %d min %d max %d mean %v", h.Count(), h.Min(), h.Max(), h.Mean())
+	}
+	for _, p := range []float64{50, 90, 99, 100} {
+		want := int64(p * 100)
+		got := h.Percentile(p)
+		if got < want || float64(got) > float64(want)*(1+1.0/histogramSubBuckets) {
+			t.Errorf("p%v = %d, want about %d", p, got, want)
+		}
+	}
+
+	var small Histogram
+	for _, v := range []int64{3, 3, 3, 7} {
+		small.Add(v)
+	}
+	if got := small.Percentile(50); got != 3 {
+		t.Errorf("p50 = %d, want 3 (exact below %d)", got, histogramSubBuckets)
+	}
+}
+
+func TestHistogramBuckets(t *testing.T) {
+	// Every value must fall in a bucket whose upper bound is at least the value
+	// and within the relative error
+	for v := int64(0); v < 1<<20; v += 7 {
+		upper := bucketUpper(bucketOf(v))
+		if upper < v || float64(upper-v) > float64(v)/histogramSubBuckets {
+			t.Fatalf("value %d in bucket %d with upper bound %d", v, bucketOf(v), upper)
+		}
+	}
+	if b := bucketOf(math.MaxInt64); b >= len(Histogram{}.counts) || bucketUpper(b) != math.MaxInt64 {
+		t.Fatalf("max value maps to bucket %d with upper bound %d", b, bucketUpper(b))
+	}
+}
@@ -0,0 +1,98 @@
+package sketch
+
+import (
+	"container/heap"
+	"sort"
+)
+
+// TopK finds the most frequent values of a stream with the space-saving
+// algorithm, keeping a fixed number of counters. Counts are upper bounds;
+// Error is the maximum overcount of each.
+type TopK struct {
+	capacity int
+	counters map[string]*counter
+	heap     counterHeap // Min-heap by count
+}
+
+// Counted is a value with its estimated count.
+type Counted struct {
+	Value string
+	Count int64
+	Error int64
+}
+
+type counter struct {
+	Counted
+	index int
+}
+
+// NewTopK creates a TopK that keeps capacity counters. Results for the top n
+// are reliable when capacity is well above n (e.g. 10n).
+func NewTopK(capacity int) *TopK {
+	if capacity < 1 {
+		capacity = 1
+	}
+	return &TopK{capacity: capacity, counters: make(map[string]*counter, capacity)}
+}
+
+// Add counts one occurrence of v.
+func (t *TopK) Add(v []byte) {
+	if c, ok := t.counters[string(v)]; ok {
+		c.Count++
+		heap.Fix(&t.heap, c.index)
+		return
+	}
+	if len(t.counters) < t.capacity {
+		c := &counter{Counted: Counted{Value: string(v), Count: 1}}
+		t.counters[c.Value] = c
+		heap.Push(&t.heap, c)
+		return
+	}
+	// Replace the least frequent value; the new one inherits its count as error
+	c := t.heap[0]
+	delete(t.counters, c.Value)
+	c.Value = string(v)
+	c.Error = c.Count
+	c.Count++
+	t.counters[c.Value] = c
+	heap.Fix(&t.heap, 0)
+}
+
+// Top returns up to n values with the highest counts, most frequent first.
+func (t *TopK) Top(n int) []Counted {
+	out := make([]Counted, 0, len(t.counters))
+	for _, c := range t.counters {
+		out = append(out, c.Counted)
+	}
+	sort.Slice(out, func(i, j int) bool {
+		if out[i].Count != out[j].Count {
+			return out[i].Count > out[j].Count
+		}
+		return out[i].Value < out[j].Value
+	})
+	if len(out) > n {
+		out = out[:n]
+	}
+	return out
+}
+
+type counterHeap []*counter
+
+func (h counterHeap) Len() int           { return len(h) }
+func (h counterHeap) Less(i, j int) bool { return h[i].Count < h[j].Count }
+func (h counterHeap) Swap(i, j int) {
+	h[i], h[j] = h[j], h[i]
+	h[i].index = i
+	h[j].index = j
+}
+func (h *counterHeap) Push(x any) {
+	c := x.(*counter)
+	c.index = len(*h)
+	*h = append(*h, c)
+}
+func (h *counterHeap) Pop() any {
+	old := *h
+	c := old[len(old)-1]
+	*h = old[:len(old)-1]
+	return c
+}
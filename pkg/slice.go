@@ -0,0 +1,70 @@
+package pkg
+
+import (
+	"context"
+	"errors"
+	"io"
+
+	"github.com/lolocompany/kafka-replay/v2/pkg/transcoder"
+)
+
+// SliceConfig holds configuration for the Slice function
+type SliceConfig struct {
+	Input  io.ReadSeeker
+	Output io.Writer
+	From   int64 // Index of the first entry to copy (0-based)
+	To     int64 // Index after the last entry to copy (-1 for the end of the input)
+}
+
+// Slice copies the entries From..To-1 of a recording into a new one. Entries
+// before From are seeked over rather than decoded; recordings have no index,
+// so reaching From still reads every entry header before it.
+func Slice(ctx context.Context, cfg SliceConfig) (int64, error) {
+	if cfg.Input == nil || cfg.Output == nil {
+		return 0, errors.New("input and output are required")
+	}
+	if cfg.From < 0 || (cfg.To >= 0 && cfg.To < cfg.From) {
+		return 0, errors.New("invalid range: from must not be negative or after to")
+	}
+
+	decoder, err := transcoder.NewDecodeReader(cfg.Input, true)
+	if err != nil {
+		return 0, err
+	}
+	encoder, err := transcoder.NewEncodeWriter(cfg.Output)
+	if err != nil {
+		return 0, err
+	}
+
+	for i := int64(0); i < cfg.From; i++ {
+		if i%1024 == 0 && ctx.Err() != nil {
+			return 0, ctx.Err()
+		}
+		if err := decoder.Skip(); err != nil {
+			if err == io.EOF {
+				return 0, nil
+			}
+			return 0, err
+		}
+	}
+
+	reader := newEntryReader(decoder)
+	var written int64
+	for cfg.To < 0 || cfg.From+written < cfg.To {
+		if written%1024 == 0 && ctx.Err() != nil {
+			return written, ctx.Err()
+		}
+		e, err := reader.next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return written, err
+		}
+		if err := writeEntry(encoder, e); err != nil {
+			return written, err
+		}
+		written++
+	}
+	return written, nil
+}
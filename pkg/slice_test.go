@@ -0,0 +1,35 @@
+package pkg
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"testing"
+)
+
+func TestSlice(t *testing.T) {
+	var input []testEntry
+	for i := 0; i < 10; i++ {
+		input = append(input, testEntry{"t", fmt.Sprint(i), fmt.Sprint(i), int64(i)})
+	}
+	cases := []struct {
+		from, to int64
+		want     []testEntry
+	}{
+		{3, 5, input[3:5]},
+		{8, -1, input[8:]},
+		{0, 2, input[:2]},
+		{12, -1, nil},
+	}
+	for _, c := range cases {
+		var out bytes.Buffer
+		n, err := Slice(context.Background(), SliceConfig{Input: encodeEntries(t, input), Output: &out, From: c.from, To: c.to})
+		if err != nil {
+			t.Fatalf("Slice(%d, %d) failed: %v", c.from, c.to, err)
+		}
+		got := decodeEntries(t, out.Bytes())
+		if n != int64(len(c.want)) || fmt.Sprint(got) != fmt.Sprint(c.want) {
+			t.Errorf("Slice(%d, %d) = %v, want %v", c.from, c.to, got, c.want)
+		}
+	}
+}
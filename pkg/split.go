@@ -0,0 +1,296 @@
+package pkg
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"io"
+	"slices"
+	"sort"
+	"time"
+
+	"github.com/lolocompany/kafka-replay/v2/pkg/transcoder"
+)
+
+// SplitMode selects how Split assigns entries to output files.
+type SplitMode string
+
+const (
+	// SplitByKeyHash distributes keys over Buckets files by key hash, so all
+	// entries of a key end up in the same file.
+	SplitByKeyHash SplitMode = "key-hash"
+	// SplitByPartition writes one file per source topic and partition.
+	SplitByPartition SplitMode = "partition"
+	// SplitByHour writes one file per hour of entry timestamps (UTC).
+	SplitByHour SplitMode = "hour"
+	// SplitBySize starts a new file whenever the current one would exceed MaxBytes.
+	SplitBySize SplitMode = "size"
+)
+
+const (
+	// MaxSplitBuckets is the largest number of files for SplitByKeyHash, whose
+	// files all stay open until the input ends
+	MaxSplitBuckets = 256
+	// splitOpenPartitions is the number of partition files SplitByPartition
+	// keeps open; the least recently written is closed to open another
+	splitOpenPartitions = 256
+	// splitOpenHours is the number of hour files SplitByHour keeps open, so
+	// that entries slightly out of order around an hour boundary still go to
+	// their hour's file
+	splitOpenHours = 2
+)
+
+// SplitConfig holds configuration for the Split function
+type SplitConfig struct {
+	Input    io.ReadSeeker
+	By       SplitMode
+	Buckets  int   // Number of files for SplitByKeyHash
+	MaxBytes int64 // Maximum file size for SplitBySize
+	// Create opens the output file with the given name, e.g. in an output directory
+	Create func(name string) (io.WriteCloser, error)
+}
+
+// SplitFile describes one file produced by Split
+type SplitFile struct {
+	Name           string    `json:"file"`
+	Entries        int64     `json:"entries"`
+	Bytes          int64     `json:"bytes"`
+	FirstTimestamp time.Time `json:"firstTimestamp"`
+	LastTimestamp  time.Time `json:"lastTimestamp"`
+	Topic          string    `json:"topic,omitempty"`     // SplitByPartition
+	Partition      *int      `json:"partition,omitempty"` // SplitByPartition, nil if unknown
+	Bucket         *int      `json:"bucket,omitempty"`    // SplitByKeyHash
+	Hour           string    `json:"hour,omitempty"`      // SplitByHour
+}
+
+// SplitManifest lists the files produced by Split
+type SplitManifest struct {
+	Input   string      `json:"input,omitempty"`
+	By      string      `json:"by"`
+	Entries int64       `json:"entries"`
+	Files   []SplitFile `json:"files"`
+}
+
+// splitOutput is an output file of Split
+type splitOutput struct {
+	file    SplitFile
+	group   string // Hour or partition of the file, otherwise its name
+	part    int    // Number of earlier files of the same group
+	w       io.WriteCloser
+	encoder *transcoder.EncodeWriter
+}
+
+// Split fans one recording out into several. Entries keep their timestamps,
+// metadata and relative order within each file. Files are named after their
+// key bucket, topic and partition, hour or sequence number, and are listed in
+// the returned manifest sorted by name, with the extra files of an hour or
+// partition (see below) after its first. Keyless entries are spread
+// round-robin over the buckets in key-hash mode.
+//
+// In hour, partition and size mode only some files are kept open, so long
+// recordings of many partitions do not run out of file descriptors: the
+// latest hours, the most recently written partitions, and the current file.
+// An entry whose hour file has already been closed, which only happens in a
+// recording far out of time order, starts another file for that hour named
+// e.g. 2024-01-15T10-1.log. Likewise, an entry of a partition whose file was
+// closed starts another file for it named e.g. orders-3.1.log.
+func Split(ctx context.Context, cfg SplitConfig) (SplitManifest, error) {
+	manifest := SplitManifest{By: string(cfg.By), Files: []SplitFile{}}
+	if cfg.Input == nil || cfg.Create == nil {
+		return manifest, errors.New("input and create are required")
+	}
+	switch cfg.By {
+	case SplitByKeyHash:
+		if cfg.Buckets <= 0 || cfg.Buckets > MaxSplitBuckets {
+			return manifest, fmt.Errorf("key-hash split requires between 1 and %d buckets", MaxSplitBuckets)
+		}
+		manifest.By = fmt.Sprintf("%s:%d", cfg.By, cfg.Buckets)
+	case SplitBySize:
+		if cfg.MaxBytes <= transcoder.HeaderSize {
+			return manifest, fmt.Errorf("size split requires a maximum size above %d bytes", transcoder.HeaderSize)
+		}
+		manifest.By = fmt.Sprintf("%s:%d", cfg.By, cfg.MaxBytes)
+	case SplitByPartition, SplitByHour:
+	default:
+		return manifest, fmt.Errorf("unsupported split mode %q (use %s:N, %s, %s or %s:BYTES)", cfg.By, SplitByKeyHash, SplitByPartition, SplitByHour, SplitBySize)
+	}
+
+	decoder, err := transcoder.NewDecodeReader(cfg.Input, true)
+	if err != nil {
+		return manifest, err
+	}
+	reader := newEntryReader(decoder)
+
+	outputs := make(map[string]*splitOutput) // Open files by name
+	var done []*splitOutput                  // Closed files, without their writers
+	defer func() {
+		for _, out := range outputs {
+			out.w.Close()
+		}
+	}()
+	open := func(file SplitFile, group string, part int) (*splitOutput, error) {
+		w, err := cfg.Create(file.Name)
+		if err != nil {
+			return nil, err
+		}
+		out := &splitOutput{file: file, group: group, part: part, w: w}
+		outputs[file.Name] = out
+		if out.encoder, err = transcoder.NewEncodeWriter(w); err != nil {
+			return nil, err
+		}
+		return out, nil
+	}
+	closeOutput := func(out *splitOutput) error {
+		delete(outputs, out.file.Name)
+		out.file.Bytes = out.encoder.TotalBytes()
+		done = append(done, &splitOutput{file: out.file, group: out.group, part: out.part})
+		return out.w.Close()
+	}
+
+	var keyless int
+	var sizePart int
+	var current *splitOutput          // SplitBySize
+	var openHours []*splitOutput      // SplitByHour, oldest hour first
+	var openPartitions []*splitOutput // SplitByPartition, least recently written first
+	parts := make(map[string]int)     // Files so far per hour or partition
+	for {
+		if manifest.Entries%1024 == 0 && ctx.Err() != nil {
+			return manifest, ctx.Err()
+		}
+		e, err := reader.next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return manifest, err
+		}
+
+		var file SplitFile
+		switch cfg.By {
+		case SplitByKeyHash:
+			var bucket int
+			if e.Key == nil {
+				bucket = keyless % cfg.Buckets
+				keyless++
+			} else {
+				h := fnv.New32a()
+				h.Write(e.Key)
+				bucket = int(h.Sum32() % uint32(cfg.Buckets))
+			}
+			file = SplitFile{Name: fmt.Sprintf("key-%0*d.log", len(fmt.Sprint(cfg.Buckets-1)), bucket), Bucket: &bucket}
+		case SplitByPartition:
+			file = SplitFile{Topic: e.Metadata.Topic}
+			name := "unknown"
+			if e.Metadata.HasPartition() {
+				p := e.Metadata.Partition
+				file.Partition = &p
+				name = fmt.Sprint(p)
+			}
+			if e.Metadata.Topic != "" {
+				name = e.Metadata.Topic + "-" + name
+			} else {
+				name = "partition-" + name
+			}
+			i := slices.IndexFunc(openPartitions, func(out *splitOutput) bool { return out.group == name })
+			if i < 0 {
+				if len(openPartitions) == splitOpenPartitions {
+					if err := closeOutput(openPartitions[0]); err != nil {
+						return manifest, err
+					}
+					openPartitions = openPartitions[1:]
+				}
+				part := parts[name]
+				parts[name]++
+				// A '.' cannot be mistaken for another topic's partition number
+				file.Name = name + ".log"
+				if part > 0 {
+					file.Name = fmt.Sprintf("%s.%d.log", name, part)
+				}
+				out, err := open(file, name, part)
+				if err != nil {
+					return manifest, err
+				}
+				openPartitions = append(openPartitions, out)
+			} else if i < len(openPartitions)-1 {
+				out := openPartitions[i]
+				openPartitions = append(slices.Delete(openPartitions, i, i+1), out)
+			}
+			file = openPartitions[len(openPartitions)-1].file
+		case SplitByHour:
+			hour := e.Time.UTC().Format("2006-01-02T15")
+			i := slices.IndexFunc(openHours, func(out *splitOutput) bool { return out.file.Hour == hour })
+			if i < 0 {
+				if len(openHours) == splitOpenHours {
+					if err := closeOutput(openHours[0]); err != nil {
+						return manifest, err
+					}
+					openHours = openHours[1:]
+				}
+				part := parts[hour]
+				parts[hour]++
+				name := hour + ".log"
+				if part > 0 {
+					name = fmt.Sprintf("%s-%d.log", hour, part)
+				}
+				out, err := open(SplitFile{Name: name, Hour: hour}, hour, part)
+				if err != nil {
+					return manifest, err
+				}
+				openHours = append(openHours, out)
+				sort.Slice(openHours, func(i, j int) bool { return openHours[i].file.Hour < openHours[j].file.Hour })
+				i = slices.Index(openHours, out)
+			}
+			file = openHours[i].file
+		case SplitBySize:
+			size := int64(transcoder.EntryFixedSize + len(e.Metadata.Topic) + len(e.Key) + len(e.Value))
+			if current != nil && current.file.Entries > 0 && current.encoder.TotalBytes()+size > cfg.MaxBytes {
+				if err := closeOutput(current); err != nil {
+					return manifest, err
+				}
+				current = nil
+			}
+			if current == nil {
+				name := fmt.Sprintf("part-%05d.log", sizePart)
+				sizePart++
+				if current, err = open(SplitFile{Name: name}, name, 0); err != nil {
+					return manifest, err
+				}
+			}
+			file = current.file
+		}
+
+		out, ok := outputs[file.Name]
+		if !ok {
+			if out, err = open(file, file.Name, 0); err != nil {
+				return manifest, err
+			}
+		}
+		if err := writeEntry(out.encoder, e); err != nil {
+			return manifest, err
+		}
+		if out.file.Entries == 0 {
+			out.file.FirstTimestamp = e.Time
+		}
+		out.file.Entries++
+		out.file.LastTimestamp = e.Time
+		manifest.Entries++
+	}
+
+	for _, out := range outputs {
+		if err := closeOutput(out); err != nil {
+			return manifest, err
+		}
+	}
+	sort.Slice(done, func(i, j int) bool {
+		a, b := done[i], done[j]
+		if a.group != b.group {
+			return a.group < b.group
+		}
+		return a.part < b.part
+	})
+	for _, out := range done {
+		manifest.Files = append(manifest.Files, out.file)
+	}
+	return manifest, nil
+}
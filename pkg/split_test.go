@@ -0,0 +1,195 @@
+package pkg
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"reflect"
+	"testing"
+	"time"
+)
+
+// memFiles collects Split outputs in memory
+type memFiles map[string]*bytes.Buffer
+
+type nopWriteCloser struct{ io.Writer }
+
+func (nopWriteCloser) Close() error { return nil }
+
+func (m memFiles) create(name string) (io.WriteCloser, error) {
+	if _, ok := m[name]; ok {
+		return nil, fmt.Errorf("%s created twice", name)
+	}
+	m[name] = &bytes.Buffer{}
+	return nopWriteCloser{m[name]}, nil
+}
+
+// openFiles counts the files of a memFiles that are open
+type openFiles struct {
+	files memFiles
+	open  int
+	max   int // Most files open at once
+}
+
+type countedFile struct {
+	io.Writer
+	o *openFiles
+}
+
+func (f countedFile) Close() error {
+	f.o.open--
+	return nil
+}
+
+func (o *openFiles) create(name string) (io.WriteCloser, error) {
+	w, err := o.files.create(name)
+	if err != nil {
+		return nil, err
+	}
+	o.open++
+	o.max = max(o.max, o.open)
+	return countedFile{w, o}, nil
+}
+
+func TestSplit_KeyHash(t *testing.T) {
+	var input []testEntry
+	for i := 0; i < 100; i++ {
+		input = append(input, testEntry{"users", fmt.Sprintf("user-%d", i%10), fmt.Sprint(i), int64(i)})
+	}
+	files := memFiles{}
+	manifest, err := Split(context.Background(), SplitConfig{Input: encodeEntries(t, input), By: SplitByKeyHash, Buckets: 4, Create: files.create})
+	if err != nil {
+		t.Fatalf("Split failed: %v", err)
+	}
+	if manifest.Entries != 100 || manifest.By != "key-hash:4" {
+		t.Errorf("unexpected manifest %+v", manifest)
+	}
+
+	bucketOf := make(map[string]string)
+	var total int64
+	for _, f := range manifest.Files {
+		entries := decodeEntries(t, files[f.Name].Bytes())
+		if int64(len(entries)) != f.Entries || int64(files[f.Name].Len()) != f.Bytes {
+			t.Errorf("%s: manifest says %d entries and %d bytes", f.Name, f.Entries, f.Bytes)
+		}
+		total += f.Entries
+		for i, e := range entries {
+			if b, ok := bucketOf[e.key]; ok && b != f.Name {
+				t.Errorf("key %s in %s and %s", e.key, b, f.Name)
+			}
+			bucketOf[e.key] = f.Name
+			if i > 0 && e.ts <= entries[i-1].ts {
+				t.Errorf("%s: entries out of order", f.Name)
+			}
+		}
+	}
+	if total != 100 {
+		t.Errorf("files hold %d entries, want 100", total)
+	}
+}
+
+func TestSplit_PartitionAndSize(t *testing.T) {
+	input := []testEntry{{"a", "k", "1", 1}, {"b", "k", "2", 2}, {"a", "k", "3", 3}}
+	files := memFiles{}
+	manifest, err := Split(context.Background(), SplitConfig{Input: encodeEntries(t, input), By: SplitByPartition, Create: files.create})
+	if err != nil {
+		t.Fatalf("Split failed: %v", err)
+	}
+	if len(manifest.Files) != 2 || manifest.Files[0].Name != "a-0.log" || manifest.Files[0].Entries != 2 || *manifest.Files[1].Partition != 0 {
+		t.Errorf("unexpected files %+v", manifest.Files)
+	}
+
+	// A 20 byte header and 43 bytes per entry (40 fixed, topic, key, value): two fit in 120 bytes
+	files = memFiles{}
+	manifest, err = Split(context.Background(), SplitConfig{Input: encodeEntries(t, input), By: SplitBySize, MaxBytes: 120, Create: files.create})
+	if err != nil {
+		t.Fatalf("Split failed: %v", err)
+	}
+	if len(manifest.Files) != 2 || manifest.Files[0].Entries != 2 || manifest.Files[1].Name != "part-00001.log" {
+		t.Errorf("unexpected files %+v", manifest.Files)
+	}
+	for _, f := range manifest.Files {
+		if f.Bytes > 120 {
+			t.Errorf("%s is %d bytes, above the limit", f.Name, f.Bytes)
+		}
+	}
+}
+
+func TestSplit_PartitionOpenFiles(t *testing.T) {
+	// More partitions than stay open, then the first again, whose file was
+	// closed, and the last, whose file is still open
+	count := splitOpenPartitions + 44
+	var input []testEntry
+	for i := range count {
+		input = append(input, testEntry{fmt.Sprintf("t%03d", i), "k", "v", int64(i)})
+	}
+	input = append(input, testEntry{"t000", "k", "v", int64(count)}, testEntry{fmt.Sprintf("t%03d", count-1), "k", "v", int64(count + 1)})
+	o := &openFiles{files: memFiles{}}
+	manifest, err := Split(context.Background(), SplitConfig{Input: encodeEntries(t, input), By: SplitByPartition, Create: o.create})
+	if err != nil {
+		t.Fatalf("Split failed: %v", err)
+	}
+	if len(manifest.Files) != count+1 || manifest.Entries != int64(count+2) {
+		t.Fatalf("%d files with %d entries, want %d with %d", len(manifest.Files), manifest.Entries, count+1, count+2)
+	}
+	first, last := manifest.Files[:2], manifest.Files[len(manifest.Files)-1]
+	if first[0].Name != "t000-0.log" || first[1].Name != "t000-0.1.log" || first[1].Entries != 1 || first[1].Topic != "t000" || first[1].Bytes != int64(o.files["t000-0.1.log"].Len()) {
+		t.Errorf("unexpected files %+v", first)
+	}
+	if last.Name != fmt.Sprintf("t%03d-0.log", count-1) || last.Entries != 2 {
+		t.Errorf("unexpected last file %+v", last)
+	}
+	if o.open != 0 || o.max > splitOpenPartitions {
+		t.Errorf("%d files left open, at most %d open at once; want 0 and %d", o.open, o.max, splitOpenPartitions)
+	}
+}
+
+func TestSplit_Hour(t *testing.T) {
+	hour := int64(time.Hour / time.Millisecond)
+	base := time.Date(2024, 1, 15, 10, 0, 0, 0, time.UTC).UnixMilli()
+	var input []testEntry
+	// Hours 10 to 13 in order, with an entry of hour 10 slightly late and one
+	// far out of order
+	for i, h := range []int64{0, 0, 1, 0, 1, 2, 3, 0, 3} {
+		input = append(input, testEntry{"t", "k", fmt.Sprint(i), base + h*hour + int64(i)})
+	}
+	o := &openFiles{files: memFiles{}}
+	manifest, err := Split(context.Background(), SplitConfig{Input: encodeEntries(t, input), By: SplitByHour, Create: o.create})
+	if err != nil {
+		t.Fatalf("Split failed: %v", err)
+	}
+	var names []string
+	var entries []int64
+	for _, f := range manifest.Files {
+		names = append(names, f.Name)
+		entries = append(entries, f.Entries)
+	}
+	wantNames := []string{"2024-01-15T10.log", "2024-01-15T10-1.log", "2024-01-15T11.log", "2024-01-15T12.log", "2024-01-15T13.log"}
+	if !reflect.DeepEqual(names, wantNames) || !reflect.DeepEqual(entries, []int64{3, 1, 2, 1, 2}) {
+		t.Errorf("files %v with %v entries, want %v with [3 1 2 1 2]", names, entries, wantNames)
+	}
+	if o.open != 0 || o.max > splitOpenHours {
+		t.Errorf("%d files left open, at most %d open at once; want 0 and %d", o.open, o.max, splitOpenHours)
+	}
+}
+
+func TestSplit_Limits(t *testing.T) {
+	var input []testEntry
+	for i := range 10 {
+		input = append(input, testEntry{"t", "k", "value", int64(i)})
+	}
+	o := &openFiles{files: memFiles{}}
+	manifest, err := Split(context.Background(), SplitConfig{Input: encodeEntries(t, input), By: SplitBySize, MaxBytes: 120, Create: o.create})
+	if err != nil {
+		t.Fatalf("Split failed: %v", err)
+	}
+	if len(manifest.Files) != 5 || o.open != 0 || o.max != 1 {
+		t.Errorf("%d files with %d left open and at most %d open at once, want 5, 0 and 1", len(manifest.Files), o.open, o.max)
+	}
+
+	_, err = Split(context.Background(), SplitConfig{Input: encodeEntries(t, input), By: SplitByKeyHash, Buckets: MaxSplitBuckets + 1, Create: memFiles{}.create})
+	if err == nil {
+		t.Errorf("expected an error for %d buckets", MaxSplitBuckets+1)
+	}
+}
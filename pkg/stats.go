@@ -0,0 +1,358 @@
+package pkg
+
+import (
+	"container/heap"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"time"
+
+	"github.com/lolocompany/kafka-replay/v2/pkg/sketch"
+	"github.com/lolocompany/kafka-replay/v2/pkg/transcoder"
+)
+
+const (
+	// DefaultStatsTop is the default number of hot keys and largest messages reported
+	DefaultStatsTop = 10
+	// DefaultStatsBuckets is the number of throughput buckets aimed for when
+	// the interval is chosen automatically
+	DefaultStatsBuckets = 60
+	// statsMaxBuckets bounds the throughput series, and the number of
+	// per-second counters kept before falling back to per-minute resolution
+	statsMaxBuckets = 100_000
+)
+
+// statsIntervals are the candidate throughput intervals, smallest first
+var statsIntervals = []time.Duration{
+	time.Second, 10 * time.Second, time.Minute, 10 * time.Minute,
+	time.Hour, 6 * time.Hour, 24 * time.Hour, 7 * 24 * time.Hour,
+}
+
+// StatsConfig holds configuration for the Stats function
+type StatsConfig struct {
+	Input    io.ReadSeeker
+	Top      int           // Hot keys and largest messages reported (default DefaultStatsTop)
+	Interval time.Duration // Throughput bucket width; 0 chooses one for about DefaultStatsBuckets buckets
+}
+
+// SizeStats summarizes a size distribution in bytes. Percentiles are upper
+// bounds within about 6%; min, max and mean are exact.
+type SizeStats struct {
+	Min  int64   `json:"min"`
+	P50  int64   `json:"p50"`
+	P90  int64   `json:"p90"`
+	P99  int64   `json:"p99"`
+	P999 int64   `json:"p999"`
+	Max  int64   `json:"max"`
+	Mean float64 `json:"mean"`
+}
+
+// ThroughputBucket counts the messages of one interval
+type ThroughputBucket struct {
+	Start    time.Time `json:"start"`
+	Messages int64     `json:"messages"`
+	Bytes    int64     `json:"bytes"` // Key and value bytes
+	Rate     float64   `json:"rate"`  // Messages per second
+}
+
+// HotKey is one of the most frequent keys. Count is an upper bound that
+// overcounts by at most Error.
+type HotKey struct {
+	Key   string `json:"key"`
+	Count int64  `json:"count"`
+	Error int64  `json:"error,omitempty"`
+}
+
+// LargeMessage is one of the largest messages and where to find it
+type LargeMessage struct {
+	Position   int64     `json:"position"`   // Entry index, as used by slice and cat --skip
+	ByteOffset int64     `json:"byteOffset"` // Offset of the entry in the file
+	Size       int64     `json:"size"`       // Key and value bytes
+	Key        string    `json:"key,omitempty"`
+	Timestamp  time.Time `json:"timestamp"`
+	Topic      string    `json:"topic,omitempty"`
+	Partition  *int      `json:"partition,omitempty"`
+	Offset     *int64    `json:"offset,omitempty"`
+}
+
+// StatsResult describes the contents of a recording
+type StatsResult struct {
+	Entries         int64              `json:"entries"`
+	Bytes           int64              `json:"bytes"`   // File size
+	Keyless         int64              `json:"keyless"` // Entries without a key
+	FirstTimestamp  time.Time          `json:"firstTimestamp"`
+	LastTimestamp   time.Time          `json:"lastTimestamp"`
+	DurationSeconds float64            `json:"durationSeconds"`
+	AverageRate     float64            `json:"averageRate"`        // Messages per second over the whole recording
+	PeakRate        int64              `json:"peakRate,omitempty"` // Most messages in a single second, if known
+	DistinctKeys    uint64             `json:"distinctKeys"`       // Estimated, within about 1%
+	KeySize         SizeStats          `json:"keySize"`            // Entries with a key only
+	ValueSize       SizeStats          `json:"valueSize"`
+	Interval        string             `json:"interval"`
+	Throughput      []ThroughputBucket `json:"throughput"`
+	TopKeys         []HotKey           `json:"topKeys"`
+	Largest         []LargeMessage     `json:"largest"`
+}
+
+// Stats reads a recording once and summarizes it. Memory stays bounded: keys
+// are counted with a HyperLogLog and a space-saving counter, sizes with
+// logarithmic histograms, and throughput per second (per minute for
+// recordings spanning more than about a day of distinct seconds).
+func Stats(ctx context.Context, cfg StatsConfig) (StatsResult, error) {
+	var result StatsResult
+	if cfg.Input == nil {
+		return result, errors.New("input is required")
+	}
+	if cfg.Top <= 0 {
+		cfg.Top = DefaultStatsTop
+	}
+	if cfg.Interval < 0 {
+		return result, errors.New("interval cannot be negative")
+	}
+
+	decoder, err := transcoder.NewDecodeReader(cfg.Input, true)
+	if err != nil {
+		return result, err
+	}
+	reader := newEntryReader(decoder)
+
+	var keySizes, valueSizes sketch.Histogram
+	distinct := sketch.NewHyperLogLog()
+	hot := sketch.NewTopK(max(10*cfg.Top, 100))
+	var largest largestHeap
+	counts := &statsCounts{resolution: time.Second, buckets: make(map[int64]*ThroughputBucket)}
+
+	for {
+		if result.Entries%1024 == 0 && ctx.Err() != nil {
+			return result, ctx.Err()
+		}
+		offset, err := cfg.Input.Seek(0, io.SeekCurrent)
+		if err != nil {
+			return result, err
+		}
+		e, err := reader.next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return result, err
+		}
+
+		size := int64(len(e.Key) + len(e.Value))
+		if result.Entries == 0 || e.Time.Before(result.FirstTimestamp) {
+			result.FirstTimestamp = e.Time
+		}
+		if e.Time.After(result.LastTimestamp) {
+			result.LastTimestamp = e.Time
+		}
+		if e.Key == nil {
+			result.Keyless++
+		} else {
+			keySizes.Add(int64(len(e.Key)))
+			distinct.Add(e.Key)
+			hot.Add(e.Key)
+		}
+		valueSizes.Add(int64(len(e.Value)))
+		counts.add(e.Time, size)
+
+		if largest.Len() < cfg.Top || size > largest[0].Size {
+			m := LargeMessage{
+				Position:   result.Entries,
+				ByteOffset: offset,
+				Size:       size,
+				Key:        string(e.Key),
+				Timestamp:  e.Time,
+				Topic:      e.Metadata.Topic,
+			}
+			if e.Metadata.HasPartition() {
+				p, o := e.Metadata.Partition, e.Metadata.Offset
+				m.Partition, m.Offset = &p, &o
+			}
+			if largest.Len() < cfg.Top {
+				heap.Push(&largest, m)
+			} else {
+				largest[0] = m
+				heap.Fix(&largest, 0)
+			}
+		}
+
+		result.Entries++
+	}
+	if result.Bytes, err = cfg.Input.Seek(0, io.SeekEnd); err != nil {
+		return result, err
+	}
+
+	result.KeySize = sizeStats(&keySizes)
+	result.ValueSize = sizeStats(&valueSizes)
+	result.DistinctKeys = distinct.Count()
+	for _, c := range hot.Top(cfg.Top) {
+		result.TopKeys = append(result.TopKeys, HotKey{Key: c.Value, Count: c.Count, Error: c.Error})
+	}
+	if result.TopKeys == nil {
+		result.TopKeys = []HotKey{}
+	}
+	result.Largest = make([]LargeMessage, len(largest))
+	copy(result.Largest, largest)
+	sort.Slice(result.Largest, func(i, j int) bool {
+		if result.Largest[i].Size != result.Largest[j].Size {
+			return result.Largest[i].Size > result.Largest[j].Size
+		}
+		return result.Largest[i].Position < result.Largest[j].Position
+	})
+
+	duration := result.LastTimestamp.Sub(result.FirstTimestamp)
+	result.DurationSeconds = duration.Seconds()
+	if result.DurationSeconds > 0 {
+		result.AverageRate = float64(result.Entries) / result.DurationSeconds
+	}
+	if counts.resolution == time.Second {
+		for _, b := range counts.buckets {
+			result.PeakRate = max(result.PeakRate, b.Messages)
+		}
+	}
+
+	interval := cfg.Interval
+	if interval == 0 {
+		interval = autoInterval(duration, counts.resolution)
+	}
+	if interval < counts.resolution {
+		interval = counts.resolution
+	}
+	interval = interval.Truncate(counts.resolution)
+	result.Interval = interval.String()
+	if result.Throughput, err = counts.series(interval); err != nil {
+		return result, err
+	}
+	return result, nil
+}
+
+// statsCounts counts messages per second, or per minute once there are too
+// many distinct seconds
+type statsCounts struct {
+	resolution time.Duration
+	buckets    map[int64]*ThroughputBucket // By Unix time divided by resolution
+}
+
+func (c *statsCounts) add(t time.Time, size int64) {
+	slot := t.Unix() / int64(c.resolution/time.Second)
+	b, ok := c.buckets[slot]
+	if !ok {
+		if len(c.buckets) >= statsMaxBuckets && c.resolution == time.Second {
+			c.rollUp()
+			c.add(t, size)
+			return
+		}
+		b = &ThroughputBucket{}
+		c.buckets[slot] = b
+	}
+	b.Messages++
+	b.Bytes += size
+}
+
+// rollUp switches from per-second to per-minute counters
+func (c *statsCounts) rollUp() {
+	minutes := make(map[int64]*ThroughputBucket, len(c.buckets)/60+1)
+	for slot, b := range c.buckets {
+		m, ok := minutes[floorDiv(slot, 60)]
+		if !ok {
+			m = &ThroughputBucket{}
+			minutes[floorDiv(slot, 60)] = m
+		}
+		m.Messages += b.Messages
+		m.Bytes += b.Bytes
+	}
+	c.resolution = time.Minute
+	c.buckets = minutes
+}
+
+// series aggregates the counters into contiguous buckets of the given width,
+// aligned to the Unix epoch and including empty ones
+func (c *statsCounts) series(interval time.Duration) ([]ThroughputBucket, error) {
+	out := []ThroughputBucket{}
+	if len(c.buckets) == 0 {
+		return out, nil
+	}
+	per := int64(interval / c.resolution)
+	first, last := int64(0), int64(0)
+	started := false
+	for slot := range c.buckets {
+		s := floorDiv(slot, per)
+		if !started || s < first {
+			first = s
+		}
+		if !started || s > last {
+			last = s
+		}
+		started = true
+	}
+	if n := last - first + 1; n > statsMaxBuckets {
+		return nil, fmt.Errorf("interval %s gives %d throughput buckets, use a larger interval", interval, n)
+	}
+	out = make([]ThroughputBucket, last-first+1)
+	width := int64(interval / time.Second)
+	for i := range out {
+		out[i].Start = time.Unix((first+int64(i))*width, 0).UTC()
+	}
+	for slot, b := range c.buckets {
+		o := &out[floorDiv(slot, per)-first]
+		o.Messages += b.Messages
+		o.Bytes += b.Bytes
+	}
+	for i := range out {
+		out[i].Rate = float64(out[i].Messages) / interval.Seconds()
+	}
+	return out, nil
+}
+
+// autoInterval picks the smallest candidate interval that splits duration
+// into at most DefaultStatsBuckets buckets
+func autoInterval(duration, resolution time.Duration) time.Duration {
+	for _, interval := range statsIntervals {
+		if interval >= resolution && duration/interval < DefaultStatsBuckets {
+			return interval
+		}
+	}
+	week := statsIntervals[len(statsIntervals)-1]
+	return (duration/DefaultStatsBuckets/week + 1) * week
+}
+
+func sizeStats(h *sketch.Histogram) SizeStats {
+	return SizeStats{
+		Min:  h.Min(),
+		P50:  h.Percentile(50),
+		P90:  h.Percentile(90),
+		P99:  h.Percentile(99),
+		P999: h.Percentile(99.9),
+		Max:  h.Max(),
+		Mean: h.Mean(),
+	}
+}
+
+func floorDiv(a, b int64) int64 {
+	q := a / b
+	if a%b != 0 && (a < 0) != (b < 0) {
+		q--
+	}
+	return q
+}
+
+// largestHeap is a min-heap of the largest messages seen so far
+type largestHeap []LargeMessage
+
+func (h largestHeap) Len() int { return len(h) }
+func (h largestHeap) Less(i, j int) bool {
+	if h[i].Size != h[j].Size {
+		return h[i].Size < h[j].Size
+	}
+	return h[i].Position > h[j].Position // Keep the earlier of equal sizes
+}
+func (h largestHeap) Swap(i, j int) { h[i], h[j] = h[j], h[i] }
+func (h *largestHeap) Push(x any)   { *h = append(*h, x.(LargeMessage)) }
+func (h *largestHeap) Pop() any {
+	old := *h
+	x := old[len(old)-1]
+	*h = old[:len(old)-1]
+	return x
+}
@@ -0,0 +1,79 @@
+package pkg
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestStats(t *testing.T) {
+	input := []testEntry{
+		{"users", "a", "1", 0},
+		{"users", "b", "22", 500},
+		{"users", "a", "333", 1_000},
+		{"users", "", strings.Repeat("x", 100), 1_200}, // Largest, keyless
+		{"users", "a", "4444", 59_000},
+		{"orders", "c", strings.Repeat("y", 50), 61_000},
+	}
+	res, err := Stats(context.Background(), StatsConfig{Input: encodeEntries(t, input), Top: 2})
+	if err != nil {
+		t.Fatalf("Stats failed: %v", err)
+	}
+
+	if res.Entries != 6 || res.Keyless != 1 || res.DistinctKeys != 3 {
+		t.Errorf("entries %d keyless %d distinct %d", res.Entries, res.Keyless, res.DistinctKeys)
+	}
+	if res.FirstTimestamp.UnixMilli() != 0 || res.LastTimestamp.UnixMilli() != 61_000 || res.DurationSeconds != 61 {
+		t.Errorf("time range %v - %v (%vs)", res.FirstTimestamp, res.LastTimestamp, res.DurationSeconds)
+	}
+	if res.PeakRate != 2 {
+		t.Errorf("peak rate %d, want 2", res.PeakRate)
+	}
+	if res.ValueSize.Min != 1 || res.ValueSize.Max != 100 || res.KeySize.Max != 1 {
+		t.Errorf("value sizes %+v, key sizes %+v", res.ValueSize, res.KeySize)
+	}
+
+	if len(res.TopKeys) != 2 || res.TopKeys[0].Key != "a" || res.TopKeys[0].Count != 3 {
+		t.Errorf("top keys %+v", res.TopKeys)
+	}
+	if len(res.Largest) != 2 || res.Largest[0].Position != 3 || res.Largest[0].Size != 100 ||
+		res.Largest[1].Position != 5 || res.Largest[1].Key != "c" || *res.Largest[1].Offset != 5 {
+		t.Errorf("largest %+v", res.Largest)
+	}
+
+	// 61 seconds fit in 10 second buckets
+	if res.Interval != "10s" || len(res.Throughput) != 7 {
+		t.Fatalf("interval %s with %d buckets", res.Interval, len(res.Throughput))
+	}
+	if b := res.Throughput[0]; b.Messages != 4 || b.Rate != 0.4 || !b.Start.Equal(time.Unix(0, 0)) {
+		t.Errorf("first bucket %+v", b)
+	}
+	if res.Throughput[3].Messages != 0 || res.Throughput[5].Messages != 1 || res.Throughput[6].Messages != 1 {
+		t.Errorf("throughput %+v", res.Throughput)
+	}
+}
+
+func TestStats_Interval(t *testing.T) {
+	input := []testEntry{{"t", "a", "v", 0}, {"t", "a", "v", 3_600_000}}
+	res, err := Stats(context.Background(), StatsConfig{Input: encodeEntries(t, input), Interval: time.Hour})
+	if err != nil {
+		t.Fatalf("Stats failed: %v", err)
+	}
+	if res.Interval != "1h0m0s" || len(res.Throughput) != 2 {
+		t.Errorf("interval %s with %d buckets", res.Interval, len(res.Throughput))
+	}
+	if _, err := Stats(context.Background(), StatsConfig{Input: encodeEntries(t, []testEntry{{"t", "a", "v", 0}, {"t", "a", "v", 1e12}}), Interval: time.Second}); err == nil {
+		t.Errorf("expected an error for too many buckets")
+	}
+}
+
+func TestStats_Empty(t *testing.T) {
+	res, err := Stats(context.Background(), StatsConfig{Input: encodeEntries(t, nil)})
+	if err != nil {
+		t.Fatalf("Stats failed: %v", err)
+	}
+	if res.Entries != 0 || len(res.Throughput) != 0 || len(res.TopKeys) != 0 || len(res.Largest) != 0 {
+		t.Errorf("unexpected result %+v", res)
+	}
+}
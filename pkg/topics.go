@@ -0,0 +1,125 @@
+package pkg
+
+import (
+	"context"
+	"fmt"
+	"path"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/lolocompany/kafka-replay/v2/pkg/kafka"
+)
+
+// TopicSelector selects topics by exact name, glob pattern or regular expression
+type TopicSelector struct {
+	names []string
+	globs []string
+	regex *regexp.Regexp
+}
+
+// NewTopicSelector creates a TopicSelector. Each entry of topics is either an
+// exact topic name or a glob pattern (*, ? and [...], e.g. orders.*). The
+// optional regex must match the whole topic name.
+func NewTopicSelector(topics []string, regex string) (TopicSelector, error) {
+	var s TopicSelector
+	for _, t := range topics {
+		t = strings.TrimSpace(t)
+		if t == "" {
+			continue
+		}
+		if !strings.ContainsAny(t, "*?[") {
+			s.names = append(s.names, t)
+			continue
+		}
+		if _, err := path.Match(t, ""); err != nil {
+			return TopicSelector{}, fmt.Errorf("invalid topic pattern %q: %w", t, err)
+		}
+		s.globs = append(s.globs, t)
+	}
+	if regex != "" {
+		re, err := regexp.Compile("^(?:" + regex + ")$")
+		if err != nil {
+			return TopicSelector{}, fmt.Errorf("invalid topic regex %q: %w", regex, err)
+		}
+		s.regex = re
+	}
+	if len(s.names) == 0 && len(s.globs) == 0 && s.regex == nil {
+		return TopicSelector{}, fmt.Errorf("no topics given")
+	}
+	return s, nil
+}
+
+// IsPattern reports whether the selector contains a glob or regex, i.e. whether
+// it can match topics that are not listed by name.
+func (s TopicSelector) IsPattern() bool {
+	return len(s.globs) > 0 || s.regex != nil
+}
+
+// Names returns the exact topic names of the selector
+func (s TopicSelector) Names() []string {
+	return s.names
+}
+
+// Match reports whether the topic is selected. Patterns never match internal
+// topics (names starting with "__"); those can only be selected by name.
+func (s TopicSelector) Match(topic string) bool {
+	for _, name := range s.names {
+		if name == topic {
+			return true
+		}
+	}
+	if strings.HasPrefix(topic, "__") {
+		return false
+	}
+	for _, glob := range s.globs {
+		if ok, _ := path.Match(glob, topic); ok {
+			return true
+		}
+	}
+	return s.regex != nil && s.regex.MatchString(topic)
+}
+
+// TopicPartitions maps topic names to their sorted partition IDs
+type TopicPartitions map[string][]int
+
+// Topics returns the topic names in sorted order
+func (tp TopicPartitions) Topics() []string {
+	topics := make([]string, 0, len(tp))
+	for t := range tp {
+		topics = append(topics, t)
+	}
+	sort.Strings(topics)
+	return topics
+}
+
+// DiscoverTopics resolves a selector against the cluster metadata. Topics
+// selected by exact name must exist; patterns may match nothing.
+func DiscoverTopics(ctx context.Context, brokers []string, selector TopicSelector) (TopicPartitions, error) {
+	conn, err := kafka.ConnectToAnyBroker(ctx, brokers)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+
+	partitions, err := kafka.ReadAllPartitions(conn)
+	if err != nil {
+		return nil, err
+	}
+
+	result := make(TopicPartitions)
+	for _, p := range partitions {
+		if selector.Match(p.Topic) {
+			result[p.Topic] = append(result[p.Topic], p.ID)
+		}
+	}
+	for _, ids := range result {
+		sort.Ints(ids)
+	}
+	for _, name := range selector.names {
+		if _, ok := result[name]; !ok {
+			return nil, fmt.Errorf("topic %s not found", name)
+		}
+	}
+	return result, nil
+}
@@ -0,0 +1,52 @@
+package pkg
+
+import "testing"
+
+func TestTopicSelector_Match(t *testing.T) {
+	s, err := NewTopicSelector([]string{"payments", "orders.*"}, `audit-[0-9]+`)
+	if err != nil {
+		t.Fatalf("NewTopicSelector failed: %v", err)
+	}
+	if !s.IsPattern() {
+		t.Errorf("selector with glob and regex should be a pattern")
+	}
+
+	cases := map[string]bool{
+		"payments":           true,
+		"payments.v2":        false,
+		"orders.created":     true,
+		"orders":             false,
+		"audit-42":           true,
+		"audit-42-dlq":       false,
+		"__consumer_offsets": false,
+	}
+	for topic, want := range cases {
+		if got := s.Match(topic); got != want {
+			t.Errorf("Match(%q) = %v, want %v", topic, got, want)
+		}
+	}
+
+	internal, _ := NewTopicSelector([]string{"__consumer_offsets", "*"}, "")
+	if !internal.Match("__consumer_offsets") {
+		t.Errorf("internal topics must be selectable by name")
+	}
+	if internal.Match("__transaction_state") {
+		t.Errorf("patterns must not match internal topics")
+	}
+}
+
+func TestNewTopicSelector_Validation(t *testing.T) {
+	if _, err := NewTopicSelector(nil, ""); err == nil {
+		t.Errorf("expected error for empty selector")
+	}
+	if _, err := NewTopicSelector([]string{"orders.["}, ""); err == nil {
+		t.Errorf("expected error for invalid glob")
+	}
+	if _, err := NewTopicSelector(nil, "orders.("); err == nil {
+		t.Errorf("expected error for invalid regex")
+	}
+	s, err := NewTopicSelector([]string{"a", " b "}, "")
+	if err != nil || s.IsPattern() || len(s.Names()) != 2 {
+		t.Errorf("expected two exact names, got %+v (%v)", s, err)
+	}
+}
@@ -2,7 +2,9 @@ package transcoder
 
 const (
 	// ProtocolVersion is the current version of the binary protocol
-	ProtocolVersion = 2
+	ProtocolVersion = 3
+	// ProtocolVersion2 is the legacy version 2 (with message keys, without per-entry metadata)
+	ProtocolVersion2 = 2
 	// ProtocolVersion1 is the legacy version 1 (without message keys)
 	ProtocolVersion1 = 1
 	// HeaderVersionSize is the size of the version field in the header (int32 = 4 bytes)
@@ -17,4 +19,16 @@ const (
 	SizeFieldSize = 8
 	// KeySizeFieldSize is the size of the key size field (int64 = 8 bytes)
 	KeySizeFieldSize = 8
+	// PartitionFieldSize is the size of the source partition field (int32 = 4 bytes, version 3)
+	PartitionFieldSize = 4
+	// OffsetFieldSize is the size of the source offset field (int64 = 8 bytes, version 3)
+	OffsetFieldSize = 8
+	// TopicSizeFieldSize is the size of the source topic size field (int32 = 4 bytes, version 3)
+	TopicSizeFieldSize = 4
+	// EntryFixedSize is the size of all fixed-size fields of a version 3 message entry
+	EntryFixedSize = TimestampSize + PartitionFieldSize + OffsetFieldSize + TopicSizeFieldSize + KeySizeFieldSize + SizeFieldSize // 40 bytes
+	// MaxTopicSize is the maximum accepted topic name size (Kafka itself allows 249 bytes)
+	MaxTopicSize = 64 * 1024
+	// MaxPayloadSize is the maximum accepted key or message size (100MB)
+	MaxPayloadSize = 100 * 1024 * 1024
 )
@@ -26,27 +26,35 @@ func (e *BufferTooSmallError) Error() string {
 func (e *BufferTooSmallError) Unwrap() error { return ErrBufferTooSmall }
 
 // DecodeReader decodes messages from a binary file format
-// Supports both version 1 (legacy, no keys) and version 2 (with keys)
+// Supports version 1 (legacy, no keys), version 2 (with keys) and version 3 (with per-entry metadata)
 type DecodeReader struct {
 	reader             io.ReadSeeker
 	timestampBuf       []byte
 	keySizeBuf         []byte
 	sizeBuf            []byte
+	fixedBuf           []byte // Version 3 fixed-size fields following the timestamp
+	topicBuf           []byte
+	metadata           EntryMetadata // Metadata of the most recently read entry
+	recordedTime       time.Time     // Recorded timestamp of the most recently read entry
 	preserveTimestamps bool
 	dataStartOffset    int64 // Offset after the header where message data starts
 	protocolVersion    int32
+	size               int64 // Size of the input, determined by the first Skip (-1 until then)
 }
 
 // NewDecodeReader creates a new decoder for binary message files
 // It reads and validates the file header, then positions the reader at the start of message data
-// Supports both version 1 (legacy) and version 2 formats
+// Supports version 1 and 2 (legacy) and version 3 formats
 func NewDecodeReader(reader io.ReadSeeker, preserveTimestamps bool) (*DecodeReader, error) {
 	d := &DecodeReader{
 		reader:             reader,
 		timestampBuf:       make([]byte, TimestampSize),
 		keySizeBuf:         make([]byte, KeySizeFieldSize),
 		sizeBuf:            make([]byte, SizeFieldSize),
+		fixedBuf:           make([]byte, EntryFixedSize-TimestampSize),
+		metadata:           UnknownMetadata,
 		preserveTimestamps: preserveTimestamps,
+		size:               -1,
 	}
 
 	// Read and validate file header
@@ -82,6 +90,10 @@ func (d *DecodeReader) Read(key []byte, data []byte) (time.Time, int, int, error
 		return time.Time{}, 0, 0, fmt.Errorf("failed to read timestamp: %w", err)
 	}
 
+	if d.protocolVersion == ProtocolVersion {
+		return d.readV3(startOffset, key, data)
+	}
+
 	if d.protocolVersion == ProtocolVersion1 {
 		// Version 1 format: timestamp, message size, message data (no key)
 		if _, err := io.ReadFull(d.reader, d.sizeBuf); err != nil {
@@ -109,11 +121,9 @@ func (d *DecodeReader) Read(key []byte, data []byte) (time.Time, int, int, error
 			return time.Time{}, 0, 0, fmt.Errorf("failed to read message data: %w", err)
 		}
 
-		var msgTime time.Time
-		if d.preserveTimestamps {
-			unixTimestamp := int64(binary.BigEndian.Uint64(d.timestampBuf))
-			msgTime = time.Unix(unixTimestamp, 0).UTC()
-		} else {
+		d.recordedTime = time.Unix(int64(binary.BigEndian.Uint64(d.timestampBuf)), 0).UTC()
+		msgTime := d.recordedTime
+		if !d.preserveTimestamps {
 			msgTime = time.Now().UTC()
 		}
 
@@ -176,17 +186,172 @@ func (d *DecodeReader) Read(key []byte, data []byte) (time.Time, int, int, error
 		return time.Time{}, 0, 0, fmt.Errorf("failed to read message data: %w", err)
 	}
 
-	var msgTime time.Time
-	if d.preserveTimestamps {
-		unixTimestamp := int64(binary.BigEndian.Uint64(d.timestampBuf))
-		msgTime = time.Unix(unixTimestamp, 0).UTC()
-	} else {
+	d.recordedTime = time.Unix(int64(binary.BigEndian.Uint64(d.timestampBuf)), 0).UTC()
+	msgTime := d.recordedTime
+	if !d.preserveTimestamps {
+		msgTime = time.Now().UTC()
+	}
+
+	return msgTime, keyLen, dataLen, nil
+}
+
+// readV3 reads the remainder of a version 3 entry after its timestamp:
+// partition, offset, topic size, key size, message size, topic, key, message data
+func (d *DecodeReader) readV3(startOffset int64, key []byte, data []byte) (time.Time, int, int, error) {
+	if _, err := io.ReadFull(d.reader, d.fixedBuf); err != nil {
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			return time.Time{}, 0, 0, io.EOF
+		}
+		return time.Time{}, 0, 0, fmt.Errorf("failed to read entry header: %w", err)
+	}
+
+	partition := int32(binary.BigEndian.Uint32(d.fixedBuf[0:4]))
+	offset := int64(binary.BigEndian.Uint64(d.fixedBuf[4:12]))
+	topicSize := int64(int32(binary.BigEndian.Uint32(d.fixedBuf[12:16])))
+	keySize := int64(binary.BigEndian.Uint64(d.fixedBuf[16:24]))
+	messageSize := int64(binary.BigEndian.Uint64(d.fixedBuf[24:32]))
+
+	if topicSize < 0 || topicSize > MaxTopicSize {
+		return time.Time{}, 0, 0, fmt.Errorf("invalid topic size: %d bytes", topicSize)
+	}
+	if keySize < 0 || keySize > MaxPayloadSize {
+		return time.Time{}, 0, 0, fmt.Errorf("invalid key size: %d bytes", keySize)
+	}
+	if messageSize < 0 || messageSize > MaxPayloadSize {
+		return time.Time{}, 0, 0, fmt.Errorf("invalid message size: %d bytes", messageSize)
+	}
+
+	keyLen := int(keySize)
+	dataLen := int(messageSize)
+
+	// No-grow: require enough capacity; if not, rewind and report needed sizes.
+	if (keyLen > 0 && cap(key) < keyLen) || cap(data) < dataLen {
+		_, _ = d.reader.Seek(startOffset, io.SeekStart)
+		return time.Time{}, keyLen, dataLen, &BufferTooSmallError{KeyNeeded: keyLen, DataNeeded: dataLen}
+	}
+
+	// The topic is decoder-owned; reuse the previous string when it repeats
+	topicLen := int(topicSize)
+	if cap(d.topicBuf) < topicLen {
+		d.topicBuf = make([]byte, topicLen)
+	}
+	tb := d.topicBuf[:topicLen]
+	if _, err := io.ReadFull(d.reader, tb); err != nil {
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			return time.Time{}, 0, 0, io.EOF
+		}
+		return time.Time{}, 0, 0, fmt.Errorf("failed to read topic: %w", err)
+	}
+
+	if keyLen > 0 {
+		if _, err := io.ReadFull(d.reader, key[:keyLen:keyLen]); err != nil {
+			if err == io.EOF || err == io.ErrUnexpectedEOF {
+				return time.Time{}, 0, 0, io.EOF
+			}
+			return time.Time{}, 0, 0, fmt.Errorf("failed to read key data: %w", err)
+		}
+	}
+
+	if _, err := io.ReadFull(d.reader, data[:dataLen:dataLen]); err != nil {
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			return time.Time{}, 0, 0, io.EOF
+		}
+		return time.Time{}, 0, 0, fmt.Errorf("failed to read message data: %w", err)
+	}
+
+	topic := d.metadata.Topic
+	if string(tb) != topic {
+		topic = string(tb)
+	}
+	d.metadata = EntryMetadata{Topic: topic, Partition: int(partition), Offset: offset}
+
+	d.recordedTime = time.UnixMilli(int64(binary.BigEndian.Uint64(d.timestampBuf))).UTC()
+	msgTime := d.recordedTime
+	if !d.preserveTimestamps {
 		msgTime = time.Now().UTC()
 	}
 
 	return msgTime, keyLen, dataLen, nil
 }
 
+// Skip moves past the next message without reading its topic, key or data,
+// by seeking over them. It returns io.EOF at the end of the input, including
+// when the last message is truncated. Metadata is not updated.
+func (d *DecodeReader) Skip() error {
+	startOffset, err := d.reader.Seek(0, io.SeekCurrent)
+	if err != nil {
+		return err
+	}
+	if d.size < 0 {
+		if d.size, err = d.reader.Seek(0, io.SeekEnd); err != nil {
+			return err
+		}
+		if _, err := d.reader.Seek(startOffset, io.SeekStart); err != nil {
+			return err
+		}
+	}
+
+	var buf [EntryFixedSize]byte
+	header := buf[:]
+	switch d.protocolVersion {
+	case ProtocolVersion1:
+		header = buf[:TimestampSize+SizeFieldSize]
+	case ProtocolVersion2:
+		header = buf[:TimestampSize+KeySizeFieldSize+SizeFieldSize]
+	}
+	if _, err := io.ReadFull(d.reader, header); err != nil {
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			return io.EOF
+		}
+		return fmt.Errorf("failed to read entry header: %w", err)
+	}
+
+	// Sum the sizes of the variable-length fields following the header
+	var rest int64
+	switch d.protocolVersion {
+	case ProtocolVersion1:
+		rest = int64(binary.BigEndian.Uint64(header[8:16]))
+	case ProtocolVersion2:
+		rest = int64(binary.BigEndian.Uint64(header[8:16])) + int64(binary.BigEndian.Uint64(header[16:24]))
+	default:
+		topicSize := int64(int32(binary.BigEndian.Uint32(header[20:24])))
+		keySize := int64(binary.BigEndian.Uint64(header[24:32]))
+		messageSize := int64(binary.BigEndian.Uint64(header[32:40]))
+		if topicSize < 0 || topicSize > MaxTopicSize || keySize < 0 || keySize > MaxPayloadSize || messageSize < 0 || messageSize > MaxPayloadSize {
+			return fmt.Errorf("invalid entry sizes at offset %d", startOffset)
+		}
+		rest = topicSize + keySize + messageSize
+	}
+	if rest < 0 || rest > 2*MaxPayloadSize+MaxTopicSize {
+		return fmt.Errorf("invalid entry size at offset %d", startOffset)
+	}
+
+	end := startOffset + int64(len(header)) + rest
+	if end > d.size {
+		_, _ = d.reader.Seek(d.size, io.SeekStart)
+		return io.EOF
+	}
+	_, err = d.reader.Seek(end, io.SeekStart)
+	return err
+}
+
+// Metadata returns the source metadata of the most recently read message.
+// For version 1 and 2 files, this is always UnknownMetadata.
+func (d *DecodeReader) Metadata() EntryMetadata {
+	return d.metadata
+}
+
+// RecordedTime returns the timestamp stored in the file for the most recently
+// read message, even when timestamps are not preserved.
+func (d *DecodeReader) RecordedTime() time.Time {
+	return d.recordedTime
+}
+
+// ProtocolVersion returns the protocol version of the file being decoded.
+func (d *DecodeReader) ProtocolVersion() int32 {
+	return d.protocolVersion
+}
+
 // Close closes the underlying reader if it implements io.Closer
 func (d *DecodeReader) Close() error {
 	if closer, ok := d.reader.(io.Closer); ok {
@@ -195,6 +360,21 @@ func (d *DecodeReader) Close() error {
 	return nil
 }
 
+// Offset returns the byte offset of the next message in the input.
+func (d *DecodeReader) Offset() (int64, error) {
+	return d.reader.Seek(0, io.SeekCurrent)
+}
+
+// SeekTo positions the reader at the message starting at offset, as returned
+// by Offset.
+func (d *DecodeReader) SeekTo(offset int64) error {
+	if offset < d.dataStartOffset {
+		return fmt.Errorf("offset %d is inside the file header", offset)
+	}
+	_, err := d.reader.Seek(offset, io.SeekStart)
+	return err
+}
+
 // Reset seeks back to the start of message data (after the header)
 func (d *DecodeReader) Reset() error {
 	_, err := d.reader.Seek(d.dataStartOffset, io.SeekStart)
@@ -211,9 +391,9 @@ func (d *DecodeReader) readFileHeader() error {
 	// Read protocol version (int32, big-endian)
 	d.protocolVersion = int32(binary.BigEndian.Uint32(headerBuf[0:HeaderVersionSize]))
 
-	// Validate protocol version (support version 1 and 2)
-	if d.protocolVersion != ProtocolVersion1 && d.protocolVersion != ProtocolVersion {
-		return fmt.Errorf("unsupported protocol version: %d (supported versions: %d, %d)", d.protocolVersion, ProtocolVersion1, ProtocolVersion)
+	// Validate protocol version (support versions 1, 2 and 3)
+	if d.protocolVersion != ProtocolVersion1 && d.protocolVersion != ProtocolVersion2 && d.protocolVersion != ProtocolVersion {
+		return fmt.Errorf("unsupported protocol version: %d (supported versions: %d, %d, %d)", d.protocolVersion, ProtocolVersion1, ProtocolVersion2, ProtocolVersion)
 	}
 
 	// Reserved bytes are read but not used yet
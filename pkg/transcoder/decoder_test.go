@@ -78,7 +78,7 @@ func TestDecodeReader_Read(t *testing.T) {
 	// Create a file with header and one message
 	buf := &bytes.Buffer{}
 	header := make([]byte, HeaderSize)
-	binary.BigEndian.PutUint32(header[0:HeaderVersionSize], uint32(ProtocolVersion))
+	binary.BigEndian.PutUint32(header[0:HeaderVersionSize], uint32(ProtocolVersion2))
 	buf.Write(header)
 
 	testTime := time.Date(2024, 2, 2, 10, 15, 30, 0, time.UTC)
@@ -135,7 +135,7 @@ func TestDecodeReader_ReadPreserveTimestamps(t *testing.T) {
 	// Create a file with header and one message
 	buf := &bytes.Buffer{}
 	header := make([]byte, HeaderSize)
-	binary.BigEndian.PutUint32(header[0:HeaderVersionSize], uint32(ProtocolVersion))
+	binary.BigEndian.PutUint32(header[0:HeaderVersionSize], uint32(ProtocolVersion2))
 	buf.Write(header)
 
 	testTime := time.Date(2024, 2, 2, 10, 15, 30, 0, time.UTC)
@@ -186,7 +186,7 @@ func TestDecodeReader_ReadWithoutPreserveTimestamps(t *testing.T) {
 	// Create a file with header and one message
 	buf := &bytes.Buffer{}
 	header := make([]byte, HeaderSize)
-	binary.BigEndian.PutUint32(header[0:HeaderVersionSize], uint32(ProtocolVersion))
+	binary.BigEndian.PutUint32(header[0:HeaderVersionSize], uint32(ProtocolVersion2))
 	buf.Write(header)
 
 	testTime := time.Date(2024, 2, 2, 10, 15, 30, 0, time.UTC)
@@ -226,6 +226,11 @@ func TestDecodeReader_ReadWithoutPreserveTimestamps(t *testing.T) {
 		t.Errorf("Expected timestamp between %v and %v, got %v", beforeRead, afterRead, timestamp)
 	}
 
+	// The recorded timestamp remains available
+	if !decoder.RecordedTime().Equal(testTime) {
+		t.Errorf("Expected recorded time %v, got %v", testTime, decoder.RecordedTime())
+	}
+
 	if len(key) > 0 {
 		t.Errorf("Expected nil key, got %q", key)
 	}
@@ -239,7 +244,7 @@ func TestDecodeReader_MultipleReads(t *testing.T) {
 	// Create a file with header and multiple messages
 	buf := &bytes.Buffer{}
 	header := make([]byte, HeaderSize)
-	binary.BigEndian.PutUint32(header[0:HeaderVersionSize], uint32(ProtocolVersion))
+	binary.BigEndian.PutUint32(header[0:HeaderVersionSize], uint32(ProtocolVersion2))
 	buf.Write(header)
 
 	messages := []struct {
@@ -306,7 +311,7 @@ func TestDecodeReader_Reset(t *testing.T) {
 	// Create a file with header and multiple messages
 	buf := &bytes.Buffer{}
 	header := make([]byte, HeaderSize)
-	binary.BigEndian.PutUint32(header[0:HeaderVersionSize], uint32(ProtocolVersion))
+	binary.BigEndian.PutUint32(header[0:HeaderVersionSize], uint32(ProtocolVersion2))
 	buf.Write(header)
 
 	testTime := time.Date(2024, 2, 2, 10, 15, 30, 0, time.UTC)
@@ -366,11 +371,53 @@ func TestDecodeReader_Reset(t *testing.T) {
 	}
 }
 
+func TestDecodeReader_OffsetSeekTo(t *testing.T) {
+	buf := &bytes.Buffer{}
+	header := make([]byte, HeaderSize)
+	binary.BigEndian.PutUint32(header[0:HeaderVersionSize], uint32(ProtocolVersion2))
+	buf.Write(header)
+	for _, msg := range []string{"first", "second"} {
+		entry := make([]byte, TimestampSize+KeySizeFieldSize+SizeFieldSize)
+		binary.BigEndian.PutUint64(entry[TimestampSize+KeySizeFieldSize:], uint64(len(msg)))
+		buf.Write(entry)
+		buf.WriteString(msg)
+	}
+
+	decoder, err := NewDecodeReader(bytes.NewReader(buf.Bytes()), true)
+	if err != nil {
+		t.Fatalf("NewDecodeReader failed: %v", err)
+	}
+	if offset, err := decoder.Offset(); err != nil || offset != HeaderSize {
+		t.Fatalf("Offset before first message = %d, %v; want %d", offset, err, HeaderSize)
+	}
+	var key, data []byte
+	if _, _, _, err := readNoGrow(t, decoder, &key, &data); err != nil {
+		t.Fatalf("Read failed: %v", err)
+	}
+	second, err := decoder.Offset()
+	if err != nil {
+		t.Fatalf("Offset failed: %v", err)
+	}
+	if _, _, _, err := readNoGrow(t, decoder, &key, &data); err != nil {
+		t.Fatalf("Read failed: %v", err)
+	}
+
+	if err := decoder.SeekTo(second); err != nil {
+		t.Fatalf("SeekTo failed: %v", err)
+	}
+	if _, _, _, err := readNoGrow(t, decoder, &key, &data); err != nil || string(data) != "second" {
+		t.Errorf("Read after SeekTo = %q, %v; want %q", data, err, "second")
+	}
+	if err := decoder.SeekTo(0); err == nil {
+		t.Error("SeekTo into the header succeeded")
+	}
+}
+
 func TestDecodeReader_EmptyMessage(t *testing.T) {
 	// Create a file with header and empty message
 	buf := &bytes.Buffer{}
 	header := make([]byte, HeaderSize)
-	binary.BigEndian.PutUint32(header[0:HeaderVersionSize], uint32(ProtocolVersion))
+	binary.BigEndian.PutUint32(header[0:HeaderVersionSize], uint32(ProtocolVersion2))
 	buf.Write(header)
 
 	testTime := time.Date(2024, 2, 2, 10, 15, 30, 0, time.UTC)
@@ -417,7 +464,7 @@ func TestDecodeReader_InvalidSize(t *testing.T) {
 	// Create a file with invalid message size
 	buf := &bytes.Buffer{}
 	header := make([]byte, HeaderSize)
-	binary.BigEndian.PutUint32(header[0:HeaderVersionSize], uint32(ProtocolVersion))
+	binary.BigEndian.PutUint32(header[0:HeaderVersionSize], uint32(ProtocolVersion2))
 	buf.Write(header)
 
 	testTime := time.Date(2024, 2, 2, 10, 15, 30, 0, time.UTC)
@@ -507,7 +554,7 @@ func TestDecodeReader_Version2WithKey(t *testing.T) {
 	// Create a version 2 file with a key
 	buf := &bytes.Buffer{}
 	header := make([]byte, HeaderSize)
-	binary.BigEndian.PutUint32(header[0:HeaderVersionSize], uint32(ProtocolVersion))
+	binary.BigEndian.PutUint32(header[0:HeaderVersionSize], uint32(ProtocolVersion2))
 	buf.Write(header)
 
 	testTime := time.Date(2024, 2, 2, 10, 15, 30, 0, time.UTC)
@@ -555,3 +602,50 @@ func TestDecodeReader_Version2WithKey(t *testing.T) {
 		t.Errorf("Data mismatch: expected dataLen=%d %q, got dataLen=%d %q", len(testData), testData, dataLen, data)
 	}
 }
+
+func TestDecodeReader_Skip(t *testing.T) {
+	buf := &bytes.Buffer{}
+	encoder, err := NewEncodeWriter(buf)
+	if err != nil {
+		t.Fatalf("NewEncodeWriter failed: %v", err)
+	}
+	for i, data := range []string{"first", "second", "third"} {
+		meta := EntryMetadata{Topic: "orders", Partition: 1, Offset: int64(i)}
+		if _, err := encoder.WriteEntry(time.UnixMilli(int64(i)), []byte(data), []byte("key"), meta); err != nil {
+			t.Fatalf("WriteEntry failed: %v", err)
+		}
+	}
+
+	decoder, err := NewDecodeReader(bytes.NewReader(buf.Bytes()), true)
+	if err != nil {
+		t.Fatalf("NewDecodeReader failed: %v", err)
+	}
+	for i := 0; i < 2; i++ {
+		if err := decoder.Skip(); err != nil {
+			t.Fatalf("Skip %d failed: %v", i, err)
+		}
+	}
+	var key, data []byte
+	if _, _, _, err := readNoGrow(t, decoder, &key, &data); err != nil {
+		t.Fatalf("Read after Skip failed: %v", err)
+	}
+	if string(data) != "third" || decoder.Metadata().Offset != 2 {
+		t.Errorf("expected the third message, got %q at offset %d", data, decoder.Metadata().Offset)
+	}
+	if err := decoder.Skip(); err != io.EOF {
+		t.Errorf("expected EOF at the end, got %v", err)
+	}
+
+	// A truncated last entry is not skipped over
+	truncated, err := NewDecodeReader(bytes.NewReader(buf.Bytes()[:buf.Len()-2]), true)
+	if err != nil {
+		t.Fatalf("NewDecodeReader failed: %v", err)
+	}
+	skipped := 0
+	for truncated.Skip() == nil {
+		skipped++
+	}
+	if skipped != 2 {
+		t.Errorf("skipped %d entries of a truncated file, want 2", skipped)
+	}
+}
@@ -9,25 +9,21 @@ import (
 
 // EncodeWriter encodes messages to a binary file format
 type EncodeWriter struct {
-	writer       io.Writer
-	timestampBuf []byte
-	keySizeBuf   []byte
-	sizeBuf      []byte
-	totalBytes   int64
+	writer     io.Writer
+	fixedBuf   []byte
+	totalBytes int64
 }
 
 // NewEncodeWriter creates a new encoder for binary message files
 // It writes the file header and positions the writer ready for message data
-// New files are written in version 2 format (with message keys)
+// New files are written in version 3 format (with message keys and per-entry metadata)
 func NewEncodeWriter(writer io.Writer) (*EncodeWriter, error) {
 	e := &EncodeWriter{
-		writer:       writer,
-		timestampBuf: make([]byte, TimestampSize),
-		keySizeBuf:   make([]byte, KeySizeFieldSize),
-		sizeBuf:      make([]byte, SizeFieldSize),
+		writer:   writer,
+		fixedBuf: make([]byte, EntryFixedSize),
 	}
 
-	// Write file header with version 2
+	// Write file header with version 3
 	if err := e.writeFileHeader(); err != nil {
 		return nil, fmt.Errorf("failed to write file header: %w", err)
 	}
@@ -37,51 +33,61 @@ func NewEncodeWriter(writer io.Writer) (*EncodeWriter, error) {
 	return e, nil
 }
 
-// Write writes a message to the output in version 2 binary format:
-// timestamp (8 bytes) + key size (8 bytes) + message size (8 bytes) + key (variable) + message data (variable)
-// If key is nil or empty, key size is written as 0
+// Write writes a message without source metadata. See WriteEntry.
 func (e *EncodeWriter) Write(timestamp time.Time, messageData []byte, key []byte) (int64, error) {
+	return e.WriteEntry(timestamp, messageData, key, UnknownMetadata)
+}
+
+// WriteEntry writes a message to the output in version 3 binary format:
+// timestamp (8 bytes) + partition (4 bytes) + offset (8 bytes) + topic size (4 bytes) +
+// key size (8 bytes) + message size (8 bytes) + topic (variable) + key (variable) + message data (variable)
+// If key is nil or empty, key size is written as 0
+func (e *EncodeWriter) WriteEntry(timestamp time.Time, messageData []byte, key []byte, meta EntryMetadata) (int64, error) {
 	messageSize := int64(len(messageData))
 	keySize := int64(len(key))
-	if key == nil {
-		keySize = 0
+	topicSize := int64(len(meta.Topic))
+	if topicSize > MaxTopicSize {
+		return 0, fmt.Errorf("topic name too long: %d bytes", topicSize)
 	}
 
-	// Write timestamp (fixed size: 8 bytes Unix timestamp, big-endian)
-	unixTimestamp := timestamp.Unix()
-	binary.BigEndian.PutUint64(e.timestampBuf, uint64(unixTimestamp))
-	if _, err := e.writer.Write(e.timestampBuf); err != nil {
+	// All fixed-size fields are written with a single call (big-endian)
+	buf := e.fixedBuf
+	binary.BigEndian.PutUint64(buf[0:8], uint64(timestamp.UnixMilli()))
+	binary.BigEndian.PutUint32(buf[8:12], uint32(int32(meta.Partition)))
+	binary.BigEndian.PutUint64(buf[12:20], uint64(meta.Offset))
+	binary.BigEndian.PutUint32(buf[20:24], uint32(topicSize))
+	binary.BigEndian.PutUint64(buf[24:32], uint64(keySize))
+	binary.BigEndian.PutUint64(buf[32:40], uint64(messageSize))
+	if _, err := e.writer.Write(buf); err != nil {
 		return 0, err
 	}
+	written := int64(EntryFixedSize)
 
-	// Write key size (fixed size: 8 bytes, big-endian)
-	binary.BigEndian.PutUint64(e.keySizeBuf, uint64(keySize))
-	if _, err := e.writer.Write(e.keySizeBuf); err != nil {
-		return TimestampSize, err
-	}
-
-	// Write message size (fixed size: 8 bytes, big-endian)
-	binary.BigEndian.PutUint64(e.sizeBuf, uint64(messageSize))
-	if _, err := e.writer.Write(e.sizeBuf); err != nil {
-		return TimestampSize + KeySizeFieldSize, err
+	// Write topic (if known)
+	if topicSize > 0 {
+		if _, err := io.WriteString(e.writer, meta.Topic); err != nil {
+			return written, err
+		}
+		written += topicSize
 	}
 
 	// Write key data (if present)
 	if keySize > 0 {
 		if _, err := e.writer.Write(key); err != nil {
-			return TimestampSize + KeySizeFieldSize + SizeFieldSize, err
+			return written, err
 		}
+		written += keySize
 	}
 
 	// Write message data
 	if _, err := e.writer.Write(messageData); err != nil {
-		return TimestampSize + KeySizeFieldSize + SizeFieldSize + keySize, err
+		return written, err
 	}
+	written += messageSize
 
-	bytesWritten := TimestampSize + KeySizeFieldSize + SizeFieldSize + keySize + messageSize
-	e.totalBytes += bytesWritten
+	e.totalBytes += written
 
-	return bytesWritten, nil
+	return written, nil
 }
 
 // TotalBytes returns the total number of bytes written so far (including header)
@@ -89,6 +95,15 @@ func (e *EncodeWriter) TotalBytes() int64 {
 	return e.totalBytes
 }
 
+// Sync commits the written data to stable storage if the underlying writer
+// supports it (e.g. *os.File). It is a no-op otherwise.
+func (e *EncodeWriter) Sync() error {
+	if syncer, ok := e.writer.(interface{ Sync() error }); ok {
+		return syncer.Sync()
+	}
+	return nil
+}
+
 // Close closes the underlying writer if it implements io.Closer
 func (e *EncodeWriter) Close() error {
 	if closer, ok := e.writer.(io.Closer); ok {
@@ -98,11 +113,11 @@ func (e *EncodeWriter) Close() error {
 }
 
 // writeFileHeader writes the file header containing protocol version and reserved space
-// Always writes version 2 (current version)
+// Always writes version 3 (current version)
 func (e *EncodeWriter) writeFileHeader() error {
 	headerBuf := make([]byte, HeaderSize)
 
-	// Write protocol version 2 (int32, big-endian)
+	// Write protocol version 3 (int32, big-endian)
 	binary.BigEndian.PutUint32(headerBuf[0:HeaderVersionSize], uint32(ProtocolVersion))
 
 	// Reserved bytes are already zero-initialized
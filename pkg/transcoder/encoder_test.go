@@ -54,7 +54,7 @@ func TestEncodeWriter_Write(t *testing.T) {
 		t.Fatalf("Write failed: %v", err)
 	}
 
-	expectedBytes := int64(TimestampSize + KeySizeFieldSize + SizeFieldSize + len(testData))
+	expectedBytes := int64(EntryFixedSize + len(testData))
 	if bytesWritten != expectedBytes {
 		t.Errorf("Expected %d bytes written, got %d", expectedBytes, bytesWritten)
 	}
@@ -72,11 +72,22 @@ func TestEncodeWriter_Write(t *testing.T) {
 	// Check timestamp
 	timestampBytes := allData[offset : offset+TimestampSize]
 	unixTimestamp := int64(binary.BigEndian.Uint64(timestampBytes))
-	if unixTimestamp != testTime.Unix() {
-		t.Errorf("Timestamp mismatch: expected %d, got %d", testTime.Unix(), unixTimestamp)
+	if unixTimestamp != testTime.UnixMilli() {
+		t.Errorf("Timestamp mismatch: expected %d, got %d", testTime.UnixMilli(), unixTimestamp)
 	}
 	offset += TimestampSize
 
+	// Check metadata (unknown partition/offset, no topic)
+	partition := int32(binary.BigEndian.Uint32(allData[offset : offset+PartitionFieldSize]))
+	offset += PartitionFieldSize
+	sourceOffset := int64(binary.BigEndian.Uint64(allData[offset : offset+OffsetFieldSize]))
+	offset += OffsetFieldSize
+	topicSize := int32(binary.BigEndian.Uint32(allData[offset : offset+TopicSizeFieldSize]))
+	offset += TopicSizeFieldSize
+	if partition != -1 || sourceOffset != -1 || topicSize != 0 {
+		t.Errorf("Metadata mismatch: expected -1/-1/0, got %d/%d/%d", partition, sourceOffset, topicSize)
+	}
+
 	// Check key size (should be 0 for nil key)
 	keySizeBytes := allData[offset : offset+KeySizeFieldSize]
 	keySize := int64(binary.BigEndian.Uint64(keySizeBytes))
@@ -137,11 +148,14 @@ func TestEncodeWriter_MultipleWrites(t *testing.T) {
 		// Read timestamp
 		timestampBytes := allData[offset : offset+TimestampSize]
 		unixTimestamp := int64(binary.BigEndian.Uint64(timestampBytes))
-		if unixTimestamp != msg.timestamp.Unix() {
-			t.Errorf("Message %d timestamp mismatch: expected %d, got %d", i, msg.timestamp.Unix(), unixTimestamp)
+		if unixTimestamp != msg.timestamp.UnixMilli() {
+			t.Errorf("Message %d timestamp mismatch: expected %d, got %d", i, msg.timestamp.UnixMilli(), unixTimestamp)
 		}
 		offset += TimestampSize
 
+		// Skip metadata (partition, offset, topic size = 0)
+		offset += PartitionFieldSize + OffsetFieldSize + TopicSizeFieldSize
+
 		// Read key size (should be 0 for nil key)
 		keySizeBytes := allData[offset : offset+KeySizeFieldSize]
 		keySize := int64(binary.BigEndian.Uint64(keySizeBytes))
@@ -182,14 +196,14 @@ func TestEncodeWriter_EmptyMessage(t *testing.T) {
 		t.Fatalf("Write failed: %v", err)
 	}
 
-	expectedBytes := int64(TimestampSize + KeySizeFieldSize + SizeFieldSize)
+	expectedBytes := int64(EntryFixedSize)
 	if bytesWritten != expectedBytes {
 		t.Errorf("Expected %d bytes written, got %d", expectedBytes, bytesWritten)
 	}
 
 	// Verify size field is 0
 	allData := buf.Bytes()
-	offset := HeaderSize + TimestampSize + KeySizeFieldSize
+	offset := HeaderSize + EntryFixedSize - SizeFieldSize
 	sizeBytes := allData[offset : offset+SizeFieldSize]
 	size := int64(binary.BigEndian.Uint64(sizeBytes))
 	if size != 0 {
@@ -215,7 +229,7 @@ func TestEncodeWriter_LargeMessage(t *testing.T) {
 		t.Fatalf("Write failed: %v", err)
 	}
 
-	expectedBytes := TimestampSize + KeySizeFieldSize + SizeFieldSize + int64(len(largeData))
+	expectedBytes := EntryFixedSize + int64(len(largeData))
 	if bytesWritten != expectedBytes {
 		t.Errorf("Expected %d bytes written, got %d", expectedBytes, bytesWritten)
 	}
@@ -0,0 +1,23 @@
+package transcoder
+
+// EntryMetadata holds the source position of a message entry.
+// It is stored per entry by version 3 files; entries read from version 1 and
+// 2 files report UnknownMetadata.
+type EntryMetadata struct {
+	Topic     string // Source topic ("" if unknown)
+	Partition int    // Source partition (-1 if unknown)
+	Offset    int64  // Source offset (-1 if unknown)
+}
+
+// UnknownMetadata is the metadata of entries without source information.
+var UnknownMetadata = EntryMetadata{Partition: -1, Offset: -1}
+
+// HasPartition reports whether the source partition is known.
+func (m EntryMetadata) HasPartition() bool {
+	return m.Partition >= 0
+}
+
+// HasOffset reports whether the source offset is known.
+func (m EntryMetadata) HasOffset() bool {
+	return m.Offset >= 0
+}
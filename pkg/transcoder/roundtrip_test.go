@@ -337,3 +337,53 @@ func TestRoundTripLargeMessage(t *testing.T) {
 
 	decoder.Close()
 }
+
+// TestRoundTripMetadata tests that version 3 per-entry metadata and millisecond timestamps survive a round trip
+func TestRoundTripMetadata(t *testing.T) {
+	buf := &bytes.Buffer{}
+	encoder, err := NewEncodeWriter(buf)
+	if err != nil {
+		t.Fatalf("NewEncodeWriter failed: %v", err)
+	}
+
+	entries := []struct {
+		timestamp time.Time
+		key       []byte
+		data      []byte
+		meta      EntryMetadata
+	}{
+		{time.Date(2024, 1, 1, 0, 0, 0, 123e6, time.UTC), []byte("k1"), []byte("a"), EntryMetadata{Topic: "orders", Partition: 3, Offset: 42}},
+		{time.Date(2024, 1, 1, 0, 0, 0, 456e6, time.UTC), nil, []byte("b"), EntryMetadata{Topic: "orders", Partition: 0, Offset: 7}},
+		{time.Date(2024, 1, 1, 0, 0, 1, 0, time.UTC), []byte("k3"), []byte("c"), UnknownMetadata},
+	}
+	for _, e := range entries {
+		if _, err := encoder.WriteEntry(e.timestamp, e.data, e.key, e.meta); err != nil {
+			t.Fatalf("WriteEntry failed: %v", err)
+		}
+	}
+
+	decoder, err := NewDecodeReader(bytes.NewReader(buf.Bytes()), true)
+	if err != nil {
+		t.Fatalf("NewDecodeReader failed: %v", err)
+	}
+	if decoder.ProtocolVersion() != ProtocolVersion {
+		t.Errorf("Expected protocol version %d, got %d", ProtocolVersion, decoder.ProtocolVersion())
+	}
+
+	var key, data []byte
+	for i, e := range entries {
+		timestamp, _, _, err := readNoGrow(t, decoder, &key, &data)
+		if err != nil {
+			t.Fatalf("Read %d failed: %v", i, err)
+		}
+		if !timestamp.Equal(e.timestamp) {
+			t.Errorf("Entry %d timestamp mismatch: expected %v, got %v", i, e.timestamp, timestamp)
+		}
+		if !bytes.Equal(key, e.key) || !bytes.Equal(data, e.data) {
+			t.Errorf("Entry %d payload mismatch: got key=%q data=%q", i, key, data)
+		}
+		if decoder.Metadata() != e.meta {
+			t.Errorf("Entry %d metadata mismatch: expected %+v, got %+v", i, e.meta, decoder.Metadata())
+		}
+	}
+}